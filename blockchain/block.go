@@ -18,8 +18,32 @@ func NewBlock(index int, transactions []types.Transaction, prevHash []byte) *typ
 	    Difficulty:   consensus.CalculateDifficultyBits(consensus.TargetBits),
 	}
 
+	block.MerkleRoot = block.ComputeMerkleRoot()
 	block.Hash = block.CalculateHash()
 	/* CALCULATE BLOCK SIZE && DIFFICULTY */
 
 	return block
 }
+
+// NewProofOfWork returns the proof of work committing to the block header
+func NewProofOfWork(block *types.Block) *consensus.ProofOfWork {
+	return &consensus.ProofOfWork{
+		Data:       block.SerializeHeader(),
+		Timestamp:  block.Timestamp,
+		Nonce:      uint64(block.Nonce),
+		Difficulty: block.Difficulty,
+	}
+}
+
+// MineBlock searches for a nonce meeting the block's difficulty and
+// updates the block hash to match
+func MineBlock(block *types.Block, timeout time.Duration) error {
+	pow := NewProofOfWork(block)
+	if err := pow.Mine(timeout); err != nil {
+		return err
+	}
+
+	block.Nonce = int(pow.Nonce)
+	block.Hash = block.CalculateHash()
+	return nil
+}
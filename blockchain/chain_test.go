@@ -3,7 +3,7 @@ package blockchain
 import (
 	"fmt"
 	"testing"
-	"blockchain/transaction"
+	"blockchain/types"
 )
 
 
@@ -12,28 +12,20 @@ func TestBlockchain(t *testing.T) {
     chain := NewBlockchain()
 
     // Add blocks
-    block1 := NewBlock(1, []transaction.Transaction{
-        {
-            Inputs: []transaction.TransactionInput{
-                {"tx1", 0},
-            },
-            Outputs: []transaction.TransactionOutput{
-                {"address1", 10.0},
-            },
-        },
+    block1 := NewBlock(1, []types.Transaction{
+        *types.NewTransaction(
+            []types.Input{*types.NewInput([]byte("tx1"), 0, nil)},
+            []types.Output{{Amount: 10.0, Address: []byte("address1")}},
+        ),
     }, chain.GetLatestBlock().Hash)
 
     chain.AddBlock(*block1)
 
-    block2 := NewBlock(2, []transaction.Transaction{
-        {
-            Inputs: []transaction.TransactionInput{
-                {"tx2", 1},
-            },
-            Outputs: []transaction.TransactionOutput{
-                {"address2", 20.0},
-            },
-        },
+    block2 := NewBlock(2, []types.Transaction{
+        *types.NewTransaction(
+            []types.Input{*types.NewInput([]byte("tx2"), 1, nil)},
+            []types.Output{{Amount: 20.0, Address: []byte("address2")}},
+        ),
     }, block1.Hash)
 
     chain.AddBlock(*block2)
@@ -42,8 +34,8 @@ func TestBlockchain(t *testing.T) {
     for _, block := range chain.Blocks {
         fmt.Printf("Index: %d\n", block.Index)
         fmt.Printf("Timestamp: %d\n", block.Timestamp)
-        fmt.Printf("PrevHash: %s\n", block.PrevHash)
-        fmt.Printf("Hash: %s\n", block.Hash)
+        fmt.Printf("PrevHash: %x\n", block.PrevHash)
+        fmt.Printf("Hash: %x\n", block.Hash)
         fmt.Printf("Nonce: %d\n\n", block.Nonce)
     }
 
@@ -0,0 +1,184 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"blockchain/types"
+)
+
+// Chain files start with a header naming the range of blocks they hold,
+// followed by one record per block in height order. Every record is the
+// block in its canonical binary encoding, prefixed with its length and a
+// checksum. The header carries a checksum of its own.
+const (
+	ChainFileVersion = 1
+	chainFileMagic   = "GOCHAIN\x00"
+	// maxBlockRecord bounds the size of a block read from a chain file
+	maxBlockRecord = 32 << 20
+)
+
+// ErrChecksum is returned when a chain file record is corrupt
+var ErrChecksum = errors.New("chain file checksum mismatch")
+
+// ChainFileHeader describes the blocks held in a chain file
+type ChainFileHeader struct {
+	Version     uint32
+	StartHeight uint32
+	BlockCount  uint32
+}
+
+// ChainWriter writes blocks to a chain file
+type ChainWriter struct {
+	w       *bufio.Writer
+	header  ChainFileHeader
+	written uint32
+}
+
+// ChainReader reads blocks back from a chain file
+type ChainReader struct {
+	r      *bufio.Reader
+	header ChainFileHeader
+	read   uint32
+}
+
+// NewChainWriter writes the file header for count blocks starting at
+// startHeight and returns a writer for the blocks themselves
+func NewChainWriter(w io.Writer, startHeight, count int) (*ChainWriter, error) {
+	cw := &ChainWriter{
+		w: bufio.NewWriter(w),
+		header: ChainFileHeader{
+			Version:     ChainFileVersion,
+			StartHeight: uint32(startHeight),
+			BlockCount:  uint32(count),
+		},
+	}
+
+	var header bytes.Buffer
+	header.WriteString(chainFileMagic)
+	binary.Write(&header, binary.LittleEndian, cw.header)
+
+	if _, err := cw.w.Write(header.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := cw.w.Write(checksum(header.Bytes())); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return cw, nil
+}
+
+// WriteBlock appends the next block. Blocks must be written in height
+// order, starting at the header's start height.
+func (cw *ChainWriter) WriteBlock(block *types.Block) error {
+	if cw.written >= cw.header.BlockCount {
+		return fmt.Errorf("chain file already holds %d blocks", cw.header.BlockCount)
+	}
+	if want := int(cw.header.StartHeight + cw.written); block.Index != want {
+		return fmt.Errorf("expected block %d, got block %d", want, block.Index)
+	}
+
+	data := block.Serialize()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(data)))
+
+	for _, part := range [][]byte{length[:], checksum(data), data} {
+		if _, err := cw.w.Write(part); err != nil {
+			return fmt.Errorf("failed to write block %d: %w", block.Index, err)
+		}
+	}
+
+	cw.written++
+	return nil
+}
+
+// Close flushes the file, failing if fewer blocks were written than the
+// header announced
+func (cw *ChainWriter) Close() error {
+	if err := cw.w.Flush(); err != nil {
+		return err
+	}
+	if cw.written != cw.header.BlockCount {
+		return fmt.Errorf("wrote %d of %d blocks", cw.written, cw.header.BlockCount)
+	}
+	return nil
+}
+
+// NewChainReader reads and checks the chain file header
+func NewChainReader(r io.Reader) (*ChainReader, error) {
+	cr := &ChainReader{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(chainFileMagic)+binary.Size(cr.header))
+	if _, err := io.ReadFull(cr.r, header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(header[:len(chainFileMagic)]) != chainFileMagic {
+		return nil, errors.New("not a chain file")
+	}
+
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(cr.r, sum); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if !bytes.Equal(sum, checksum(header)) {
+		return nil, ErrChecksum
+	}
+
+	binary.Read(bytes.NewReader(header[len(chainFileMagic):]), binary.LittleEndian, &cr.header)
+	if cr.header.Version != ChainFileVersion {
+		return nil, fmt.Errorf("unsupported chain file version %d", cr.header.Version)
+	}
+	return cr, nil
+}
+
+// Header returns the chain file header
+func (cr *ChainReader) Header() ChainFileHeader {
+	return cr.header
+}
+
+// ReadBlock returns the next block, or io.EOF once every block announced
+// in the header has been read
+func (cr *ChainReader) ReadBlock() (*types.Block, error) {
+	if cr.read >= cr.header.BlockCount {
+		return nil, io.EOF
+	}
+	height := cr.header.StartHeight + cr.read
+
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(cr.r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %w", height, err)
+	}
+	length := binary.LittleEndian.Uint32(prefix[:4])
+	if length > maxBlockRecord {
+		return nil, fmt.Errorf("block %d is too large (%d bytes)", height, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %w", height, err)
+	}
+	if !bytes.Equal(prefix[4:], checksum(data)) {
+		return nil, fmt.Errorf("block %d: %w", height, ErrChecksum)
+	}
+
+	block, err := types.DeserializeBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode block %d: %w", height, err)
+	}
+	if block.Index != int(height) {
+		return nil, fmt.Errorf("expected block %d, got block %d", height, block.Index)
+	}
+
+	cr.read++
+	return block, nil
+}
+
+// checksum returns the first four bytes of the double SHA-256 of data
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
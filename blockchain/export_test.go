@@ -0,0 +1,81 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"blockchain/types"
+)
+
+func TestChainFileRoundTrip(t *testing.T) {
+	chain := []*types.Block{NewBlock(0, []types.Transaction{}, []byte{0x00})}
+	for i := 1; i <= 3; i++ {
+		chain = append(chain, mineTestBlock(t, chain[i-1], []types.Transaction{testTransaction(float64(i))}))
+	}
+
+	var buf bytes.Buffer
+	writer, err := NewChainWriter(&buf, 0, len(chain))
+	if err != nil {
+		t.Fatalf("NewChainWriter failed: %v", err)
+	}
+	for _, block := range chain {
+		if err := writer.WriteBlock(block); err != nil {
+			t.Fatalf("WriteBlock failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reader, err := NewChainReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewChainReader failed: %v", err)
+	}
+	if reader.Header().BlockCount != 4 {
+		t.Errorf("Expected 4 blocks in header, got %d", reader.Header().BlockCount)
+	}
+
+	var prev *types.Block
+	for i := range chain {
+		block, err := reader.ReadBlock()
+		if err != nil {
+			t.Fatalf("ReadBlock failed: %v", err)
+		}
+		if !bytes.Equal(block.Hash, chain[i].Hash) {
+			t.Errorf("Block %d does not match the original", i)
+		}
+		if err := ValidateBlock(block, prev, testParams); err != nil {
+			t.Errorf("Imported block %d is invalid: %v", i, err)
+		}
+		prev = block
+	}
+
+	if _, err := reader.ReadBlock(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last block, got %v", err)
+	}
+}
+
+func TestChainFileCorruption(t *testing.T) {
+	genesis := NewBlock(0, []types.Transaction{testTransaction(1.0)}, []byte{0x00})
+
+	var buf bytes.Buffer
+	writer, _ := NewChainWriter(&buf, 0, 1)
+	writer.WriteBlock(genesis)
+	writer.Close()
+
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+
+	reader, err := NewChainReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewChainReader failed: %v", err)
+	}
+	if _, err := reader.ReadBlock(); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected checksum error, got %v", err)
+	}
+
+	if _, err := NewChainReader(bytes.NewReader([]byte("not a chain file at all"))); err == nil {
+		t.Errorf("Expected an error for a file without a chain header")
+	}
+}
@@ -11,6 +11,10 @@ type Miner struct {
 	Blockchain      *Blockchain
 	TransactionPool *transaction.TransactionPool
 	Difficulty      int
+	// PayTo receives the coinbase of mined blocks
+	PayTo []byte
+	// Params are the consensus parameters blocks are mined with
+	Params *ChainParams
 }
 
 // NewMiner initializes a new miner.
@@ -19,28 +23,29 @@ func NewMiner(blockchain *Blockchain, transactionPool *transaction.TransactionPo
 		Blockchain:      blockchain,
 		TransactionPool: transactionPool,
 		Difficulty:      difficulty,
+		Params:          DefaultChainParams(),
 	}
 }
 
 // Mine retrieves transactions, mines a block, and appends it to the chain.
 func (m *Miner) Mine() (*types.Block, error) {
-	transactions := m.TransactionPool.GetTransactions()
+	// Get the previous block
+	prevBlock := m.Blockchain.Blocks[len(m.Blockchain.Blocks)-1]
 
-	if len(transactions) == 0 {
+	template := NewBlockTemplate(prevBlock, m.TransactionPool, m.Params)
+	if len(template.Transactions) == 0 {
 		return nil, fmt.Errorf("no transactions to mine")
 	}
 
-	// Get the previous block
-	prevBlock := m.Blockchain.Blocks[len(m.Blockchain.Blocks)-1]
-
 	// Create a new block
-	newBlock := NewBlock(len(m.Blockchain.Blocks), transactions, prevBlock.Hash)
+	newBlock := template.Block(template.Coinbase(m.PayTo, nil))
 
 	// Perform mining (Proof-of-Work)
 //	newBlock.MineBlock(m.Difficulty)
 
 	// Add the mined block to the blockchain
 	m.Blockchain.Blocks = append(m.Blockchain.Blocks, newBlock)
+	m.TransactionPool.BlockConnected(newBlock)
 
 	return newBlock, nil
 }
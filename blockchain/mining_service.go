@@ -0,0 +1,207 @@
+package blockchain
+
+import (
+	"blockchain/consensus"
+	"blockchain/types"
+	"bytes"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hashBatch is the number of nonces a mining thread tries between checks
+// for new work
+const hashBatch = 4096
+
+// MiningConfig holds the settings of a MiningService
+type MiningConfig struct {
+	// PayTo receives the coinbase of mined blocks
+	PayTo []byte
+	// Threads is the number of nonce searching goroutines
+	Threads int
+	// RefreshInterval is how often a fresh template is compared with the
+	// one being mined
+	RefreshInterval time.Duration
+	// RestartFeeRatio is the growth of template fees, as a share of the
+	// fees being mined for, that restarts work on the new template
+	RestartFeeRatio float64
+}
+
+// DefaultMiningConfig returns the default mining settings, one thread per
+// CPU
+func DefaultMiningConfig() *MiningConfig {
+	return &MiningConfig{
+		Threads:         runtime.NumCPU(),
+		RefreshInterval: 5 * time.Second,
+		RestartFeeRatio: 0.1,
+	}
+}
+
+// MiningStats reports the work of a MiningService
+type MiningStats struct {
+	Hashes   uint64
+	Blocks   uint64
+	Rejected uint64
+	Started  time.Time
+}
+
+// HashRate returns the average number of hashes per second since start
+func (s MiningStats) HashRate() float64 {
+	elapsed := time.Since(s.Started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Hashes) / elapsed
+}
+
+// MiningService mines blocks continuously on the templates returned by
+// newTemplate, empty ones included, and passes them to submit. Work is
+// restarted when the tip changes or the fees on offer grow enough.
+type MiningService struct {
+	config      MiningConfig
+	newTemplate func() (*BlockTemplate, error)
+	submit      func(*types.Block) error
+
+	hashes   atomic.Uint64
+	blocks   atomic.Uint64
+	rejected atomic.Uint64
+	started  time.Time
+}
+
+// NewMiningService returns a miner building blocks from the templates
+// returned by newTemplate and passing solved blocks to submit
+func NewMiningService(config *MiningConfig, newTemplate func() (*BlockTemplate, error), submit func(*types.Block) error) *MiningService {
+	if config == nil {
+		config = DefaultMiningConfig()
+	}
+	m := &MiningService{config: *config, newTemplate: newTemplate, submit: submit}
+	if m.config.Threads < 1 {
+		m.config.Threads = 1
+	}
+	if m.config.RefreshInterval <= 0 {
+		m.config.RefreshInterval = DefaultMiningConfig().RefreshInterval
+	}
+	return m
+}
+
+// Run mines until stop is closed. Blocks rejected by submit are counted
+// and mining goes on; an error building a template ends the run.
+func (m *MiningService) Run(stop <-chan struct{}) error {
+	m.started = time.Now()
+	for {
+		template, err := m.newTemplate()
+		if err != nil {
+			return err
+		}
+		block := template.Block(template.Coinbase(m.config.PayTo, nil))
+
+		nonce, solved := m.solve(block, template, stop)
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if !solved {
+			continue
+		}
+
+		block.Nonce = int(nonce)
+		block.Hash = block.CalculateHash()
+		if err := m.submit(block); err != nil {
+			m.rejected.Add(1)
+			continue
+		}
+		m.blocks.Add(1)
+	}
+}
+
+// Stats returns the work done so far
+func (m *MiningService) Stats() MiningStats {
+	return MiningStats{
+		Hashes:   m.hashes.Load(),
+		Blocks:   m.blocks.Load(),
+		Rejected: m.rejected.Load(),
+		Started:  m.started,
+	}
+}
+
+// solve searches a nonce for block with every thread. It gives up when
+// stop is closed or a fresh template is worth switching to.
+func (m *MiningService) solve(block *types.Block, template *BlockTemplate, stop <-chan struct{}) (uint64, bool) {
+	abort := make(chan struct{})
+	var once sync.Once
+	cancel := func() { once.Do(func() { close(abort) }) }
+
+	var found atomic.Bool
+	var solution uint64
+	var wg sync.WaitGroup
+
+	threads := uint64(m.config.Threads)
+	for i := uint64(0); i < threads; i++ {
+		wg.Add(1)
+		go func(nonce uint64) {
+			defer wg.Done()
+			pow := NewProofOfWork(block)
+			for {
+				for n := 0; n < hashBatch; n++ {
+					pow.Nonce = nonce
+					if pow.Validate() {
+						if found.CompareAndSwap(false, true) {
+							solution = nonce
+							cancel()
+						}
+						m.hashes.Add(uint64(n + 1))
+						return
+					}
+					nonce += threads
+				}
+				m.hashes.Add(hashBatch)
+				select {
+				case <-abort:
+					return
+				default:
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(m.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return solution, found.Load()
+		case <-stop:
+			cancel()
+			<-done
+			return 0, false
+		case <-ticker.C:
+			if fresh, err := m.newTemplate(); err == nil && m.shouldRestart(template, fresh) {
+				cancel()
+				<-done
+				return solution, found.Load()
+			}
+		}
+	}
+}
+
+// shouldRestart reports whether fresh is worth abandoning the work on
+// current: it builds on a new tip, or offers enough more in fees
+func (m *MiningService) shouldRestart(current, fresh *BlockTemplate) bool {
+	if !bytes.Equal(current.PrevHash, fresh.PrevHash) {
+		return true
+	}
+	currentFees := current.CoinbaseValue - consensus.BlockSubsidy(current.Height)
+	freshFees := fresh.CoinbaseValue - consensus.BlockSubsidy(fresh.Height)
+	if currentFees <= 0 {
+		return freshFees > 0
+	}
+	return freshFees-currentFees >= currentFees*m.config.RestartFeeRatio
+}
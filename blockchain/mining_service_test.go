@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"blockchain/transaction"
+	"blockchain/types"
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiningService(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), utxos)
+
+	genesis := NewBlock(0, []types.Transaction{}, []byte{0x00})
+	tip := mineTestBlock(t, genesis, []types.Transaction{testTransaction(50)})
+
+	var mu sync.Mutex
+	var found []*types.Block
+	stop := make(chan struct{})
+	newTemplate := func() (*BlockTemplate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return NewBlockTemplate(tip, pool, testParams), nil
+	}
+	submit := func(block *types.Block) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := ValidateBlock(block, tip, testParams); err != nil {
+			return err
+		}
+		found = append(found, block)
+		tip = block
+		if len(found) == 2 {
+			close(stop)
+		}
+		return nil
+	}
+
+	config := &MiningConfig{PayTo: []byte("miner"), Threads: 2, RefreshInterval: time.Second}
+	service := NewMiningService(config, newTemplate, submit)
+
+	done := make(chan error, 1)
+	go func() { done <- service.Run(stop) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Timed out waiting for blocks")
+	}
+
+	if len(found) != 2 {
+		t.Fatalf("Expected 2 blocks, got %d", len(found))
+	}
+	for i, block := range found {
+		if block.Index != i+2 {
+			t.Errorf("Expected block %d, got %d", i+2, block.Index)
+		}
+		if len(block.Transactions) != 1 || !block.Transactions[0].IsCoinbase() {
+			t.Errorf("Expected an empty block with only a coinbase")
+		}
+		if !bytes.Equal(block.Transactions[0].Outputs[0].Address, []byte("miner")) {
+			t.Errorf("Expected the coinbase to pay the configured address")
+		}
+	}
+	if !bytes.Equal(found[1].PrevHash, found[0].Hash) {
+		t.Errorf("Expected the second block to build on the first")
+	}
+
+	stats := service.Stats()
+	if stats.Blocks != 2 || stats.Rejected != 0 || stats.Hashes == 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestMiningServiceRestart(t *testing.T) {
+	service := NewMiningService(&MiningConfig{RestartFeeRatio: 0.1}, nil, nil)
+	current := &BlockTemplate{Height: 2, PrevHash: []byte("tip"), CoinbaseValue: 50}
+
+	tests := []struct {
+		name    string
+		fresh   *BlockTemplate
+		restart bool
+	}{
+		{"same template", &BlockTemplate{Height: 2, PrevHash: []byte("tip"), CoinbaseValue: 50}, false},
+		{"new tip", &BlockTemplate{Height: 3, PrevHash: []byte("new"), CoinbaseValue: 50}, true},
+		{"first fees", &BlockTemplate{Height: 2, PrevHash: []byte("tip"), CoinbaseValue: 50.5}, true},
+	}
+	for _, test := range tests {
+		if got := service.shouldRestart(current, test.fresh); got != test.restart {
+			t.Errorf("%s: expected restart %v, got %v", test.name, test.restart, got)
+		}
+	}
+
+	current.CoinbaseValue = 51
+	if service.shouldRestart(current, &BlockTemplate{Height: 2, PrevHash: []byte("tip"), CoinbaseValue: 51.05}) {
+		t.Errorf("Expected a small fee increase not to restart")
+	}
+	if !service.shouldRestart(current, &BlockTemplate{Height: 2, PrevHash: []byte("tip"), CoinbaseValue: 51.2}) {
+		t.Errorf("Expected a large fee increase to restart")
+	}
+}
@@ -3,25 +3,41 @@ package blockchain
 import (
 	"testing"
 	"blockchain/transaction"
+	"blockchain/types"
+	"blockchain/wallet"
 )
 
 func TestMining(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	owner := wallet.AddressFromPublicKey(&key.PublicKey, true)
+	utxos := testUTXOs{}
+
 	// Initialize blockchain and transaction pool
 	chain := NewBlockchain()
-	txPool := transaction.NewTransactionPool()
+	txPool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), utxos)
 
 	// Add some transactions to the pool
-	txPool.AddTransaction(transaction.Transaction{
-		Inputs:  []transaction.TransactionInput{{"tx1", 0}},
-		Outputs: []transaction.TransactionOutput{{"address1", 5.0}},
-	})
-	txPool.AddTransaction(transaction.Transaction{
-		Inputs:  []transaction.TransactionInput{{"tx2", 1}},
-		Outputs: []transaction.TransactionOutput{{"address2", 3.0}},
-	})
+	for _, name := range []string{"tx1", "tx2"} {
+		funding := &types.Output{Amount: 5.0, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
+		utxos[name] = funding
+		tx := types.NewTransaction(
+			[]types.Input{*types.NewInput([]byte(name), 0, nil)},
+			[]types.Output{{Amount: 4.9, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}},
+		)
+		if err := transaction.SignInput(tx, 0, funding, key); err != nil {
+			t.Fatalf("SignInput failed: %v", err)
+		}
+		if err := txPool.AddTransaction(*tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
 
 	// Initialize miner
 	miner := NewMiner(chain, txPool, 4)
+	miner.PayTo = owner
 
 	// Mine a block
 	block, err := miner.Mine()
@@ -29,9 +45,9 @@ func TestMining(t *testing.T) {
 		t.Fatalf("Mining failed: %v", err)
 	}
 
-	// Verify block content
-	if len(block.Transactions) != 2 {
-		t.Errorf("Expected 2 transactions, got %d", len(block.Transactions))
+	// Verify block content, the coinbase and both transactions
+	if len(block.Transactions) != 3 {
+		t.Errorf("Expected 3 transactions, got %d", len(block.Transactions))
 	}
 
 	// Verify blockchain length
@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"blockchain/consensus"
+	"blockchain/transaction"
+	"blockchain/types"
+	"blockchain/wallet"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// regtestChain mines and validates blocks on top of a genesis block,
+// keeping the UTXO set they leave
+type regtestChain struct {
+	tip   *types.Block
+	utxos map[string]*types.Output
+	// origins holds the block creating each unspent output
+	origins map[string]utxoOrigin
+}
+
+type utxoOrigin struct {
+	height   int
+	coinbase bool
+}
+
+func newRegtestChain() *regtestChain {
+	return &regtestChain{
+		tip:     NewBlock(0, []types.Transaction{}, []byte{0x00}),
+		utxos:   make(map[string]*types.Output),
+		origins: make(map[string]utxoOrigin),
+	}
+}
+
+func (c *regtestChain) GetUTXO(txHash []byte, index uint64) (*types.Output, error) {
+	if output, ok := c.utxos[fmt.Sprintf("%x:%d", txHash, index)]; ok {
+		return output, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (c *regtestChain) GetUTXOOrigin(txHash []byte, index uint64) (int, bool, error) {
+	origin, ok := c.origins[fmt.Sprintf("%x:%d", txHash, index)]
+	if !ok {
+		return 0, false, errors.New("not found")
+	}
+	return origin.height, origin.coinbase, nil
+}
+
+func (c *regtestChain) GetBestHeight() (int, error) {
+	return c.tip.Index, nil
+}
+
+// mine validates and connects a block paying its subsidy to payTo and
+// holding txs
+func (c *regtestChain) mine(t *testing.T, payTo wallet.Address, txs ...types.Transaction) (*types.Block, error) {
+	t.Helper()
+	height := c.tip.Index + 1
+	coinbase := types.NewTransaction(
+		[]types.Input{*types.NewCoinbaseInput([]byte(fmt.Sprintf("height %d", height)))},
+		[]types.Output{{Amount: consensus.BlockSubsidy(height), ScriptPubKey: payTo.ScriptPubKey(), ScriptType: payTo.ScriptType(), Address: payTo.Payload()}},
+	)
+	block := mineTestBlock(t, c.tip, append([]types.Transaction{*coinbase}, txs...))
+	if err := ValidateBlock(block, c.tip, testParams); err != nil {
+		return nil, err
+	}
+	if err := ValidateBlockTransactions(block, c); err != nil {
+		return nil, err
+	}
+
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if i > 0 {
+			for _, input := range tx.Inputs {
+				delete(c.utxos, fmt.Sprintf("%x:%d", input.PreviousTxHash, input.OutputIndex))
+				delete(c.origins, fmt.Sprintf("%x:%d", input.PreviousTxHash, input.OutputIndex))
+			}
+		}
+		for j := range tx.Outputs {
+			c.utxos[fmt.Sprintf("%x:%d", tx.Hash(), j)] = &tx.Outputs[j]
+			c.origins[fmt.Sprintf("%x:%d", tx.Hash(), j)] = utxoOrigin{height, i == 0}
+		}
+	}
+	c.tip = block
+	return block, nil
+}
+
+func TestMultisigSpendEndToEnd(t *testing.T) {
+	var cosigners []*wallet.Wallet
+	var pubKeys [][]byte
+	for i := 0; i < 3; i++ {
+		w, err := wallet.NewWalletWithMnemonic(wallet.DefaultConfig())
+		if err != nil {
+			t.Fatalf("NewWalletWithMnemonic failed: %v", err)
+		}
+		origin, err := w.KeyOrigin(w.Address)
+		if err != nil {
+			t.Fatalf("KeyOrigin failed: %v", err)
+		}
+		cosigners = append(cosigners, w)
+		pubKeys = append(pubKeys, origin.PubKey)
+	}
+	vault, err := wallet.NewMultisigWallet(2, pubKeys, "vault")
+	if err != nil {
+		t.Fatalf("NewMultisigWallet failed: %v", err)
+	}
+	vaultAddress, _ := wallet.NewScriptHashAddress(vault.Address, wallet.RegTest)
+	payee, _ := wallet.NewPubKeyHashAddress(cosigners[0].Address, wallet.RegTest)
+
+	chain := newRegtestChain()
+	funding, err := chain.mine(t, vaultAddress)
+	if err != nil {
+		t.Fatalf("Funding block is invalid: %v", err)
+	}
+	coinbase := &funding.Transactions[0]
+	subsidy := coinbase.Outputs[0].Amount
+
+	spend := types.NewTransaction(
+		[]types.Input{*types.NewInput(coinbase.Hash(), 0, nil)},
+		[]types.Output{
+			{Amount: 10, ScriptPubKey: payee.ScriptPubKey(), ScriptType: payee.ScriptType(), Address: payee.Payload()},
+			{Amount: subsidy - 10.001, ScriptPubKey: vaultAddress.ScriptPubKey(), ScriptType: vaultAddress.ScriptType(), Address: vaultAddress.Payload()},
+		},
+	)
+	psbt, err := transaction.NewPSBT(spend)
+	if err != nil {
+		t.Fatalf("NewPSBT failed: %v", err)
+	}
+	if err := psbt.SetPrevTx(0, coinbase); err != nil {
+		t.Fatalf("SetPrevTx failed: %v", err)
+	}
+	psbt.Inputs[0].RedeemScript = vault.RedeemScript
+
+	// The first and last co-signers each sign their own copy
+	signed := make([]*transaction.PSBT, 0, 2)
+	for _, cosigner := range []*wallet.Wallet{cosigners[0], cosigners[2]} {
+		copied, err := transaction.ParsePSBT(psbt.Base64())
+		if err != nil {
+			t.Fatalf("ParsePSBT failed: %v", err)
+		}
+		key, err := wallet.PrivateKeyFromMnemonic(cosigner.Mnemonic, wallet.DefaultConfig())
+		if err != nil {
+			t.Fatalf("PrivateKeyFromMnemonic failed: %v", err)
+		}
+		if err := copied.SignInput(0, key); err != nil {
+			t.Fatalf("SignInput failed: %v", err)
+		}
+		signed = append(signed, copied)
+	}
+	outsider, _ := wallet.GenerateKey()
+	if err := signed[0].SignInput(0, outsider); err == nil {
+		t.Errorf("Expected a key outside the script to be refused")
+	}
+
+	if err := signed[0].Finalize(); !errors.Is(err, transaction.ErrIncomplete) {
+		t.Fatalf("Expected one signature to be too few, got %v", err)
+	}
+	if err := signed[0].Combine(signed[1]); err != nil {
+		t.Fatalf("Combine failed: %v", err)
+	}
+	if err := signed[0].Finalize(); err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+	tx, err := signed[0].Extract()
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	// The funding coinbase only becomes spendable once it matures
+	if _, err := chain.mine(t, payee, *tx); !errors.Is(err, ErrBadTransaction) {
+		t.Fatalf("Expected the immature coinbase spend to be refused, got %v", err)
+	}
+	for chain.tip.Index < funding.Index+consensus.CoinbaseMaturity-1 {
+		if _, err := chain.mine(t, payee); err != nil {
+			t.Fatalf("Empty block is invalid: %v", err)
+		}
+	}
+
+	// Signatures out of key order, or one short, do not unlock the output
+	items := splitPushes(t, tx.Inputs[0].ScriptSig)
+	for name, reorder := range map[string][][]byte{
+		"swapped signatures": {items[0], items[2], items[1], items[3]},
+		"one signature":      {items[0], items[1], items[3]},
+	} {
+		bad := *tx
+		bad.Inputs = []types.Input{tx.Inputs[0]}
+		bad.Inputs[0].ScriptSig = joinPushes(reorder)
+		bad.InvalidateHash()
+		if err := transaction.VerifyInput(&bad, 0, &coinbase.Outputs[0]); !errors.Is(err, transaction.ErrBadSignature) {
+			t.Errorf("%s: expected ErrBadSignature, got %v", name, err)
+		}
+		if _, err := chain.mine(t, payee, bad); !errors.Is(err, ErrBadTransaction) {
+			t.Errorf("%s: expected the block to be refused, got %v", name, err)
+		}
+	}
+
+	if _, err := chain.mine(t, payee, *tx); err != nil {
+		t.Fatalf("Block spending the multisig output is invalid: %v", err)
+	}
+	if _, err := chain.GetUTXO(coinbase.Hash(), 0); err == nil {
+		t.Errorf("Expected the multisig output to be spent")
+	}
+	change, err := chain.GetUTXO(tx.Hash(), 1)
+	if err != nil || !bytes.Equal(change.Address, vault.Address) {
+		t.Errorf("Expected the change to return to the multisig address, got %+v (%v)", change, err)
+	}
+}
+
+// splitPushes returns the items of a scriptSig of pushes shorter than 256
+// bytes
+func splitPushes(t *testing.T, script []byte) [][]byte {
+	t.Helper()
+	var items [][]byte
+	for len(script) > 0 {
+		start, n := 1, int(script[0])
+		if n == 0x4c && len(script) > 1 {
+			start, n = 2, int(script[1])
+		} else if n > 0x4c {
+			t.Fatalf("Unexpected opcode in scriptSig %x", script)
+		}
+		if start+n > len(script) {
+			t.Fatalf("Truncated scriptSig %x", script)
+		}
+		items = append(items, script[start:start+n])
+		script = script[start+n:]
+	}
+	return items
+}
+
+func joinPushes(items [][]byte) []byte {
+	var script []byte
+	for _, item := range items {
+		if len(item) >= 0x4c {
+			script = append(script, 0x4c)
+		}
+		script = append(append(script, byte(len(item))), item...)
+	}
+	return script
+}
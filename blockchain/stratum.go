@@ -0,0 +1,475 @@
+package blockchain
+
+import (
+	"blockchain/consensus"
+	"blockchain/types"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The Stratum server speaks Stratum v1: newline separated JSON-RPC over
+// TCP. Miners subscribe and are given an extranonce1 unique to their
+// connection, authorize one or more workers, and receive jobs with
+// mining.notify. A job carries the serialized coinbase split around the
+// extranonce, coinb1 and coinb2, and the Merkle branch of the coinbase.
+// A miner builds the coinbase as coinb1 + extranonce1 + extranonce2 +
+// coinb2, hashes it into the Merkle root, and searches nonces on the
+// resulting header.
+//
+// Shares are accepted at the easier share difficulty, the number of
+// leading zero bits sent with mining.set_difficulty, so that the work of
+// each worker can be measured. Shares also meeting the block difficulty
+// are submitted to the chain.
+
+// Stratum error codes
+const (
+	stratumErrOther         = 20
+	stratumErrJobNotFound   = 21
+	stratumErrDuplicate     = 22
+	stratumErrLowDiff       = 23
+	stratumErrUnauthorized  = 24
+	stratumErrNotSubscribed = 25
+)
+
+// extraNonce1Size is the size of the extranonce part fixed per connection
+const extraNonce1Size = 4
+
+// maxStratumJobs is the number of recent jobs shares are accepted for
+const maxStratumJobs = 8
+
+// StratumConfig holds the settings of a StratumServer
+type StratumConfig struct {
+	// ShareDifficulty is the number of leading zero bits a share's proof
+	// of work must have
+	ShareDifficulty uint32
+	// ExtraNonce2Size is the size of the extranonce part chosen by miners
+	ExtraNonce2Size int
+	// PayTo receives the coinbase of the blocks found
+	PayTo []byte
+}
+
+// DefaultStratumConfig returns the default Stratum settings
+func DefaultStratumConfig() *StratumConfig {
+	return &StratumConfig{ShareDifficulty: 16, ExtraNonce2Size: 4}
+}
+
+// WorkerStats counts the shares submitted by a worker
+type WorkerStats struct {
+	Accepted uint64
+	Rejected uint64
+	Blocks   uint64
+}
+
+// StratumServer hands out mining jobs built from block templates and
+// collects the shares of the miners connected to it
+type StratumServer struct {
+	config      StratumConfig
+	newTemplate func() (*BlockTemplate, error)
+	submit      func(*types.Block) error
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	jobs       map[string]*stratumJob
+	jobOrder   []string
+	currentJob *stratumJob
+	nextJobID  uint64
+	nextNonce1 uint32
+	clients    map[*stratumClient]bool
+	workers    map[string]*WorkerStats
+}
+
+// stratumJob is a block template as handed out to miners
+type stratumJob struct {
+	id       string
+	template *BlockTemplate
+	coinb1   []byte
+	coinb2   []byte
+	shares   map[shareKey]bool
+}
+
+// shareKey identifies the work of a share by its decoded fields, so that
+// resubmitting it with different hex spellings is still a duplicate
+type shareKey struct {
+	extraNonce string
+	ntime      uint32
+	nonce      uint64
+}
+
+// stratumClient is a miner connection
+type stratumClient struct {
+	conn        net.Conn
+	writeMu     sync.Mutex
+	extraNonce1 []byte
+	subscribed  bool
+	workers     map[string]bool
+}
+
+type stratumRequest struct {
+	ID     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type stratumResponse struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// NewStratumServer returns a server building jobs from the templates
+// returned by newTemplate and passing solved blocks to submit
+func NewStratumServer(config *StratumConfig, newTemplate func() (*BlockTemplate, error), submit func(*types.Block) error) *StratumServer {
+	if config == nil {
+		config = DefaultStratumConfig()
+	}
+	return &StratumServer{
+		config:      *config,
+		newTemplate: newTemplate,
+		submit:      submit,
+		jobs:        make(map[string]*stratumJob),
+		clients:     make(map[*stratumClient]bool),
+		workers:     make(map[string]*WorkerStats),
+	}
+}
+
+// Listen builds the first job and starts accepting miners on addr
+func (s *StratumServer) Listen(addr string) error {
+	if err := s.UpdateJob(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *StratumServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close disconnects every miner and stops the server
+func (s *StratumServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for client := range s.clients {
+		client.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// UpdateJob builds a job from a new template and sends it to every miner,
+// asking them to drop their previous work
+func (s *StratumServer) UpdateJob() error {
+	template, err := s.newTemplate()
+	if err != nil {
+		return fmt.Errorf("failed to build block template: %v", err)
+	}
+
+	s.mu.Lock()
+	if s.currentJob != nil && !bytes.Equal(s.currentJob.template.PrevHash, template.PrevHash) {
+		// Shares building on the previous tip are stale
+		s.jobs = make(map[string]*stratumJob)
+		s.jobOrder = nil
+	}
+	s.nextJobID++
+	job := s.newJob(strconv.FormatUint(s.nextJobID, 16), template)
+	s.jobs[job.id] = job
+	s.jobOrder = append(s.jobOrder, job.id)
+	if len(s.jobOrder) > maxStratumJobs {
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+	s.currentJob = job
+
+	var clients []*stratumClient
+	for client := range s.clients {
+		if client.subscribed {
+			clients = append(clients, client)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, client := range clients {
+		client.send(s.notify(job, true))
+	}
+	return nil
+}
+
+// WorkerStats returns the share counts of every worker
+func (s *StratumServer) WorkerStats() map[string]WorkerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]WorkerStats, len(s.workers))
+	for worker, st := range s.workers {
+		stats[worker] = *st
+	}
+	return stats
+}
+
+// newJob splits the coinbase of template around its extranonce
+func (s *StratumServer) newJob(id string, template *BlockTemplate) *stratumJob {
+	placeholder := make([]byte, extraNonce1Size+s.config.ExtraNonce2Size)
+	coinbase := template.Coinbase(s.config.PayTo, placeholder)
+	data := coinbase.Serialize()
+
+	// The extranonce ends the coinbase script, which appears as is in
+	// the serialization
+	script := coinbase.Inputs[0].ScriptSig
+	offset := bytes.Index(data, script) + len(script) - len(placeholder)
+
+	return &stratumJob{
+		id:       id,
+		template: template,
+		coinb1:   data[:offset],
+		coinb2:   data[offset+len(placeholder):],
+		shares:   make(map[shareKey]bool),
+	}
+}
+
+// notify returns the mining.notify message for job
+func (s *StratumServer) notify(job *stratumJob, clean bool) stratumNotification {
+	branch := []string{}
+	for _, hash := range job.template.MerkleBranch {
+		branch = append(branch, hex.EncodeToString(hash))
+	}
+	return stratumNotification{
+		Method: "mining.notify",
+		Params: []interface{}{
+			job.id,
+			hex.EncodeToString(job.template.PrevHash),
+			hex.EncodeToString(job.coinb1),
+			hex.EncodeToString(job.coinb2),
+			branch,
+			"00000001",
+			fmt.Sprintf("%08x", job.template.Bits),
+			fmt.Sprintf("%08x", job.template.Timestamp),
+			clean,
+		},
+	}
+}
+
+// serve handles the requests of one miner until it disconnects
+func (s *StratumServer) serve(conn net.Conn) {
+	client := &stratumClient{conn: conn, workers: make(map[string]bool)}
+
+	s.mu.Lock()
+	s.nextNonce1++
+	client.extraNonce1 = make([]byte, extraNonce1Size)
+	binary.BigEndian.PutUint32(client.extraNonce1, s.nextNonce1)
+	s.clients[client] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+		result, stratumErr := s.handle(client, &req)
+		response := stratumResponse{ID: req.ID, Result: result}
+		if stratumErr != nil {
+			response.Error = stratumErr
+		}
+		client.send(response)
+
+		if req.Method == "mining.subscribe" && stratumErr == nil {
+			s.mu.Lock()
+			job := s.currentJob
+			s.mu.Unlock()
+			client.send(stratumNotification{Method: "mining.set_difficulty", Params: []interface{}{s.config.ShareDifficulty}})
+			client.send(s.notify(job, true))
+		}
+	}
+}
+
+// handle runs one request, returning its result or a Stratum error
+func (s *StratumServer) handle(client *stratumClient, req *stratumRequest) (interface{}, []interface{}) {
+	var params []string
+	// Parameters other than strings, such as a client version, are ignored
+	var raw []interface{}
+	json.Unmarshal(req.Params, &raw)
+	for _, p := range raw {
+		if str, ok := p.(string); ok {
+			params = append(params, str)
+		}
+	}
+
+	switch req.Method {
+	case "mining.subscribe":
+		s.mu.Lock()
+		client.subscribed = true
+		s.mu.Unlock()
+		return []interface{}{
+			[][]string{{"mining.set_difficulty", "1"}, {"mining.notify", "1"}},
+			hex.EncodeToString(client.extraNonce1),
+			s.config.ExtraNonce2Size,
+		}, nil
+
+	case "mining.authorize":
+		if len(params) < 1 || params[0] == "" {
+			return false, stratumError(stratumErrOther, "worker name required")
+		}
+		s.mu.Lock()
+		client.workers[params[0]] = true
+		if s.workers[params[0]] == nil {
+			s.workers[params[0]] = &WorkerStats{}
+		}
+		s.mu.Unlock()
+		return true, nil
+
+	case "mining.submit":
+		if len(params) < 5 {
+			return false, stratumError(stratumErrOther, "expected worker, job, extranonce2, ntime and nonce")
+		}
+		return s.submitShare(client, params[0], params[1], params[2], params[3], params[4])
+
+	default:
+		return nil, stratumError(stratumErrOther, "unknown method "+req.Method)
+	}
+}
+
+// submitShare checks a share and submits it to the chain if it solves the
+// block
+func (s *StratumServer) submitShare(client *stratumClient, worker, jobID, extraNonce2Hex, ntimeHex, nonceHex string) (interface{}, []interface{}) {
+	s.mu.Lock()
+	if !client.subscribed {
+		s.mu.Unlock()
+		return false, stratumError(stratumErrNotSubscribed, "not subscribed")
+	}
+	if !client.workers[worker] {
+		s.mu.Unlock()
+		return false, stratumError(stratumErrUnauthorized, "unauthorized worker")
+	}
+	stats := s.workers[worker]
+	job, ok := s.jobs[jobID]
+	s.mu.Unlock()
+
+	reject := func(code int, message string) (interface{}, []interface{}) {
+		s.mu.Lock()
+		stats.Rejected++
+		s.mu.Unlock()
+		return false, stratumError(code, message)
+	}
+
+	if !ok {
+		return reject(stratumErrJobNotFound, "job not found")
+	}
+	extraNonce2, err := hex.DecodeString(extraNonce2Hex)
+	if err != nil || len(extraNonce2) != s.config.ExtraNonce2Size {
+		return reject(stratumErrOther, "invalid extranonce2")
+	}
+	// Miners may only roll the time forward from the job's, and not
+	// further into the future than blocks are accepted
+	ntime, err := strconv.ParseUint(ntimeHex, 16, 32)
+	if err != nil || int64(ntime) < job.template.Timestamp || int64(ntime) > time.Now().Add(MaxFutureBlockTime).Unix() {
+		return reject(stratumErrOther, "invalid ntime")
+	}
+	nonce, err := strconv.ParseUint(nonceHex, 16, 64)
+	if err != nil {
+		return reject(stratumErrOther, "invalid nonce")
+	}
+
+	coinbaseData := append(append(append(append([]byte{}, job.coinb1...), client.extraNonce1...), extraNonce2...), job.coinb2...)
+	coinbase, err := types.DeserializeTransaction(coinbaseData)
+	if err != nil {
+		return reject(stratumErrOther, "invalid coinbase")
+	}
+
+	template := *job.template
+	template.Timestamp = int64(ntime)
+	block := template.Block(*coinbase)
+	block.Nonce = int(nonce)
+	block.Hash = block.CalculateHash()
+
+	key := shareKey{string(client.extraNonce1) + string(extraNonce2), uint32(ntime), nonce}
+	s.mu.Lock()
+	duplicate := job.shares[key]
+	job.shares[key] = true
+	s.mu.Unlock()
+	if duplicate {
+		return reject(stratumErrDuplicate, "duplicate share")
+	}
+
+	pow := NewProofOfWork(block)
+	solved := pow.Validate()
+	if !solved && !pow.MeetsTarget(consensus.CalculateDifficultyBits(s.config.ShareDifficulty)) {
+		return reject(stratumErrLowDiff, "low difficulty share")
+	}
+
+	s.mu.Lock()
+	stats.Accepted++
+	s.mu.Unlock()
+
+	if solved {
+		if err := s.submit(block); err != nil {
+			// The work was done, so the share still counts
+			return true, nil
+		}
+		s.mu.Lock()
+		stats.Blocks++
+		s.mu.Unlock()
+		// Work on the old tip is now wasted
+		s.UpdateJob()
+	}
+	return true, nil
+}
+
+// send writes a message to the miner
+func (c *stratumClient) send(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(append(data, '\n'))
+}
+
+// stratumError returns a Stratum error triple
+func stratumError(code int, message string) []interface{} {
+	return []interface{}{code, message, nil}
+}
@@ -0,0 +1,283 @@
+package blockchain
+
+import (
+	"blockchain/consensus"
+	"blockchain/transaction"
+	"blockchain/types"
+	"blockchain/wallet"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMiner is a Stratum client mining in process
+type fakeMiner struct {
+	t       *testing.T
+	conn    net.Conn
+	scanner *bufio.Scanner
+	nextID  int
+
+	extraNonce1 []byte
+	nonce2Size  int
+	shareBits   uint32
+	job         []interface{}
+}
+
+func dialFakeMiner(t *testing.T, addr string) *fakeMiner {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	return &fakeMiner{t: t, conn: conn, scanner: bufio.NewScanner(conn)}
+}
+
+// call sends a request and returns its response, handling the
+// notifications received in between
+func (m *fakeMiner) call(method string, params ...interface{}) (interface{}, []interface{}) {
+	m.nextID++
+	data, _ := json.Marshal(map[string]interface{}{"id": m.nextID, "method": method, "params": params})
+	m.conn.Write(append(data, '\n'))
+
+	for m.scanner.Scan() {
+		var msg struct {
+			ID     interface{}   `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+			Result interface{}   `json:"result"`
+			Error  []interface{} `json:"error"`
+		}
+		if err := json.Unmarshal(m.scanner.Bytes(), &msg); err != nil {
+			m.t.Fatalf("Invalid message: %v", err)
+		}
+		switch msg.Method {
+		case "mining.set_difficulty":
+			m.shareBits = consensus.CalculateDifficultyBits(uint32(msg.Params[0].(float64)))
+			continue
+		case "mining.notify":
+			m.job = msg.Params
+			continue
+		}
+		if id, ok := msg.ID.(float64); ok && int(id) == m.nextID {
+			return msg.Result, msg.Error
+		}
+	}
+	m.t.Fatalf("Connection closed waiting for %s", method)
+	return nil, nil
+}
+
+// readJob waits for the job sent after subscribing
+func (m *fakeMiner) readJob() {
+	for m.job == nil && m.scanner.Scan() {
+		var msg struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.Unmarshal(m.scanner.Bytes(), &msg)
+		switch msg.Method {
+		case "mining.set_difficulty":
+			m.shareBits = consensus.CalculateDifficultyBits(uint32(msg.Params[0].(float64)))
+		case "mining.notify":
+			m.job = msg.Params
+		}
+	}
+}
+
+// block builds the block of the current job for the given nonces
+func (m *fakeMiner) block(extraNonce2 []byte, nonce uint64) *types.Block {
+	decode := func(i int) []byte {
+		data, _ := hex.DecodeString(m.job[i].(string))
+		return data
+	}
+	coinbaseData := append(append(append(decode(2), m.extraNonce1...), extraNonce2...), decode(3)...)
+	coinbase, err := types.DeserializeTransaction(coinbaseData)
+	if err != nil {
+		m.t.Fatalf("Invalid coinbase: %v", err)
+	}
+
+	var branch [][]byte
+	for _, hash := range m.job[4].([]interface{}) {
+		data, _ := hex.DecodeString(hash.(string))
+		branch = append(branch, data)
+	}
+	bits, _ := strconv.ParseUint(m.job[6].(string), 16, 32)
+	ntime, _ := strconv.ParseUint(m.job[7].(string), 16, 32)
+
+	block := &types.Block{
+		Timestamp:  int64(ntime),
+		PrevHash:   decode(1),
+		Difficulty: uint32(bits),
+		MerkleRoot: types.MerkleRootFromBranch(coinbase.Hash(), branch),
+		Nonce:      int(nonce),
+	}
+	return block
+}
+
+// mineShare searches a nonce giving a share, at the block difficulty when
+// solve is set
+func (m *fakeMiner) mineShare(extraNonce2 []byte, start uint64, solve bool) uint64 {
+	for nonce := start; ; nonce++ {
+		pow := NewProofOfWork(m.block(extraNonce2, nonce))
+		if solve && pow.Validate() || !solve && pow.MeetsTarget(m.shareBits) && !pow.Validate() {
+			return nonce
+		}
+	}
+}
+
+func (m *fakeMiner) submit(worker string, extraNonce2 []byte, nonce uint64) (interface{}, []interface{}) {
+	return m.call("mining.submit", worker, m.job[0], hex.EncodeToString(extraNonce2), m.job[7], fmt.Sprintf("%08x", nonce))
+}
+
+func TestStratumServer(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	owner := wallet.AddressFromPublicKey(&key.PublicKey, true)
+	funding := &types.Output{Amount: 10, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
+	utxos := testUTXOs{"a": funding}
+	pool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), utxos)
+	tx := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{{PreviousTxHash: []byte("a"), OutputIndex: 0, Sequence: types.SequenceFinal}},
+		Outputs: []types.Output{{Amount: 9.5, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}},
+	}
+	if err := transaction.SignInput(&tx, 0, funding, key); err != nil {
+		t.Fatalf("SignInput failed: %v", err)
+	}
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+
+	genesis := NewBlock(0, []types.Transaction{}, []byte{0x00})
+	tip := mineTestBlock(t, genesis, []types.Transaction{testTransaction(50)})
+
+	var mu sync.Mutex
+	var found []*types.Block
+	newTemplate := func() (*BlockTemplate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return NewBlockTemplate(tip, pool, testParams), nil
+	}
+	submit := func(block *types.Block) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := ValidateBlock(block, tip, testParams); err != nil {
+			return err
+		}
+		found = append(found, block)
+		tip = block
+		return nil
+	}
+
+	config := &StratumConfig{ShareDifficulty: 4, ExtraNonce2Size: 4, PayTo: []byte("pool")}
+	server := NewStratumServer(config, newTemplate, submit)
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer server.Close()
+
+	miner := dialFakeMiner(t, server.Addr().String())
+	defer miner.conn.Close()
+
+	result, _ := miner.call("mining.submit", "worker1", "1", "00000000", "00000000", "00000000")
+	if result != false {
+		t.Errorf("Expected a share before subscribing to be rejected")
+	}
+
+	result, stratumErr := miner.call("mining.subscribe", "fakeminer/1.0")
+	if stratumErr != nil {
+		t.Fatalf("Subscribe failed: %v", stratumErr)
+	}
+	subscription := result.([]interface{})
+	miner.extraNonce1, _ = hex.DecodeString(subscription[1].(string))
+	miner.nonce2Size = int(subscription[2].(float64))
+	miner.readJob()
+	if len(miner.extraNonce1) != extraNonce1Size || miner.nonce2Size != 4 || miner.job == nil {
+		t.Fatalf("Unexpected subscription %v", result)
+	}
+
+	extraNonce2 := []byte{0, 0, 0, 1}
+	nonce := miner.mineShare(extraNonce2, 0, false)
+	if _, stratumErr := miner.submit("worker1", extraNonce2, nonce); stratumErr == nil || stratumErr[0].(float64) != stratumErrUnauthorized {
+		t.Errorf("Expected an unauthorized worker error, got %v", stratumErr)
+	}
+
+	if result, _ := miner.call("mining.authorize", "worker1", "x"); result != true {
+		t.Fatalf("Authorize failed")
+	}
+	if result, stratumErr := miner.submit("worker1", extraNonce2, nonce); result != true {
+		t.Fatalf("Share rejected: %v", stratumErr)
+	}
+	if _, stratumErr := miner.submit("worker1", extraNonce2, nonce); stratumErr == nil || stratumErr[0].(float64) != stratumErrDuplicate {
+		t.Errorf("Expected a duplicate share error, got %v", stratumErr)
+	}
+	// The same share spelled differently is still a duplicate
+	_, stratumErr = miner.call("mining.submit", "worker1", miner.job[0], strings.ToUpper(hex.EncodeToString(extraNonce2)), miner.job[7], fmt.Sprintf("%016x", nonce))
+	if stratumErr == nil || stratumErr[0].(float64) != stratumErrDuplicate {
+		t.Errorf("Expected a respelled share to be a duplicate, got %v", stratumErr)
+	}
+
+	// Time may not be rolled back before the job's
+	ntime, _ := strconv.ParseUint(miner.job[7].(string), 16, 32)
+	_, stratumErr = miner.call("mining.submit", "worker1", miner.job[0], hex.EncodeToString(extraNonce2), fmt.Sprintf("%08x", ntime-1), fmt.Sprintf("%08x", nonce))
+	if stratumErr == nil || stratumErr[1] != "invalid ntime" {
+		t.Errorf("Expected an ntime before the job to be refused, got %v", stratumErr)
+	}
+
+	// A nonce failing the share difficulty
+	low := uint64(0)
+	for NewProofOfWork(miner.block(extraNonce2, low)).MeetsTarget(miner.shareBits) {
+		low++
+	}
+	if _, stratumErr := miner.submit("worker1", extraNonce2, low); stratumErr == nil || stratumErr[0].(float64) != stratumErrLowDiff {
+		t.Errorf("Expected a low difficulty error, got %v", stratumErr)
+	}
+
+	// A share solving the block is submitted to the chain and a new job
+	// is sent for the next height
+	oldJob := miner.job[0]
+	nonce = miner.mineShare(extraNonce2, 0, true)
+	if result, stratumErr := miner.submit("worker1", extraNonce2, nonce); result != true {
+		t.Fatalf("Block share rejected: %v", stratumErr)
+	}
+
+	mu.Lock()
+	if len(found) != 1 {
+		t.Fatalf("Expected a block to be submitted, got %d", len(found))
+	}
+	block := found[0]
+	mu.Unlock()
+
+	if block.Index != 2 || len(block.Transactions) != 2 {
+		t.Errorf("Expected block 2 with the pooled transaction, got block %d with %d transactions", block.Index, len(block.Transactions))
+	}
+	script := block.Transactions[0].Inputs[0].ScriptSig
+	if !bytes.HasSuffix(script, append(append([]byte{}, miner.extraNonce1...), extraNonce2...)) {
+		t.Errorf("Expected the coinbase script to end with the extranonce, got %x", script)
+	}
+	if block.Transactions[0].Outputs[0].Amount != consensus.BlockSubsidy(2)+0.5 {
+		t.Errorf("Expected the coinbase to claim the subsidy and fees, got %f", block.Transactions[0].Outputs[0].Amount)
+	}
+
+	_, stratumErr = miner.call("mining.submit", "worker1", oldJob, hex.EncodeToString(extraNonce2), miner.job[7], "00000000")
+	if stratumErr == nil || stratumErr[0].(float64) != stratumErrJobNotFound {
+		t.Errorf("Expected a share for the previous tip to be rejected as stale, got %v", stratumErr)
+	}
+	if miner.job[0] == oldJob {
+		t.Errorf("Expected a new job after the block was found")
+	}
+
+	stats := server.WorkerStats()["worker1"]
+	if stats.Accepted != 2 || stats.Blocks != 1 || stats.Rejected != 5 {
+		t.Errorf("Unexpected worker stats %+v", stats)
+	}
+}
@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"blockchain/consensus"
+	"blockchain/transaction"
+	"blockchain/types"
+	"fmt"
+	"time"
+)
+
+// coinbaseReserve is the block space kept for the coinbase transaction
+const coinbaseReserve = 1000
+
+// BlockTemplate holds what a miner needs to build a block on top of prev:
+// the header fields, the transactions to include after the coinbase and the
+// value the coinbase may claim
+type BlockTemplate struct {
+	Height    int
+	PrevHash  []byte
+	Bits      uint32
+	Timestamp int64
+	// CoinbaseValue is the block subsidy plus the fees of the transactions
+	CoinbaseValue float64
+	Transactions  []TemplateTransaction
+	// MerkleBranch combines with the coinbase hash into the Merkle root
+	MerkleBranch [][]byte
+}
+
+// TemplateTransaction is a transaction selected for a block template
+type TemplateTransaction struct {
+	Tx   types.Transaction
+	Fee  float64
+	Size uint64
+}
+
+// ChainParams holds the consensus parameters a chain is validated and
+// mined with
+type ChainParams struct {
+	// InitialBits is the difficulty of the first block after the genesis
+	// block
+	InitialBits uint32
+}
+
+// DefaultChainParams returns the parameters of the chain
+func DefaultChainParams() *ChainParams {
+	return &ChainParams{
+		InitialBits: consensus.CalculateDifficultyBits(consensus.TargetBits),
+	}
+}
+
+// NextBits returns the difficulty of the block following prev. The first
+// block after the genesis block has the initial difficulty and later blocks
+// keep that of their parent: there is no retargeting.
+func NextBits(prev *types.Block, params *ChainParams) uint32 {
+	if prev.Index == 0 {
+		return params.InitialBits
+	}
+	return prev.Difficulty
+}
+
+// NewBlockTemplate builds a template for the block following prev with the
+// best paying transactions of pool
+func NewBlockTemplate(prev *types.Block, pool *transaction.TransactionPool, params *ChainParams) *BlockTemplate {
+	height := prev.Index + 1
+	template := &BlockTemplate{
+		Height:    height,
+		PrevHash:  prev.Hash,
+		Bits:      NextBits(prev, params),
+		Timestamp: time.Now().Unix(),
+	}
+
+	// The first hash stands in for the coinbase, which the branch omits
+	hashes := [][]byte{nil}
+	var fees float64
+	for _, tx := range pool.SelectTransactions(consensus.MaxBlockSize - coinbaseReserve) {
+		entry, ok := pool.GetTransaction(tx.Hash())
+		if !ok {
+			continue
+		}
+		template.Transactions = append(template.Transactions, TemplateTransaction{Tx: tx, Fee: entry.Fee, Size: entry.Size})
+		fees += entry.Fee
+		hashes = append(hashes, tx.Hash())
+	}
+	// Summed as ValidateBlockTransactions does, so the value is not off by
+	// a rounding error
+	template.CoinbaseValue = consensus.BlockSubsidy(height) + fees
+	template.MerkleBranch = types.MerkleBranch(hashes)
+	return template
+}
+
+// Coinbase returns a coinbase transaction paying the template's full value
+// to payTo. extraNonce is added to the coinbase script so that miners
+// sharing a payout address work on different blocks.
+func (t *BlockTemplate) Coinbase(payTo []byte, extraNonce []byte) types.Transaction {
+	script := append([]byte(fmt.Sprintf("height %d ", t.Height)), extraNonce...)
+	return types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput(script)},
+		Outputs: []types.Output{{Amount: t.CoinbaseValue, ScriptPubKey: payTo, ScriptType: "P2PKH", Address: payTo}},
+	}
+}
+
+// Block assembles the block to mine from the template and a coinbase
+func (t *BlockTemplate) Block(coinbase types.Transaction) *types.Block {
+	transactions := []types.Transaction{coinbase}
+	for _, tx := range t.Transactions {
+		transactions = append(transactions, tx.Tx)
+	}
+
+	block := &types.Block{
+		Index:        t.Height,
+		Timestamp:    t.Timestamp,
+		Transactions: transactions,
+		PrevHash:     t.PrevHash,
+		Difficulty:   t.Bits,
+	}
+	block.MerkleRoot = types.MerkleRootFromBranch(coinbase.Hash(), t.MerkleBranch)
+	block.Hash = block.CalculateHash()
+	return block
+}
@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"blockchain/consensus"
+	"blockchain/transaction"
+	"blockchain/types"
+	"blockchain/wallet"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testUTXOs is an in-memory transaction.UTXOSource
+type testUTXOs map[string]*types.Output
+
+func (u testUTXOs) GetUTXO(txHash []byte, index uint64) (*types.Output, error) {
+	if index == 0 {
+		if output, ok := u[string(txHash)]; ok {
+			return output, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (u testUTXOs) GetUTXOOrigin(txHash []byte, index uint64) (int, bool, error) {
+	if _, err := u.GetUTXO(txHash, index); err != nil {
+		return 0, false, err
+	}
+	return 0, false, nil
+}
+
+func (u testUTXOs) GetBestHeight() (int, error) {
+	return 0, nil
+}
+
+func TestBlockTemplate(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	owner := wallet.AddressFromPublicKey(&key.PublicKey, true)
+	funding := &types.Output{Amount: 10, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
+	utxos := testUTXOs{"funding": funding}
+
+	signedSpend := func(prevHash []byte, prevOutput *types.Output, amount float64) types.Transaction {
+		tx := types.Transaction{
+			Version: 1,
+			Inputs:  []types.Input{{PreviousTxHash: prevHash, OutputIndex: 0, Sequence: types.SequenceFinal}},
+			Outputs: []types.Output{{Amount: amount, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}},
+		}
+		if err := transaction.SignInput(&tx, 0, prevOutput, key); err != nil {
+			t.Fatalf("SignInput failed: %v", err)
+		}
+		return tx
+	}
+	parent := signedSpend([]byte("funding"), funding, 9.9)
+	child := signedSpend(parent.Hash(), &parent.Outputs[0], 9.7)
+
+	pool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), utxos)
+	for _, tx := range []types.Transaction{parent, child} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	genesis := NewBlock(0, []types.Transaction{}, []byte{0x00})
+	prev := mineTestBlock(t, genesis, []types.Transaction{testTransaction(50)})
+
+	template := NewBlockTemplate(prev, pool, testParams)
+	if template.Height != 2 || !bytes.Equal(template.PrevHash, prev.Hash) || template.Bits != prev.Difficulty {
+		t.Fatalf("Template does not build on the previous block: %+v", template)
+	}
+	if len(template.Transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(template.Transactions))
+	}
+	if fees := template.CoinbaseValue - consensus.BlockSubsidy(2); fees < 0.29 || fees > 0.31 {
+		t.Errorf("Expected 0.3 in fees, got %f", fees)
+	}
+
+	block := template.Block(template.Coinbase(owner, []byte("extra")))
+	if !bytes.Equal(block.MerkleRoot, block.ComputeMerkleRoot()) {
+		t.Fatalf("Merkle root from the branch does not match the transactions")
+	}
+	if err := MineBlock(block, 10*time.Second); err != nil {
+		t.Fatalf("MineBlock failed: %v", err)
+	}
+	if err := ValidateBlock(block, prev, testParams); err != nil {
+		t.Fatalf("Block from template is invalid: %v", err)
+	}
+	if err := ValidateBlockTransactions(block, utxos); err != nil {
+		t.Fatalf("Block transactions are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		transactions func() []types.Transaction
+		want         error
+	}{
+		{"no coinbase", func() []types.Transaction {
+			return []types.Transaction{parent}
+		}, ErrBadCoinbase},
+		{"second coinbase", func() []types.Transaction {
+			return []types.Transaction{block.Transactions[0], block.Transactions[0]}
+		}, ErrBadCoinbase},
+		{"coinbase too large", func() []types.Transaction {
+			return []types.Transaction{template.Coinbase(owner, nil), parent}
+		}, ErrCoinbaseValue},
+		{"child before parent", func() []types.Transaction {
+			return []types.Transaction{block.Transactions[0], child, parent}
+		}, ErrBadTransaction},
+		{"double spend", func() []types.Transaction {
+			return []types.Transaction{block.Transactions[0], parent, signedSpend([]byte("funding"), funding, 9)}
+		}, ErrBadTransaction},
+		{"bad signature", func() []types.Transaction {
+			unsigned := parent
+			unsigned.Inputs = []types.Input{parent.Inputs[0]}
+			unsigned.Inputs[0].ScriptSig = []byte("sig")
+			unsigned.InvalidateHash()
+			return []types.Transaction{block.Transactions[0], unsigned}
+		}, ErrBadTransaction},
+		{"unspendable output", func() []types.Transaction {
+			witness := parent
+			witness.Inputs = []types.Input{parent.Inputs[0]}
+			witness.Outputs = []types.Output{{Amount: 9, ScriptPubKey: make([]byte, 34), ScriptType: wallet.ScriptTypeP2WSH, Address: make([]byte, 32)}}
+			witness.InvalidateHash()
+			if err := transaction.SignInput(&witness, 0, funding, key); err != nil {
+				t.Fatalf("SignInput failed: %v", err)
+			}
+			return []types.Transaction{block.Transactions[0], witness}
+		}, ErrBadTransaction},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tampered := &types.Block{Index: block.Index, Transactions: tc.transactions()}
+			if err := ValidateBlockTransactions(tampered, utxos); !errors.Is(err, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
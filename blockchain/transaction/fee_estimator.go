@@ -0,0 +1,281 @@
+package transaction
+
+import (
+	"blockchain/types"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Fee estimation follows transactions from the time they enter the pool
+// until they are confirmed. Transactions are grouped in exponentially
+// spaced fee rate buckets, and for each bucket the estimator counts how
+// many transactions confirmed within each number of blocks. Counts decay
+// with every block so that recent blocks weigh more.
+const (
+	// MaxConfirmTarget is the largest number of blocks an estimate is made for
+	MaxConfirmTarget = 48
+	// DefaultFeeConfidence is the share of transactions of a bucket that
+	// must have confirmed within the target for it to be recommended
+	DefaultFeeConfidence = 0.85
+
+	minBucketFeeRate = 0.00000001
+	maxBucketFeeRate = 0.001
+	bucketSpacing    = 1.2
+	// feeDecay is applied to every count each block
+	feeDecay = 0.998
+	// sufficientSamples is the least number of transactions an estimate
+	// is based on
+	sufficientSamples   = 2
+	feeEstimatesVersion = 1
+)
+
+// ErrNoEstimate is returned when too few transactions were seen to
+// estimate a fee
+var ErrNoEstimate = errors.New("insufficient data to estimate a fee")
+
+// trackedTx is a pooled transaction waiting for confirmation
+type trackedTx struct {
+	Height int `json:"height"`
+	Bucket int `json:"bucket"`
+}
+
+// FeeEstimator estimates the fee rate needed for a transaction to confirm
+// within a number of blocks
+type FeeEstimator struct {
+	mu sync.Mutex
+
+	buckets []float64
+	// confirmed[t][b] counts bucket b transactions confirmed within t+1 blocks
+	confirmed [][]float64
+	// resolved counts the transactions of each bucket confirmed in any
+	// number of blocks or dropped after MaxConfirmTarget blocks
+	resolved []float64
+	tracked  map[string]trackedTx
+	height   int
+}
+
+// NewFeeEstimator returns an estimator without any data, starting at the
+// given chain height
+func NewFeeEstimator(height int) *FeeEstimator {
+	fe := &FeeEstimator{tracked: make(map[string]trackedTx), height: height}
+	for rate := minBucketFeeRate; rate <= maxBucketFeeRate; rate *= bucketSpacing {
+		fe.buckets = append(fe.buckets, rate)
+	}
+	fe.resolved = make([]float64, len(fe.buckets))
+	fe.confirmed = make([][]float64, MaxConfirmTarget)
+	for i := range fe.confirmed {
+		fe.confirmed[i] = make([]float64, len(fe.buckets))
+	}
+	return fe
+}
+
+// bucket returns the index of the bucket holding feeRate
+func (fe *FeeEstimator) bucket(feeRate float64) int {
+	b := 0
+	for b+1 < len(fe.buckets) && fe.buckets[b+1] <= feeRate {
+		b++
+	}
+	return b
+}
+
+// Height returns the height of the last block processed
+func (fe *FeeEstimator) Height() int {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	return fe.height
+}
+
+// TrackTransaction starts following a transaction entering the pool. A
+// transaction already followed keeps the height it was first seen at.
+func (fe *FeeEstimator) TrackTransaction(hash []byte, feeRate float64) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if _, ok := fe.tracked[string(hash)]; ok {
+		return
+	}
+	fe.tracked[string(hash)] = trackedTx{Height: fe.height, Bucket: fe.bucket(feeRate)}
+}
+
+// RemoveTransaction stops following a transaction that left the pool
+// without being confirmed, such as a replaced or evicted one
+func (fe *FeeEstimator) RemoveTransaction(hash []byte) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	delete(fe.tracked, string(hash))
+}
+
+// ProcessBlock records how long the followed transactions of a block took
+// to confirm. Blocks at or below the last processed height are ignored.
+func (fe *FeeEstimator) ProcessBlock(block *types.Block) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if block.Index <= fe.height {
+		return
+	}
+	fe.height = block.Index
+
+	for i := range fe.resolved {
+		fe.resolved[i] *= feeDecay
+		for t := range fe.confirmed {
+			fe.confirmed[t][i] *= feeDecay
+		}
+	}
+
+	for i := range block.Transactions {
+		hash := string(block.Transactions[i].Hash())
+		tx, ok := fe.tracked[hash]
+		if !ok {
+			continue
+		}
+		delete(fe.tracked, hash)
+
+		blocks := fe.height - tx.Height
+		if blocks < 1 {
+			blocks = 1
+		}
+		for t := blocks - 1; t < MaxConfirmTarget; t++ {
+			fe.confirmed[t][tx.Bucket]++
+		}
+		fe.resolved[tx.Bucket]++
+	}
+
+	// Transactions waiting longer than any target count as failures
+	for hash, tx := range fe.tracked {
+		if fe.height-tx.Height > MaxConfirmTarget {
+			delete(fe.tracked, hash)
+			fe.resolved[tx.Bucket]++
+		}
+	}
+}
+
+// EstimateFee returns the lowest fee rate, per byte, at which transactions
+// confirmed within targetBlocks with DefaultFeeConfidence
+func (fe *FeeEstimator) EstimateFee(targetBlocks int) (float64, error) {
+	return fe.EstimateFeeConfidence(targetBlocks, DefaultFeeConfidence)
+}
+
+// EstimateFeeConfidence returns the lowest fee rate at which at least the
+// given share of transactions confirmed within targetBlocks. Buckets are
+// examined from the highest fee rate down, merged until they hold enough
+// transactions. Transactions still in the pool after targetBlocks count
+// against their bucket.
+func (fe *FeeEstimator) EstimateFeeConfidence(targetBlocks int, confidence float64) (float64, error) {
+	if targetBlocks < 1 || targetBlocks > MaxConfirmTarget {
+		return 0, fmt.Errorf("target must be between 1 and %d blocks", MaxConfirmTarget)
+	}
+	if confidence <= 0 || confidence > 1 {
+		return 0, errors.New("confidence must be between 0 and 1")
+	}
+
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	waiting := make([]float64, len(fe.buckets))
+	for _, tx := range fe.tracked {
+		if fe.height-tx.Height >= targetBlocks {
+			waiting[tx.Bucket]++
+		}
+	}
+
+	best := -1
+	var confirmed, total float64
+	for b := len(fe.buckets) - 1; b >= 0; b-- {
+		confirmed += fe.confirmed[targetBlocks-1][b]
+		total += fe.resolved[b] + waiting[b]
+		if total < sufficientSamples {
+			continue
+		}
+		if confirmed/total < confidence {
+			break
+		}
+		best = b
+		confirmed, total = 0, 0
+	}
+
+	if best < 0 {
+		return 0, ErrNoEstimate
+	}
+	return fe.buckets[best], nil
+}
+
+// feeEstimatesFile is the saved state of a FeeEstimator
+type feeEstimatesFile struct {
+	Version   int                  `json:"version"`
+	Height    int                  `json:"height"`
+	Buckets   []float64            `json:"buckets"`
+	Confirmed [][]float64          `json:"confirmed"`
+	Resolved  []float64            `json:"resolved"`
+	Tracked   map[string]trackedTx `json:"tracked"`
+}
+
+// Save writes the estimator state to path
+func (fe *FeeEstimator) Save(path string) error {
+	fe.mu.Lock()
+	state := feeEstimatesFile{
+		Version:   feeEstimatesVersion,
+		Height:    fe.height,
+		Buckets:   fe.buckets,
+		Confirmed: fe.confirmed,
+		Resolved:  fe.resolved,
+		Tracked:   make(map[string]trackedTx, len(fe.tracked)),
+	}
+	for hash, tx := range fe.tracked {
+		state.Tracked[hex.EncodeToString([]byte(hash))] = tx
+	}
+	data, err := json.Marshal(state)
+	fe.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode fee estimates: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fee estimates: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFeeEstimator reads an estimator saved at path. Without a usable saved
+// state, such as a missing file or one written with different buckets, a
+// fresh estimator starting at height is returned.
+func LoadFeeEstimator(path string, height int) (*FeeEstimator, error) {
+	fe := NewFeeEstimator(height)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fe, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fee estimates: %w", err)
+	}
+
+	var state feeEstimatesFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode fee estimates: %w", err)
+	}
+	if state.Version != feeEstimatesVersion || len(state.Buckets) != len(fe.buckets) ||
+		len(state.Confirmed) != MaxConfirmTarget || len(state.Resolved) != len(fe.buckets) {
+		return fe, nil
+	}
+	for _, row := range state.Confirmed {
+		if len(row) != len(fe.buckets) {
+			return fe, nil
+		}
+	}
+
+	fe.height = state.Height
+	fe.confirmed = state.Confirmed
+	fe.resolved = state.Resolved
+	for hexHash, tx := range state.Tracked {
+		hash, err := hex.DecodeString(hexHash)
+		if err != nil || tx.Bucket < 0 || tx.Bucket >= len(fe.buckets) {
+			continue
+		}
+		fe.tracked[string(hash)] = tx
+	}
+	return fe, nil
+}
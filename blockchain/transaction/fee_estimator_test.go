@@ -0,0 +1,80 @@
+package transaction
+
+import (
+	"blockchain/types"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestFeeEstimator(t *testing.T) {
+	fe := NewFeeEstimator(0)
+	if _, err := fe.EstimateFee(1); err != ErrNoEstimate {
+		t.Errorf("Expected ErrNoEstimate without data, got %v", err)
+	}
+
+	// Each block confirms the high fee transactions sent just before it
+	// while the low fee ones stay in the pool
+	for height := 1; height <= 20; height++ {
+		var confirmed []types.Transaction
+		for i := 0; i < 3; i++ {
+			high := spend([]byte(fmt.Sprintf("high-%d-%d", height, i)), 0, 1)
+			low := spend([]byte(fmt.Sprintf("low-%d-%d", height, i)), 0, 1)
+			fe.TrackTransaction(high.Hash(), 0.0001)
+			fe.TrackTransaction(low.Hash(), 0.000001)
+			confirmed = append(confirmed, high)
+		}
+		fe.ProcessBlock(&types.Block{Index: height, Transactions: confirmed})
+	}
+
+	rate, err := fe.EstimateFee(1)
+	if err != nil {
+		t.Fatalf("EstimateFee failed: %v", err)
+	}
+	if rate > 0.0001 || rate < 0.000001 {
+		t.Errorf("Expected an estimate between the low and high fee rates, got %.8f", rate)
+	}
+	if _, err := fe.EstimateFee(MaxConfirmTarget + 1); err == nil {
+		t.Errorf("Expected error for a target beyond MaxConfirmTarget")
+	}
+
+	// A lower confidence accepts the same or a lower fee rate
+	if lower, err := fe.EstimateFeeConfidence(1, 0.5); err != nil || lower > rate {
+		t.Errorf("Expected a lower confidence estimate at most %.8f, got %.8f (%v)", rate, lower, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "fee_estimates.dat")
+	if err := fe.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := LoadFeeEstimator(path, 0)
+	if err != nil {
+		t.Fatalf("LoadFeeEstimator failed: %v", err)
+	}
+	if loaded.Height() != 20 {
+		t.Errorf("Expected height 20, got %d", loaded.Height())
+	}
+	if reloaded, _ := loaded.EstimateFee(1); reloaded != rate {
+		t.Errorf("Expected estimate %.8f after reload, got %.8f", rate, reloaded)
+	}
+}
+
+func TestFeeEstimatorPool(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+	fe := NewFeeEstimator(0)
+	pool.SetFeeEstimator(fe)
+
+	tx := spend(utxos.fund("a", 10), 0, 9.9)
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if len(fe.tracked) != 1 {
+		t.Fatalf("Expected the pooled transaction to be tracked")
+	}
+
+	pool.BlockConnected(&types.Block{Index: 1, Transactions: []types.Transaction{tx}})
+	if len(fe.tracked) != 0 || fe.resolved[fe.bucket(0.1/float64(len(tx.Serialize())))] == 0 {
+		t.Errorf("Expected the confirmation to be recorded")
+	}
+}
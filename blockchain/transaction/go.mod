@@ -6,9 +6,15 @@ replace blockchain/wallet => ../../wallet
 
 replace blockchain/types => ../../types
 
+replace blockchain/consensus => ../../consensus
+
+require (
+	blockchain/consensus v0.0.0-00010101000000-000000000000
+	blockchain/types v0.0.0-00010101000000-000000000000
+	blockchain/wallet v0.0.0-00010101000000-000000000000
+)
+
 require (
-	blockchain/types v0.0.0-00010101000000-000000000000 // indirect
-	blockchain/wallet v0.0.0-00010101000000-000000000000 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 	github.com/ethereum/go-ethereum v1.14.12 // indirect
 	github.com/holiman/uint256 v1.3.1 // indirect
@@ -0,0 +1,213 @@
+package transaction
+
+import (
+	"blockchain/types"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrOrphan is returned when a transaction is held until its parents arrive
+var ErrOrphan = errors.New("transaction held as an orphan until its parents are known")
+
+// orphan is a transaction spending outputs the pool does not know about
+type orphan struct {
+	tx      types.Transaction
+	hash    string
+	peer    string
+	expires time.Time
+	missing []outpoint
+}
+
+// orphanPool holds orphans, indexed by the outputs they are waiting for.
+// It is guarded by the lock of the TransactionPool owning it.
+type orphanPool struct {
+	orphans   map[string]*orphan
+	byMissing map[outpoint]map[string]*orphan
+	perPeer   map[string]int
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		orphans:   make(map[string]*orphan),
+		byMissing: make(map[outpoint]map[string]*orphan),
+		perPeer:   make(map[string]int),
+	}
+}
+
+func (op *orphanPool) add(o *orphan) {
+	op.orphans[o.hash] = o
+	for _, missing := range o.missing {
+		if op.byMissing[missing] == nil {
+			op.byMissing[missing] = make(map[string]*orphan)
+		}
+		op.byMissing[missing][o.hash] = o
+	}
+	op.perPeer[o.peer]++
+}
+
+func (op *orphanPool) remove(o *orphan) {
+	delete(op.orphans, o.hash)
+	for _, missing := range o.missing {
+		delete(op.byMissing[missing], o.hash)
+		if len(op.byMissing[missing]) == 0 {
+			delete(op.byMissing, missing)
+		}
+	}
+	if op.perPeer[o.peer]--; op.perPeer[o.peer] == 0 {
+		delete(op.perPeer, o.peer)
+	}
+}
+
+// expire drops the orphans whose parents did not arrive in time
+func (op *orphanPool) expire(now time.Time) {
+	for _, o := range op.orphans {
+		if now.After(o.expires) {
+			op.remove(o)
+		}
+	}
+}
+
+// oldest returns the orphan closest to expiry
+func (op *orphanPool) oldest() *orphan {
+	var oldest *orphan
+	for _, o := range op.orphans {
+		if oldest == nil || o.expires.Before(oldest.expires) {
+			oldest = o
+		}
+	}
+	return oldest
+}
+
+// sorted returns the orphans in arrival order
+func (op *orphanPool) sorted() []*orphan {
+	orphans := make([]*orphan, 0, len(op.orphans))
+	for _, o := range op.orphans {
+		orphans = append(orphans, o)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].expires.Before(orphans[j].expires) })
+	return orphans
+}
+
+// ProcessTransaction adds a transaction received from peer to the pool. A
+// transaction spending unknown outputs is held as an orphan and ErrOrphan
+// is returned. Once accepted, orphans waiting for the transaction are
+// added as well. The accepted transactions are returned for relay.
+func (tp *TransactionPool) ProcessTransaction(tx types.Transaction, peer string) ([]types.Transaction, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	err := tp.add(tx)
+	if errors.Is(err, ErrMissingInputs) {
+		return nil, tp.addOrphan(tx, peer, time.Now().Add(tp.config.OrphanExpiry))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := append([]types.Transaction{tx}, tp.processOrphans([]types.Transaction{tx})...)
+	for _, tx := range accepted {
+		tp.track(tx)
+	}
+	return accepted, nil
+}
+
+// addOrphan holds tx until the outputs it spends become known
+func (tp *TransactionPool) addOrphan(tx types.Transaction, peer string, expires time.Time) error {
+	hash := string(tx.Hash())
+	if _, ok := tp.orphans.orphans[hash]; ok {
+		return ErrOrphan
+	}
+
+	// Orphans over the limits are refused like any transaction with
+	// missing inputs
+	size := uint64(len(tx.Serialize()))
+	if tp.config.MaxOrphans < 1 || size > tp.config.MaxOrphanSize {
+		return ErrMissingInputs
+	}
+	if tp.orphans.perPeer[peer] >= tp.config.MaxOrphansPerPeer {
+		return ErrMissingInputs
+	}
+
+	var missing []outpoint
+	for _, input := range tx.Inputs {
+		if _, err := tp.lookupOutput(input.PreviousTxHash, input.OutputIndex); err != nil {
+			missing = append(missing, outpoint{string(input.PreviousTxHash), input.OutputIndex})
+		}
+	}
+
+	tp.orphans.expire(time.Now())
+	for len(tp.orphans.orphans) >= tp.config.MaxOrphans {
+		tp.orphans.remove(tp.orphans.oldest())
+	}
+
+	tp.orphans.add(&orphan{tx: tx, hash: hash, peer: peer, expires: expires, missing: missing})
+	return ErrOrphan
+}
+
+// processOrphans retries the orphans spending outputs of the given newly
+// available transactions, and in turn those spending the orphans accepted.
+// It returns the transactions added to the pool.
+func (tp *TransactionPool) processOrphans(available []types.Transaction) []types.Transaction {
+	var accepted []types.Transaction
+	for len(available) > 0 {
+		tx := available[0]
+		available = available[1:]
+		hash := string(tx.Hash())
+
+		var waiting []*orphan
+		for index := range tx.Outputs {
+			for _, o := range tp.orphans.byMissing[outpoint{hash, uint64(index)}] {
+				waiting = append(waiting, o)
+			}
+		}
+		// Retry in arrival order so that results do not depend on map order
+		sort.Slice(waiting, func(i, j int) bool { return waiting[i].expires.Before(waiting[j].expires) })
+
+		for _, o := range waiting {
+			if _, ok := tp.orphans.orphans[o.hash]; !ok {
+				continue
+			}
+			tp.orphans.remove(o)
+
+			err := tp.add(o.tx)
+			if errors.Is(err, ErrMissingInputs) {
+				// Still waiting for another parent
+				tp.addOrphan(o.tx, o.peer, o.expires)
+				continue
+			}
+			if err == nil {
+				accepted = append(accepted, o.tx)
+				available = append(available, o.tx)
+			}
+		}
+	}
+	return accepted
+}
+
+// IsOrphan reports whether the transaction is held as an orphan
+func (tp *TransactionPool) IsOrphan(hash []byte) bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	_, ok := tp.orphans.orphans[string(hash)]
+	return ok
+}
+
+// OrphanCount returns the number of orphans held
+func (tp *TransactionPool) OrphanCount() int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return len(tp.orphans.orphans)
+}
+
+// RemovePeerOrphans drops the orphans received from peer, for instance
+// when it disconnects or misbehaves
+func (tp *TransactionPool) RemovePeerOrphans(peer string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, o := range tp.orphans.orphans {
+		if o.peer == peer {
+			tp.orphans.remove(o)
+		}
+	}
+}
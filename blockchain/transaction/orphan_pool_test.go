@@ -0,0 +1,98 @@
+package transaction
+
+import (
+	"blockchain/types"
+	"testing"
+	"time"
+)
+
+func TestOrphanPool(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	parent := spend(utxos.fund("a", 10), 0, 9.9)
+	child := spend(parent.Hash(), 0, 9.8)
+	grandchild := spend(child.Hash(), 0, 9.7)
+
+	// Children arriving before their parent are held
+	for _, tx := range []types.Transaction{grandchild, child} {
+		if _, err := pool.ProcessTransaction(tx, "peer1"); err != ErrOrphan {
+			t.Fatalf("Expected ErrOrphan, got %v", err)
+		}
+	}
+	if pool.OrphanCount() != 2 || pool.Count() != 0 {
+		t.Fatalf("Expected 2 orphans and an empty pool, got %d and %d", pool.OrphanCount(), pool.Count())
+	}
+
+	accepted, err := pool.ProcessTransaction(parent, "peer2")
+	if err != nil {
+		t.Fatalf("ProcessTransaction failed: %v", err)
+	}
+	if len(accepted) != 3 {
+		t.Errorf("Expected the parent and both orphans to be accepted, got %d", len(accepted))
+	}
+	if pool.OrphanCount() != 0 || pool.Count() != 3 {
+		t.Errorf("Expected no orphans and 3 pooled transactions, got %d and %d", pool.OrphanCount(), pool.Count())
+	}
+}
+
+func TestOrphanPoolConfirmedParent(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	parent := spend(utxos.fund("a", 10), 0, 9.9)
+	child := spend(parent.Hash(), 0, 9.8)
+	if _, err := pool.ProcessTransaction(child, "peer1"); err != ErrOrphan {
+		t.Fatalf("Expected ErrOrphan, got %v", err)
+	}
+
+	// The parent is confirmed in a block without passing through the pool
+	utxos[outpoint{string(parent.Hash()), 0}] = &parent.Outputs[0]
+	accepted := pool.RemoveTransactions([]types.Transaction{parent})
+	if len(accepted) != 1 || pool.IsOrphan(child.Hash()) {
+		t.Errorf("Expected the orphan to enter the pool, got %d accepted", len(accepted))
+	}
+	if _, ok := pool.GetTransaction(child.Hash()); !ok {
+		t.Errorf("Expected the child in the pool")
+	}
+}
+
+func TestOrphanPoolLimits(t *testing.T) {
+	config := DefaultPoolConfig()
+	config.MaxOrphans = 3
+	config.MaxOrphansPerPeer = 2
+	config.OrphanExpiry = time.Hour
+	pool := NewTransactionPool(config, testUTXOs{})
+
+	for i, peer := range []string{"peer1", "peer1", "peer1"} {
+		_, err := pool.ProcessTransaction(spend([]byte{byte(i)}, 0, 1), peer)
+		if i < 2 && err != ErrOrphan {
+			t.Errorf("Expected ErrOrphan, got %v", err)
+		}
+		if i == 2 && err != ErrMissingInputs {
+			t.Errorf("Expected the per-peer limit to refuse the orphan, got %v", err)
+		}
+	}
+
+	// The pool-wide limit evicts the oldest orphan
+	first := spend([]byte{0}, 0, 1)
+	pool.ProcessTransaction(spend([]byte{3}, 0, 1), "peer2")
+	pool.ProcessTransaction(spend([]byte{4}, 0, 1), "peer3")
+	if pool.OrphanCount() != 3 || pool.IsOrphan(first.Hash()) {
+		t.Errorf("Expected the oldest orphan to be evicted, %d orphans held", pool.OrphanCount())
+	}
+
+	pool.RemovePeerOrphans("peer1")
+	if pool.OrphanCount() != 2 {
+		t.Errorf("Expected 2 orphans after removing peer1, got %d", pool.OrphanCount())
+	}
+
+	// Expired orphans are dropped when new ones arrive
+	config.OrphanExpiry = -time.Second
+	pool = NewTransactionPool(config, testUTXOs{})
+	pool.ProcessTransaction(spend([]byte{0}, 0, 1), "peer1")
+	pool.ProcessTransaction(spend([]byte{1}, 0, 1), "peer2")
+	if pool.OrphanCount() != 1 {
+		t.Errorf("Expected the expired orphan to be dropped, %d held", pool.OrphanCount())
+	}
+}
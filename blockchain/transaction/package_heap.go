@@ -0,0 +1,87 @@
+package transaction
+
+import "container/heap"
+
+// packageScore is the fee and size of a pooled transaction together with
+// the relatives it is scored with: its ancestors not yet selected when
+// filling a block, its descendants when trimming the pool
+type packageScore struct {
+	entry *TxEntry
+	fee   float64
+	size  uint64
+	// order is the place of entry in byFeeRate, which breaks ties
+	order int
+	// index is the place of the score in its heap, -1 once out of it
+	index int
+}
+
+// rate returns the fee rate of the package
+func (s *packageScore) rate() float64 {
+	return s.fee / float64(s.size)
+}
+
+// packageHeap keeps package scores with the first by before on top
+type packageHeap struct {
+	scores []*packageScore
+	before func(a, b *packageScore) bool
+}
+
+// newPackageHeap returns a heap of scores ordered by before
+func newPackageHeap(scores []*packageScore, before func(a, b *packageScore) bool) *packageHeap {
+	h := &packageHeap{scores: scores, before: before}
+	for i, s := range scores {
+		s.index = i
+	}
+	heap.Init(h)
+	return h
+}
+
+func (h *packageHeap) Len() int { return len(h.scores) }
+
+func (h *packageHeap) Less(i, j int) bool {
+	a, b := h.scores[i], h.scores[j]
+	if h.before(a, b) != h.before(b, a) {
+		return h.before(a, b)
+	}
+	return a.order < b.order
+}
+
+func (h *packageHeap) Swap(i, j int) {
+	h.scores[i], h.scores[j] = h.scores[j], h.scores[i]
+	h.scores[i].index = i
+	h.scores[j].index = j
+}
+
+func (h *packageHeap) Push(x any) {
+	s := x.(*packageScore)
+	s.index = len(h.scores)
+	h.scores = append(h.scores, s)
+}
+
+func (h *packageHeap) Pop() any {
+	last := len(h.scores) - 1
+	s := h.scores[last]
+	h.scores[last] = nil
+	h.scores = h.scores[:last]
+	s.index = -1
+	return s
+}
+
+// pop removes and returns the top score
+func (h *packageHeap) pop() *packageScore {
+	return heap.Pop(h).(*packageScore)
+}
+
+// fix restores the order after the fee or size of s changed
+func (h *packageHeap) fix(s *packageScore) {
+	if s.index >= 0 {
+		heap.Fix(h, s.index)
+	}
+}
+
+// remove takes s out of the heap if it is still in it
+func (h *packageHeap) remove(s *packageScore) {
+	if s.index >= 0 {
+		heap.Remove(h, s.index)
+	}
+}
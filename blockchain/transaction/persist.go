@@ -0,0 +1,256 @@
+package transaction
+
+import (
+	"bufio"
+	"blockchain/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Mempool files start with a magic string and version, followed by the
+// number of transactions and one record per transaction: the time it
+// entered the pool and its canonical encoding, prefixed with its length.
+// Parents are written before the transactions spending them. Since version
+// 2 the orphans follow, as their count and then for each its expiry time,
+// the peer it came from and its encoding, both prefixed with their length.
+const (
+	MempoolFileVersion = 2
+	mempoolFileMagic   = "GOMEMPOOL\x00"
+	// maxMempoolRecord bounds the size of a transaction read back
+	maxMempoolRecord = 4 << 20
+)
+
+// LoadStats reports what happened to the transactions of a mempool file
+type LoadStats struct {
+	Loaded int
+	// Failed counts transactions no longer valid against the chain
+	Failed int
+	// Skipped counts transactions already in the pool
+	Skipped int
+	// Orphans counts orphans still waiting for their parents
+	Orphans int
+}
+
+// Dump writes every pooled transaction and orphan to w
+func (tp *TransactionPool) Dump(w io.Writer) error {
+	tp.mu.Lock()
+	entries := tp.sortedEntries()
+	orphans := tp.orphans.sorted()
+	tp.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(mempoolFileMagic)
+	binary.Write(bw, binary.LittleEndian, uint32(MempoolFileVersion))
+	binary.Write(bw, binary.LittleEndian, uint32(len(entries)))
+
+	for _, entry := range entries {
+		data := entry.Tx.Serialize()
+		binary.Write(bw, binary.LittleEndian, entry.Added.Unix())
+		binary.Write(bw, binary.LittleEndian, uint32(len(data)))
+		if _, err := bw.Write(data); err != nil {
+			return fmt.Errorf("failed to write mempool: %w", err)
+		}
+	}
+
+	binary.Write(bw, binary.LittleEndian, uint32(len(orphans)))
+	for _, o := range orphans {
+		data := o.tx.Serialize()
+		binary.Write(bw, binary.LittleEndian, o.expires.Unix())
+		binary.Write(bw, binary.LittleEndian, uint32(len(o.peer)))
+		bw.WriteString(o.peer)
+		binary.Write(bw, binary.LittleEndian, uint32(len(data)))
+		if _, err := bw.Write(data); err != nil {
+			return fmt.Errorf("failed to write mempool: %w", err)
+		}
+	}
+	return bw.Flush()
+}
+
+// Load reads transactions written by Dump and adds them back to the pool,
+// revalidating each against the current UTXO set. Orphans whose parents
+// are still unknown are held again until they expire.
+func (tp *TransactionPool) Load(r io.Reader) (*LoadStats, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(mempoolFileMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("failed to read mempool header: %w", err)
+	}
+	if string(magic) != mempoolFileMagic {
+		return nil, errors.New("not a mempool file")
+	}
+	var version, count uint32
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("failed to read mempool header: %w", err)
+	}
+	if version < 1 || version > MempoolFileVersion {
+		return nil, fmt.Errorf("unsupported mempool file version %d", version)
+	}
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("failed to read mempool header: %w", err)
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	stats := &LoadStats{}
+	for i := uint32(0); i < count; i++ {
+		var added int64
+		if err := binary.Read(br, binary.LittleEndian, &added); err != nil {
+			return stats, fmt.Errorf("failed to read transaction %d: %w", i, err)
+		}
+		data, err := readMempoolRecord(br)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read transaction %d: %w", i, err)
+		}
+
+		tx, err := types.DeserializeTransaction(data)
+		if err != nil {
+			return stats, fmt.Errorf("failed to decode transaction %d: %w", i, err)
+		}
+
+		switch err := tp.add(*tx); {
+		case err == nil:
+			tp.entries[string(tx.Hash())].Added = time.Unix(added, 0)
+			stats.Loaded++
+		case errors.Is(err, ErrAlreadyInPool):
+			stats.Skipped++
+		default:
+			stats.Failed++
+		}
+	}
+	if version < 2 {
+		return stats, nil
+	}
+
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return stats, fmt.Errorf("failed to read orphan count: %w", err)
+	}
+	now := time.Now()
+	for i := uint32(0); i < count; i++ {
+		var expires int64
+		if err := binary.Read(br, binary.LittleEndian, &expires); err != nil {
+			return stats, fmt.Errorf("failed to read orphan %d: %w", i, err)
+		}
+		peer, err := readMempoolRecord(br)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read orphan %d: %w", i, err)
+		}
+		data, err := readMempoolRecord(br)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read orphan %d: %w", i, err)
+		}
+		tx, err := types.DeserializeTransaction(data)
+		if err != nil {
+			return stats, fmt.Errorf("failed to decode orphan %d: %w", i, err)
+		}
+
+		// A parent may have been confirmed or loaded above in the meantime
+		switch err := tp.add(*tx); {
+		case err == nil:
+			accepted := tp.processOrphans([]types.Transaction{*tx})
+			stats.Loaded += 1 + len(accepted)
+			stats.Orphans -= len(accepted)
+		case errors.Is(err, ErrAlreadyInPool):
+			stats.Skipped++
+		case errors.Is(err, ErrMissingInputs) && time.Unix(expires, 0).After(now):
+			if tp.addOrphan(*tx, string(peer), time.Unix(expires, 0)) == ErrOrphan {
+				stats.Orphans++
+			} else {
+				stats.Failed++
+			}
+		default:
+			stats.Failed++
+		}
+	}
+	return stats, nil
+}
+
+// readMempoolRecord reads a length prefixed record of a mempool file
+func readMempoolRecord(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > maxMempoolRecord {
+		return nil, fmt.Errorf("record is too large (%d bytes)", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DumpFile writes the pool to path, replacing the file atomically
+func (tp *TransactionPool) DumpFile(path string) error {
+	var buf bytes.Buffer
+	if err := tp.Dump(&buf); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create mempool file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write mempool file: %w", err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write mempool file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write mempool file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write mempool file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile loads the pool saved at path. A missing file loads nothing.
+func (tp *TransactionPool) LoadFile(path string) (*LoadStats, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &LoadStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mempool file: %w", err)
+	}
+	defer file.Close()
+	return tp.Load(file)
+}
+
+// sortedEntries returns every entry with parents before their children
+func (tp *TransactionPool) sortedEntries() []*TxEntry {
+	entries := make([]*TxEntry, 0, len(tp.entries))
+	visited := make(map[string]bool)
+
+	var visit func(entry *TxEntry)
+	visit = func(entry *TxEntry) {
+		if visited[string(entry.Hash)] {
+			return
+		}
+		visited[string(entry.Hash)] = true
+		for _, parent := range entry.parents {
+			visit(parent)
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range tp.byFeeRate {
+		visit(entry)
+	}
+	return entries
+}
@@ -0,0 +1,122 @@
+package transaction
+
+import (
+	"blockchain/types"
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestMempoolDumpLoad(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	// The child pays the higher fee rate but must be written after its parent
+	parent := spend(utxos.fund("a", 10), 0, 9.99)
+	child := spend(parent.Hash(), 0, 5)
+	other := spend(utxos.fund("b", 10), 0, 9)
+	for _, tx := range []types.Transaction{parent, child, other} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pool.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+
+	// "b" was spent by a block while the node was down
+	delete(utxos, outpoint{"b", 0})
+	loaded := NewTransactionPool(DefaultPoolConfig(), utxos)
+	stats, err := loaded.Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if stats.Loaded != 2 || stats.Failed != 1 {
+		t.Errorf("Expected 2 loaded and 1 failed, got %+v", stats)
+	}
+	if _, ok := loaded.GetTransaction(child.Hash()); !ok {
+		t.Errorf("Expected child to be reloaded")
+	}
+
+	if _, err := loaded.Load(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Errorf("Expected error loading a file without a header")
+	}
+}
+
+func TestMempoolDumpLoadOrphans(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	parent := spend(utxos.fund("a", 10), 0, 9.9)
+	child := spend(parent.Hash(), 0, 9.8)
+	stranger := spend([]byte("unknown"), 0, 1)
+	for _, tx := range []types.Transaction{child, stranger} {
+		if _, err := pool.ProcessTransaction(tx, "local"); err != ErrOrphan {
+			t.Fatalf("Expected ErrOrphan, got %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pool.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+
+	loaded := NewTransactionPool(DefaultPoolConfig(), utxos)
+	stats, err := loaded.Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if stats.Orphans != 2 || loaded.OrphanCount() != 2 {
+		t.Fatalf("Expected 2 orphans reloaded, got %+v", stats)
+	}
+
+	// The reloaded orphan still enters the pool once its parent arrives
+	if accepted, err := loaded.ProcessTransaction(parent, "local"); err != nil || len(accepted) != 2 {
+		t.Errorf("Expected the parent and its orphan to be accepted, got %d: %v", len(accepted), err)
+	}
+
+	// An orphan whose parent was confirmed meanwhile is loaded into the pool
+	utxos[outpoint{string(parent.Hash()), 0}] = &parent.Outputs[0]
+	loaded = NewTransactionPool(DefaultPoolConfig(), utxos)
+	stats, err = loaded.Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if stats.Loaded != 1 || stats.Orphans != 1 {
+		t.Errorf("Expected 1 loaded and 1 orphan, got %+v", stats)
+	}
+	if _, ok := loaded.GetTransaction(child.Hash()); !ok {
+		t.Errorf("Expected the child in the pool")
+	}
+}
+
+func TestMempoolDumpFile(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+	tx := spend(utxos.fund("a", 10), 0, 9.9)
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "mempool.dat")
+	stats, err := NewTransactionPool(DefaultPoolConfig(), utxos).LoadFile(path)
+	if err != nil || stats.Loaded != 0 {
+		t.Fatalf("Expected a missing file to load nothing, got %+v, %v", stats, err)
+	}
+
+	if err := pool.DumpFile(path); err != nil {
+		t.Fatalf("DumpFile failed: %v", err)
+	}
+	loaded := NewTransactionPool(DefaultPoolConfig(), utxos)
+	if _, err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	// Entry times survive the round trip
+	want := pool.Entries()[0].Added.Unix()
+	if got := loaded.Entries()[0].Added.Unix(); got != want {
+		t.Errorf("Expected entry time %d, got %d", want, got)
+	}
+}
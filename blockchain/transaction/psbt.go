@@ -0,0 +1,635 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// psbtMagic starts every serialized PSBT
+var psbtMagic = []byte("psbt\xff")
+
+// Key types of the PSBT maps. The numbers are those BIP 174 gives the same
+// fields, 0x00 for the transaction creating the spent output and 0x01 for
+// the output alone as in a witness UTXO, but the values use this chain's
+// own transaction and output encoding, so the PSBTs are not read by
+// Bitcoin software.
+const (
+	psbtGlobalUnsignedTx = 0x00
+
+	psbtInPrevTx         = 0x00
+	psbtInUTXO           = 0x01
+	psbtInPartialSig     = 0x02
+	psbtInRedeemScript   = 0x04
+	psbtInDerivation     = 0x06
+	psbtInFinalScriptSig = 0x07
+
+	psbtOutRedeemScript = 0x00
+	psbtOutDerivation   = 0x02
+)
+
+// ErrIncomplete is returned when a PSBT is finalized or extracted before
+// its inputs carry enough signatures
+var ErrIncomplete = errors.New("transaction is not fully signed")
+
+// PSBT is a partially signed transaction: an unsigned transaction with the
+// data signers need to sign its inputs without access to the chain, and the
+// signatures gathered so far. It is passed between the machines and parties
+// taking part in a payment until every input is signed.
+type PSBT struct {
+	Tx      *types.Transaction
+	Inputs  []PSBTInput
+	Outputs []PSBTOutput
+}
+
+// PSBTInput holds what is known about the spending of an input
+type PSBTInput struct {
+	// PrevTx is the transaction creating the spent output. Signatures do
+	// not commit to the amount spent, so signers take the output from it
+	// rather than trust UTXO.
+	PrevTx *types.Transaction
+	// UTXO is the output spent by the input
+	UTXO         *types.Output
+	RedeemScript []byte
+	Derivations  []wallet.KeyOrigin
+	PartialSigs  []PartialSignature
+	// FinalScriptSig is set once the input is finalized, the other fields
+	// but PrevTx and UTXO are then dropped
+	FinalScriptSig []byte
+}
+
+// PSBTOutput holds what is known about an output, so that signers can
+// recognise their change
+type PSBTOutput struct {
+	RedeemScript []byte
+	Derivations  []wallet.KeyOrigin
+}
+
+// PartialSignature is the signature of an input by one public key
+type PartialSignature struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// NewPSBT wraps an unsigned transaction. Inputs and outputs start without
+// any data, the previous transaction of each input must be added with
+// SetPrevTx before it can be signed.
+func NewPSBT(tx *types.Transaction) (*PSBT, error) {
+	for i, input := range tx.Inputs {
+		if len(input.ScriptSig) != 0 {
+			return nil, fmt.Errorf("input %d is already signed", i)
+		}
+	}
+	return &PSBT{
+		Tx:      tx,
+		Inputs:  make([]PSBTInput, len(tx.Inputs)),
+		Outputs: make([]PSBTOutput, len(tx.Outputs)),
+	}, nil
+}
+
+// SetPrevTx records prevTx as the transaction creating the output spent by
+// input index, and that output as its UTXO
+func (p *PSBT) SetPrevTx(index int, prevTx *types.Transaction) error {
+	if index < 0 || index >= len(p.Inputs) {
+		return fmt.Errorf("no input %d", index)
+	}
+	utxo, err := p.prevOutput(index, prevTx)
+	if err != nil {
+		return err
+	}
+	p.Inputs[index].PrevTx, p.Inputs[index].UTXO = prevTx, utxo
+	return nil
+}
+
+// SignInput adds the signature by key of input index. The key must be the
+// one the spent output pays to, or one of the keys of the redeem script of
+// a P2SH output. The spent output is taken from the previous transaction,
+// which must hash to the one the input names.
+func (p *PSBT) SignInput(index int, key *ecdsa.PrivateKey) error {
+	if index < 0 || index >= len(p.Inputs) {
+		return fmt.Errorf("no input %d", index)
+	}
+	input := &p.Inputs[index]
+	if input.PrevTx == nil {
+		return fmt.Errorf("input %d has no previous transaction to sign", index)
+	}
+	if input.FinalScriptSig != nil {
+		return fmt.Errorf("input %d is already finalized", index)
+	}
+	utxo, err := p.prevOutput(index, input.PrevTx)
+	if err != nil {
+		return err
+	}
+	if input.UTXO != nil && !bytes.Equal(input.UTXO.Serialize(), utxo.Serialize()) {
+		return fmt.Errorf("input %d: UTXO does not match the previous transaction", index)
+	}
+	input.UTXO = utxo
+
+	pubKey := wallet.SerializePublicKey(&key.PublicKey)
+	scriptCode := utxo.ScriptPubKey
+	if utxo.ScriptType == wallet.ScriptTypeP2SH {
+		_, pubKeys, err := input.multisigScript()
+		if err != nil {
+			return fmt.Errorf("input %d: %w", index, err)
+		}
+		if !slices.ContainsFunc(pubKeys, func(k []byte) bool { return bytes.Equal(k, pubKey) }) {
+			return fmt.Errorf("key does not spend input %d", index)
+		}
+		scriptCode = input.RedeemScript
+	} else if !bytes.Equal(wallet.AddressFromPublicKey(&key.PublicKey, true), utxo.Address) {
+		return fmt.Errorf("key does not spend input %d", index)
+	}
+	sig, err := signatureFor(p.Tx, index, scriptCode, key)
+	if err != nil {
+		return err
+	}
+	input.addPartialSig(PartialSignature{pubKey, sig})
+	return nil
+}
+
+// prevOutput returns the output of prevTx spent by input index, checking
+// prevTx is the transaction the input names
+func (p *PSBT) prevOutput(index int, prevTx *types.Transaction) (*types.Output, error) {
+	input := p.Tx.Inputs[index]
+	if !bytes.Equal(prevTx.Hash(), input.PreviousTxHash) {
+		return nil, fmt.Errorf("input %d: previous transaction %x is not the one spent", index, prevTx.Hash())
+	}
+	if input.OutputIndex >= uint64(len(prevTx.Outputs)) {
+		return nil, fmt.Errorf("input %d: previous transaction has no output %d", index, input.OutputIndex)
+	}
+	return &prevTx.Outputs[input.OutputIndex], nil
+}
+
+// Combine merges the data and signatures of other, a copy of the same
+// unsigned transaction signed elsewhere, into p. Copies disagreeing on the
+// output an input spends, or carrying a wrong previous transaction, are
+// refused.
+func (p *PSBT) Combine(other *PSBT) error {
+	if !bytes.Equal(p.Tx.Hash(), other.Tx.Hash()) {
+		return errors.New("PSBTs are for different transactions")
+	}
+
+	for i := range p.Inputs {
+		input, theirs := p.Inputs[i], other.Inputs[i]
+		if input.UTXO != nil && theirs.UTXO != nil && !bytes.Equal(input.UTXO.Serialize(), theirs.UTXO.Serialize()) {
+			return fmt.Errorf("input %d spends different UTXOs", i)
+		}
+		if theirs.PrevTx != nil {
+			if _, err := p.prevOutput(i, theirs.PrevTx); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range p.Inputs {
+		input, theirs := &p.Inputs[i], &other.Inputs[i]
+		if input.UTXO == nil {
+			input.UTXO = theirs.UTXO
+		}
+		if input.PrevTx == nil {
+			input.PrevTx = theirs.PrevTx
+		}
+		if input.FinalScriptSig == nil && theirs.FinalScriptSig != nil {
+			*input = PSBTInput{PrevTx: input.PrevTx, UTXO: input.UTXO, FinalScriptSig: theirs.FinalScriptSig}
+		}
+		if input.FinalScriptSig != nil {
+			continue
+		}
+		if input.RedeemScript == nil {
+			input.RedeemScript = theirs.RedeemScript
+		}
+		for _, origin := range theirs.Derivations {
+			input.Derivations = addDerivation(input.Derivations, origin)
+		}
+		for _, sig := range theirs.PartialSigs {
+			input.addPartialSig(sig)
+		}
+	}
+	for i := range p.Outputs {
+		output, theirs := &p.Outputs[i], &other.Outputs[i]
+		if output.RedeemScript == nil {
+			output.RedeemScript = theirs.RedeemScript
+		}
+		for _, origin := range theirs.Derivations {
+			output.Derivations = addDerivation(output.Derivations, origin)
+		}
+	}
+	return nil
+}
+
+// Finalize builds the scriptSig of every input that carries enough
+// signatures and checks it. Finalized inputs keep only their previous
+// transaction, UTXO and scriptSig. It returns ErrIncomplete if some inputs could not be
+// finalized.
+func (p *PSBT) Finalize() error {
+	complete := true
+	for i := range p.Inputs {
+		input := &p.Inputs[i]
+		if input.FinalScriptSig != nil {
+			continue
+		}
+		if input.UTXO == nil {
+			complete = false
+			continue
+		}
+
+		scriptSig, err := input.finalScriptSig()
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		if scriptSig == nil {
+			complete = false
+			continue
+		}
+
+		signed := *p.Tx
+		signed.Inputs = slices.Clone(p.Tx.Inputs)
+		signed.Inputs[i].ScriptSig = scriptSig
+		signed.InvalidateHash()
+		if err := VerifyInput(&signed, i, input.UTXO); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		*input = PSBTInput{PrevTx: input.PrevTx, UTXO: input.UTXO, FinalScriptSig: scriptSig}
+	}
+	if !complete {
+		return ErrIncomplete
+	}
+	return nil
+}
+
+// IsComplete reports whether every input is finalized
+func (p *PSBT) IsComplete() bool {
+	for _, input := range p.Inputs {
+		if input.FinalScriptSig == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the signed transaction of a finalized PSBT
+func (p *PSBT) Extract() (*types.Transaction, error) {
+	if !p.IsComplete() {
+		return nil, ErrIncomplete
+	}
+	tx := *p.Tx
+	tx.Inputs = slices.Clone(p.Tx.Inputs)
+	for i, input := range p.Inputs {
+		tx.Inputs[i].ScriptSig = input.FinalScriptSig
+	}
+	tx.InvalidateHash()
+	return &tx, nil
+}
+
+// Fee returns the fee paid by the transaction, which needs the UTXO of
+// every input. Amounts are taken from the previous transactions where
+// known.
+func (p *PSBT) Fee() (float64, error) {
+	var fee float64
+	for i, input := range p.Inputs {
+		utxo := input.UTXO
+		if input.PrevTx != nil {
+			var err error
+			if utxo, err = p.prevOutput(i, input.PrevTx); err != nil {
+				return 0, err
+			}
+		}
+		if utxo == nil {
+			return 0, fmt.Errorf("input %d has no UTXO", i)
+		}
+		fee += utxo.Amount
+	}
+	for _, output := range p.Tx.Outputs {
+		fee -= output.Amount
+	}
+	return fee, nil
+}
+
+// AddInputDerivation records the origin of a key signing input index
+func (p *PSBT) AddInputDerivation(index int, origin wallet.KeyOrigin) {
+	p.Inputs[index].Derivations = addDerivation(p.Inputs[index].Derivations, origin)
+}
+
+// AddOutputDerivation records the origin of the key an output pays to
+func (p *PSBT) AddOutputDerivation(index int, origin wallet.KeyOrigin) {
+	p.Outputs[index].Derivations = addDerivation(p.Outputs[index].Derivations, origin)
+}
+
+// finalScriptSig builds the scriptSig of the input from its partial
+// signatures, nil if it does not have enough
+func (input *PSBTInput) finalScriptSig() ([]byte, error) {
+	var script bytes.Buffer
+	if input.UTXO.ScriptType != wallet.ScriptTypeP2SH {
+		for _, sig := range input.PartialSigs {
+			key, err := wallet.ParsePublicKey(sig.PubKey)
+			if err == nil && bytes.Equal(wallet.AddressFromPublicKey(key, true), input.UTXO.Address) {
+				pushData(&script, sig.Signature)
+				pushData(&script, sig.PubKey)
+				return script.Bytes(), nil
+			}
+		}
+		return nil, nil
+	}
+
+	// OP_0, then m signatures in the order of their keys and the redeem
+	// script
+	m, pubKeys, err := input.multisigScript()
+	if err != nil {
+		return nil, err
+	}
+	pushData(&script, nil)
+	signed := 0
+	for _, pubKey := range pubKeys {
+		i, found := slices.BinarySearchFunc(input.PartialSigs, pubKey, func(s PartialSignature, pubKey []byte) int {
+			return bytes.Compare(s.PubKey, pubKey)
+		})
+		if found && signed < m {
+			pushData(&script, input.PartialSigs[i].Signature)
+			signed++
+		}
+	}
+	if signed < m {
+		return nil, nil
+	}
+	pushData(&script, input.RedeemScript)
+	return script.Bytes(), nil
+}
+
+// multisigScript returns the required signatures and keys of the redeem
+// script of an input spending a P2SH output
+func (input *PSBTInput) multisigScript() (int, [][]byte, error) {
+	if input.RedeemScript == nil {
+		return 0, nil, errors.New("P2SH input has no redeem script")
+	}
+	if !bytes.Equal(wallet.Hash160(input.RedeemScript), input.UTXO.Address) {
+		return 0, nil, errors.New("redeem script does not match the spent output")
+	}
+	return wallet.ParseMultisigScript(input.RedeemScript)
+}
+
+// addPartialSig records sig, replacing an earlier signature by the same key
+func (input *PSBTInput) addPartialSig(sig PartialSignature) {
+	i, found := slices.BinarySearchFunc(input.PartialSigs, sig.PubKey, func(s PartialSignature, pubKey []byte) int {
+		return bytes.Compare(s.PubKey, pubKey)
+	})
+	if found {
+		input.PartialSigs[i] = sig
+		return
+	}
+	input.PartialSigs = slices.Insert(input.PartialSigs, i, sig)
+}
+
+// addDerivation adds origin to derivations kept sorted by public key
+func addDerivation(derivations []wallet.KeyOrigin, origin wallet.KeyOrigin) []wallet.KeyOrigin {
+	i, found := slices.BinarySearchFunc(derivations, origin.PubKey, func(o wallet.KeyOrigin, pubKey []byte) int {
+		return bytes.Compare(o.PubKey, pubKey)
+	})
+	if found {
+		return derivations
+	}
+	return slices.Insert(derivations, i, origin)
+}
+
+// Serialize encodes the PSBT in the layout of BIP 174: the magic, then a
+// global map holding the unsigned transaction and a map per input and per
+// output. Each map is a list of length prefixed keys and values ended by
+// an empty key, the first byte of each key giving its type. The UTXO of an
+// input is left out when its previous transaction is there.
+func (p *PSBT) Serialize() []byte {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+
+	writePair(&buf, []byte{psbtGlobalUnsignedTx}, p.Tx.Serialize())
+	buf.WriteByte(0)
+
+	for _, input := range p.Inputs {
+		if input.PrevTx != nil {
+			writePair(&buf, []byte{psbtInPrevTx}, input.PrevTx.Serialize())
+		} else if input.UTXO != nil {
+			writePair(&buf, []byte{psbtInUTXO}, input.UTXO.Serialize())
+		}
+		for _, sig := range input.PartialSigs {
+			writePair(&buf, append([]byte{psbtInPartialSig}, sig.PubKey...), sig.Signature)
+		}
+		if input.RedeemScript != nil {
+			writePair(&buf, []byte{psbtInRedeemScript}, input.RedeemScript)
+		}
+		writeDerivations(&buf, psbtInDerivation, input.Derivations)
+		if input.FinalScriptSig != nil {
+			writePair(&buf, []byte{psbtInFinalScriptSig}, input.FinalScriptSig)
+		}
+		buf.WriteByte(0)
+	}
+
+	for _, output := range p.Outputs {
+		if output.RedeemScript != nil {
+			writePair(&buf, []byte{psbtOutRedeemScript}, output.RedeemScript)
+		}
+		writeDerivations(&buf, psbtOutDerivation, output.Derivations)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// DeserializePSBT decodes a PSBT encoded by Serialize
+func DeserializePSBT(data []byte) (*PSBT, error) {
+	if !bytes.HasPrefix(data, psbtMagic) {
+		return nil, errors.New("not a PSBT")
+	}
+	r := bytes.NewReader(data[len(psbtMagic):])
+
+	global, err := readMap(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read global map: %w", err)
+	}
+	var tx *types.Transaction
+	for _, pair := range global {
+		if pair.key[0] != psbtGlobalUnsignedTx || len(pair.key) != 1 {
+			return nil, fmt.Errorf("unknown global key type %#x", pair.key[0])
+		}
+		if tx, err = types.DeserializeTransaction(pair.value); err != nil {
+			return nil, fmt.Errorf("failed to decode unsigned transaction: %w", err)
+		}
+	}
+	if tx == nil {
+		return nil, errors.New("PSBT has no unsigned transaction")
+	}
+	p, err := NewPSBT(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range p.Inputs {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input %d: %w", i, err)
+		}
+		input := &p.Inputs[i]
+		for _, pair := range pairs {
+			keyData := pair.key[1:]
+			switch pair.key[0] {
+			case psbtInPrevTx:
+				input.PrevTx, err = types.DeserializeTransaction(pair.value)
+			case psbtInUTXO:
+				input.UTXO, err = types.DeserializeOutput(pair.value)
+			case psbtInPartialSig:
+				input.addPartialSig(PartialSignature{keyData, pair.value})
+			case psbtInRedeemScript:
+				input.RedeemScript = pair.value
+			case psbtInDerivation:
+				var origin wallet.KeyOrigin
+				if origin, err = decodeOrigin(keyData, pair.value); err == nil {
+					input.Derivations = addDerivation(input.Derivations, origin)
+				}
+			case psbtInFinalScriptSig:
+				input.FinalScriptSig = pair.value
+			default:
+				err = fmt.Errorf("unknown key type %#x", pair.key[0])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("input %d: %w", i, err)
+			}
+		}
+		if input.PrevTx != nil {
+			utxo, err := p.prevOutput(i, input.PrevTx)
+			if err != nil {
+				return nil, err
+			}
+			if input.UTXO != nil && !bytes.Equal(input.UTXO.Serialize(), utxo.Serialize()) {
+				return nil, fmt.Errorf("input %d: UTXO does not match the previous transaction", i)
+			}
+			input.UTXO = utxo
+		}
+	}
+
+	for i := range p.Outputs {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output %d: %w", i, err)
+		}
+		output := &p.Outputs[i]
+		for _, pair := range pairs {
+			switch pair.key[0] {
+			case psbtOutRedeemScript:
+				output.RedeemScript = pair.value
+			case psbtOutDerivation:
+				var origin wallet.KeyOrigin
+				if origin, err = decodeOrigin(pair.key[1:], pair.value); err == nil {
+					output.Derivations = addDerivation(output.Derivations, origin)
+				}
+			default:
+				err = fmt.Errorf("unknown key type %#x", pair.key[0])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("output %d: %w", i, err)
+			}
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data after PSBT")
+	}
+	return p, nil
+}
+
+// Base64 returns the serialized PSBT in base64, the form it is passed
+// around in
+func (p *PSBT) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Serialize())
+}
+
+// ParsePSBT decodes a PSBT in base64
+func ParsePSBT(s string) (*PSBT, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return DeserializePSBT(data)
+}
+
+// psbtPair is a key and value of a PSBT map
+type psbtPair struct {
+	key   []byte
+	value []byte
+}
+
+func writePair(w *bytes.Buffer, key, value []byte) {
+	writeVarBytes(w, key)
+	writeVarBytes(w, value)
+}
+
+func writeVarBytes(w *bytes.Buffer, data []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(data)))])
+	w.Write(data)
+}
+
+// writeDerivations writes origins keyed by their public key, with the
+// fingerprint and path as the value
+func writeDerivations(w *bytes.Buffer, keyType byte, origins []wallet.KeyOrigin) {
+	for _, origin := range origins {
+		value := append([]byte{}, origin.Fingerprint[:]...)
+		for _, index := range origin.Path {
+			value = binary.LittleEndian.AppendUint32(value, index)
+		}
+		writePair(w, append([]byte{keyType}, origin.PubKey...), value)
+	}
+}
+
+func decodeOrigin(pubKey, value []byte) (wallet.KeyOrigin, error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return wallet.KeyOrigin{}, errors.New("malformed derivation path")
+	}
+	origin := wallet.KeyOrigin{PubKey: pubKey}
+	copy(origin.Fingerprint[:], value)
+	for i := 4; i < len(value); i += 4 {
+		origin.Path = append(origin.Path, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return origin, nil
+}
+
+// readMap reads the pairs of a map up to its empty key, refusing duplicate
+// keys
+func readMap(r *bytes.Reader) ([]psbtPair, error) {
+	var pairs []psbtPair
+	seen := make(map[string]bool)
+	for {
+		key, err := readVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return pairs, nil
+		}
+		value, err := readVarBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("duplicate key %x", key)
+		}
+		seen[string(key)] = true
+		pairs = append(pairs, psbtPair{key, value})
+	}
+}
+
+func readVarBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, n)
+	io.ReadFull(r, data)
+	return data, nil
+}
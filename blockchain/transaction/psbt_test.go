@@ -0,0 +1,260 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+
+	"blockchain/types"
+	"blockchain/wallet"
+)
+
+// twoOwnerPSBT returns a PSBT spending one output of each of two wallets,
+// with the previous transaction and origin of each input key recorded
+func twoOwnerPSBT(t *testing.T) (*PSBT, []*types.Output, []*wallet.Wallet) {
+	t.Helper()
+	var prevTxs []*types.Transaction
+	var prevOutputs []*types.Output
+	var owners []*wallet.Wallet
+	tx := &types.Transaction{Version: 1}
+	for i := range 2 {
+		w, err := wallet.NewWalletWithMnemonic(wallet.DefaultConfig())
+		if err != nil {
+			t.Fatalf("NewWalletWithMnemonic failed: %v", err)
+		}
+		owners = append(owners, w)
+		prevTx := &types.Transaction{Version: 1, Outputs: []types.Output{{Amount: float64(i + 1), ScriptPubKey: w.Address, ScriptType: "P2PKH", Address: w.Address}}}
+		prevTxs = append(prevTxs, prevTx)
+		prevOutputs = append(prevOutputs, &prevTx.Outputs[0])
+		tx.Inputs = append(tx.Inputs, types.Input{PreviousTxHash: prevTx.Hash(), Sequence: types.MaxRBFSequence})
+	}
+	tx.Outputs = []types.Output{{Amount: 2.9, ScriptPubKey: []byte("payee"), ScriptType: "P2PKH", Address: []byte("payee")}}
+
+	p, err := NewPSBT(tx)
+	if err != nil {
+		t.Fatalf("NewPSBT failed: %v", err)
+	}
+	for i, owner := range owners {
+		origin, err := owner.KeyOrigin(owner.Address)
+		if err != nil {
+			t.Fatalf("KeyOrigin failed: %v", err)
+		}
+		if err := p.SetPrevTx(i, prevTxs[i]); err != nil {
+			t.Fatalf("SetPrevTx failed: %v", err)
+		}
+		p.AddInputDerivation(i, *origin)
+	}
+	return p, prevOutputs, owners
+}
+
+func TestPSBTSerializationRoundTrip(t *testing.T) {
+	p, _, owners := twoOwnerPSBT(t)
+	p.Outputs[0].RedeemScript = []byte{0x51}
+	origin, _ := owners[0].KeyOrigin(owners[0].Address)
+	p.AddOutputDerivation(0, *origin)
+
+	decoded, err := ParsePSBT(p.Base64())
+	if err != nil {
+		t.Fatalf("ParsePSBT failed: %v", err)
+	}
+	if !bytes.Equal(decoded.Serialize(), p.Serialize()) {
+		t.Fatalf("Round trip changed the PSBT")
+	}
+	got := decoded.Inputs[0].Derivations[0]
+	if !bytes.Equal(got.PubKey, origin.PubKey) || got.Fingerprint != origin.Fingerprint || wallet.FormatDerivationPath(got.Path) != "m/44'/1'/0'/0/0" {
+		t.Errorf("Derivation not preserved: %+v", got)
+	}
+	if fee, err := decoded.Fee(); err != nil || fee < 0.0999 || fee > 0.1001 {
+		t.Errorf("Expected a fee of 0.1, got %v (%v)", fee, err)
+	}
+
+	serialized := p.Serialize()
+	for _, bad := range [][]byte{
+		[]byte("psbu\xff"),
+		serialized[:len(serialized)-1],
+		append(serialized, 0),
+	} {
+		if _, err := DeserializePSBT(bad); err == nil {
+			t.Errorf("Expected %x to be refused", bad)
+		}
+	}
+}
+
+func TestPSBTSignCombineFinalize(t *testing.T) {
+	p, prevOutputs, owners := twoOwnerPSBT(t)
+
+	// Each owner signs its own copy, finding its key from the recorded
+	// origin as an offline signer would
+	copies := make([]*PSBT, len(owners))
+	for i, owner := range owners {
+		var err error
+		if copies[i], err = DeserializePSBT(p.Serialize()); err != nil {
+			t.Fatalf("DeserializePSBT failed: %v", err)
+		}
+		origin := &copies[i].Inputs[i].Derivations[0]
+		if _, err := owner.KeyForOrigin(&p.Inputs[1-i].Derivations[0]); !errors.Is(err, wallet.ErrUnknownOrigin) {
+			t.Errorf("Expected the other input's origin to be unknown, got %v", err)
+		}
+		key, err := owner.KeyForOrigin(origin)
+		if err != nil {
+			t.Fatalf("KeyForOrigin failed: %v", err)
+		}
+		if err := copies[i].SignInput(1-i, key); err == nil {
+			t.Errorf("Expected a key to be refused for an input it does not spend")
+		}
+		if err := copies[i].SignInput(i, key); err != nil {
+			t.Fatalf("SignInput(%d) failed: %v", i, err)
+		}
+	}
+
+	if err := copies[0].Finalize(); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Expected ErrIncomplete with one signature, got %v", err)
+	}
+	if _, err := copies[0].Extract(); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Expected extracting an incomplete PSBT to fail, got %v", err)
+	}
+
+	if err := copies[0].Combine(copies[1]); err != nil {
+		t.Fatalf("Combine failed: %v", err)
+	}
+	if err := copies[0].Finalize(); err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+	if len(copies[0].Inputs[1].PartialSigs) != 0 || copies[0].Inputs[1].UTXO == nil || copies[0].Inputs[1].PrevTx == nil {
+		t.Errorf("Expected finalized inputs to keep only their previous transaction, UTXO and scriptSig")
+	}
+	tx, err := copies[0].Extract()
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	for i, prevOutput := range prevOutputs {
+		if err := VerifyInput(tx, i, prevOutput); err != nil {
+			t.Errorf("Input %d does not verify: %v", i, err)
+		}
+	}
+
+	// A copy claiming another UTXO or previous transaction is refused, a
+	// different transaction cannot be combined at all
+	other, _, _ := twoOwnerPSBT(t)
+	conflicting, _ := DeserializePSBT(p.Serialize())
+	conflicting.Inputs[0] = PSBTInput{UTXO: &types.Output{Amount: 5, ScriptPubKey: []byte("x"), ScriptType: "P2PKH", Address: []byte("x")}}
+	if err := p.Combine(conflicting); err == nil {
+		t.Errorf("Expected combining conflicting UTXOs to fail")
+	}
+	conflicting.Inputs[0] = PSBTInput{PrevTx: other.Inputs[0].PrevTx}
+	if err := p.Combine(conflicting); err == nil {
+		t.Errorf("Expected combining a wrong previous transaction to fail")
+	}
+	other.Tx.Outputs[0].Amount = 2.8
+	other.Tx.InvalidateHash()
+	if err := p.Combine(other); err == nil {
+		t.Errorf("Expected combining different transactions to fail")
+	}
+}
+
+func TestInputSignaturesAreCanonical(t *testing.T) {
+	p, prevOutputs, owners := twoOwnerPSBT(t)
+	key, err := owners[0].KeyForOrigin(&p.Inputs[0].Derivations[0])
+	if err != nil {
+		t.Fatalf("KeyForOrigin failed: %v", err)
+	}
+
+	// Signing is deterministic, so both copies carry the same signature
+	copied, _ := DeserializePSBT(p.Serialize())
+	for _, psbt := range []*PSBT{p, copied} {
+		if err := psbt.SignInput(0, key); err != nil {
+			t.Fatalf("SignInput failed: %v", err)
+		}
+	}
+	sig := p.Inputs[0].PartialSigs[0].Signature
+	if !bytes.Equal(sig, copied.Inputs[0].PartialSigs[0].Signature) {
+		t.Errorf("Expected signing twice to give the same signature")
+	}
+
+	// Negating S leaves a mathematically valid signature with another
+	// encoding, which would change the transaction ID
+	r, s, err := wallet.ParseSignature(wallet.S256(), sig)
+	if err != nil {
+		t.Fatalf("ParseSignature failed: %v", err)
+	}
+	highS := new(big.Int).Sub(wallet.S256().Params().N, s)
+	malleated, err := asn1.Marshal(struct{ R, S *big.Int }{r, highS})
+	if err != nil {
+		t.Fatalf("asn1.Marshal failed: %v", err)
+	}
+	if err := wallet.CheckSignature(&key.PublicKey, SignatureHash(p.Tx, 0, prevOutputs[0]), malleated); !errors.Is(err, wallet.ErrNonCanonicalSignature) {
+		t.Fatalf("Expected the high S signature to be non-canonical, got %v", err)
+	}
+
+	tx := *p.Tx
+	tx.Inputs = append([]types.Input(nil), p.Tx.Inputs...)
+	var script bytes.Buffer
+	pushData(&script, malleated)
+	pushData(&script, wallet.SerializePublicKey(&key.PublicKey))
+	tx.Inputs[0].ScriptSig = script.Bytes()
+	tx.InvalidateHash()
+	if err := VerifyInput(&tx, 0, prevOutputs[0]); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected the high S input to be refused, got %v", err)
+	}
+
+	script.Reset()
+	pushData(&script, sig)
+	pushData(&script, wallet.SerializePublicKey(&key.PublicKey))
+	tx.Inputs[0].ScriptSig = script.Bytes()
+	tx.InvalidateHash()
+	if err := VerifyInput(&tx, 0, prevOutputs[0]); err != nil {
+		t.Errorf("Canonical input refused: %v", err)
+	}
+}
+
+func TestPSBTSignsOnlyThePreviousTransactionOutput(t *testing.T) {
+	p, _, owners := twoOwnerPSBT(t)
+	key, err := owners[0].KeyForOrigin(&p.Inputs[0].Derivations[0])
+	if err != nil {
+		t.Fatalf("KeyForOrigin failed: %v", err)
+	}
+	prevTx := p.Inputs[0].PrevTx
+
+	// A UTXO alone, as a watch-only coordinator could lie about, is not
+	// signed
+	bare, _ := DeserializePSBT(p.Serialize())
+	bare.Inputs[0].PrevTx = nil
+	if err := bare.SignInput(0, key); err == nil {
+		t.Errorf("Expected an input without its previous transaction to be refused")
+	}
+
+	// An inflated amount disagrees with the previous transaction
+	inflated, _ := DeserializePSBT(p.Serialize())
+	utxo := *inflated.Inputs[0].UTXO
+	utxo.Amount = 100
+	inflated.Inputs[0].UTXO = &utxo
+	if err := inflated.SignInput(0, key); err == nil {
+		t.Errorf("Expected a UTXO differing from the previous transaction to be refused")
+	}
+	if fee, err := inflated.Fee(); err != nil || fee < 0.0999 || fee > 0.1001 {
+		t.Errorf("Expected the fee from the previous transactions, got %v (%v)", fee, err)
+	}
+
+	// Another transaction than the one spent is refused however it
+	// arrives
+	if err := p.SetPrevTx(0, p.Inputs[1].PrevTx); err == nil {
+		t.Errorf("Expected SetPrevTx to refuse another transaction")
+	}
+	swapped, _ := DeserializePSBT(p.Serialize())
+	swapped.Inputs[0].PrevTx = p.Inputs[1].PrevTx
+	if _, err := DeserializePSBT(swapped.Serialize()); err == nil {
+		t.Errorf("Expected a PSBT with a wrong previous transaction to be refused")
+	}
+	if err := swapped.SignInput(0, key); err == nil {
+		t.Errorf("Expected signing with a wrong previous transaction to fail")
+	}
+
+	if p.Inputs[0].PrevTx != prevTx {
+		t.Fatalf("SetPrevTx replaced the previous transaction on failure")
+	}
+	if err := p.SignInput(0, key); err != nil {
+		t.Errorf("SignInput failed: %v", err)
+	}
+}
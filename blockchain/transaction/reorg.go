@@ -0,0 +1,68 @@
+package transaction
+
+import "blockchain/types"
+
+// BlockConnected updates the pool for a block added to the chain: its
+// transactions leave the pool, along with any pooled transaction spending
+// the same outputs. Orphans waiting for them are accepted and returned so
+// that they can be relayed. The fee estimator, if any, records how long
+// the block's transactions waited.
+func (tp *TransactionPool) BlockConnected(block *types.Block) []types.Transaction {
+	tp.mu.Lock()
+	estimator := tp.estimator
+	tp.mu.Unlock()
+	if estimator != nil {
+		// Confirmations are recorded before the transactions leave the pool
+		estimator.ProcessBlock(block)
+	}
+
+	var txs []types.Transaction
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			txs = append(txs, tx)
+		}
+	}
+	return tp.RemoveTransactions(txs)
+}
+
+// BlockDisconnected returns the transactions of a block removed from the
+// chain to the pool, revalidating each of them, and returns those accepted.
+// The UTXO source must already reflect the disconnection. Pooled
+// transactions left spending outputs that no longer exist, such as the
+// coinbase of the block, are evicted with their descendants.
+//
+// During a reorg, blocks are disconnected from the tip down, then the new
+// branch is connected with BlockConnected.
+func (tp *TransactionPool) BlockDisconnected(block *types.Block) []types.Transaction {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	var restored []types.Transaction
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		if err := tp.add(tx); err == nil {
+			restored = append(restored, tx)
+		}
+	}
+	tp.removeUnspendable()
+
+	return append(restored, tp.processOrphans(restored)...)
+}
+
+// removeUnspendable evicts the pooled transactions spending outputs found
+// neither in the pool nor in the UTXO set
+func (tp *TransactionPool) removeUnspendable() {
+	for _, entry := range append([]*TxEntry(nil), tp.byFeeRate...) {
+		if _, ok := tp.entries[string(entry.Hash)]; !ok {
+			continue
+		}
+		for _, input := range entry.Tx.Inputs {
+			if _, err := tp.lookupOutput(input.PreviousTxHash, input.OutputIndex); err != nil {
+				tp.remove(string(entry.Hash), true)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package transaction
+
+import (
+	"blockchain/types"
+	"testing"
+)
+
+func TestBlockConnectDisconnect(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	parent := spend(utxos.fund("a", 10), 0, 9.9)
+	child := spend(parent.Hash(), 0, 9.8)
+	other := spend(utxos.fund("b", 10), 0, 9)
+	for _, tx := range []types.Transaction{parent, child, other} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	// A block from a peer confirms the parent and spends "b" elsewhere
+	coinbase := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput([]byte("height 1"))},
+		Outputs: []types.Output{testOutput(50)},
+	}
+	conflict := spend([]byte("b"), 0, 9.5)
+	block := &types.Block{Index: 1, Transactions: []types.Transaction{coinbase, parent, conflict}}
+
+	connect := func() {
+		delete(utxos, outpoint{"a", 0})
+		delete(utxos, outpoint{"b", 0})
+		for _, tx := range block.Transactions {
+			utxos[outpoint{string(tx.Hash()), 0}] = &tx.Outputs[0]
+		}
+	}
+	connect()
+	pool.BlockConnected(block)
+
+	if pool.Count() != 1 {
+		t.Fatalf("Expected only the child to remain, got %d", pool.Count())
+	}
+	if _, ok := pool.GetTransaction(child.Hash()); !ok {
+		t.Fatalf("Expected the child of a confirmed transaction to remain")
+	}
+
+	// A pooled transaction spending the coinbase
+	coinbaseSpend := spend(coinbase.Hash(), 0, 49)
+	if err := pool.AddTransaction(coinbaseSpend); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+
+	// The block is disconnected by a reorg
+	utxos.fund("a", 10)
+	utxos.fund("b", 10)
+	for _, tx := range block.Transactions {
+		delete(utxos, outpoint{string(tx.Hash()), 0})
+	}
+	restored := pool.BlockDisconnected(block)
+
+	if len(restored) != 2 {
+		t.Errorf("Expected 2 transactions returned to the pool, got %d", len(restored))
+	}
+	if _, ok := pool.GetTransaction(coinbaseSpend.Hash()); ok {
+		t.Errorf("Expected the spend of a disconnected coinbase to be evicted")
+	}
+	if descendants := pool.GetDescendants(parent.Hash()); len(descendants) != 1 {
+		t.Errorf("Expected the restored parent to be linked to its child, got %d descendants", len(descendants))
+	}
+
+	// Connecting the block again on the new branch leaves only the child
+	connect()
+	pool.BlockConnected(block)
+	if pool.Count() != 1 {
+		t.Errorf("Expected only the child to remain, got %d", pool.Count())
+	}
+}
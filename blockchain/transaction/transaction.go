@@ -1,11 +1,287 @@
 package transaction
 
 import (
-/*	"crypto/ecdsa"
-	"crypto/sha256"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"blockchain/wallet"
 	"blockchain/types"
-*/
+	"blockchain/wallet"
+)
+
+// ErrBadSignature is returned when an input's scriptSig does not unlock the
+// output it spends
+var ErrBadSignature = errors.New("input signature is invalid")
+
+// MaxScriptSigSize is the largest scriptSig SignInput produces: a canonical
+// DER signature and a compressed public key, each prefixed by its length
+const MaxScriptSigSize = 1 + wallet.MaxSignatureSize + 1 + 33
+
+// MultisigScriptSigSize returns the largest scriptSig spending a P2SH
+// output of a multisig redeem script: OP_0, the required DER signatures and
+// the pushed script
+func MultisigScriptSigSize(redeemScript []byte) int {
+	m, _, err := wallet.ParseMultisigScript(redeemScript)
+	if err != nil {
+		return 0
+	}
+	var script bytes.Buffer
+	pushData(&script, redeemScript)
+	return 1 + m*(1+wallet.MaxSignatureSize) + script.Len()
+}
+
+// MaxScriptElementSize is the largest item a script may push, which bounds
+// the size of redeem scripts
+const MaxScriptElementSize = 520
+
+// Push opcodes for items too long for a single length byte
+const (
+	opPushData1 = 0x4c
+	opPushData2 = 0x4d
 )
+
+// SignatureHash returns the digest signed for input index: the hash of the
+// transaction with every scriptSig cleared except that of the signed input,
+// which is replaced by the script of the output it spends
+func SignatureHash(tx *types.Transaction, index int, prevOutput *types.Output) []byte {
+	return signatureHash(tx, index, prevOutput.ScriptPubKey)
+}
+
+// signatureHash returns the digest signed for input index with scriptCode
+// in place of its scriptSig: the script of the spent output, or the redeem
+// script of a P2SH output
+func signatureHash(tx *types.Transaction, index int, scriptCode []byte) []byte {
+	signed := types.Transaction{
+		ID:       tx.ID,
+		Version:  tx.Version,
+		Locktime: tx.Locktime,
+		Inputs:   make([]types.Input, len(tx.Inputs)),
+		Outputs:  tx.Outputs,
+	}
+	for i, input := range tx.Inputs {
+		input.ScriptSig = nil
+		if i == index {
+			input.ScriptSig = scriptCode
+		}
+		signed.Inputs[i] = input
+	}
+	return signed.Hash()
+}
+
+// SignInput signs input index with key, setting its scriptSig to the
+// signature followed by the public key
+func SignInput(tx *types.Transaction, index int, prevOutput *types.Output, key *ecdsa.PrivateKey) error {
+	if index < 0 || index >= len(tx.Inputs) {
+		return fmt.Errorf("no input %d", index)
+	}
+
+	sig, err := signatureFor(tx, index, prevOutput.ScriptPubKey, key)
+	if err != nil {
+		return err
+	}
+	pubKey := wallet.SerializePublicKey(&key.PublicKey)
+
+	var script bytes.Buffer
+	pushData(&script, sig)
+	pushData(&script, pubKey)
+	tx.Inputs[index].ScriptSig = script.Bytes()
+	tx.InvalidateHash()
+	return nil
+}
+
+// signatureFor returns the canonical DER signature by key of input index,
+// the same every time the input is signed
+func signatureFor(tx *types.Transaction, index int, scriptCode []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	sig, err := wallet.Sign(key, signatureHash(tx, index, scriptCode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign input %d: %w", index, err)
+	}
+	return sig, nil
+}
+
+// ErrUnsupportedScript is returned for outputs VerifyInput cannot check a
+// spend of, which could never be spent
+var ErrUnsupportedScript = errors.New("output script type cannot be spent")
+
+// CheckOutputScript refuses an output VerifyInput cannot verify a spend
+// of: only P2PKH and P2SH outputs of a 20 byte hash are spendable, witness
+// programs are not
+func CheckOutputScript(output *types.Output) error {
+	if output.ScriptType != wallet.ScriptTypeP2PKH && output.ScriptType != wallet.ScriptTypeP2SH {
+		return fmt.Errorf("%w: %q", ErrUnsupportedScript, output.ScriptType)
+	}
+	if len(output.Address) != wallet.Hash160Size {
+		return fmt.Errorf("%w: %s of a %d byte hash", ErrUnsupportedScript, output.ScriptType, len(output.Address))
+	}
+	return nil
+}
+
+// CheckOutputScripts applies CheckOutputScript to every output of tx
+func CheckOutputScripts(tx *types.Transaction) error {
+	for i := range tx.Outputs {
+		if err := CheckOutputScript(&tx.Outputs[i]); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// VerifyInput checks that the scriptSig of input index carries a valid
+// signature by the key paid to by prevOutput, or for P2SH outputs enough
+// signatures for the multisig redeem script it hashes to
+func VerifyInput(tx *types.Transaction, index int, prevOutput *types.Output) error {
+	if index < 0 || index >= len(tx.Inputs) {
+		return fmt.Errorf("no input %d", index)
+	}
+	if prevOutput.ScriptType == wallet.ScriptTypeP2SH {
+		return verifyMultisigInput(tx, index, prevOutput)
+	}
+
+	script := bytes.NewReader(tx.Inputs[index].ScriptSig)
+	sig, err := readPush(script)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	pubKeyBytes, err := readPush(script)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	// Signatures do not cover scriptSigs, so anything more would let
+	// anyone change the transaction's hash without invalidating it
+	if script.Len() != 0 {
+		return fmt.Errorf("%w: %d bytes after the public key", ErrBadSignature, script.Len())
+	}
+
+	pubKey, err := wallet.ParsePublicKey(pubKeyBytes)
+	if err != nil {
+		return fmt.Errorf("%w: malformed public key", ErrBadSignature)
+	}
+
+	if !bytes.Equal(wallet.AddressFromPublicKey(pubKey, true), prevOutput.Address) {
+		return fmt.Errorf("%w: public key does not match the spent output", ErrBadSignature)
+	}
+	if err := wallet.CheckSignature(pubKey, SignatureHash(tx, index, prevOutput), sig); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return nil
+}
+
+// verifyMultisigInput checks the scriptSig of an input spending a P2SH
+// output: OP_0, the signatures and the redeem script. As with
+// OP_CHECKMULTISIG the signatures must follow the order of their keys in
+// the script.
+func verifyMultisigInput(tx *types.Transaction, index int, prevOutput *types.Output) error {
+	items, err := readPushes(tx.Inputs[index].ScriptSig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if len(items) < 2 || len(items[0]) != 0 {
+		return fmt.Errorf("%w: malformed multisig scriptSig", ErrBadSignature)
+	}
+	redeemScript := items[len(items)-1]
+	if !bytes.Equal(wallet.Hash160(redeemScript), prevOutput.Address) {
+		return fmt.Errorf("%w: redeem script does not match the spent output", ErrBadSignature)
+	}
+	m, pubKeys, err := wallet.ParseMultisigScript(redeemScript)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	sigs := items[1 : len(items)-1]
+	if len(sigs) != m {
+		return fmt.Errorf("%w: %d signatures for a %d-of-%d script", ErrBadSignature, len(sigs), m, len(pubKeys))
+	}
+
+	// Non-canonical signatures are refused up front rather than left to
+	// match no key
+	for _, sig := range sigs {
+		if _, _, err := wallet.ParseSignature(wallet.S256(), sig); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadSignature, err)
+		}
+	}
+
+	hash := signatureHash(tx, index, redeemScript)
+	next := 0
+	for _, sig := range sigs {
+		for next < len(pubKeys) && !verifySignature(pubKeys[next], hash, sig) {
+			next++
+		}
+		if next == len(pubKeys) {
+			return ErrBadSignature
+		}
+		next++
+	}
+	return nil
+}
+
+// verifySignature reports whether sig is a valid signature of hash by the
+// serialized public key pubKey
+func verifySignature(pubKey, hash, sig []byte) bool {
+	key, err := wallet.ParsePublicKey(pubKey)
+	return err == nil && wallet.CheckSignature(key, hash, sig) == nil
+}
+
+// pushData appends data to a script as a push: short items are prefixed by
+// their length, longer ones by OP_PUSHDATA1 or OP_PUSHDATA2 and then their
+// length, and an empty item is OP_0
+func pushData(script *bytes.Buffer, data []byte) {
+	switch {
+	case len(data) < opPushData1:
+		script.WriteByte(byte(len(data)))
+	case len(data) <= 0xff:
+		script.WriteByte(opPushData1)
+		script.WriteByte(byte(len(data)))
+	default:
+		script.WriteByte(opPushData2)
+		binary.Write(script, binary.LittleEndian, uint16(len(data)))
+	}
+	script.Write(data)
+}
+
+// readPush reads the next pushed item of a script
+func readPush(script *bytes.Reader) ([]byte, error) {
+	op, err := script.ReadByte()
+	if err != nil {
+		return nil, errors.New("truncated script")
+	}
+	n := int(op)
+	switch {
+	case op == opPushData1:
+		length, err := script.ReadByte()
+		if err != nil {
+			return nil, errors.New("truncated script")
+		}
+		n = int(length)
+	case op == opPushData2:
+		var length uint16
+		if err := binary.Read(script, binary.LittleEndian, &length); err != nil {
+			return nil, errors.New("truncated script")
+		}
+		n = int(length)
+	case op > opPushData2:
+		return nil, fmt.Errorf("unexpected opcode %#x in scriptSig", op)
+	}
+	if n > MaxScriptElementSize {
+		return nil, fmt.Errorf("push of %d bytes exceeds %d", n, MaxScriptElementSize)
+	}
+	if n > script.Len() {
+		return nil, errors.New("truncated script")
+	}
+	data := make([]byte, n)
+	script.Read(data)
+	return data, nil
+}
+
+// readPushes reads every item of a push-only script
+func readPushes(script []byte) ([][]byte, error) {
+	r := bytes.NewReader(script)
+	var items [][]byte
+	for r.Len() > 0 {
+		item, err := readPush(r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
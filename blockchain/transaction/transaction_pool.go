@@ -1,43 +1,751 @@
 package transaction
 
 import (
+	"blockchain/consensus"
 	"blockchain/types"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
-// TransactionPool stores unconfirmed transactions.
+// Errors returned when a transaction is refused by the pool
+var (
+	ErrAlreadyInPool = errors.New("transaction already in pool")
+	ErrCoinbase      = errors.New("coinbase transactions cannot enter the pool")
+	ErrMissingInputs = errors.New("transaction spends unknown outputs")
+	ErrConflict      = errors.New("transaction spends outputs already spent in the pool")
+	ErrFeeTooLow     = errors.New("transaction fee rate is below the pool minimum")
+	ErrPoolFull      = errors.New("pool is full and the fee rate is too low to evict others")
+	ErrPackageLimit  = errors.New("transaction exceeds the unconfirmed chain limits")
+	ErrReplacement   = errors.New("replacement rejected")
+	ErrImmature      = errors.New("transaction spends a coinbase output before it matures")
+)
+
+// UTXOSource looks up confirmed unspent outputs. It is satisfied by the
+// chain database.
+type UTXOSource interface {
+	GetUTXO(txHash []byte, index uint64) (*types.Output, error)
+	// GetUTXOOrigin returns the height of the block that created an
+	// unspent output and whether it is a coinbase output
+	GetUTXOOrigin(txHash []byte, index uint64) (int, bool, error)
+	// GetBestHeight returns the height of the chain tip
+	GetBestHeight() (int, error)
+}
+
+// PoolConfig holds the limits applied by a TransactionPool
+type PoolConfig struct {
+	// MaxSize is the total serialized size of pooled transactions, in bytes
+	MaxSize uint64
+	// MinFeeRate is the lowest fee per byte accepted
+	MinFeeRate float64
+	// MaxAncestors and MaxAncestorSize limit the unconfirmed transactions a
+	// pooled transaction depends on, itself included
+	MaxAncestors    int
+	MaxAncestorSize uint64
+	// MaxDescendants and MaxDescendantSize limit the unconfirmed
+	// transactions depending on a pooled transaction, itself included
+	MaxDescendants    int
+	MaxDescendantSize uint64
+	// IncrementalFeeRate is the fee per byte a replacement must add on top
+	// of the fees of the transactions it replaces
+	IncrementalFeeRate float64
+	// MaxReplacements limits how many transactions, descendants included,
+	// a single replacement may evict
+	MaxReplacements int
+	// MaxOrphans limits the transactions held while their parents are
+	// unknown, MaxOrphansPerPeer how many of them one peer may supply
+	MaxOrphans        int
+	MaxOrphansPerPeer int
+	// MaxOrphanSize is the largest orphan kept, in bytes
+	MaxOrphanSize uint64
+	// OrphanExpiry is how long an orphan waits for its parents
+	OrphanExpiry time.Duration
+}
+
+// DefaultPoolConfig returns the default pool limits
+func DefaultPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		MaxSize:            300 << 20,
+		MinFeeRate:         0,
+		MaxAncestors:       25,
+		MaxAncestorSize:    101000,
+		MaxDescendants:     25,
+		MaxDescendantSize:  101000,
+		IncrementalFeeRate: 0.00000001,
+		MaxReplacements:    100,
+		MaxOrphans:         100,
+		MaxOrphansPerPeer:  25,
+		MaxOrphanSize:      100000,
+		OrphanExpiry:       20 * time.Minute,
+	}
+}
+
+// TxEntry is a transaction held in the pool together with its fee data
+type TxEntry struct {
+	Tx      types.Transaction
+	Hash    []byte
+	Fee     float64
+	Size    uint64
+	FeeRate float64
+	Added   time.Time
+
+	// Pooled transactions this one spends, and those spending it
+	parents  map[string]*TxEntry
+	children map[string]*TxEntry
+}
+
+// outpoint identifies a transaction output
+type outpoint struct {
+	hash  string
+	index uint64
+}
+
+// TransactionPool stores unconfirmed transactions, indexed by hash and
+// ordered by fee rate.
 type TransactionPool struct {
-	mu           sync.Mutex
-	transactions []types.Transaction
+	mu     sync.Mutex
+	config PoolConfig
+	utxos  UTXOSource
+
+	entries map[string]*TxEntry
+	// byFeeRate holds every entry, highest fee rate first
+	byFeeRate []*TxEntry
+	// spends maps each outpoint spent by a pooled transaction to its hash
+	spends map[outpoint]string
+	size   uint64
+
+	orphans *orphanPool
+	// estimator, when set, follows pooled transactions until confirmed
+	estimator *FeeEstimator
 }
 
-// NewTransactionPool initializes a new transaction pool.
-func NewTransactionPool() *TransactionPool {
+// NewTransactionPool initializes a new transaction pool. Inputs are looked up
+// in utxos, or among the outputs of other pooled transactions.
+func NewTransactionPool(config *PoolConfig, utxos UTXOSource) *TransactionPool {
+	if config == nil {
+		config = DefaultPoolConfig()
+	}
 	return &TransactionPool{
-		transactions: []types.Transaction{},
+		config:  *config,
+		utxos:   utxos,
+		entries: make(map[string]*TxEntry),
+		spends:  make(map[outpoint]string),
+		orphans: newOrphanPool(),
 	}
 }
 
-// AddTransaction adds a transaction to the pool.
-func (tp *TransactionPool) AddTransaction(tx types.Transaction) {
+// AddTransaction validates a transaction, signatures included, against the
+// pool and the UTXO set and adds it, evicting the lowest fee rate
+// transactions if the pool is full. A transaction spending outputs already
+// spent in the pool is accepted only as a replacement, following the
+// replace-by-fee rules.
+func (tp *TransactionPool) AddTransaction(tx types.Transaction) error {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
-	tp.transactions = append(tp.transactions, tx)
+	if err := tp.add(tx); err != nil {
+		return err
+	}
+	tp.track(tx)
+	return nil
 }
 
-// GetTransactions retrieves all pending transactions and clears the pool.
-func (tp *TransactionPool) GetTransactions() []types.Transaction {
+// SetFeeEstimator makes the pool report the transactions it accepts and
+// the blocks it is told about to fe
+func (tp *TransactionPool) SetFeeEstimator(fe *FeeEstimator) {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
+	tp.estimator = fe
+}
+
+// track hands a newly accepted transaction to the fee estimator
+func (tp *TransactionPool) track(tx types.Transaction) {
+	if tp.estimator == nil {
+		return
+	}
+	if entry, ok := tp.entries[string(tx.Hash())]; ok {
+		tp.estimator.TrackTransaction(entry.Hash, entry.FeeRate)
+	}
+}
 
-	pending := tp.transactions
-	tp.transactions = []types.Transaction{} // Clear the pool
-	return pending
+// add is AddTransaction with the pool already locked
+func (tp *TransactionPool) add(tx types.Transaction) error {
+	entry, err := tp.newEntry(tx)
+	if err != nil {
+		return err
+	}
+
+	conflicts := make(map[string]*TxEntry)
+	for _, input := range entry.Tx.Inputs {
+		if spender, spent := tp.spends[outpoint{string(input.PreviousTxHash), input.OutputIndex}]; spent {
+			conflicts[spender] = tp.entries[spender]
+		}
+	}
+	if len(conflicts) > 0 {
+		if err := tp.checkReplacement(entry, conflicts); err != nil {
+			return err
+		}
+	}
+
+	if err := tp.checkPackageLimits(entry); err != nil {
+		return err
+	}
+
+	for hash := range conflicts {
+		tp.remove(hash, true)
+	}
+	tp.insert(entry)
+	tp.trim()
+
+	if _, ok := tp.entries[string(entry.Hash)]; !ok {
+		return ErrPoolFull
+	}
+	return nil
+}
+
+// newEntry checks tx and computes its fee from the outputs it spends
+func (tp *TransactionPool) newEntry(tx types.Transaction) (*TxEntry, error) {
+	if tx.IsCoinbase() {
+		return nil, ErrCoinbase
+	}
+	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+		return nil, errors.New("transaction must have inputs and outputs")
+	}
+
+	hash := tx.Hash()
+	if _, ok := tp.entries[string(hash)]; ok {
+		return nil, ErrAlreadyInPool
+	}
+
+	var in, out float64
+	seen := make(map[outpoint]bool)
+	for i, input := range tx.Inputs {
+		op := outpoint{string(input.PreviousTxHash), input.OutputIndex}
+		if seen[op] {
+			return nil, errors.New("transaction spends the same output twice")
+		}
+		seen[op] = true
+
+		output, err := tp.lookupOutput(input.PreviousTxHash, input.OutputIndex)
+		if err != nil {
+			return nil, err
+		}
+		if err := tp.checkMaturity(input); err != nil {
+			return nil, err
+		}
+		// Blocks are only valid with signed inputs, so the pool must not
+		// offer unsigned ones to miners
+		if err := VerifyInput(&tx, i, output); err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		in += output.Amount
+	}
+	if err := CheckOutputScripts(&tx); err != nil {
+		return nil, err
+	}
+	for _, output := range tx.Outputs {
+		if output.Amount < 0 {
+			return nil, errors.New("transaction has a negative output")
+		}
+		out += output.Amount
+	}
+	if out > in {
+		return nil, fmt.Errorf("outputs (%f) exceed inputs (%f)", out, in)
+	}
+
+	size := uint64(len(tx.Serialize()))
+	entry := &TxEntry{
+		Tx:       tx,
+		Hash:     hash,
+		Fee:      in - out,
+		Size:     size,
+		FeeRate:  (in - out) / float64(size),
+		Added:    time.Now(),
+		parents:  make(map[string]*TxEntry),
+		children: make(map[string]*TxEntry),
+	}
+	if entry.FeeRate < tp.config.MinFeeRate {
+		return nil, ErrFeeTooLow
+	}
+	return entry, nil
+}
+
+// lookupOutput finds a spendable output among pooled transactions, then in
+// the UTXO set
+func (tp *TransactionPool) lookupOutput(hash []byte, index uint64) (*types.Output, error) {
+	if parent, ok := tp.entries[string(hash)]; ok {
+		if index >= uint64(len(parent.Tx.Outputs)) {
+			return nil, ErrMissingInputs
+		}
+		return &parent.Tx.Outputs[index], nil
+	}
+
+	if tp.utxos == nil {
+		return nil, ErrMissingInputs
+	}
+	output, err := tp.utxos.GetUTXO(hash, index)
+	if err != nil || output == nil {
+		return nil, ErrMissingInputs
+	}
+	return output, nil
+}
+
+// checkMaturity refuses an input spending a coinbase output that could not
+// be spent in the next block
+func (tp *TransactionPool) checkMaturity(input types.Input) error {
+	if _, ok := tp.entries[string(input.PreviousTxHash)]; ok || tp.utxos == nil {
+		return nil
+	}
+	height, coinbase, err := tp.utxos.GetUTXOOrigin(input.PreviousTxHash, input.OutputIndex)
+	if err != nil {
+		return ErrMissingInputs
+	}
+	if !coinbase {
+		return nil
+	}
+	best, err := tp.utxos.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	if !consensus.CoinbaseMature(height, best+1) {
+		return ErrImmature
+	}
+	return nil
+}
+
+// checkReplacement applies the replace-by-fee rules to entry, which spends
+// outputs already spent by conflicts. Every conflict must signal
+// replaceability, and entry must pay a higher fee rate than each of them
+// and more in fees than everything it evicts, by the incremental fee rate.
+func (tp *TransactionPool) checkReplacement(entry *TxEntry, conflicts map[string]*TxEntry) error {
+	replaced := make(map[string]*TxEntry)
+	for hash, conflict := range conflicts {
+		if !tp.replaceable(conflict) {
+			return ErrConflict
+		}
+		if entry.FeeRate <= conflict.FeeRate {
+			return fmt.Errorf("%w: fee rate %g does not exceed %g of %x", ErrReplacement, entry.FeeRate, conflict.FeeRate, conflict.Hash)
+		}
+		replaced[hash] = conflict
+		for h, descendant := range tp.descendants(conflict) {
+			replaced[h] = descendant
+		}
+	}
+	if len(replaced) > tp.config.MaxReplacements {
+		return fmt.Errorf("%w: would evict %d transactions", ErrReplacement, len(replaced))
+	}
+
+	// The replacement may only spend unconfirmed outputs that the
+	// transactions it replaces were already spending
+	parents := make(map[string]bool)
+	for _, conflict := range conflicts {
+		for hash := range conflict.parents {
+			parents[hash] = true
+		}
+	}
+	for _, input := range entry.Tx.Inputs {
+		hash := string(input.PreviousTxHash)
+		if _, ok := replaced[hash]; ok {
+			return fmt.Errorf("%w: spends a transaction it replaces", ErrReplacement)
+		}
+		if _, pooled := tp.entries[hash]; pooled && !parents[hash] {
+			return fmt.Errorf("%w: spends a new unconfirmed output", ErrReplacement)
+		}
+	}
+
+	var replacedFees float64
+	for _, e := range replaced {
+		replacedFees += e.Fee
+	}
+	if required := replacedFees + tp.config.IncrementalFeeRate*float64(entry.Size); entry.Fee <= replacedFees || entry.Fee < required {
+		return fmt.Errorf("%w: fee %g is below the required %g", ErrReplacement, entry.Fee, required)
+	}
+	return nil
+}
+
+// replaceable reports whether entry or any of its pooled ancestors signals
+// replace-by-fee
+func (tp *TransactionPool) replaceable(entry *TxEntry) bool {
+	if entry.Tx.SignalsReplacement() {
+		return true
+	}
+	for _, ancestor := range tp.ancestors(entry) {
+		if ancestor.Tx.SignalsReplacement() {
+			return true
+		}
+	}
+	return false
+}
+
+// BumpFee returns a copy of the pooled transaction with the given hash
+// paying at least feeRate, and enough to replace it and its descendants.
+// The extra fee is taken from output changeIndex. The inputs must be signed
+// again before the replacement is added to the pool.
+func (tp *TransactionPool) BumpFee(hash []byte, feeRate float64, changeIndex int) (*types.Transaction, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	entry, ok := tp.entries[string(hash)]
+	if !ok {
+		return nil, fmt.Errorf("transaction %x is not in the pool", hash)
+	}
+	if !tp.replaceable(entry) {
+		return nil, fmt.Errorf("transaction %x does not signal replace-by-fee", hash)
+	}
+	if changeIndex < 0 || changeIndex >= len(entry.Tx.Outputs) {
+		return nil, fmt.Errorf("no output %d", changeIndex)
+	}
+
+	// Signatures vary in length by a byte or two once the inputs are
+	// signed again
+	size := float64(entry.Size + 2*uint64(len(entry.Tx.Inputs)))
+
+	replacedFees := entry.Fee
+	for _, descendant := range tp.descendants(entry) {
+		replacedFees += descendant.Fee
+	}
+	fee := max(
+		feeRate*size,
+		replacedFees+tp.config.IncrementalFeeRate*size,
+		(entry.FeeRate+tp.config.IncrementalFeeRate)*size,
+	)
+
+	bumped := types.Transaction{
+		ID:       entry.Tx.ID,
+		Version:  entry.Tx.Version,
+		Locktime: entry.Tx.Locktime,
+		Inputs:   append([]types.Input(nil), entry.Tx.Inputs...),
+		Outputs:  append([]types.Output(nil), entry.Tx.Outputs...),
+	}
+	change := &bumped.Outputs[changeIndex]
+	change.Amount -= fee - entry.Fee
+	if change.Amount < 0 {
+		return nil, fmt.Errorf("output %d cannot cover the extra fee of %f", changeIndex, fee-entry.Fee)
+	}
+	return &bumped, nil
+}
+
+// checkPackageLimits refuses entry if it would have too many unconfirmed
+// ancestors, or give any of them too many descendants
+func (tp *TransactionPool) checkPackageLimits(entry *TxEntry) error {
+	ancestors := make(map[string]*TxEntry)
+	for _, input := range entry.Tx.Inputs {
+		if parent, ok := tp.entries[string(input.PreviousTxHash)]; ok {
+			ancestors[string(parent.Hash)] = parent
+			collect(parent, ancestors, func(e *TxEntry) map[string]*TxEntry { return e.parents })
+		}
+	}
+
+	count, size := 1, entry.Size
+	for _, ancestor := range ancestors {
+		count++
+		size += ancestor.Size
+	}
+	if count > tp.config.MaxAncestors || size > tp.config.MaxAncestorSize {
+		return fmt.Errorf("%w: %d ancestors of %d bytes", ErrPackageLimit, count, size)
+	}
+
+	for _, ancestor := range ancestors {
+		count, size := 2, ancestor.Size+entry.Size
+		for _, descendant := range tp.descendants(ancestor) {
+			count++
+			size += descendant.Size
+		}
+		if count > tp.config.MaxDescendants || size > tp.config.MaxDescendantSize {
+			return fmt.Errorf("%w: %x would have %d descendants of %d bytes", ErrPackageLimit, ancestor.Hash, count, size)
+		}
+	}
+	return nil
+}
+
+// collect adds to set every entry reachable from entry through next
+func collect(entry *TxEntry, set map[string]*TxEntry, next func(*TxEntry) map[string]*TxEntry) {
+	for hash, e := range next(entry) {
+		if _, ok := set[hash]; !ok {
+			set[hash] = e
+			collect(e, set, next)
+		}
+	}
+}
+
+// ancestors returns the pooled transactions entry depends on
+func (tp *TransactionPool) ancestors(entry *TxEntry) map[string]*TxEntry {
+	set := make(map[string]*TxEntry)
+	collect(entry, set, func(e *TxEntry) map[string]*TxEntry { return e.parents })
+	return set
+}
+
+// descendants returns the pooled transactions depending on entry
+func (tp *TransactionPool) descendants(entry *TxEntry) map[string]*TxEntry {
+	set := make(map[string]*TxEntry)
+	collect(entry, set, func(e *TxEntry) map[string]*TxEntry { return e.children })
+	return set
+}
+
+// insert adds entry to every index
+func (tp *TransactionPool) insert(entry *TxEntry) {
+	tp.entries[string(entry.Hash)] = entry
+	for _, input := range entry.Tx.Inputs {
+		tp.spends[outpoint{string(input.PreviousTxHash), input.OutputIndex}] = string(entry.Hash)
+		if parent, ok := tp.entries[string(input.PreviousTxHash)]; ok {
+			entry.parents[string(parent.Hash)] = parent
+			parent.children[string(entry.Hash)] = entry
+		}
+	}
+	// A transaction returned to the pool by a reorg may already be spent
+	// by pooled ones
+	for index := range entry.Tx.Outputs {
+		if spender, ok := tp.spends[outpoint{string(entry.Hash), uint64(index)}]; ok {
+			child := tp.entries[spender]
+			entry.children[spender] = child
+			child.parents[string(entry.Hash)] = entry
+		}
+	}
+
+	i := sort.Search(len(tp.byFeeRate), func(i int) bool {
+		return tp.byFeeRate[i].FeeRate < entry.FeeRate
+	})
+	tp.byFeeRate = append(tp.byFeeRate, nil)
+	copy(tp.byFeeRate[i+1:], tp.byFeeRate[i:])
+	tp.byFeeRate[i] = entry
+
+	tp.size += entry.Size
+}
+
+// remove drops the entry with the given hash, and with removeDescendants
+// also every pooled transaction depending on it. Otherwise its children
+// are left in the pool, as happens when it is confirmed.
+func (tp *TransactionPool) remove(hash string, removeDescendants bool) {
+	entry, ok := tp.entries[hash]
+	if !ok {
+		return
+	}
+
+	delete(tp.entries, hash)
+	if tp.estimator != nil {
+		tp.estimator.RemoveTransaction(entry.Hash)
+	}
+	for _, input := range entry.Tx.Inputs {
+		delete(tp.spends, outpoint{string(input.PreviousTxHash), input.OutputIndex})
+	}
+	for i, e := range tp.byFeeRate {
+		if e == entry {
+			tp.byFeeRate = append(tp.byFeeRate[:i], tp.byFeeRate[i+1:]...)
+			break
+		}
+	}
+	tp.size -= entry.Size
+
+	for _, parent := range entry.parents {
+		delete(parent.children, hash)
+	}
+	for childHash, child := range entry.children {
+		delete(child.parents, hash)
+		if removeDescendants {
+			tp.remove(childHash, true)
+		}
+	}
+}
+
+// trim evicts transactions with their descendants until the pool fits in
+// its size limit. A transaction is scored by the better of its own fee rate
+// and that of its descendant package, so a parent that is paid for by its
+// children is kept, and the lowest scoring one goes first.
+func (tp *TransactionPool) trim() {
+	if tp.size <= tp.config.MaxSize {
+		return
+	}
+
+	scores := make(map[string]*packageScore, len(tp.byFeeRate))
+	list := make([]*packageScore, 0, len(tp.byFeeRate))
+	for i, entry := range tp.byFeeRate {
+		score := &packageScore{entry: entry, fee: entry.Fee, size: entry.Size, order: i}
+		for _, descendant := range tp.descendants(entry) {
+			score.fee += descendant.Fee
+			score.size += descendant.Size
+		}
+		scores[string(entry.Hash)] = score
+		list = append(list, score)
+	}
+	evictionScore := func(s *packageScore) float64 { return max(s.entry.FeeRate, s.rate()) }
+	packages := newPackageHeap(list, func(a, b *packageScore) bool {
+		return evictionScore(a) < evictionScore(b)
+	})
+
+	for tp.size > tp.config.MaxSize && packages.Len() > 0 {
+		lowest := packages.pop().entry
+		evicted := tp.descendants(lowest)
+		evicted[string(lowest.Hash)] = lowest
+
+		// The ancestors left in the pool lose the evicted transactions
+		// from their descendant packages
+		for hash, e := range evicted {
+			packages.remove(scores[hash])
+			for ancestorHash := range tp.ancestors(e) {
+				if _, ok := evicted[ancestorHash]; !ok {
+					score := scores[ancestorHash]
+					score.fee -= e.Fee
+					score.size -= e.Size
+					packages.fix(score)
+				}
+			}
+		}
+		tp.remove(string(lowest.Hash), true)
+	}
+}
+
+// RemoveTransactions drops transactions that have been included in a block,
+// along with any pooled transaction spending the same outputs. Orphans
+// waiting for the confirmed transactions are then added to the pool, and
+// returned so that they can be relayed.
+func (tp *TransactionPool) RemoveTransactions(txs []types.Transaction) []types.Transaction {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for i := range txs {
+		tp.remove(string(txs[i].Hash()), false)
+		for _, input := range txs[i].Inputs {
+			if spender, ok := tp.spends[outpoint{string(input.PreviousTxHash), input.OutputIndex}]; ok {
+				tp.remove(spender, true)
+			}
+		}
+	}
+	return tp.processOrphans(txs)
+}
+
+// SelectTransactions returns the transactions to include in a block of at
+// most maxSize bytes. Transactions are picked by ancestor fee rate: the fee
+// rate of a transaction together with its not yet selected ancestors, which
+// are selected with it. A child paying a high fee thereby pulls in a parent
+// paying a low one.
+func (tp *TransactionPool) SelectTransactions(maxSize uint64) []types.Transaction {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	scores := make(map[string]*packageScore, len(tp.byFeeRate))
+	list := make([]*packageScore, 0, len(tp.byFeeRate))
+	for i, entry := range tp.byFeeRate {
+		score := &packageScore{entry: entry, fee: entry.Fee, size: entry.Size, order: i}
+		for _, ancestor := range tp.ancestors(entry) {
+			score.fee += ancestor.Fee
+			score.size += ancestor.Size
+		}
+		scores[string(entry.Hash)] = score
+		list = append(list, score)
+	}
+	packages := newPackageHeap(list, func(a, b *packageScore) bool {
+		return a.rate() > b.rate()
+	})
+
+	var selected []types.Transaction
+	included := make(map[string]bool)
+	var size uint64
+	for packages.Len() > 0 {
+		best := packages.pop()
+
+		// Selecting ancestors of the package for another one shrinks it
+		// by no more than the room they take, so it will never fit
+		if size+best.size > maxSize {
+			continue
+		}
+
+		pkg := []*TxEntry{best.entry}
+		for hash, ancestor := range tp.ancestors(best.entry) {
+			if !included[hash] {
+				pkg = append(pkg, ancestor)
+			}
+		}
+		// An ancestor always has fewer ancestors than its descendants
+		sort.Slice(pkg, func(i, j int) bool {
+			return len(tp.ancestors(pkg[i])) < len(tp.ancestors(pkg[j]))
+		})
+		for _, e := range pkg {
+			selected = append(selected, e.Tx)
+			included[string(e.Hash)] = true
+			size += e.Size
+			packages.remove(scores[string(e.Hash)])
+
+			// Descendants no longer carry e in their packages
+			for hash := range tp.descendants(e) {
+				score := scores[hash]
+				score.fee -= e.Fee
+				score.size -= e.Size
+				packages.fix(score)
+			}
+		}
+	}
+	return selected
+}
+
+// GetTransaction returns the pooled transaction with the given hash
+func (tp *TransactionPool) GetTransaction(hash []byte) (*TxEntry, bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	entry, ok := tp.entries[string(hash)]
+	return entry, ok
+}
+
+// LookupOutput returns an output spendable by a new transaction, either a
+// confirmed unspent output or one created by a pooled transaction
+func (tp *TransactionPool) LookupOutput(hash []byte, index uint64) (*types.Output, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.lookupOutput(hash, index)
+}
+
+// GetAncestors returns the pooled transactions the given one depends on
+func (tp *TransactionPool) GetAncestors(hash []byte) []*TxEntry {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.relatives(hash, tp.ancestors)
+}
+
+// GetDescendants returns the pooled transactions depending on the given one
+func (tp *TransactionPool) GetDescendants(hash []byte) []*TxEntry {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.relatives(hash, tp.descendants)
+}
+
+// relatives returns the entries found by walk from the given transaction
+func (tp *TransactionPool) relatives(hash []byte, walk func(*TxEntry) map[string]*TxEntry) []*TxEntry {
+	entry, ok := tp.entries[string(hash)]
+	if !ok {
+		return nil
+	}
+	var entries []*TxEntry
+	for _, e := range walk(entry) {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// IsSpent reports whether a pooled transaction spends the given output
+func (tp *TransactionPool) IsSpent(hash []byte, index uint64) bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	_, ok := tp.spends[outpoint{string(hash), index}]
+	return ok
+}
+
+// Entries returns every pooled transaction, highest fee rate first
+func (tp *TransactionPool) Entries() []*TxEntry {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return append([]*TxEntry(nil), tp.byFeeRate...)
 }
 
 // Count returns the number of pending transactions in the pool.
 func (tp *TransactionPool) Count() int {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
-	return len(tp.transactions)
+	return len(tp.entries)
+}
+
+// Size returns the total serialized size of the pooled transactions
+func (tp *TransactionPool) Size() uint64 {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.size
 }
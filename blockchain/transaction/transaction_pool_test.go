@@ -0,0 +1,501 @@
+package transaction
+
+import (
+	"blockchain/consensus"
+	"blockchain/types"
+	"blockchain/wallet"
+	"errors"
+	"testing"
+)
+
+// testUTXOs is an in-memory UTXOSource
+type testUTXOs map[outpoint]*types.Output
+
+func (u testUTXOs) GetUTXO(txHash []byte, index uint64) (*types.Output, error) {
+	if output, ok := u[outpoint{string(txHash), index}]; ok {
+		return output, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// testKey owns every output the tests create, so that their spends can be
+// signed without looking the outputs up
+var testKey, _ = wallet.PrivateKeyFromHex("0000000000000000000000000000000000000000000000000000000000000001")
+
+// testOutput returns an output of amount paying to testKey
+func testOutput(amount float64) types.Output {
+	owner := wallet.AddressFromPublicKey(&testKey.PublicKey, true)
+	return types.Output{Amount: amount, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
+}
+
+func (u testUTXOs) GetUTXOOrigin(txHash []byte, index uint64) (int, bool, error) {
+	if _, ok := u[outpoint{string(txHash), index}]; ok {
+		return 0, false, nil
+	}
+	return 0, false, errors.New("not found")
+}
+
+func (u testUTXOs) GetBestHeight() (int, error) {
+	return 0, nil
+}
+
+// fund adds a confirmed output of amount and returns its outpoint hash
+func (u testUTXOs) fund(name string, amount float64) []byte {
+	hash := []byte(name)
+	output := testOutput(amount)
+	u[outpoint{name, 0}] = &output
+	return hash
+}
+
+// spend returns a signed transaction paying amount from an output owned by
+// testKey back to testKey
+func spend(prevHash []byte, index uint64, amount float64) types.Transaction {
+	tx := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{{PreviousTxHash: prevHash, OutputIndex: index, Sequence: 0xFFFFFFFF}},
+		Outputs: []types.Output{testOutput(amount)},
+	}
+	sign(&tx)
+	return tx
+}
+
+// sign signs every input of tx with testKey, after tests change it
+func sign(tx *types.Transaction) {
+	prevOutput := testOutput(0)
+	for i := range tx.Inputs {
+		if err := SignInput(tx, i, &prevOutput, testKey); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestTransactionPoolOrdering(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	low := spend(utxos.fund("a", 10), 0, 9.99)
+	high := spend(utxos.fund("b", 10), 0, 9)
+	mid := spend(utxos.fund("c", 10), 0, 9.5)
+	for _, tx := range []types.Transaction{low, high, mid} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	if err := pool.AddTransaction(low); err != ErrAlreadyInPool {
+		t.Errorf("Expected ErrAlreadyInPool, got %v", err)
+	}
+	if err := pool.AddTransaction(spend([]byte("a"), 0, 5)); err != ErrConflict {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+	if err := pool.AddTransaction(spend([]byte("unknown"), 0, 5)); err != ErrMissingInputs {
+		t.Errorf("Expected ErrMissingInputs, got %v", err)
+	}
+
+	selected := pool.SelectTransactions(1 << 20)
+	if len(selected) != 3 {
+		t.Fatalf("Expected 3 transactions, got %d", len(selected))
+	}
+	for i, want := range []types.Transaction{high, mid, low} {
+		if string(selected[i].Hash()) != string(want.Hash()) {
+			t.Errorf("Transaction %d out of fee rate order", i)
+		}
+	}
+
+	// A limit fitting one transaction selects the best paying one
+	one := pool.SelectTransactions(uint64(len(high.Serialize())))
+	if len(one) != 1 || string(one[0].Hash()) != string(high.Hash()) {
+		t.Errorf("Expected only the highest fee transaction, got %d", len(one))
+	}
+
+	pool.RemoveTransactions([]types.Transaction{high})
+	if pool.Count() != 2 {
+		t.Errorf("Expected 2 transactions after removal, got %d", pool.Count())
+	}
+}
+
+func TestTransactionPoolChains(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	parent := spend(utxos.fund("a", 10), 0, 9.9)
+	child := spend(parent.Hash(), 0, 5)
+	if err := pool.AddTransaction(parent); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if err := pool.AddTransaction(child); err != nil {
+		t.Fatalf("Adding child of a pooled transaction failed: %v", err)
+	}
+
+	// The child pays more but must follow its parent
+	selected := pool.SelectTransactions(1 << 20)
+	if len(selected) != 2 || string(selected[0].Hash()) != string(parent.Hash()) {
+		t.Errorf("Expected parent before child")
+	}
+
+	// A block spending the parent's input elsewhere evicts both
+	conflict := spend([]byte("a"), 0, 1)
+	pool.RemoveTransactions([]types.Transaction{conflict})
+	if pool.Count() != 0 {
+		t.Errorf("Expected conflicting chain to be evicted, %d left", pool.Count())
+	}
+}
+
+func TestTransactionPoolEviction(t *testing.T) {
+	utxos := testUTXOs{}
+	low := spend(utxos.fund("a", 10), 0, 9.99)
+	high := spend(utxos.fund("b", 10), 0, 9)
+
+	config := DefaultPoolConfig()
+	config.MaxSize = uint64(len(low.Serialize()))
+	pool := NewTransactionPool(config, utxos)
+
+	if err := pool.AddTransaction(low); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if err := pool.AddTransaction(high); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if _, ok := pool.GetTransaction(low.Hash()); ok {
+		t.Errorf("Expected the lowest fee transaction to be evicted")
+	}
+
+	lower := spend(utxos.fund("c", 10), 0, 9.999)
+	if err := pool.AddTransaction(lower); err != ErrPoolFull {
+		t.Errorf("Expected ErrPoolFull, got %v", err)
+	}
+	if pool.Size() > config.MaxSize {
+		t.Errorf("Pool size %d exceeds limit %d", pool.Size(), config.MaxSize)
+	}
+}
+
+func TestTransactionPoolChildPaysForParent(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	parent := spend(utxos.fund("a", 10), 0, 10)
+	child := spend(parent.Hash(), 0, 8)
+	other := spend(utxos.fund("b", 10), 0, 9.5)
+	for _, tx := range []types.Transaction{parent, child, other} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	if ancestors := pool.GetAncestors(child.Hash()); len(ancestors) != 1 {
+		t.Errorf("Expected 1 ancestor, got %d", len(ancestors))
+	}
+	if descendants := pool.GetDescendants(parent.Hash()); len(descendants) != 1 {
+		t.Errorf("Expected 1 descendant, got %d", len(descendants))
+	}
+
+	// The zero fee parent is mined first thanks to its child's fee
+	selected := pool.SelectTransactions(1 << 20)
+	if len(selected) != 3 {
+		t.Fatalf("Expected 3 transactions, got %d", len(selected))
+	}
+	for i, want := range []types.Transaction{parent, child, other} {
+		if string(selected[i].Hash()) != string(want.Hash()) {
+			t.Errorf("Transaction %d out of ancestor fee rate order", i)
+		}
+	}
+
+	// Confirming the parent leaves the child without pooled ancestors
+	pool.RemoveTransactions([]types.Transaction{parent})
+	if ancestors := pool.GetAncestors(child.Hash()); len(ancestors) != 0 {
+		t.Errorf("Expected no ancestors after confirmation, got %d", len(ancestors))
+	}
+}
+
+// sharedParent returns a zero fee transaction with two outputs of 5,
+// each spent by one of its children paying back fee1 and fee2
+func sharedParent(utxos testUTXOs, name string, fee1, fee2 float64) (parent, child1, child2 types.Transaction) {
+	parent = types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{{PreviousTxHash: utxos.fund(name, 10), OutputIndex: 0, Sequence: 0xFFFFFFFF}},
+		Outputs: []types.Output{testOutput(5), testOutput(5)},
+	}
+	sign(&parent)
+	return parent, spend(parent.Hash(), 0, 5-fee1), spend(parent.Hash(), 1, 5-fee2)
+}
+
+func TestTransactionPoolSelectionRescoresDescendants(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	// With the parent counted, the second child pays less than other.
+	// Once the first child has pulled the parent in, it pays more.
+	parent, child1, child2 := sharedParent(utxos, "a", 2, 0.5)
+	other := spend(utxos.fund("b", 10), 0, 9.6)
+	for _, tx := range []types.Transaction{parent, child1, child2, other} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	selected := pool.SelectTransactions(1 << 20)
+	if len(selected) != 4 {
+		t.Fatalf("Expected 4 transactions, got %d", len(selected))
+	}
+	for i, want := range []types.Transaction{parent, child1, child2, other} {
+		if string(selected[i].Hash()) != string(want.Hash()) {
+			t.Errorf("Transaction %d out of ancestor fee rate order", i)
+		}
+	}
+}
+
+func TestTransactionPoolTrimRescoresAncestors(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	// The cheap child drags its parent's package below other until it is
+	// evicted, after which the parent's package pays more than other
+	parent, cheap, rich := sharedParent(utxos, "a", 0.01, 1)
+	other := spend(utxos.fund("b", 10), 0, 9.6)
+	for _, tx := range []types.Transaction{parent, cheap, rich, other} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	pool.config.MaxSize = uint64(len(parent.Serialize()) + len(rich.Serialize()) + len(other.Serialize())/2)
+	pool.trim()
+	for _, tx := range []types.Transaction{parent, rich} {
+		if _, ok := pool.GetTransaction(tx.Hash()); !ok {
+			t.Errorf("Expected %x to be kept", tx.Hash())
+		}
+	}
+	for _, tx := range []types.Transaction{cheap, other} {
+		if _, ok := pool.GetTransaction(tx.Hash()); ok {
+			t.Errorf("Expected %x to be evicted", tx.Hash())
+		}
+	}
+}
+
+func TestTransactionPoolPackageLimits(t *testing.T) {
+	utxos := testUTXOs{}
+	config := DefaultPoolConfig()
+	config.MaxAncestors = 3
+	pool := NewTransactionPool(config, utxos)
+
+	tx := spend(utxos.fund("a", 10), 0, 9)
+	chain := []types.Transaction{tx}
+	for i := 0; i < 2; i++ {
+		tx = spend(tx.Hash(), 0, tx.Outputs[0].Amount-0.1)
+		chain = append(chain, tx)
+	}
+	for _, tx := range chain {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	tooLong := spend(tx.Hash(), 0, tx.Outputs[0].Amount-0.1)
+	if err := pool.AddTransaction(tooLong); !errors.Is(err, ErrPackageLimit) {
+		t.Errorf("Expected ErrPackageLimit, got %v", err)
+	}
+
+	// Evicting a parent takes its descendants with it
+	config = DefaultPoolConfig()
+	config.MaxSize = 3 * uint64(len(chain[0].Serialize()))
+	pool = NewTransactionPool(config, utxos)
+
+	root := spend(utxos.fund("b", 10), 0, 10)
+	for _, tx := range []types.Transaction{root, spend(root.Hash(), 0, 9.9)} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	if err := pool.AddTransaction(spend(utxos.fund("c", 10), 0, 9)); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if err := pool.AddTransaction(spend(utxos.fund("d", 10), 0, 9)); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if pool.Count() != 2 {
+		t.Errorf("Expected the parent and its child to be evicted, %d left", pool.Count())
+	}
+	if _, ok := pool.GetTransaction(root.Hash()); ok {
+		t.Errorf("Expected the parent to be evicted")
+	}
+}
+
+func TestTransactionPoolReplaceByFee(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	funding := utxos.fund("a", 10)
+	original := spend(funding, 0, 9.9)
+	original.Inputs[0].Sequence = types.MaxRBFSequence
+	sign(&original)
+	child := spend(original.Hash(), 0, 9.8)
+	for _, tx := range []types.Transaction{original, child} {
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+
+	// Paying less than the original and its child together is refused
+	cheap := spend(funding, 0, 9.85)
+	if err := pool.AddTransaction(cheap); !errors.Is(err, ErrReplacement) {
+		t.Errorf("Expected ErrReplacement, got %v", err)
+	}
+
+	replacement := spend(funding, 0, 9.7)
+	if err := pool.AddTransaction(replacement); err != nil {
+		t.Fatalf("Replacement refused: %v", err)
+	}
+	if pool.Count() != 1 {
+		t.Errorf("Expected the original and its child to be replaced, %d left", pool.Count())
+	}
+
+	// A transaction that does not signal cannot be replaced
+	final := spend(utxos.fund("b", 10), 0, 9.9)
+	if err := pool.AddTransaction(final); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if err := pool.AddTransaction(spend([]byte("b"), 0, 5)); err != ErrConflict {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+}
+
+func TestTransactionPoolBumpFee(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	owner := wallet.AddressFromPublicKey(&key.PublicKey, true)
+
+	utxos := testUTXOs{}
+	prevOutput := &types.Output{Amount: 10, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
+	utxos[outpoint{"a", 0}] = prevOutput
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	original := spend([]byte("a"), 0, 6)
+	original.Inputs[0].Sequence = types.MaxRBFSequence
+	original.Outputs = append(original.Outputs, types.Output{Amount: 3.99, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner})
+	if err := SignInput(&original, 0, prevOutput, key); err != nil {
+		t.Fatalf("SignInput failed: %v", err)
+	}
+	if err := VerifyInput(&original, 0, prevOutput); err != nil {
+		t.Fatalf("VerifyInput failed: %v", err)
+	}
+	if err := pool.AddTransaction(original); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+
+	bumped, err := pool.BumpFee(original.Hash(), 0.001, 1)
+	if err != nil {
+		t.Fatalf("BumpFee failed: %v", err)
+	}
+	if err := VerifyInput(bumped, 0, prevOutput); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected the old signature to be invalid, got %v", err)
+	}
+	if err := SignInput(bumped, 0, prevOutput, key); err != nil {
+		t.Fatalf("SignInput failed: %v", err)
+	}
+	if err := pool.AddTransaction(*bumped); err != nil {
+		t.Fatalf("Bumped transaction refused: %v", err)
+	}
+
+	entry, ok := pool.GetTransaction(bumped.Hash())
+	if !ok || entry.FeeRate < 0.001 {
+		t.Errorf("Expected a fee rate of at least 0.001, got %+v", entry)
+	}
+	if _, ok := pool.GetTransaction(original.Hash()); ok {
+		t.Errorf("Expected the original to be replaced")
+	}
+}
+
+func TestTransactionPoolRefusesUnspendableOutputs(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	// A P2WSH output pays to a 32 byte program no input can ever verify
+	// against
+	witness := spend(utxos.fund("a", 10), 0, 9)
+	witness.Outputs[0] = types.Output{Amount: 9, ScriptPubKey: make([]byte, 34), ScriptType: wallet.ScriptTypeP2WSH, Address: make([]byte, 32)}
+	sign(&witness)
+	if err := pool.AddTransaction(witness); !errors.Is(err, ErrUnsupportedScript) {
+		t.Errorf("Expected a P2WSH output to be refused, got %v", err)
+	}
+
+	short := spend(utxos.fund("b", 10), 0, 9)
+	short.Outputs[0].Address = short.Outputs[0].Address[:10]
+	sign(&short)
+	if err := pool.AddTransaction(short); !errors.Is(err, ErrUnsupportedScript) {
+		t.Errorf("Expected a P2PKH output of a short hash to be refused, got %v", err)
+	}
+}
+
+func TestTransactionPoolRequiresSignatures(t *testing.T) {
+	utxos := testUTXOs{}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	unsigned := spend(utxos.fund("a", 10), 0, 9)
+	unsigned.Inputs[0].ScriptSig = nil
+	unsigned.InvalidateHash()
+	if err := pool.AddTransaction(unsigned); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for an unsigned input, got %v", err)
+	}
+
+	// A signature made before the outputs changed no longer verifies
+	tampered := spend([]byte("a"), 0, 9)
+	tampered.Outputs[0].Amount = 9.5
+	tampered.InvalidateHash()
+	if err := pool.AddTransaction(tampered); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for a tampered transaction, got %v", err)
+	}
+
+	// Children of pooled transactions and orphans are checked the same way
+	parent := spend([]byte("a"), 0, 9)
+	child := spend(parent.Hash(), 0, 8)
+	child.Inputs[0].ScriptSig = nil
+	child.InvalidateHash()
+	if _, err := pool.ProcessTransaction(child, "peer1"); err != ErrOrphan {
+		t.Fatalf("Expected ErrOrphan, got %v", err)
+	}
+	if accepted, err := pool.ProcessTransaction(parent, "peer1"); err != nil || len(accepted) != 1 {
+		t.Errorf("Expected only the parent to be accepted, got %d: %v", len(accepted), err)
+	}
+	if _, ok := pool.GetTransaction(child.Hash()); ok {
+		t.Errorf("Expected the unsigned orphan to be refused")
+	}
+}
+
+// coinbaseUTXOs reports every output as created by the coinbase of block 1
+type coinbaseUTXOs struct {
+	testUTXOs
+	best int
+}
+
+func (u *coinbaseUTXOs) GetUTXOOrigin(txHash []byte, index uint64) (int, bool, error) {
+	if _, err := u.GetUTXO(txHash, index); err != nil {
+		return 0, false, err
+	}
+	return 1, true, nil
+}
+
+func (u *coinbaseUTXOs) GetBestHeight() (int, error) {
+	return u.best, nil
+}
+
+func TestTransactionPoolCoinbaseMaturity(t *testing.T) {
+	utxos := &coinbaseUTXOs{testUTXOs: testUTXOs{}, best: consensus.CoinbaseMaturity - 1}
+	pool := NewTransactionPool(DefaultPoolConfig(), utxos)
+
+	// The next block is one short of the coinbase maturing
+	tx := spend(utxos.fund("a", 50), 0, 49)
+	if err := pool.AddTransaction(tx); err != ErrImmature {
+		t.Errorf("Expected ErrImmature, got %v", err)
+	}
+
+	utxos.best++
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Errorf("Expected the mature coinbase to be spendable, got %v", err)
+	}
+	// Children spend the pooled transaction, not the coinbase
+	if err := pool.AddTransaction(spend(tx.Hash(), 0, 48)); err != nil {
+		t.Errorf("AddTransaction failed: %v", err)
+	}
+}
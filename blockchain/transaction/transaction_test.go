@@ -1,28 +1,27 @@
 package transaction
 
 import (
+	"errors"
 	"testing"
 
-	"go-blockchain/wallet"
+	"blockchain/types"
+	"blockchain/wallet"
 )
 
 func TestTransactionSigningAndVerification(t *testing.T) {
-	// Generate a key pair for signing and verification
-	privateKey, publicKey, err := wallet.GenerateKeyPair()
+	// Generate a key to sign and verify with
+	privateKey, err := wallet.GenerateKey()
 	if err != nil {
-		t.Fatalf("GenerateKeyPair failed: %v", err)
-	}
-
-	// Define transaction inputs and outputs
-	inputs := []TransactionInput{
-		{PreviousTxID: "abcd1234", OutputIndex: 0},
-	}
-	outputs := []TransactionOutput{
-		{Address: "recipient_address", Amount: 10.0},
+		t.Fatalf("GenerateKey failed: %v", err)
 	}
+	owner := wallet.AddressFromPublicKey(&privateKey.PublicKey, true)
+	prevOutput := &types.Output{Amount: 10.0, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
 
 	// Create a new transaction
-	tx := NewTransaction(inputs, outputs)
+	tx := types.NewTransaction(
+		[]types.Input{*types.NewInput([]byte("abcd1234"), 0, nil)},
+		[]types.Output{{Amount: 10.0, ScriptPubKey: []byte("recipient_address"), ScriptType: "P2PKH", Address: []byte("recipient_address")}},
+	)
 
 	// Ensure the transaction is initialized correctly
 	if len(tx.Inputs) != 1 || len(tx.Outputs) != 1 {
@@ -30,27 +29,50 @@ func TestTransactionSigningAndVerification(t *testing.T) {
 	}
 
 	// Sign the transaction
-	err = tx.SignTransaction(privateKey)
-	if err != nil {
-		t.Fatalf("SignTransaction failed: %v", err)
+	if err := SignInput(tx, 0, prevOutput, privateKey); err != nil {
+		t.Fatalf("SignInput failed: %v", err)
 	}
 
 	// Ensure the signature is added
-	if len(tx.SignatureR) == 0 || len(tx.SignatureS) == 0 {
+	if len(tx.Inputs[0].ScriptSig) == 0 {
 		t.Errorf("Transaction signature missing after signing")
 	}
 
 	// Verify the transaction
-	if !tx.VerifyTransaction(publicKey) {
-		t.Errorf("Transaction verification failed: signature is invalid")
+	if err := VerifyInput(tx, 0, prevOutput); err != nil {
+		t.Errorf("Transaction verification failed: %v", err)
 	}
 
 	// Modify the transaction to simulate tampering
 	tx.Outputs[0].Amount = 20.0
+	tx.InvalidateHash()
 
 	// Verify the tampered transaction
-	if tx.VerifyTransaction(publicKey) {
+	if err := VerifyInput(tx, 0, prevOutput); err == nil {
 		t.Errorf("Tampered transaction verification should have failed")
 	}
 }
 
+func TestVerifyInputRejectsTrailingScriptSigBytes(t *testing.T) {
+	privateKey, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	owner := wallet.AddressFromPublicKey(&privateKey.PublicKey, true)
+	prevOutput := &types.Output{Amount: 10.0, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}
+
+	tx := types.NewTransaction(
+		[]types.Input{*types.NewInput([]byte("abcd1234"), 0, nil)},
+		[]types.Output{{Amount: 10.0, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}},
+	)
+	if err := SignInput(tx, 0, prevOutput, privateKey); err != nil {
+		t.Fatalf("SignInput failed: %v", err)
+	}
+
+	// The signature still matches, since it does not cover the scriptSig
+	tx.Inputs[0].ScriptSig = append(tx.Inputs[0].ScriptSig, 0x01, 0xff)
+	tx.InvalidateHash()
+	if err := VerifyInput(tx, 0, prevOutput); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for trailing scriptSig bytes, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"blockchain/consensus"
+	"blockchain/transaction"
+	"blockchain/types"
+)
+
+// Errors returned by ValidateBlock for each consensus rule
+var (
+	ErrBadHeight      = errors.New("block height does not follow the previous block")
+	ErrBadPrevHash    = errors.New("block does not link to the previous block")
+	ErrBadHash        = errors.New("block hash does not match its contents")
+	ErrBadMerkleRoot  = errors.New("merkle root does not match the transactions")
+	ErrBadProofOfWork = errors.New("block does not satisfy its proof of work")
+	ErrBadDifficulty  = errors.New("block difficulty does not follow the previous block")
+	ErrBadTimestamp   = errors.New("block timestamp is out of range")
+	ErrBadCoinbase    = errors.New("block must start with its only coinbase transaction")
+	ErrCoinbaseValue  = errors.New("coinbase claims more than the subsidy and fees")
+	ErrBlockTooLarge  = errors.New("block transactions exceed the maximum block size")
+	ErrBadTransaction = errors.New("block contains an invalid transaction")
+)
+
+// MedianTimeSpan is the number of blocks whose median timestamp a new
+// block may not precede
+const MedianTimeSpan = 11
+
+// MaxFutureBlockTime is how far ahead of the local clock a block's
+// timestamp may be
+const MaxFutureBlockTime = 2 * time.Hour
+
+// ValidateBlock checks block against the consensus rules of params. prev is
+// the block it builds on, or nil for the genesis block, which carries no
+// proof of work. Only the header fields of prev are used. The proof of work
+// is checked against the difficulty the chain requires, not the one the
+// block declares.
+func ValidateBlock(block, prev *types.Block, params *ChainParams) error {
+	if prev != nil {
+		if block.Index != prev.Index+1 {
+			return fmt.Errorf("%w: got %d after %d", ErrBadHeight, block.Index, prev.Index)
+		}
+		if !bytes.Equal(block.PrevHash, prev.Hash) {
+			return ErrBadPrevHash
+		}
+		if bits := NextBits(prev, params); block.Difficulty != bits {
+			return fmt.Errorf("%w: bits %08x, expected %08x", ErrBadDifficulty, block.Difficulty, bits)
+		}
+	} else if block.Index != 0 {
+		return fmt.Errorf("%w: block %d has no previous block", ErrBadHeight, block.Index)
+	}
+
+	if !block.IsValid() {
+		return ErrBadHash
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.ComputeMerkleRoot()) {
+		return ErrBadMerkleRoot
+	}
+
+	if prev != nil && !NewProofOfWork(block).Validate() {
+		return ErrBadProofOfWork
+	}
+
+	return nil
+}
+
+// ValidateBlockTime checks that the timestamp of block is not before
+// medianTimePast, the MedianTimePast of the blocks it builds on, nor more
+// than MaxFutureBlockTime after now
+func ValidateBlockTime(block *types.Block, medianTimePast int64, now time.Time) error {
+	if block.Timestamp < medianTimePast {
+		return fmt.Errorf("%w: %d is before the median time %d", ErrBadTimestamp, block.Timestamp, medianTimePast)
+	}
+	if block.Timestamp > now.Add(MaxFutureBlockTime).Unix() {
+		return fmt.Errorf("%w: %d is too far in the future", ErrBadTimestamp, block.Timestamp)
+	}
+	return nil
+}
+
+// MedianTimePast returns the median of the last MedianTimeSpan of
+// timestamps, the timestamps of a chain's blocks oldest first
+func MedianTimePast(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+	if len(timestamps) > MedianTimeSpan {
+		timestamps = timestamps[len(timestamps)-MedianTimeSpan:]
+	}
+	sorted := slices.Clone(timestamps)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// ValidateBlockTransactions checks the transactions of block against the
+// UTXO set of the chain it extends: a single leading coinbase claiming no
+// more than the subsidy and fees, and every other transaction spending
+// existing outputs, at most once and with valid signatures. Outputs created
+// earlier in the block may be spent, but coinbase outputs only once they are
+// consensus.CoinbaseMaturity blocks deep.
+func ValidateBlockTransactions(block *types.Block, utxos transaction.UTXOSource) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return ErrBadCoinbase
+	}
+
+	type outpoint struct {
+		hash  string
+		index uint64
+	}
+	created := make(map[outpoint]*types.Output)
+	spent := make(map[outpoint]bool)
+
+	var size uint64
+	var fees float64
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		size += uint64(len(tx.Serialize()))
+		if i > 0 {
+			if tx.IsCoinbase() {
+				return ErrBadCoinbase
+			}
+			if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+				return fmt.Errorf("%w: transaction %d has no inputs or outputs", ErrBadTransaction, i)
+			}
+
+			var in, out float64
+			for j, input := range tx.Inputs {
+				op := outpoint{string(input.PreviousTxHash), input.OutputIndex}
+				if spent[op] {
+					return fmt.Errorf("%w: transaction %d double spends input %d", ErrBadTransaction, i, j)
+				}
+				spent[op] = true
+
+				prevOutput, ok := created[op]
+				if ok && op.hash == string(block.Transactions[0].Hash()) {
+					return fmt.Errorf("%w: transaction %d input %d spends the coinbase of its own block", ErrBadTransaction, i, j)
+				}
+				if !ok {
+					output, err := utxos.GetUTXO(input.PreviousTxHash, input.OutputIndex)
+					if err != nil || output == nil {
+						return fmt.Errorf("%w: transaction %d input %d spends a missing output", ErrBadTransaction, i, j)
+					}
+					height, coinbase, err := utxos.GetUTXOOrigin(input.PreviousTxHash, input.OutputIndex)
+					if err != nil {
+						return fmt.Errorf("%w: transaction %d input %d spends a missing output", ErrBadTransaction, i, j)
+					}
+					if coinbase && !consensus.CoinbaseMature(height, block.Index) {
+						return fmt.Errorf("%w: transaction %d input %d spends a coinbase output from block %d before it matures", ErrBadTransaction, i, j, height)
+					}
+					prevOutput = output
+				}
+				if err := transaction.VerifyInput(tx, j, prevOutput); err != nil {
+					return fmt.Errorf("%w: transaction %d: %v", ErrBadTransaction, i, err)
+				}
+				in += prevOutput.Amount
+			}
+			if err := transaction.CheckOutputScripts(tx); err != nil {
+				return fmt.Errorf("%w: transaction %d: %v", ErrBadTransaction, i, err)
+			}
+			for _, output := range tx.Outputs {
+				if output.Amount < 0 {
+					return fmt.Errorf("%w: transaction %d has a negative output", ErrBadTransaction, i)
+				}
+				out += output.Amount
+			}
+			if out > in {
+				return fmt.Errorf("%w: transaction %d outputs exceed its inputs", ErrBadTransaction, i)
+			}
+			fees += in - out
+		}
+
+		for j := range tx.Outputs {
+			created[outpoint{string(tx.Hash()), uint64(j)}] = &tx.Outputs[j]
+		}
+	}
+
+	if size > consensus.MaxBlockSize {
+		return ErrBlockTooLarge
+	}
+
+	var claimed float64
+	for _, output := range block.Transactions[0].Outputs {
+		claimed += output.Amount
+	}
+	if claimed > consensus.BlockSubsidy(block.Index)+fees {
+		return fmt.Errorf("%w: %f claimed, %f allowed", ErrCoinbaseValue, claimed, consensus.BlockSubsidy(block.Index)+fees)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"blockchain/consensus"
+	"blockchain/types"
+)
+
+// testParams keeps proof of work cheap in tests
+var testParams = &ChainParams{InitialBits: consensus.CalculateDifficultyBits(8)}
+
+func mineTestBlock(t *testing.T, prev *types.Block, transactions []types.Transaction) *types.Block {
+	block := NewBlock(prev.Index+1, transactions, prev.Hash)
+	block.Difficulty = NextBits(prev, testParams)
+	if err := MineBlock(block, 10*time.Second); err != nil {
+		t.Fatalf("MineBlock failed: %v", err)
+	}
+	return block
+}
+
+func testTransaction(amount float64) types.Transaction {
+	return types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput([]byte("test"))},
+		Outputs: []types.Output{{Amount: amount, ScriptPubKey: []byte("address"), ScriptType: "P2PKH", Address: []byte("address")}},
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	genesis := NewBlock(0, []types.Transaction{}, []byte{0x00})
+	if err := ValidateBlock(genesis, nil, testParams); err != nil {
+		t.Fatalf("Genesis block is invalid: %v", err)
+	}
+
+	block := mineTestBlock(t, genesis, []types.Transaction{testTransaction(10.0)})
+	if err := ValidateBlock(block, genesis, testParams); err != nil {
+		t.Fatalf("Mined block is invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(b *types.Block)
+		want   error
+	}{
+		{"wrong height", func(b *types.Block) { b.Index = 5 }, ErrBadHeight},
+		{"wrong previous hash", func(b *types.Block) { b.PrevHash = []byte("other") }, ErrBadPrevHash},
+		{"stale hash", func(b *types.Block) { b.Timestamp++ }, ErrBadHash},
+		{"wrong merkle root", func(b *types.Block) {
+			b.MerkleRoot = make([]byte, 32)
+		}, ErrBadMerkleRoot},
+		{"changed transactions", func(b *types.Block) {
+			b.Transactions[0].Outputs[0].Amount = 20.0
+			b.Transactions[0].InvalidateHash()
+			b.Hash = b.CalculateHash()
+		}, ErrBadMerkleRoot},
+		{"no proof of work", func(b *types.Block) {
+			b.Nonce++
+			b.Hash = b.CalculateHash()
+		}, ErrBadProofOfWork},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tampered := *block
+			tampered.Transactions = []types.Transaction{testTransaction(10.0)}
+			tc.tamper(&tampered)
+
+			if err := ValidateBlock(&tampered, genesis, testParams); !errors.Is(err, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateBlockRequiresChainDifficulty(t *testing.T) {
+	genesis := NewBlock(0, []types.Transaction{}, []byte{0x00})
+	prev := mineTestBlock(t, genesis, []types.Transaction{testTransaction(10.0)})
+
+	// A block declaring easier bits than the chain requires is solved in a
+	// few hashes and checks out against its own bits
+	easy := NewBlock(prev.Index+1, []types.Transaction{testTransaction(10.0)}, prev.Hash)
+	easy.Difficulty = 0x2100ffff
+	if err := MineBlock(easy, 10*time.Second); err != nil {
+		t.Fatalf("MineBlock failed: %v", err)
+	}
+	if !NewProofOfWork(easy).Validate() {
+		t.Fatalf("Expected the block to meet its own bits")
+	}
+	if err := ValidateBlock(easy, prev, testParams); !errors.Is(err, ErrBadDifficulty) {
+		t.Errorf("Expected ErrBadDifficulty, got %v", err)
+	}
+
+	if err := ValidateBlock(mineTestBlock(t, prev, []types.Transaction{testTransaction(10.0)}), prev, testParams); err != nil {
+		t.Errorf("Block at the chain's difficulty is invalid: %v", err)
+	}
+}
+
+func TestValidateBlockTime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var timestamps []int64
+	for i := int64(0); i < 20; i++ {
+		timestamps = append(timestamps, now.Unix()-1000+i*10)
+	}
+	// The median of the last 11 of 20 timestamps is the 15th
+	median := MedianTimePast(timestamps)
+	if median != timestamps[14] {
+		t.Fatalf("Expected median %d, got %d", timestamps[14], median)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		timestamp int64
+		valid     bool
+	}{
+		{"at the median", median, true},
+		{"now", now.Unix(), true},
+		{"before the median", median - 1, false},
+		{"at the drift limit", now.Add(MaxFutureBlockTime).Unix(), true},
+		{"beyond the drift limit", now.Add(MaxFutureBlockTime).Unix() + 1, false},
+	} {
+		err := ValidateBlockTime(&types.Block{Timestamp: tc.timestamp}, median, now)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrBadTimestamp) {
+			t.Errorf("%s: expected ErrBadTimestamp, got %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+
+    "blockchain/chain"
+    "blockchain/types"
+    "go-blockchain/db"
+    "github.com/spf13/cobra"
+)
+
+const chainDBPath = "blockchain.db"
+
+var getTransactionCmd = &cobra.Command{
+    Use:   "gettransaction <txid>",
+    Short: "Look up a confirmed transaction by its hash",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        txid, err := hex.DecodeString(args[0])
+        if err != nil {
+            fmt.Println("Invalid transaction ID")
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        tx, loc, err := chainDB.GetTransactionByHash(txid)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        out, _ := json.MarshalIndent(struct {
+            TxID        string      `json:"txid"`
+            BlockHash   string      `json:"blockHash"`
+            BlockHeight int         `json:"blockHeight"`
+            Position    int         `json:"position"`
+            Transaction interface{} `json:"transaction"`
+        }{hex.EncodeToString(txid), hex.EncodeToString(loc.BlockHash), loc.BlockIndex, loc.Position, tx}, "", " ")
+        fmt.Println(string(out))
+    },
+}
+
+var buildTxIndexCmd = &cobra.Command{
+    Use:   "buildtxindex",
+    Short: "Enable the transaction index and build it over the existing chain",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        var err error
+        if chainDB.TxIndexEnabled() {
+            err = chainDB.BuildTxIndex()
+        } else {
+            err = chainDB.EnableTxIndex()
+        }
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println("Transaction index built")
+    },
+}
+
+var historyPage, historyLimit int
+
+var historyCmd = &cobra.Command{
+    Use:   "history <address>",
+    Short: "List the credits and debits of an address",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        address, err := decodeAddress(args[0])
+        if err != nil {
+            fmt.Println("Invalid address:", err)
+            os.Exit(1)
+        }
+        if historyPage < 1 || historyLimit < 1 {
+            fmt.Println("--page and --limit must be positive")
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        totals, err := chainDB.GetAddressTotals(address)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        entries, err := chainDB.GetAddressHistory(address, (historyPage-1)*historyLimit, historyLimit)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        fmt.Printf("Received: %f, Sent: %f, Balance: %f, Transactions: %d\n",
+            totals.Received, totals.Sent, totals.Balance, totals.TxCount)
+        for _, entry := range entries {
+            if entry.IsDebit {
+                fmt.Printf("Block %d  tx %x  input %d   -%f\n", entry.BlockIndex, entry.TxHash, entry.Index, entry.Amount)
+            } else {
+                fmt.Printf("Block %d  tx %x  output %d  +%f\n", entry.BlockIndex, entry.TxHash, entry.Index, entry.Amount)
+            }
+        }
+    },
+}
+
+var buildAddrIndexCmd = &cobra.Command{
+    Use:   "buildaddrindex",
+    Short: "Enable the address index and build it over the existing chain",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        var err error
+        if chainDB.AddressIndexEnabled() {
+            err = chainDB.BuildAddressIndex()
+        } else {
+            err = chainDB.EnableAddressIndex()
+        }
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println("Address index built")
+    },
+}
+
+var reindexVerifyOnly bool
+
+var reindexCmd = &cobra.Command{
+    Use:   "reindex",
+    Short: "Rebuild the UTXO set, indexes and chain work from the stored blocks",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        if reindexVerifyOnly {
+            verifyChain(chainDB)
+            return
+        }
+
+        if err := chainDB.Reindex(); err != nil {
+            fmt.Println("Reindex failed:", err)
+            os.Exit(1)
+        }
+        fmt.Println("Chain state rebuilt")
+    },
+}
+
+// verifyChain re-validates every stored block against the consensus rules
+// and exits at the first one that fails
+func verifyChain(chainDB *db.BlockchainDB) {
+    best, err := chainDB.GetBestHeight()
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    if best < 0 {
+        fmt.Println("No blocks to verify")
+        return
+    }
+
+    // Pruned bodies cannot be checked, so start after them
+    start := chainDB.PruneHeight() + 1
+    var prev *types.Block
+    var timestamps []int64
+    if start > 0 {
+        if prev, err = chainDB.GetBlockHeader(start - 1); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        if timestamps, err = recentTimestamps(chainDB, start-1); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Printf("Blocks up to %d have been pruned, verifying from %d\n", start-1, start)
+    }
+
+    for height := start; height <= best; height++ {
+        block, err := chainDB.GetBlockByHeight(height)
+        if err != nil {
+            fmt.Printf("Failed to read block %d: %v\n", height, err)
+            os.Exit(1)
+        }
+        if err := blockchain.ValidateBlock(block, prev, blockchain.DefaultChainParams()); err != nil {
+            fmt.Printf("Block %d failed validation: %v\n", height, err)
+            os.Exit(1)
+        }
+        if prev != nil {
+            if err := blockchain.ValidateBlockTime(block, blockchain.MedianTimePast(timestamps), time.Now()); err != nil {
+                fmt.Printf("Block %d failed validation: %v\n", height, err)
+                os.Exit(1)
+            }
+        }
+        if timestamps = append(timestamps, block.Timestamp); len(timestamps) > blockchain.MedianTimeSpan {
+            timestamps = timestamps[1:]
+        }
+        if done := height - start + 1; done%progressInterval == 0 {
+            fmt.Printf("Verified %d/%d blocks\n", done, best-start+1)
+        }
+        prev = block
+    }
+
+    fmt.Printf("Verified blocks %d to %d\n", start, best)
+}
+
+func init() {
+    reindexCmd.Flags().BoolVar(&reindexVerifyOnly, "verify-only", false, "Only re-validate the stored blocks and report the first invalid one")
+
+    historyCmd.Flags().IntVar(&historyPage, "page", 1, "Page of the history to show")
+    historyCmd.Flags().IntVar(&historyLimit, "limit", 25, "Number of entries per page")
+
+    rootCmd.AddCommand(getTransactionCmd)
+    rootCmd.AddCommand(buildTxIndexCmd)
+    rootCmd.AddCommand(historyCmd)
+    rootCmd.AddCommand(buildAddrIndexCmd)
+    rootCmd.AddCommand(reindexCmd)
+}
+
+func openDatabase() *db.BlockchainDB {
+    chainDB, err := db.InitDatabase(chainDBPath)
+    if err != nil {
+        fmt.Println("Failed to open chain database:", err)
+        os.Exit(1)
+    }
+    return chainDB
+}
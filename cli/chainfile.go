@@ -0,0 +1,203 @@
+package cli
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+
+    "blockchain/chain"
+    "blockchain/transaction"
+    "blockchain/types"
+    "go-blockchain/db"
+    "github.com/spf13/cobra"
+)
+
+// progressInterval is how many blocks are processed between progress lines
+const progressInterval = 1000
+
+var exportFrom, exportTo int
+
+var exportChainCmd = &cobra.Command{
+    Use:   "exportchain <file>",
+    Short: "Write the stored blocks to a chain file",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        best, err := chainDB.GetBestHeight()
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        to := exportTo
+        if to < 0 || to > best {
+            to = best
+        }
+        if exportFrom < 0 || exportFrom > to {
+            fmt.Printf("Nothing to export: chain height is %d\n", best)
+            os.Exit(1)
+        }
+        if exportFrom <= chainDB.PruneHeight() {
+            fmt.Printf("Blocks up to %d have been pruned\n", chainDB.PruneHeight())
+            os.Exit(1)
+        }
+
+        file, err := os.Create(args[0])
+        if err != nil {
+            fmt.Println("Failed to create chain file:", err)
+            os.Exit(1)
+        }
+        defer file.Close()
+
+        total := to - exportFrom + 1
+        writer, err := blockchain.NewChainWriter(file, exportFrom, total)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        for height := exportFrom; height <= to; height++ {
+            block, err := chainDB.GetBlockByHeight(height)
+            if err != nil {
+                fmt.Printf("Failed to read block %d: %v\n", height, err)
+                os.Exit(1)
+            }
+            if err := writer.WriteBlock(block); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            if done := height - exportFrom + 1; done%progressInterval == 0 {
+                fmt.Printf("Exported %d/%d blocks\n", done, total)
+            }
+        }
+
+        if err := writer.Close(); err != nil {
+            fmt.Println("Failed to write chain file:", err)
+            os.Exit(1)
+        }
+        fmt.Printf("Exported blocks %d to %d to %s\n", exportFrom, to, args[0])
+    },
+}
+
+var importChainCmd = &cobra.Command{
+    Use:   "importchain <file>",
+    Short: "Validate the blocks of a chain file and add them to the chain",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        file, err := os.Open(args[0])
+        if err != nil {
+            fmt.Println("Failed to open chain file:", err)
+            os.Exit(1)
+        }
+        defer file.Close()
+
+        reader, err := blockchain.NewChainReader(file)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        header := reader.Header()
+        start, total := int(header.StartHeight), int(header.BlockCount)
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        best, err := chainDB.GetBestHeight()
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        if start > best+1 {
+            fmt.Printf("Chain file starts at block %d but the chain ends at %d\n", start, best)
+            os.Exit(1)
+        }
+
+        var prev *types.Block
+        if start > 0 {
+            if prev, err = chainDB.GetBlockHeader(start - 1); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+
+        // Transactions confirmed by the imported blocks leave the mempool, and
+        // the time they waited feeds the fee estimates
+        pool := openMempool(chainDB)
+        estimator := openFeeEstimator(chainDB)
+        pool.SetFeeEstimator(estimator)
+
+        imported, skipped := 0, 0
+        for {
+            block, err := reader.ReadBlock()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+
+            if block.Index <= best {
+                if err := blockchain.ValidateBlock(block, prev, blockchain.DefaultChainParams()); err != nil {
+                    fmt.Printf("Block %d is invalid: %v\n", block.Index, err)
+                    os.Exit(1)
+                }
+                // Blocks we already hold must be the same blocks
+                stored, err := chainDB.GetBlockHeader(block.Index)
+                if err != nil {
+                    fmt.Println(err)
+                    os.Exit(1)
+                }
+                if !bytes.Equal(stored.Hash, block.Hash) {
+                    fmt.Printf("Block %d conflicts with the stored chain\n", block.Index)
+                    os.Exit(1)
+                }
+                skipped++
+            } else {
+                // New blocks get the same checks as mined or submitted ones,
+                // spending from the UTXO set the import has built so far
+                if err := importBlock(chainDB, pool, block, prev); err != nil {
+                    fmt.Printf("Block %d is invalid: %v\n", block.Index, err)
+                    os.Exit(1)
+                }
+                imported++
+            }
+
+            if done := imported + skipped; done%progressInterval == 0 {
+                fmt.Printf("Processed %d/%d blocks\n", done, total)
+            }
+            prev = block
+        }
+
+        saveMempool(pool)
+        saveFeeEstimator(estimator)
+        fmt.Printf("Imported %d blocks, %d already in the chain\n", imported, skipped)
+    },
+}
+
+// importBlock fully validates a block read from a chain file and adds it to
+// the chain. The genesis block has no parent or coinbase, so it only gets
+// the header checks.
+func importBlock(chainDB *db.BlockchainDB, pool *transaction.TransactionPool, block, prev *types.Block) error {
+    if prev != nil {
+        return connectBlock(chainDB, pool, block)
+    }
+    if err := blockchain.ValidateBlock(block, nil, blockchain.DefaultChainParams()); err != nil {
+        return err
+    }
+    if err := addBlock(chainDB, block); err != nil {
+        return err
+    }
+    pool.BlockConnected(block)
+    return nil
+}
+
+func init() {
+    exportChainCmd.Flags().IntVar(&exportFrom, "from", 0, "Height of the first block to export")
+    exportChainCmd.Flags().IntVar(&exportTo, "to", -1, "Height of the last block to export (default: chain tip)")
+
+    rootCmd.AddCommand(exportChainCmd)
+    rootCmd.AddCommand(importChainCmd)
+}
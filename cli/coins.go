@@ -0,0 +1,185 @@
+package cli
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "os"
+
+    "blockchain/transaction"
+    "blockchain/types"
+    "blockchain/wallet"
+    "go-blockchain/db"
+)
+
+const coinsPath = "wallet.coins"
+
+// walletAddresses returns every address the loaded wallets receive coins
+// on, change addresses included
+func walletAddresses() [][]byte {
+    var addresses [][]byte
+    for _, w := range wallets {
+        addresses = append(addresses, w.Addresses()...)
+    }
+    return addresses
+}
+
+// syncCoins brings the coin tracker of the loaded wallets up to date with
+// the chain and the mempool, and saves it. Blocks the tracker saw that are
+// no longer in the chain are disconnected first. When the tracker cannot
+// follow, after a reorg deeper than it remembers or for a new set of
+// wallets, it is seeded again from the UTXO set.
+func syncCoins(chainDB *db.BlockchainDB, pool *transaction.TransactionPool) *wallet.CoinTracker {
+    tracker, err := wallet.LoadCoinTracker(coinsPath, walletAddresses())
+    if err != nil {
+        fmt.Println("Failed to load wallet coins, rescanning:", err)
+        tracker = wallet.NewCoinTracker(walletAddresses())
+    }
+
+    best, err := chainDB.GetBestHeight()
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+
+    for tracker.Height() >= 0 {
+        height := tracker.Height()
+        if height <= best {
+            tracked, _ := tracker.BlockHash(height)
+            header, err := chainDB.GetBlockHeader(height)
+            if err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            if bytes.Equal(header.Hash, tracked) {
+                break
+            }
+        }
+        if err := tracker.DisconnectTip(); errors.Is(err, wallet.ErrReorgTooDeep) {
+            tracker = wallet.NewCoinTracker(walletAddresses())
+        }
+    }
+    if tracker.Height() < 0 {
+        seedCoins(chainDB, tracker)
+    }
+
+    for height := tracker.Height() + 1; height <= best; height++ {
+        block, err := chainDB.GetBlockByHeight(height)
+        if err != nil {
+            fmt.Printf("Failed to read block %d: %v\n", height, err)
+            os.Exit(1)
+        }
+        if err := tracker.ConnectBlock(block); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+    }
+
+    var pending []types.Transaction
+    for _, entry := range pool.Entries() {
+        pending = append(pending, entry.Tx)
+    }
+    tracker.SetMempool(pending)
+
+    if err := tracker.Save(coinsPath); err != nil {
+        fmt.Println("Failed to save wallet coins:", err)
+        os.Exit(1)
+    }
+
+    // Watch-only wallets keep a gap of unused addresses past those that
+    // received coins, and the coins of new addresses need a rescan
+    if extendWatchedAddresses(tracker.Used) > 0 {
+        saveWallets()
+        return syncCoins(chainDB, pool)
+    }
+    return tracker
+}
+
+// extendWatchedAddresses derives the addresses watch-only wallets need to
+// keep GapLimit unused ones, and returns how many were added
+func extendWatchedAddresses(used func(address []byte) bool) int {
+    added := 0
+    for _, w := range wallets {
+        if !w.WatchOnly {
+            continue
+        }
+        n, err := w.ExtendAddresses(used)
+        if err != nil {
+            fmt.Printf("Failed to derive addresses of %s: %v\n", w.Alias, err)
+            os.Exit(1)
+        }
+        added += n
+    }
+    return added
+}
+
+// usedAddresses returns a test of whether any stored block pays an
+// address, answered by the address index when it is enabled. Blocks
+// already pruned are not seen.
+func usedAddresses(chainDB *db.BlockchainDB) func(address []byte) bool {
+    if chainDB.AddressIndexEnabled() {
+        return func(address []byte) bool {
+            totals, err := chainDB.GetAddressTotals(address)
+            return err == nil && totals.TxCount > 0
+        }
+    }
+
+    best, err := chainDB.GetBestHeight()
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    used := make(map[string]bool)
+    for height := chainDB.PruneHeight() + 1; height <= best; height++ {
+        block, err := chainDB.GetBlockByHeight(height)
+        if err != nil {
+            fmt.Printf("Failed to read block %d: %v\n", height, err)
+            os.Exit(1)
+        }
+        for _, tx := range block.Transactions {
+            for _, output := range tx.Outputs {
+                used[string(output.Address)] = true
+            }
+        }
+    }
+    return func(address []byte) bool {
+        return used[string(address)]
+    }
+}
+
+// seedCoins starts a new tracker from the unspent outputs of the wallets in
+// the UTXO set, which also covers pruned blocks
+func seedCoins(chainDB *db.BlockchainDB, tracker *wallet.CoinTracker) {
+    height, err := chainDB.UTXOHeight()
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    if height < 0 {
+        return
+    }
+    header, err := chainDB.GetBlockHeader(height)
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+
+    var coins []wallet.Coin
+    for _, address := range walletAddresses() {
+        entries, err := chainDB.GetUTXOsByAddress(address)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        for _, entry := range entries {
+            coins = append(coins, wallet.Coin{
+                TxHash:   entry.TxHash,
+                Index:    entry.OutputIndex,
+                Output:   entry.Output,
+                Height:   entry.BlockIndex,
+                Coinbase: entry.IsCoinbase,
+            })
+        }
+    }
+    tracker.Seed(height, header.Hash, coins)
+}
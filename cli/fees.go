@@ -0,0 +1,74 @@
+package cli
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strconv"
+
+    "blockchain/transaction"
+    "go-blockchain/db"
+    "github.com/spf13/cobra"
+)
+
+const feeEstimatesPath = "fee_estimates.dat"
+
+var feeConfidence float64
+
+var estimateFeeCmd = &cobra.Command{
+    Use:   "estimatefee <blocks>",
+    Short: "Estimate the fee rate needed to confirm within a number of blocks",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        target, err := strconv.Atoi(args[0])
+        if err != nil {
+            fmt.Println("Invalid number of blocks")
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        estimator := openFeeEstimator(chainDB)
+        rate, err := estimator.EstimateFeeConfidence(target, feeConfidence)
+        if errors.Is(err, transaction.ErrNoEstimate) {
+            fmt.Printf("Not enough transactions seen to estimate a fee for %d blocks\n", target)
+            os.Exit(1)
+        }
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Printf("%.8f per byte\n", rate)
+    },
+}
+
+func init() {
+    estimateFeeCmd.Flags().Float64Var(&feeConfidence, "confidence", transaction.DefaultFeeConfidence, "Share of transactions at the estimated rate that confirmed in time")
+    rootCmd.AddCommand(estimateFeeCmd)
+}
+
+// openFeeEstimator loads the saved fee estimator, starting a fresh one at
+// the chain tip if there is none
+func openFeeEstimator(chainDB *db.BlockchainDB) *transaction.FeeEstimator {
+    best, err := chainDB.GetBestHeight()
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    estimator, err := transaction.LoadFeeEstimator(feeEstimatesPath, best)
+    if err != nil {
+        // Estimates are rebuilt from the next blocks
+        fmt.Println("Failed to load fee estimates, starting fresh:", err)
+        estimator = transaction.NewFeeEstimator(best)
+    }
+    return estimator
+}
+
+// saveFeeEstimator writes the fee estimator state to its file
+func saveFeeEstimator(estimator *transaction.FeeEstimator) {
+    if err := estimator.Save(feeEstimatesPath); err != nil {
+        fmt.Println("Failed to save fee estimates:", err)
+        os.Exit(1)
+    }
+}
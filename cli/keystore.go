@@ -0,0 +1,198 @@
+package cli
+
+import (
+    "bufio"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "blockchain/wallet"
+    "github.com/spf13/cobra"
+    "golang.org/x/term"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+var encryptWalletCmd = &cobra.Command{
+    Use:   "encryptwallet",
+    Short: "Encrypt the wallet mnemonics with a passphrase",
+    Run: func(cmd *cobra.Command, args []string) {
+        loadWallets()
+        if keystore.Encrypted() {
+            fmt.Println("Wallet is already encrypted, use changepassphrase to change its passphrase")
+            os.Exit(1)
+        }
+
+        passphrase := readNewPassphrase()
+        setPassphrase(passphrase)
+        saveWallets()
+        lockWallet()
+
+        fmt.Println("Wallet encrypted, unlock it with walletpassphrase to sign transactions")
+        if _, err := os.Stat(walletsPath + ".bak"); err == nil {
+            fmt.Printf("Warning: %s.bak still holds unencrypted mnemonics\n", walletsPath)
+        }
+    },
+}
+
+var walletPassphraseCmd = &cobra.Command{
+    Use:   "walletpassphrase <timeout>",
+    Short: "Unlock the wallet for <timeout> seconds",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        timeout, err := strconv.Atoi(args[0])
+        if err != nil || timeout <= 0 {
+            fmt.Println("Timeout must be a positive number of seconds")
+            os.Exit(1)
+        }
+
+        loadWallets()
+        if !keystore.Encrypted() {
+            fmt.Println("Wallet is not encrypted")
+            os.Exit(1)
+        }
+        key, err := keystore.Unlock(readPassphrase("Passphrase: "))
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        if err := lockWallet(); err != nil {
+            fmt.Println("Failed to lock wallet:", err)
+            os.Exit(1)
+        }
+        expires := time.Now().Add(time.Duration(timeout) * time.Second)
+        if err := startUnlockAgent(key, expires); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Printf("Wallet unlocked until %s\n", expires.Format(time.RFC3339))
+    },
+}
+
+var walletLockCmd = &cobra.Command{
+    Use:   "walletlock",
+    Short: "Lock the wallet before its unlock timeout",
+    Run: func(cmd *cobra.Command, args []string) {
+        if err := lockWallet(); err != nil {
+            fmt.Println("Failed to lock wallet:", err)
+            os.Exit(1)
+        }
+        fmt.Println("Wallet locked")
+    },
+}
+
+var changePassphraseCmd = &cobra.Command{
+    Use:   "changepassphrase",
+    Short: "Change the wallet passphrase",
+    Run: func(cmd *cobra.Command, args []string) {
+        loadWallets()
+        if !keystore.Encrypted() {
+            fmt.Println("Wallet is not encrypted, use encryptwallet")
+            os.Exit(1)
+        }
+        key, err := keystore.Unlock(readPassphrase("Current passphrase: "))
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        for _, w := range wallets {
+            if err := w.Decrypt(key); err != nil {
+                fmt.Printf("Failed to decrypt wallet %s: %v\n", w.Alias, err)
+                os.Exit(1)
+            }
+        }
+
+        setPassphrase(readNewPassphrase())
+        saveWallets()
+        lockWallet()
+        fmt.Println("Passphrase changed, the wallet is locked")
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(encryptWalletCmd)
+    rootCmd.AddCommand(walletPassphraseCmd)
+    rootCmd.AddCommand(walletLockCmd)
+    rootCmd.AddCommand(changePassphraseCmd)
+}
+
+// setPassphrase makes the key of passphrase, with a fresh salt, the key of
+// the loaded keystore
+func setPassphrase(passphrase string) {
+    params, err := wallet.NewKDFParams()
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    key, err := params.DeriveKey(passphrase)
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    if err := keystore.SetKey(params, key); err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    keystoreKey = key
+}
+
+// unlockedKey returns the key of ks held by the unlock agent, stopping
+// agents holding the key of an old passphrase
+func unlockedKey(ks *wallet.Keystore) ([]byte, bool) {
+    answer, err := askUnlockAgent("key")
+    if err != nil {
+        lockWallet()
+        return nil, false
+    }
+    key, err := hex.DecodeString(answer)
+    if err != nil || ks.CheckKey(key) != nil {
+        lockWallet()
+        return nil, false
+    }
+    return key, true
+}
+
+// exitLocked stops a command needing the secrets of a locked wallet
+func exitLocked() {
+    fmt.Println("Wallet is locked, unlock it with walletpassphrase <timeout>")
+    os.Exit(1)
+}
+
+// readPassphrase prompts for a passphrase and reads it from standard input,
+// without echo when that is a terminal
+func readPassphrase(prompt string) string {
+    fmt.Fprint(os.Stderr, prompt)
+    if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+        passphrase, err := term.ReadPassword(fd)
+        fmt.Fprintln(os.Stderr)
+        if err != nil {
+            fmt.Println("Failed to read passphrase:", err)
+            os.Exit(1)
+        }
+        return string(passphrase)
+    }
+    line, err := stdin.ReadString('\n')
+    if err != nil && line == "" {
+        fmt.Println("\nFailed to read passphrase:", err)
+        os.Exit(1)
+    }
+    return strings.TrimRight(line, "\r\n")
+}
+
+// readNewPassphrase reads a new passphrase twice and checks both match
+func readNewPassphrase() string {
+    passphrase := readPassphrase("New passphrase: ")
+    if passphrase == "" {
+        fmt.Println("Passphrase must not be empty")
+        os.Exit(1)
+    }
+    if readPassphrase("Repeat passphrase: ") != passphrase {
+        fmt.Println("Passphrases do not match")
+        os.Exit(1)
+    }
+    return passphrase
+}
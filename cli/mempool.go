@@ -0,0 +1,137 @@
+package cli
+
+import (
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "os"
+
+    "blockchain/transaction"
+    "blockchain/types"
+    "go-blockchain/db"
+    "github.com/spf13/cobra"
+)
+
+const mempoolPath = "mempool.dat"
+
+// localPeer is the peer orphans submitted from the command line are held for
+const localPeer = "local"
+
+var sendRawTransactionCmd = &cobra.Command{
+    Use:   "sendrawtransaction <hex>",
+    Short: "Validate a serialized transaction and add it to the mempool",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        data, err := hex.DecodeString(args[0])
+        if err != nil {
+            fmt.Println("Invalid transaction hex")
+            os.Exit(1)
+        }
+        tx, err := types.DeserializeTransaction(data)
+        if err != nil {
+            fmt.Println("Invalid transaction:", err)
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        pool := openMempool(chainDB)
+        estimator := openFeeEstimator(chainDB)
+        pool.SetFeeEstimator(estimator)
+        accepted, err := submitTransaction(pool, *tx)
+        switch {
+        case errors.Is(err, transaction.ErrOrphan):
+            fmt.Println("Spends unknown outputs, holding it until its parents are submitted")
+        case err != nil:
+            fmt.Println("Transaction rejected:", err)
+            os.Exit(1)
+        case len(accepted) > 1:
+            fmt.Printf("Also accepted %d held transactions spending it\n", len(accepted)-1)
+        }
+        saveMempool(pool)
+        saveFeeEstimator(estimator)
+        fmt.Printf("%x\n", tx.Hash())
+    },
+}
+
+var saveMempoolCmd = &cobra.Command{
+    Use:   "savemempool",
+    Short: "Revalidate the saved mempool against the chain and write it back",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        pool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), chainDB)
+        stats, err := pool.LoadFile(mempoolPath)
+        if err != nil {
+            fmt.Println("Failed to load mempool:", err)
+            os.Exit(1)
+        }
+        saveMempool(pool)
+        fmt.Printf("Saved %d transactions and %d orphans to %s (%d no longer valid)\n", pool.Count(), pool.OrphanCount(), mempoolPath, stats.Failed)
+    },
+}
+
+var mempoolInfoCmd = &cobra.Command{
+    Use:   "mempoolinfo",
+    Short: "Show the state of the mempool",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        config := transaction.DefaultPoolConfig()
+        pool := openMempool(chainDB)
+
+        var fees, minFeeRate float64
+        entries := pool.Entries()
+        for i, entry := range entries {
+            fees += entry.Fee
+            if i == 0 || entry.FeeRate < minFeeRate {
+                minFeeRate = entry.FeeRate
+            }
+        }
+
+        fmt.Printf("Transactions:   %d\n", pool.Count())
+        fmt.Printf("Orphans:        %d\n", pool.OrphanCount())
+        fmt.Printf("Size:           %d bytes\n", pool.Size())
+        fmt.Printf("Usage:          %.2f%% of %d bytes\n", float64(pool.Size())*100/float64(config.MaxSize), config.MaxSize)
+        fmt.Printf("Total fees:     %.8f\n", fees)
+        fmt.Printf("Min fee rate:   %.8f per byte\n", minFeeRate)
+        fmt.Printf("Pool min rate:  %.8f per byte\n", config.MinFeeRate)
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(sendRawTransactionCmd)
+    rootCmd.AddCommand(saveMempoolCmd)
+    rootCmd.AddCommand(mempoolInfoCmd)
+}
+
+// submitTransaction adds a transaction submitted from the command line to
+// the pool. As for one relayed by a peer, a transaction spending outputs
+// not known yet is held as an orphan, and saved with the mempool, until its
+// parents are submitted. It returns the transactions accepted, orphans
+// included.
+func submitTransaction(pool *transaction.TransactionPool, tx types.Transaction) ([]types.Transaction, error) {
+    return pool.ProcessTransaction(tx, localPeer)
+}
+
+// openMempool loads the pending transactions saved in the mempool file,
+// dropping any that are no longer valid against the chain
+func openMempool(chainDB *db.BlockchainDB) *transaction.TransactionPool {
+    pool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), chainDB)
+    if _, err := pool.LoadFile(mempoolPath); err != nil {
+        // An unreadable file only costs the pending transactions
+        fmt.Println("Failed to load mempool, starting empty:", err)
+    }
+    return pool
+}
+
+// saveMempool writes the pending transactions to the mempool file
+func saveMempool(pool *transaction.TransactionPool) {
+    if err := pool.DumpFile(mempoolPath); err != nil {
+        fmt.Println("Failed to save mempool:", err)
+        os.Exit(1)
+    }
+}
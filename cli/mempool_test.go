@@ -0,0 +1,84 @@
+package cli
+
+import (
+    "os"
+    "testing"
+    "time"
+
+    "blockchain/transaction"
+    "blockchain/types"
+    "blockchain/wallet"
+)
+
+func TestSubmitTransactionHoldsOrphans(t *testing.T) {
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(t.TempDir()); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Chdir(wd)
+
+    chainDB := openDatabase()
+    defer chainDB.Close()
+
+    key, err := wallet.GenerateKey()
+    if err != nil {
+        t.Fatalf("GenerateKey failed: %v", err)
+    }
+    owner := wallet.AddressFromPublicKey(&key.PublicKey, true)
+    payment := func(prevHash []byte, amount float64) types.Transaction {
+        return types.Transaction{
+            Version: 1,
+            Inputs:  []types.Input{{PreviousTxHash: prevHash, OutputIndex: 0, Sequence: types.SequenceFinal}},
+            Outputs: []types.Output{{Amount: amount, ScriptPubKey: owner, ScriptType: "P2PKH", Address: owner}},
+        }
+    }
+
+    coinbase := types.Transaction{
+        Version: 1,
+        Inputs:  []types.Input{*types.NewCoinbaseInput([]byte{0})},
+        Outputs: []types.Output{{Amount: 50, ScriptPubKey: []byte("miner"), ScriptType: "P2PKH", Address: []byte("miner")}},
+    }
+    funding := payment([]byte("elsewhere"), 10)
+    funding.Inputs[0].ScriptSig = []byte{0}
+    block := &types.Block{Timestamp: time.Now().Unix(), Transactions: []types.Transaction{coinbase, funding}, PrevHash: []byte{0}, Hash: []byte("block")}
+    if err := chainDB.AddBlock(block); err != nil {
+        t.Fatalf("AddBlock failed: %v", err)
+    }
+
+    signed := func(prev *types.Transaction, amount float64) types.Transaction {
+        tx := payment(prev.Hash(), amount)
+        if err := transaction.SignInput(&tx, 0, &prev.Outputs[0], key); err != nil {
+            t.Fatalf("SignInput failed: %v", err)
+        }
+        return tx
+    }
+    parent := signed(&funding, 9.9)
+    child := signed(&parent, 9.8)
+
+    // The child is submitted first and waits in the saved mempool
+    pool := openMempool(chainDB)
+    if _, err := submitTransaction(pool, child); err != transaction.ErrOrphan {
+        t.Fatalf("Expected ErrOrphan, got %v", err)
+    }
+    saveMempool(pool)
+
+    pool = openMempool(chainDB)
+    if pool.OrphanCount() != 1 {
+        t.Fatalf("Expected the orphan to be saved, got %d", pool.OrphanCount())
+    }
+    accepted, err := submitTransaction(pool, parent)
+    if err != nil {
+        t.Fatalf("Submitting the parent failed: %v", err)
+    }
+    if len(accepted) != 2 {
+        t.Errorf("Expected the parent and the held child to be accepted, got %d", len(accepted))
+    }
+    saveMempool(pool)
+
+    if pool = openMempool(chainDB); pool.Count() != 2 || pool.OrphanCount() != 0 {
+        t.Errorf("Expected 2 pooled transactions and no orphans, got %d and %d", pool.Count(), pool.OrphanCount())
+    }
+}
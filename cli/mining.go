@@ -0,0 +1,292 @@
+package cli
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "os/signal"
+    "runtime"
+    "syscall"
+    "time"
+
+    "blockchain/chain"
+    "blockchain/consensus"
+    "blockchain/transaction"
+    "blockchain/types"
+    "go-blockchain/db"
+    "github.com/spf13/cobra"
+)
+
+// ErrStaleBlock is returned for a submitted block that does not extend the
+// chain tip
+var ErrStaleBlock = errors.New("block does not extend the chain tip")
+
+var getBlockTemplateCmd = &cobra.Command{
+    Use:   "getblocktemplate",
+    Short: "Print a template of the next block for an external miner",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        prev := chainTip(chainDB)
+        template := blockchain.NewBlockTemplate(prev, openMempool(chainDB), blockchain.DefaultChainParams())
+
+        type templateTx struct {
+            TxID string  `json:"txid"`
+            Data string  `json:"data"`
+            Fee  float64 `json:"fee"`
+            Size uint64  `json:"size"`
+        }
+        txs := []templateTx{}
+        for _, tx := range template.Transactions {
+            txs = append(txs, templateTx{
+                TxID: hex.EncodeToString(tx.Tx.Hash()),
+                Data: hex.EncodeToString(tx.Tx.Serialize()),
+                Fee:  tx.Fee,
+                Size: tx.Size,
+            })
+        }
+        branch := []string{}
+        for _, hash := range template.MerkleBranch {
+            branch = append(branch, hex.EncodeToString(hash))
+        }
+
+        out, _ := json.MarshalIndent(struct {
+            Height            int          `json:"height"`
+            PreviousBlockHash string       `json:"previousBlockHash"`
+            Bits              string       `json:"bits"`
+            CurTime           int64        `json:"curTime"`
+            CoinbaseValue     float64      `json:"coinbaseValue"`
+            SizeLimit         int          `json:"sizeLimit"`
+            Transactions      []templateTx `json:"transactions"`
+            MerkleBranch      []string     `json:"merkleBranch"`
+        }{
+            Height:            template.Height,
+            PreviousBlockHash: hex.EncodeToString(template.PrevHash),
+            Bits:              fmt.Sprintf("%08x", template.Bits),
+            CurTime:           template.Timestamp,
+            CoinbaseValue:     template.CoinbaseValue,
+            SizeLimit:         consensus.MaxBlockSize,
+            Transactions:      txs,
+            MerkleBranch:      branch,
+        }, "", "  ")
+        fmt.Println(string(out))
+    },
+}
+
+var submitBlockCmd = &cobra.Command{
+    Use:   "submitblock <hex>",
+    Short: "Validate a mined block and add it to the chain",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        data, err := hex.DecodeString(args[0])
+        if err != nil {
+            fmt.Println("Invalid block hex")
+            os.Exit(1)
+        }
+        block, err := types.DeserializeBlock(data)
+        if err != nil {
+            fmt.Println("Invalid block:", err)
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        if err := submitBlock(chainDB, block); err != nil {
+            fmt.Println("Block rejected:", err)
+            os.Exit(1)
+        }
+        fmt.Printf("Block %d accepted: %x\n", block.Index, block.Hash)
+    },
+}
+
+var disconnectBlockCmd = &cobra.Command{
+    Use:   "disconnectblock",
+    Short: "Remove the tip block from the chain, returning its transactions to the mempool",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        block, err := chainDB.DisconnectBlock()
+        if errors.Is(err, db.ErrNoUndoData) {
+            fmt.Printf("%v, run reindex first\n", err)
+            os.Exit(1)
+        }
+        if err != nil {
+            fmt.Println("Failed to disconnect block:", err)
+            os.Exit(1)
+        }
+
+        pool := openMempool(chainDB)
+        returned := pool.BlockDisconnected(block)
+        saveMempool(pool)
+        fmt.Printf("Block %d disconnected: %x\n", block.Index, block.Hash)
+        fmt.Printf("%d of %d transactions returned to the mempool\n", len(returned), len(block.Transactions)-1)
+    },
+}
+
+var mineAddress string
+var mineThreads int
+
+var mineCmd = &cobra.Command{
+    Use:   "mine",
+    Short: "Mine blocks continuously until interrupted",
+    Run: func(cmd *cobra.Command, args []string) {
+        payTo, err := walletAddress(mineAddress)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        // The mempool file is read again for every template so that
+        // transactions saved by other commands are picked up
+        newTemplate := func() (*blockchain.BlockTemplate, error) {
+            prev, err := tipHeader(chainDB)
+            if err != nil {
+                return nil, err
+            }
+            return blockchain.NewBlockTemplate(prev, openMempool(chainDB), blockchain.DefaultChainParams()), nil
+        }
+        submit := func(block *types.Block) error {
+            if err := submitBlock(chainDB, block); err != nil {
+                fmt.Printf("Block %d rejected: %v\n", block.Index, err)
+                return err
+            }
+            fmt.Printf("Block %d mined with %d transactions: %x\n", block.Index, len(block.Transactions)-1, block.Hash)
+            return nil
+        }
+
+        config := blockchain.DefaultMiningConfig()
+        config.PayTo = payTo
+        config.Threads = mineThreads
+        service := blockchain.NewMiningService(config, newTemplate, submit)
+
+        stop := make(chan struct{})
+        signals := make(chan os.Signal, 1)
+        signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+        defer signal.Stop(signals)
+        go func() {
+            <-signals
+            close(stop)
+        }()
+
+        fmt.Printf("Mining to %s with %d threads, press Ctrl-C to stop\n", encodeAddress(payTo), mineThreads)
+        if err := service.Run(stop); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        stats := service.Stats()
+        fmt.Printf("Mined %d blocks (%d rejected), %.0f hashes/s\n", stats.Blocks, stats.Rejected, stats.HashRate())
+    },
+}
+
+func init() {
+    mineCmd.Flags().StringVar(&mineAddress, "address", "", "Wallet alias or address receiving the coinbase, the default wallet if empty")
+    mineCmd.Flags().IntVar(&mineThreads, "threads", runtime.NumCPU(), "Number of mining threads")
+    rootCmd.AddCommand(getBlockTemplateCmd)
+    rootCmd.AddCommand(submitBlockCmd)
+    rootCmd.AddCommand(disconnectBlockCmd)
+    rootCmd.AddCommand(mineCmd)
+}
+
+// chainTip returns the header of the last block of the chain
+func chainTip(chainDB *db.BlockchainDB) *types.Block {
+    prev, err := tipHeader(chainDB)
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    return prev
+}
+
+// tipHeader returns the header of the last block of the chain
+func tipHeader(chainDB *db.BlockchainDB) (*types.Block, error) {
+    best, err := chainDB.GetBestHeight()
+    if err != nil {
+        return nil, err
+    }
+    if best < 0 {
+        return nil, errors.New("the chain has no genesis block")
+    }
+    return chainDB.GetBlockHeader(best)
+}
+
+// submitBlock fully validates a block extending the chain tip and adds it
+// to the chain, removing its transactions from the saved mempool
+func submitBlock(chainDB *db.BlockchainDB, block *types.Block) error {
+    pool := openMempool(chainDB)
+    estimator := openFeeEstimator(chainDB)
+    pool.SetFeeEstimator(estimator)
+
+    if err := connectBlock(chainDB, pool, block); err != nil {
+        return err
+    }
+    saveMempool(pool)
+    saveFeeEstimator(estimator)
+    return nil
+}
+
+// connectBlock fully validates a block extending the chain tip, adds it to
+// the chain and removes its transactions from pool
+func connectBlock(chainDB *db.BlockchainDB, pool *transaction.TransactionPool, block *types.Block) error {
+    prev, err := tipHeader(chainDB)
+    if err != nil {
+        return err
+    }
+    if block.Index <= prev.Index {
+        return ErrStaleBlock
+    }
+    if err := blockchain.ValidateBlock(block, prev, blockchain.DefaultChainParams()); err != nil {
+        return err
+    }
+    timestamps, err := recentTimestamps(chainDB, prev.Index)
+    if err != nil {
+        return err
+    }
+    if err := blockchain.ValidateBlockTime(block, blockchain.MedianTimePast(timestamps), time.Now()); err != nil {
+        return err
+    }
+    if err := blockchain.ValidateBlockTransactions(block, chainDB); err != nil {
+        return err
+    }
+
+    if err := addBlock(chainDB, block); err != nil {
+        return err
+    }
+    pool.BlockConnected(block)
+    return nil
+}
+
+// addBlock stores a validated block. Pruning after it may fail with the
+// block stored all the same, so that is only reported.
+func addBlock(chainDB *db.BlockchainDB, block *types.Block) error {
+    err := chainDB.AddBlock(block)
+    if errors.Is(err, db.ErrPruneFailed) {
+        fmt.Println(err)
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to add block: %v", err)
+    }
+    return nil
+}
+
+// recentTimestamps returns the timestamps of the last
+// blockchain.MedianTimeSpan blocks up to height, oldest first
+func recentTimestamps(chainDB *db.BlockchainDB, height int) ([]int64, error) {
+    var timestamps []int64
+    for h := max(0, height-blockchain.MedianTimeSpan+1); h <= height; h++ {
+        header, err := chainDB.GetBlockHeader(h)
+        if err != nil {
+            return nil, err
+        }
+        timestamps = append(timestamps, header.Timestamp)
+    }
+    return timestamps, nil
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+    "bytes"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "strconv"
+
+    "blockchain/wallet"
+    "github.com/spf13/cobra"
+)
+
+var multisigAlias string
+
+var createMultisigCmd = &cobra.Command{
+    Use:   "createmultisig <m> <pubkey>...",
+    Short: "Watch a P2SH address spendable by any m of the public keys, as shown by getpubkey",
+    Args:  cobra.MinimumNArgs(2),
+    Run: func(cmd *cobra.Command, args []string) {
+        m, err := strconv.Atoi(args[0])
+        if err != nil {
+            fmt.Println("Number of signatures must be an integer")
+            os.Exit(1)
+        }
+        var pubKeys [][]byte
+        for _, arg := range args[1:] {
+            pubKey, err := hex.DecodeString(arg)
+            if err != nil {
+                fmt.Printf("Invalid public key %s: %v\n", arg, err)
+                os.Exit(1)
+            }
+            pubKeys = append(pubKeys, pubKey)
+        }
+
+        alias := multisigAlias
+        if alias == "" {
+            if alias, err = wallet.GenerateAlias(); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+        vault, err := wallet.NewMultisigWallet(m, pubKeys, alias)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        loadWallets()
+        for _, w := range wallets {
+            if w.Alias == alias {
+                fmt.Printf("A wallet called %s already exists\n", alias)
+                os.Exit(1)
+            }
+            if w.IsMultisig() && bytes.Equal(w.Address, vault.Address) {
+                fmt.Printf("Already watching this multisig address as %s\n", w.Alias)
+                os.Exit(1)
+            }
+        }
+        wallets = append(wallets, CliWallet{false, vault})
+        saveWallets()
+
+        fmt.Printf("Created %d of %d multisig wallet %s\n", m, len(pubKeys), alias)
+        fmt.Println("Address:", ownAddress(vault, vault.Address))
+        fmt.Println("Redeem script:", hex.EncodeToString(vault.RedeemScript))
+    },
+}
+
+var getPubKeyCmd = &cobra.Command{
+    Use:   "getpubkey [walletID]",
+    Short: "Show the public key of a wallet's address, for creating a multisig address with it",
+    Args:  cobra.MaximumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        id := ""
+        if len(args) == 1 {
+            id = args[0]
+        }
+        loadWallets()
+        w := findWallet(id)
+
+        switch {
+        case w.IsMultisig():
+            fmt.Println("Multisig wallets have no key of their own, use a co-signer's")
+            os.Exit(1)
+        case w.WatchOnly && w.AccountKey == "":
+            fmt.Println("Wallet watches a list of addresses and has no public keys")
+            os.Exit(1)
+        case w.IsLocked() && !w.WatchOnly:
+            exitLocked()
+        case w.NeedsMigration():
+            fmt.Printf("Wallet %s uses a legacy key, run migratewallets first\n", w.Alias)
+            os.Exit(1)
+        }
+
+        origin, err := w.KeyOrigin(w.Address)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println(hex.EncodeToString(origin.PubKey))
+    },
+}
+
+func init() {
+    createMultisigCmd.Flags().StringVar(&multisigAlias, "alias", "", "Alias of the multisig wallet (default: a generated one)")
+
+    rootCmd.AddCommand(createMultisigCmd)
+    rootCmd.AddCommand(getPubKeyCmd)
+}
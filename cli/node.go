@@ -1,20 +1,285 @@
 package cli
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
+    "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
 
+    "blockchain/chain"
+    "blockchain/transaction"
+    "blockchain/types"
+    "go-blockchain/db"
     "github.com/spf13/cobra"
 )
 
+var txIndex, addrIndex bool
+var pruneTarget string
+var persistMempool bool
+var stratumAddr, stratumPayTo string
+var shareDifficulty uint32
+
+const (
+    // mempoolDumpInterval is how often a running node saves its mempool
+    mempoolDumpInterval = 15 * time.Minute
+    // mempoolSyncInterval is how often a running node picks up the
+    // transactions other commands saved to the mempool file
+    mempoolSyncInterval = 10 * time.Second
+    // stratumJobInterval is how often miners are sent a job with the
+    // transactions that arrived since the last one
+    stratumJobInterval = 30 * time.Second
+)
+
 var startNodeCmd = &cobra.Command{
     Use:   "startnode",
     Short: "Start the full node",
     Run: func(cmd *cobra.Command, args []string) {
         fmt.Println("Starting full node...")
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        if txIndex && !chainDB.TxIndexEnabled() {
+            fmt.Println("Building transaction index...")
+            if err := chainDB.EnableTxIndex(); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+        if addrIndex && !chainDB.AddressIndexEnabled() {
+            fmt.Println("Building address index...")
+            if err := chainDB.EnableAddressIndex(); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+
+        if pruneTarget != "" {
+            config, err := parsePruneTarget(pruneTarget)
+            if err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            if err := chainDB.EnablePruning(config); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            fmt.Printf("Pruning enabled, block bodies up to height %d removed\n", chainDB.PruneHeight())
+        }
+        fmt.Println(servicesSummary(chainDB))
+
+        pool := transaction.NewTransactionPool(transaction.DefaultPoolConfig(), chainDB)
+        if persistMempool {
+            stats, err := pool.LoadFile(mempoolPath)
+            if err != nil {
+                fmt.Println("Failed to load mempool, starting empty:", err)
+            } else {
+                fmt.Printf("Loaded %d mempool transactions (%d no longer valid)\n", stats.Loaded, stats.Failed)
+            }
+        }
+
+        estimator := openFeeEstimator(chainDB)
+        pool.SetFeeEstimator(estimator)
+
+        var server *blockchain.StratumServer
+        if stratumAddr != "" {
+            var err error
+            if server, err = startStratum(chainDB, pool); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            defer server.Close()
+            fmt.Println("Stratum server listening on", server.Addr())
+        }
+
         // TODO: Add logic to start the node
+        fmt.Println("Node running, press Ctrl-C to stop")
+        runNode(pool, estimator, server)
+    },
+}
+
+var getNetworkInfoCmd = &cobra.Command{
+    Use:   "getnetworkinfo",
+    Short: "Show the services the node advertises to peers and the blocks it can serve",
+    Run: func(cmd *cobra.Command, args []string) {
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        best, err := chainDB.GetBestHeight()
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        out, _ := json.MarshalIndent(struct {
+            Services    uint64 `json:"services"`
+            Pruned      bool   `json:"pruned"`
+            PruneHeight int    `json:"pruneHeight"`
+            ServesFrom  int    `json:"servesFrom"`
+            BestHeight  int    `json:"bestHeight"`
+        }{chainDB.Services(), chainDB.PruneHeight() >= 0, chainDB.PruneHeight(), chainDB.PruneHeight() + 1, best}, "", " ")
+        fmt.Println(string(out))
     },
 }
 
 func init() {
+    rootCmd.AddCommand(getNetworkInfoCmd)
+    startNodeCmd.Flags().BoolVar(&txIndex, "txindex", false, "Maintain an index of all transactions by hash")
+    startNodeCmd.Flags().BoolVar(&addrIndex, "addrindex", false, "Maintain an index of credits and debits by address")
+    startNodeCmd.Flags().StringVar(&pruneTarget, "prune", "", "Delete old block bodies, keeping <N>MB of blocks or the last <N> blocks")
+    startNodeCmd.Flags().BoolVar(&persistMempool, "persistmempool", true, "Save the mempool on shutdown and periodically, and reload it on startup")
+    startNodeCmd.Flags().StringVar(&stratumAddr, "stratum", "", "Serve mining jobs to Stratum miners on this address, such as :3333")
+    startNodeCmd.Flags().StringVar(&stratumPayTo, "payto", "", "Address receiving the coinbase of blocks found by Stratum miners")
+    startNodeCmd.Flags().Uint32Var(&shareDifficulty, "share-difficulty", blockchain.DefaultStratumConfig().ShareDifficulty, "Leading zero bits required of Stratum shares")
     rootCmd.AddCommand(startNodeCmd)
 }
+
+// startStratum starts a Stratum server mining on the chain tip with the
+// transactions of pool
+func startStratum(chainDB *db.BlockchainDB, pool *transaction.TransactionPool) (*blockchain.StratumServer, error) {
+    if stratumPayTo == "" {
+        return nil, errors.New("--payto must be set to an address with --stratum")
+    }
+    payTo, err := coinbaseAddress(stratumPayTo)
+    if err != nil {
+        return nil, fmt.Errorf("invalid --payto address: %v", err)
+    }
+
+    config := blockchain.DefaultStratumConfig()
+    config.ShareDifficulty = shareDifficulty
+    config.PayTo = payTo
+
+    // Blocks from different miners are connected one at a time
+    var mu sync.Mutex
+    newTemplate := func() (*blockchain.BlockTemplate, error) {
+        prev, err := tipHeader(chainDB)
+        if err != nil {
+            return nil, err
+        }
+        return blockchain.NewBlockTemplate(prev, pool, blockchain.DefaultChainParams()), nil
+    }
+    submit := func(block *types.Block) error {
+        mu.Lock()
+        defer mu.Unlock()
+        if err := connectBlock(chainDB, pool, block); err != nil {
+            fmt.Printf("Block %d from Stratum miner rejected: %v\n", block.Index, err)
+            return err
+        }
+        fmt.Printf("Block %d found by Stratum miner: %x\n", block.Index, block.Hash)
+        return nil
+    }
+
+    server := blockchain.NewStratumServer(config, newTemplate, submit)
+    if err := server.Listen(stratumAddr); err != nil {
+        return nil, err
+    }
+    return server, nil
+}
+
+// runNode blocks until the node is interrupted, saving the mempool and fee
+// estimates periodically and once more on shutdown, and refreshing the
+// Stratum job if a server is running
+func runNode(pool *transaction.TransactionPool, estimator *transaction.FeeEstimator, server *blockchain.StratumServer) {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    defer signal.Stop(signals)
+
+    ticker := time.NewTicker(mempoolDumpInterval)
+    defer ticker.Stop()
+    syncTicker := time.NewTicker(mempoolSyncInterval)
+    defer syncTicker.Stop()
+    jobTicker := time.NewTicker(stratumJobInterval)
+    defer jobTicker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            if persistMempool {
+                if err := dumpNodeMempool(pool); err != nil {
+                    fmt.Println("Failed to save mempool:", err)
+                }
+            }
+        case <-syncTicker.C:
+            if persistMempool {
+                syncMempool(pool)
+            }
+            if err := estimator.Save(feeEstimatesPath); err != nil {
+                fmt.Println("Failed to save fee estimates:", err)
+            }
+        case <-jobTicker.C:
+            if server != nil {
+                if err := server.UpdateJob(); err != nil {
+                    fmt.Println(err)
+                }
+            }
+        case <-signals:
+            fmt.Println("Shutting down...")
+            if err := estimator.Save(feeEstimatesPath); err != nil {
+                fmt.Println("Failed to save fee estimates:", err)
+            }
+            if persistMempool {
+                if err := dumpNodeMempool(pool); err != nil {
+                    fmt.Println("Failed to save mempool:", err)
+                    return
+                }
+                fmt.Printf("Saved %d mempool transactions\n", pool.Count())
+            }
+            return
+        }
+    }
+}
+
+// syncMempool adds to the node's pool the transactions that commands such
+// as sendrawtransaction saved to the mempool file while the node runs
+func syncMempool(pool *transaction.TransactionPool) {
+    stats, err := pool.LoadFile(mempoolPath)
+    if err != nil {
+        fmt.Println("Failed to read mempool:", err)
+        return
+    }
+    if stats.Loaded > 0 {
+        fmt.Printf("Added %d transactions from %s\n", stats.Loaded, mempoolPath)
+    }
+}
+
+// dumpNodeMempool saves the node's pool, first merging the mempool file so
+// that transactions submitted since the last sync are not overwritten
+func dumpNodeMempool(pool *transaction.TransactionPool) error {
+    syncMempool(pool)
+    return pool.DumpFile(mempoolPath)
+}
+
+// servicesSummary describes the services the node advertises, so that
+// peers do not ask a pruned node for the blocks it deleted
+func servicesSummary(chainDB *db.BlockchainDB) string {
+    if chainDB.Services()&db.ServiceNodeNetworkLimited != 0 {
+        return fmt.Sprintf("Advertising NODE_NETWORK_LIMITED (services %d), serving blocks above height %d", chainDB.Services(), chainDB.PruneHeight())
+    }
+    return fmt.Sprintf("Advertising NODE_NETWORK (services %d), serving the full chain", chainDB.Services())
+}
+
+// parsePruneTarget reads a --prune value, either a size such as "550MB" or
+// a number of blocks to keep
+func parsePruneTarget(value string) (db.PruneConfig, error) {
+    if size, ok := strings.CutSuffix(strings.ToUpper(value), "MB"); ok {
+        mb, err := strconv.ParseUint(size, 10, 64)
+        if err != nil || mb == 0 {
+            return db.PruneConfig{}, fmt.Errorf("invalid prune size %q", value)
+        }
+        return db.PruneConfig{KeepBlocks: db.MinBlocksToKeep, TargetSize: mb * 1024 * 1024}, nil
+    }
+
+    blocks, err := strconv.Atoi(value)
+    if err != nil {
+        return db.PruneConfig{}, fmt.Errorf("invalid prune target %q, expected <N>MB or a number of blocks", value)
+    }
+    if blocks < db.MinBlocksToKeep {
+        return db.PruneConfig{}, fmt.Errorf("must keep at least %d blocks", db.MinBlocksToKeep)
+    }
+    return db.PruneConfig{KeepBlocks: blocks}, nil
+}
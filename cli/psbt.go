@@ -0,0 +1,380 @@
+package cli
+
+import (
+    "bytes"
+    "crypto/ecdsa"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "strconv"
+
+    "blockchain/transaction"
+    "blockchain/types"
+    "blockchain/wallet"
+    "github.com/spf13/cobra"
+    "go-blockchain/db"
+)
+
+var psbtFeeRate float64
+var psbtFrom string
+
+var createPSBTCmd = &cobra.Command{
+    Use:   "createpsbt <address> <amount>",
+    Short: "Create a partially signed transaction paying an amount to an address, for signing elsewhere",
+    Args:  cobra.ExactArgs(2),
+    Run: func(cmd *cobra.Command, args []string) {
+        recipient, err := recipientAddress(args[0])
+        if err != nil {
+            fmt.Println("Invalid address:", err)
+            os.Exit(1)
+        }
+        amount, err := strconv.ParseFloat(args[1], 64)
+        if err != nil || amount <= 0 || math.IsInf(amount, 0) {
+            fmt.Println("Amount must be a positive number")
+            os.Exit(1)
+        }
+
+        loadWallets()
+        from := findWallet(psbtFrom)
+        // Full wallets need their mnemonic for the change address
+        if from.IsLocked() && !from.WatchOnly {
+            exitLocked()
+        }
+        if from.NeedsMigration() {
+            fmt.Printf("Wallet %s uses a legacy key, run migratewallets first\n", from.Alias)
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        pool := openMempool(chainDB)
+        estimator := openFeeEstimator(chainDB)
+        pool.SetFeeEstimator(estimator)
+        tracker := syncCoins(chainDB, pool)
+
+        tx, selection := buildPayment(from, recipient, amount, paymentFeeRate(psbtFeeRate, estimator), tracker)
+        psbt, err := transaction.NewPSBT(tx)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        // Previous transactions let the signer check the amounts it
+        // spends, key origins let it find its keys without the addresses
+        // and recognise the change as its own
+        for i, coin := range selection.Coins {
+            prevTx, err := coinTransaction(chainDB, pool, &coin)
+            if err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            if err := psbt.SetPrevTx(i, prevTx); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            psbt.Inputs[i].RedeemScript = from.RedeemScript
+            if origin, err := from.KeyOrigin(coin.Output.Address); err == nil {
+                psbt.AddInputDerivation(i, *origin)
+            }
+        }
+        for i, output := range tx.Outputs {
+            if from.IsMultisig() && bytes.Equal(output.Address, from.Address) {
+                psbt.Outputs[i].RedeemScript = from.RedeemScript
+            }
+            if origin, err := from.KeyOrigin(output.Address); err == nil {
+                psbt.AddOutputDerivation(i, *origin)
+            }
+        }
+
+        if selection.Change > 0 && !from.WatchOnly {
+            saveWallets()
+        }
+        fmt.Println(psbt.Base64())
+    },
+}
+
+var signPSBTCmd = &cobra.Command{
+    Use:   "signpsbt <psbt>",
+    Short: "Sign the inputs of a partially signed transaction spent by our wallets",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        psbt := parsePSBT(args[0])
+        loadWallets()
+        printPSBTSummary(psbt)
+
+        // Signing needs no chain, everything is in the PSBT
+        signed := 0
+        for i, input := range psbt.Inputs {
+            if input.UTXO == nil || input.FinalScriptSig != nil {
+                continue
+            }
+            keys := psbtKeys(&input)
+            if len(keys) == 0 {
+                continue
+            }
+            if input.PrevTx == nil {
+                fmt.Fprintf(os.Stderr, "Input %d has no previous transaction to check its amount, not signed\n", i)
+                continue
+            }
+            for _, key := range keys {
+                if err := psbt.SignInput(i, key); err != nil {
+                    fmt.Println(err)
+                    os.Exit(1)
+                }
+            }
+            signed++
+        }
+
+        fmt.Fprintf(os.Stderr, "Signed %d of %d inputs\n", signed, len(psbt.Inputs))
+        fmt.Println(psbt.Base64())
+    },
+}
+
+var combinePSBTCmd = &cobra.Command{
+    Use:   "combinepsbt <psbt> <psbt>...",
+    Short: "Merge the signatures of copies of a partially signed transaction",
+    Args:  cobra.MinimumNArgs(2),
+    Run: func(cmd *cobra.Command, args []string) {
+        combined := parsePSBT(args[0])
+        for _, arg := range args[1:] {
+            if err := combined.Combine(parsePSBT(arg)); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+        fmt.Println(combined.Base64())
+    },
+}
+
+var finalizePSBTCmd = &cobra.Command{
+    Use:   "finalizepsbt <psbt>",
+    Short: "Build the scriptSigs of a signed PSBT and print the transaction for sendrawtransaction",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        psbt := parsePSBT(args[0])
+        err := psbt.Finalize()
+        if errors.Is(err, transaction.ErrIncomplete) {
+            fmt.Println("Transaction is not fully signed, the finalized inputs are kept:")
+            fmt.Println(psbt.Base64())
+            os.Exit(1)
+        }
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        tx, err := psbt.Extract()
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println(hex.EncodeToString(tx.Serialize()))
+    },
+}
+
+var decodePSBTCmd = &cobra.Command{
+    Use:   "decodepsbt <psbt>",
+    Short: "Show the contents of a partially signed transaction",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        psbt := parsePSBT(args[0])
+
+        type derivation struct {
+            PubKey      string `json:"pubkey"`
+            Fingerprint string `json:"fingerprint"`
+            Path        string `json:"path"`
+        }
+        derivations := func(origins []wallet.KeyOrigin) []derivation {
+            var decoded []derivation
+            for _, origin := range origins {
+                decoded = append(decoded, derivation{
+                    hex.EncodeToString(origin.PubKey), hex.EncodeToString(origin.Fingerprint[:]),
+                    wallet.FormatDerivationPath(origin.Path),
+                })
+            }
+            return decoded
+        }
+        type decodedInput struct {
+            TxID         string       `json:"txid"`
+            Index        uint64       `json:"index"`
+            Amount       *float64     `json:"amount,omitempty"`
+            Address      string       `json:"address,omitempty"`
+            Signatures   []string     `json:"partialSignatures,omitempty"`
+            RedeemScript string       `json:"redeemScript,omitempty"`
+            Derivations  []derivation `json:"derivations,omitempty"`
+            Final        bool         `json:"final"`
+        }
+        type decodedOutput struct {
+            Amount       float64      `json:"amount"`
+            Address      string       `json:"address"`
+            RedeemScript string       `json:"redeemScript,omitempty"`
+            Derivations  []derivation `json:"derivations,omitempty"`
+        }
+        decoded := struct {
+            TxID     string          `json:"txid"`
+            Inputs   []decodedInput  `json:"inputs"`
+            Outputs  []decodedOutput `json:"outputs"`
+            Fee      *float64        `json:"fee,omitempty"`
+            Complete bool            `json:"complete"`
+        }{TxID: hex.EncodeToString(psbt.Tx.Hash()), Complete: psbt.IsComplete()}
+
+        for i, input := range psbt.Inputs {
+            txInput := psbt.Tx.Inputs[i]
+            in := decodedInput{
+                TxID:         hex.EncodeToString(txInput.PreviousTxHash),
+                Index:        txInput.OutputIndex,
+                RedeemScript: hex.EncodeToString(input.RedeemScript),
+                Derivations:  derivations(input.Derivations),
+                Final:        input.FinalScriptSig != nil,
+            }
+            if input.UTXO != nil {
+                in.Amount = &input.UTXO.Amount
+                in.Address = encodeOutputAddress(input.UTXO)
+            }
+            for _, sig := range input.PartialSigs {
+                in.Signatures = append(in.Signatures, hex.EncodeToString(sig.PubKey))
+            }
+            decoded.Inputs = append(decoded.Inputs, in)
+        }
+        for i, output := range psbt.Outputs {
+            txOutput := psbt.Tx.Outputs[i]
+            decoded.Outputs = append(decoded.Outputs, decodedOutput{
+                Amount:       txOutput.Amount,
+                Address:      encodeOutputAddress(&txOutput),
+                RedeemScript: hex.EncodeToString(output.RedeemScript),
+                Derivations:  derivations(output.Derivations),
+            })
+        }
+        if fee, err := psbt.Fee(); err == nil {
+            fee = math.Round(fee*1e8) / 1e8
+            decoded.Fee = &fee
+        }
+
+        out, _ := json.MarshalIndent(decoded, "", " ")
+        fmt.Println(string(out))
+    },
+}
+
+func init() {
+    createPSBTCmd.Flags().Float64Var(&psbtFeeRate, "fee-rate", 0, "Fee per byte (default: estimated to confirm within 6 blocks)")
+    createPSBTCmd.Flags().StringVar(&psbtFrom, "from", "", "Alias or address of the paying wallet (default: the default wallet)")
+
+    rootCmd.AddCommand(createPSBTCmd)
+    rootCmd.AddCommand(signPSBTCmd)
+    rootCmd.AddCommand(combinePSBTCmd)
+    rootCmd.AddCommand(finalizePSBTCmd)
+    rootCmd.AddCommand(decodePSBTCmd)
+}
+
+// parsePSBT decodes a base64 PSBT argument, exiting on failure
+func parsePSBT(s string) *transaction.PSBT {
+    psbt, err := transaction.ParsePSBT(s)
+    if err != nil {
+        fmt.Println("Invalid PSBT:", err)
+        os.Exit(1)
+    }
+    return psbt
+}
+
+// printPSBTSummary shows on standard error what signing psbt agrees to:
+// the amount spent, the outputs not paying back to the loaded wallets and
+// the fee
+func printPSBTSummary(psbt *transaction.PSBT) {
+    var spent float64
+    unchecked := 0
+    for _, input := range psbt.Inputs {
+        if input.UTXO != nil {
+            spent += input.UTXO.Amount
+        }
+        if input.PrevTx == nil {
+            unchecked++
+        }
+    }
+    fmt.Fprintf(os.Stderr, "Spending %.8f from %d inputs\n", spent, len(psbt.Inputs))
+    if unchecked > 0 {
+        fmt.Fprintf(os.Stderr, "Warning: %d inputs have no previous transaction, their amounts are not checked\n", unchecked)
+    }
+
+    var change float64
+    for _, output := range psbt.Tx.Outputs {
+        if ownsAddress(output.Address) {
+            change += output.Amount
+            continue
+        }
+        fmt.Fprintf(os.Stderr, "Paying %.8f to %s\n", output.Amount, encodeOutputAddress(&output))
+    }
+    if change > 0 {
+        fmt.Fprintf(os.Stderr, "Change %.8f back to our wallets\n", change)
+    }
+    if fee, err := psbt.Fee(); err == nil {
+        fmt.Fprintf(os.Stderr, "Fee %.8f\n", fee)
+    } else {
+        fmt.Fprintln(os.Stderr, "Fee unknown:", err)
+    }
+}
+
+// coinTransaction returns the transaction creating coin, from the block
+// confirming it or from the mempool
+func coinTransaction(chainDB *db.BlockchainDB, pool *transaction.TransactionPool, coin *wallet.Coin) (*types.Transaction, error) {
+    if coin.Height < 0 {
+        entry, ok := pool.GetTransaction(coin.TxHash)
+        if !ok {
+            return nil, fmt.Errorf("transaction %x is not in the mempool", coin.TxHash)
+        }
+        return &entry.Tx, nil
+    }
+    block, err := chainDB.GetBlockByHeight(coin.Height)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read the transaction of coin %x:%d: %v", coin.TxHash, coin.Index, err)
+    }
+    for i := range block.Transactions {
+        if bytes.Equal(block.Transactions[i].Hash(), coin.TxHash) {
+            return &block.Transactions[i], nil
+        }
+    }
+    return nil, fmt.Errorf("transaction %x not found in block %d", coin.TxHash, coin.Height)
+}
+
+// psbtKeys finds the keys signing a PSBT input among the loaded wallets:
+// those of the redeem script keys we hold for a multisig input, otherwise
+// the key from the origins it records or else from the address it spends
+func psbtKeys(input *transaction.PSBTInput) []*ecdsa.PrivateKey {
+    if input.RedeemScript != nil {
+        _, pubKeys, err := wallet.ParseMultisigScript(input.RedeemScript)
+        if err != nil {
+            fmt.Println("Invalid redeem script:", err)
+            os.Exit(1)
+        }
+        var keys []*ecdsa.PrivateKey
+        for _, pubKey := range pubKeys {
+            if key, ok := walletKey(wallet.Hash160(pubKey)); ok {
+                keys = append(keys, key)
+            }
+        }
+        return keys
+    }
+
+    locked := false
+    for _, origin := range input.Derivations {
+        for _, w := range wallets {
+            if w.WatchOnly {
+                continue
+            }
+            if w.IsLocked() {
+                locked = true
+                continue
+            }
+            if key, err := w.KeyForOrigin(&origin); err == nil {
+                return []*ecdsa.PrivateKey{key}
+            }
+        }
+    }
+    if key, ok := walletKey(input.UTXO.Address); ok {
+        return []*ecdsa.PrivateKey{key}
+    }
+    if locked {
+        exitLocked()
+    }
+    return nil
+}
@@ -4,6 +4,7 @@ import (
     "fmt"
     "os"
 
+    "blockchain/wallet"
     "github.com/spf13/cobra"
 )
 
@@ -13,6 +14,22 @@ var rootCmd = &cobra.Command{
     Long:  `A CLI for managing the GOCHAIN blockchain network, including full nodes and miners.`,
 }
 
+var networkName string
+
+func init() {
+    rootCmd.PersistentFlags().StringVar(&networkName, "network", wallet.MainNet.Name, "Address prefixes to use: mainnet, testnet or regtest")
+}
+
+// chainNetwork returns the network selected with --network
+func chainNetwork() *wallet.Network {
+    net, err := wallet.NetworkByName(networkName)
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    return net
+}
+
 func Execute() {
     if err := rootCmd.Execute(); err != nil {
         fmt.Println(err)
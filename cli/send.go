@@ -0,0 +1,323 @@
+package cli
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "strconv"
+
+    "blockchain/transaction"
+    "blockchain/types"
+    "blockchain/wallet"
+    "github.com/spf13/cobra"
+)
+
+const (
+    // sendConfirmTarget is the number of blocks a payment aims to confirm
+    // within when no fee rate is given
+    sendConfirmTarget = 6
+    // fallbackFeeRate is paid per byte when too few transactions were seen
+    // to estimate a fee
+    fallbackFeeRate = 0.0000001
+    // minChange is the smallest change output created, less is left to the
+    // miner
+    minChange = 0.00001
+)
+
+var sendFeeRate float64
+var sendFrom string
+var sendUnsigned bool
+
+var sendCmd = &cobra.Command{
+    Use:   "send <address> <amount>",
+    Short: "Pay an amount to an address from a wallet",
+    Args:  cobra.ExactArgs(2),
+    Run: func(cmd *cobra.Command, args []string) {
+        recipient, err := recipientAddress(args[0])
+        if err != nil {
+            fmt.Println("Invalid address:", err)
+            os.Exit(1)
+        }
+        amount, err := strconv.ParseFloat(args[1], 64)
+        if err != nil || amount <= 0 || math.IsInf(amount, 0) {
+            fmt.Println("Amount must be a positive number")
+            os.Exit(1)
+        }
+
+        loadWallets()
+        from := findWallet(sendFrom)
+        if from.IsMultisig() {
+            fmt.Println("Payments from a multisig wallet are signed by its co-signers, use createpsbt")
+            os.Exit(1)
+        }
+        // Watch-only wallets cannot sign, their payments are signed
+        // elsewhere
+        unsigned := sendUnsigned || from.WatchOnly
+        if from.IsLocked() && !unsigned {
+            exitLocked()
+        }
+        if from.NeedsMigration() {
+            fmt.Printf("Wallet %s uses a legacy key, run migratewallets first\n", from.Alias)
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        pool := openMempool(chainDB)
+        estimator := openFeeEstimator(chainDB)
+        pool.SetFeeEstimator(estimator)
+        tracker := syncCoins(chainDB, pool)
+
+        tx, selection := buildPayment(from, recipient, amount, paymentFeeRate(sendFeeRate, estimator), tracker)
+
+        if unsigned {
+            // The change address is kept for the payment to be found once
+            // it is signed and sent
+            if selection.Change > 0 && !from.WatchOnly {
+                saveWallets()
+            }
+            fmt.Printf("Unsigned payment of %.8f to %s with a fee of %.8f (%d inputs, change %.8f)\n",
+                amount, recipient, selection.Fee, len(selection.Coins), selection.Change)
+            fmt.Println(hex.EncodeToString(tx.Serialize()))
+            return
+        }
+
+        for i, coin := range selection.Coins {
+            key, ok := walletKey(coin.Output.Address)
+            if !ok {
+                fmt.Printf("No key for input %d\n", i)
+                os.Exit(1)
+            }
+            if err := transaction.SignInput(tx, i, &coin.Output, key); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+        for i, coin := range selection.Coins {
+            if err := transaction.VerifyInput(tx, i, &coin.Output); err != nil {
+                fmt.Printf("Input %d: %v\n", i, err)
+                os.Exit(1)
+            }
+        }
+
+        if _, err := submitTransaction(pool, *tx); err != nil {
+            fmt.Println("Transaction rejected:", err)
+            os.Exit(1)
+        }
+        // The change address is only kept once the payment is accepted
+        if selection.Change > 0 {
+            saveWallets()
+        }
+        saveMempool(pool)
+        saveFeeEstimator(estimator)
+
+        fmt.Printf("Sent %.8f to %s with a fee of %.8f (%d inputs, change %.8f)\n",
+            amount, recipient, selection.Fee, len(selection.Coins), selection.Change)
+        fmt.Println(hex.EncodeToString(tx.Hash()))
+    },
+}
+
+var signRawTransactionCmd = &cobra.Command{
+    Use:   "signrawtransaction <hex>",
+    Short: "Sign the inputs of a serialized transaction spent by our wallets",
+    Args:  cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        data, err := hex.DecodeString(args[0])
+        if err != nil {
+            fmt.Println("Invalid transaction hex")
+            os.Exit(1)
+        }
+        tx, err := types.DeserializeTransaction(data)
+        if err != nil {
+            fmt.Println("Invalid transaction:", err)
+            os.Exit(1)
+        }
+
+        loadWallets()
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        pool := openMempool(chainDB)
+
+        // Each input is signed again so that the result does not depend on
+        // signatures made before
+        complete := true
+        for i, input := range tx.Inputs {
+            prevOutput, err := pool.LookupOutput(input.PreviousTxHash, input.OutputIndex)
+            if err != nil {
+                fmt.Printf("Input %d: %v\n", i, err)
+                os.Exit(1)
+            }
+            key, ok := walletKey(prevOutput.Address)
+            if !ok {
+                if transaction.VerifyInput(tx, i, prevOutput) != nil {
+                    complete = false
+                }
+                continue
+            }
+            if err := transaction.SignInput(tx, i, prevOutput, key); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+
+        fmt.Println(hex.EncodeToString(tx.Serialize()))
+        if !complete {
+            fmt.Println("Some inputs are not spent by our wallets and remain unsigned")
+        }
+    },
+}
+
+func init() {
+    sendCmd.Flags().Float64Var(&sendFeeRate, "fee-rate", 0, "Fee per byte (default: estimated to confirm within 6 blocks)")
+    sendCmd.Flags().StringVar(&sendFrom, "from", "", "Alias or address of the paying wallet (default: the default wallet)")
+    sendCmd.Flags().BoolVar(&sendUnsigned, "unsigned", false, "Print the unsigned transaction instead of signing and submitting it (implied for watch-only wallets)")
+    rootCmd.AddCommand(sendCmd)
+    rootCmd.AddCommand(signRawTransactionCmd)
+}
+
+// paymentFeeRate returns the fee rate given on the command line, or one
+// estimated to confirm within sendConfirmTarget blocks
+func paymentFeeRate(requested float64, estimator *transaction.FeeEstimator) float64 {
+    if requested > 0 {
+        return requested
+    }
+    feeRate, err := estimator.EstimateFee(sendConfirmTarget)
+    if err != nil {
+        return fallbackFeeRate
+    }
+    return feeRate
+}
+
+// buildPayment selects coins of from to pay amount to recipient and returns
+// the unsigned transaction, with change to an address of from as its
+// second output
+func buildPayment(from *wallet.Wallet, recipient wallet.Address, amount, feeRate float64, tracker *wallet.CoinTracker) (*types.Transaction, *wallet.CoinSelection) {
+    payment := types.Output{
+        Amount:       amount,
+        ScriptPubKey: recipient.ScriptPubKey(),
+        ScriptType:   recipient.ScriptType(),
+        Address:      recipient.Payload(),
+    }
+    params := paymentSizes(payment, from)
+    params.Target = amount
+    params.FeeRate = feeRate
+    params.MinChange = minChange
+
+    selection, err := wallet.SelectCoins(tracker.Unspent(1, from.Addresses()), params)
+    if errors.Is(err, wallet.ErrInsufficientFunds) {
+        balance := tracker.Balance(1, from.Addresses())
+        fmt.Printf("Insufficient funds: %.8f confirmed, %.8f needed plus fees\n", balance.Confirmed, amount)
+        os.Exit(1)
+    }
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+
+    tx := types.NewTransaction(nil, []types.Output{payment})
+    for _, coin := range selection.Coins {
+        input := types.NewInput(coin.TxHash, coin.Index, nil)
+        input.Sequence = types.MaxRBFSequence
+        tx.Inputs = append(tx.Inputs, *input)
+    }
+    if selection.Change > 0 {
+        changeHash, err := changeAddress(from, tracker)
+        if err != nil {
+            fmt.Println("Failed to derive a change address:", err)
+            os.Exit(1)
+        }
+        change := ownAddress(from, changeHash)
+        tx.Outputs = append(tx.Outputs, types.Output{
+            Amount:       selection.Change,
+            ScriptPubKey: change.ScriptPubKey(),
+            ScriptType:   change.ScriptType(),
+            Address:      change.Payload(),
+        })
+    }
+    return tx, selection
+}
+
+// ownAddress returns the address of hash, an address of w: a script
+// hash for multisig wallets, a key hash otherwise
+func ownAddress(w *wallet.Wallet, hash []byte) wallet.Address {
+    var address wallet.Address
+    var err error
+    if w.IsMultisig() {
+        address, err = wallet.NewScriptHashAddress(hash, chainNetwork())
+    } else {
+        address, err = wallet.NewPubKeyHashAddress(hash, chainNetwork())
+    }
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    return address
+}
+
+// changeAddress returns the address change of a payment from w goes to: a
+// new change address, the first unused derived one of a watch-only wallet,
+// or the address of a multisig wallet or the first one of a wallet
+// watching a list of addresses
+func changeAddress(w *wallet.Wallet, tracker *wallet.CoinTracker) ([]byte, error) {
+    if !w.WatchOnly {
+        return w.NewChangeAddress(wallet.DefaultConfig())
+    }
+    for _, address := range w.ChangeAddresses {
+        if !tracker.Used(address) {
+            return address, nil
+        }
+    }
+    return w.Address, nil
+}
+
+// recipientAddress decodes an address of the selected network. Raw hashes
+// are refused so a mistyped key cannot become a payment destination, and
+// so are addresses of script types the chain cannot spend.
+func recipientAddress(s string) (wallet.Address, error) {
+    address, err := wallet.DecodeAddress(s, chainNetwork())
+    if err != nil {
+        return nil, err
+    }
+    output := types.Output{ScriptType: address.ScriptType(), Address: address.Payload()}
+    if err := transaction.CheckOutputScript(&output); err != nil {
+        return nil, fmt.Errorf("cannot pay to %s: %v", s, err)
+    }
+    return address, nil
+}
+
+// paymentSizes measures the serialized sizes coin selection needs for a
+// transaction from a wallet paying payment: without inputs, per signed
+// input and per change output
+func paymentSizes(payment types.Output, from *wallet.Wallet) wallet.CoinSelectionParams {
+    tx := types.NewTransaction(nil, []types.Output{payment})
+    base := len(tx.Serialize())
+
+    scriptSigSize := transaction.MaxScriptSigSize
+    if from.IsMultisig() {
+        scriptSigSize = transaction.MultisigScriptSigSize(from.RedeemScript)
+    }
+    tx.Inputs = []types.Input{{
+        PreviousTxHash: make([]byte, sha256.Size),
+        ScriptSig:      make([]byte, scriptSigSize),
+        Sequence:       types.MaxRBFSequence,
+    }}
+    withInput := len(tx.Serialize())
+
+    change := ownAddress(from, make([]byte, 20))
+    tx.Outputs = append(tx.Outputs, types.Output{
+        Amount:       minChange,
+        ScriptPubKey: change.ScriptPubKey(),
+        ScriptType:   change.ScriptType(),
+        Address:      change.Payload(),
+    })
+    withChange := len(tx.Serialize())
+
+    return wallet.CoinSelectionParams{
+        BaseSize:   base,
+        InputSize:  withInput - base,
+        ChangeSize: withChange - withInput,
+    }
+}
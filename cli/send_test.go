@@ -0,0 +1,26 @@
+package cli
+
+import (
+    "bytes"
+    "testing"
+
+    "blockchain/wallet"
+)
+
+func TestRecipientAddressRefusesWitnessPrograms(t *testing.T) {
+    witness, err := wallet.NewWitnessAddress(0, bytes.Repeat([]byte{1}, 32), chainNetwork())
+    if err != nil {
+        t.Fatalf("NewWitnessAddress failed: %v", err)
+    }
+    if _, err := recipientAddress(witness.String()); err == nil {
+        t.Errorf("Expected sending to P2WSH address %s to be refused", witness)
+    }
+
+    keyHash, err := wallet.NewPubKeyHashAddress(bytes.Repeat([]byte{1}, 20), chainNetwork())
+    if err != nil {
+        t.Fatalf("NewPubKeyHashAddress failed: %v", err)
+    }
+    if _, err := recipientAddress(keyHash.String()); err != nil {
+        t.Errorf("P2PKH address refused: %v", err)
+    }
+}
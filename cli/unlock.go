@@ -0,0 +1,183 @@
+package cli
+
+import (
+    "bufio"
+    "encoding/hex"
+    "fmt"
+    "net"
+    "os"
+    "os/exec"
+    "os/signal"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/spf13/cobra"
+)
+
+// unlockPath is the socket of the unlock agent. Every command runs in its
+// own process, so walletpassphrase leaves a background agent holding the
+// key in memory until the timeout, and never writes the key to disk.
+const unlockPath = "wallet.unlock"
+
+// agentTimeout bounds one request to the unlock agent
+const agentTimeout = 2 * time.Second
+
+var unlockAgentCmd = &cobra.Command{
+    Use:    "unlockagent <expires>",
+    Short:  "Hold the key of an unlocked wallet until <expires> (unix time)",
+    Hidden: true,
+    Args:   cobra.ExactArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        expires, err := strconv.ParseInt(args[0], 10, 64)
+        if err != nil {
+            fmt.Println("Invalid expiry:", err)
+            os.Exit(1)
+        }
+        line, err := stdin.ReadString('\n')
+        if err != nil {
+            fmt.Println("Failed to read key:", err)
+            os.Exit(1)
+        }
+        key, err := hex.DecodeString(strings.TrimSpace(line))
+        if err != nil {
+            fmt.Println("Invalid key:", err)
+            os.Exit(1)
+        }
+
+        // The agent outlives the terminal it was started from
+        signal.Ignore(syscall.SIGHUP, syscall.SIGINT)
+        listener, err := listenUnlock()
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println("ready")
+        runUnlockAgent(listener, key, time.Unix(expires, 0))
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(unlockAgentCmd)
+}
+
+// startUnlockAgent starts an unlock agent holding key until expires. The
+// key is handed over on the agent's standard input, not in its arguments.
+func startUnlockAgent(key []byte, expires time.Time) error {
+    executable, err := os.Executable()
+    if err != nil {
+        return fmt.Errorf("failed to start unlock agent: %v", err)
+    }
+    agent := exec.Command(executable, "unlockagent", strconv.FormatInt(expires.Unix(), 10))
+    agent.Stdin = strings.NewReader(hex.EncodeToString(key) + "\n")
+    output, err := agent.StdoutPipe()
+    if err != nil {
+        return fmt.Errorf("failed to start unlock agent: %v", err)
+    }
+    if err := agent.Start(); err != nil {
+        return fmt.Errorf("failed to start unlock agent: %v", err)
+    }
+    status, _ := bufio.NewReader(output).ReadString('\n')
+    if status = strings.TrimSpace(status); status != "ready" {
+        agent.Wait()
+        return fmt.Errorf("unlock agent failed: %s", status)
+    }
+    return agent.Process.Release()
+}
+
+// listenUnlock listens on the unlock socket with mode 0600. The socket is
+// bound inside a private directory and moved into place once its mode is
+// set, so no other user can connect in between.
+func listenUnlock() (*net.UnixListener, error) {
+    dir, err := os.MkdirTemp(".", unlockPath+".")
+    if err != nil {
+        return nil, fmt.Errorf("failed to create unlock socket: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    bound := filepath.Join(dir, "socket")
+    listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: bound, Net: "unix"})
+    if err != nil {
+        return nil, fmt.Errorf("failed to create unlock socket: %v", err)
+    }
+    listener.SetUnlinkOnClose(false)
+    if err := os.Chmod(bound, 0600); err != nil {
+        listener.Close()
+        return nil, fmt.Errorf("failed to create unlock socket: %v", err)
+    }
+    if err := os.Rename(bound, unlockPath); err != nil {
+        listener.Close()
+        return nil, fmt.Errorf("failed to create unlock socket: %v", err)
+    }
+    return listener, nil
+}
+
+// runUnlockAgent serves key on listener until expires or a lock request,
+// then removes the socket unless another agent has replaced it
+func runUnlockAgent(listener *net.UnixListener, key []byte, expires time.Time) {
+    socket, statErr := os.Stat(unlockPath)
+    timer := time.AfterFunc(time.Until(expires), func() { listener.Close() })
+    defer timer.Stop()
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil || serveUnlock(conn, key) {
+            break
+        }
+    }
+    listener.Close()
+    clear(key)
+    if current, err := os.Stat(unlockPath); statErr == nil && err == nil && os.SameFile(socket, current) {
+        os.Remove(unlockPath)
+    }
+}
+
+// serveUnlock answers one request to the unlock agent: "key" with the hex
+// key, "lock" by stopping the agent. It reports whether the agent stops.
+func serveUnlock(conn net.Conn, key []byte) bool {
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(agentTimeout))
+    request, err := bufio.NewReader(conn).ReadString('\n')
+    if err != nil {
+        return false
+    }
+    switch strings.TrimSpace(request) {
+    case "key":
+        fmt.Fprintln(conn, hex.EncodeToString(key))
+    case "lock":
+        fmt.Fprintln(conn, "locked")
+        return true
+    }
+    return false
+}
+
+// askUnlockAgent sends request to the unlock agent and returns its answer
+func askUnlockAgent(request string) (string, error) {
+    conn, err := net.DialTimeout("unix", unlockPath, agentTimeout)
+    if err != nil {
+        return "", err
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(agentTimeout))
+    if _, err := fmt.Fprintln(conn, request); err != nil {
+        return "", err
+    }
+    answer, err := bufio.NewReader(conn).ReadString('\n')
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimSpace(answer), nil
+}
+
+// lockWallet stops a running unlock agent, or removes what is left of one
+func lockWallet() error {
+    if _, err := askUnlockAgent("lock"); err == nil {
+        return nil
+    }
+    if err := os.Remove(unlockPath); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+    "bytes"
+    "encoding/hex"
+    "os"
+    "testing"
+    "time"
+)
+
+func TestUnlockAgent(t *testing.T) {
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(t.TempDir()); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Chdir(wd)
+
+    listener, err := listenUnlock()
+    if err != nil {
+        t.Fatalf("listenUnlock failed: %v", err)
+    }
+    info, err := os.Stat(unlockPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if mode := info.Mode().Perm(); mode != 0600 {
+        t.Errorf("socket mode = %o, want 600", mode)
+    }
+
+    key := bytes.Repeat([]byte{7}, 32)
+    done := make(chan struct{})
+    go func() {
+        runUnlockAgent(listener, append([]byte(nil), key...), time.Now().Add(time.Minute))
+        close(done)
+    }()
+
+    answer, err := askUnlockAgent("key")
+    if err != nil {
+        t.Fatalf("askUnlockAgent failed: %v", err)
+    }
+    if answer != hex.EncodeToString(key) {
+        t.Errorf("agent answered %s, want the key", answer)
+    }
+
+    if err := lockWallet(); err != nil {
+        t.Fatalf("lockWallet failed: %v", err)
+    }
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("agent did not stop on lock")
+    }
+    if _, err := os.Stat(unlockPath); !os.IsNotExist(err) {
+        t.Errorf("socket left after lock: %v", err)
+    }
+    if _, err := askUnlockAgent("key"); err == nil {
+        t.Error("locked agent still answers")
+    }
+
+    // An expired agent stops by itself
+    listener, err = listenUnlock()
+    if err != nil {
+        t.Fatalf("listenUnlock failed: %v", err)
+    }
+    runUnlockAgent(listener, key, time.Now().Add(100*time.Millisecond))
+    if _, err := os.Stat(unlockPath); !os.IsNotExist(err) {
+        t.Errorf("socket left after expiry: %v", err)
+    }
+}
@@ -1,11 +1,18 @@
 package cli
 
 import (
+    "bytes"
+    "crypto/ecdsa"
+    "encoding/hex"
     "fmt"
+    "math"
     "os"
     "encoding/json"
     "slices"
-    "go-blockchain/wallet"
+    "strings"
+    "blockchain/transaction"
+    "blockchain/types"
+    "blockchain/wallet"
     "github.com/spf13/cobra"
 )
 
@@ -16,6 +23,13 @@ type CliWallet struct {
 var wallets []CliWallet
 var defaultWalletID string
 
+const walletsPath = "wallets.dat"
+
+// keystore is the wallet file last loaded, and keystoreKey its key while
+// the wallet is unlocked
+var keystore *wallet.Keystore
+var keystoreKey []byte
+
 var createWalletCmd = &cobra.Command{
     Use:   "createwallet",
     Short: "Create a new wallet",
@@ -30,7 +44,7 @@ var createWalletCmd = &cobra.Command{
         }
         wallets = append(wallets, CliWallet { defaultWallet, wallet })
         saveWallets()
-        fmt.Printf("Wallet created: %s\n", wallet.PublicKey)
+        fmt.Printf("Wallet created: %s\n", encodeAddress(wallet.Address))
     },
 }
 
@@ -39,8 +53,21 @@ var listWalletsCmd = &cobra.Command{
     Short: "List all wallets",
     Run: func(cmd *cobra.Command, args []string) {
       loadWallets()
-      for _, wallet := range wallets {
-        fmt.Printf("Alias: %s, Address: %x\n", wallet.Alias, wallet.Address)
+      for _, w := range wallets {
+        if w.IsMultisig() {
+          m, pubKeys, _ := wallet.ParseMultisigScript(w.RedeemScript)
+          fmt.Printf("Alias: %s, Address: %s (multisig, %d of %d)\n", w.Alias, ownAddress(w.Wallet, w.Address), m, len(pubKeys))
+          continue
+        }
+        if w.WatchOnly {
+          fmt.Printf("Alias: %s, Address: %s (watch-only, %d addresses)\n", w.Alias, encodeAddress(w.Address), len(w.Addresses()))
+          continue
+        }
+        if w.NeedsMigration() {
+          fmt.Printf("Alias: %s, Address: %s (legacy key, run migratewallets)\n", w.Alias, encodeAddress(w.Address))
+          continue
+        }
+        fmt.Printf("Alias: %s, Address: %s\n", w.Alias, encodeAddress(w.Address))
       }
     },
 }
@@ -53,7 +80,7 @@ var setDefaultWalletCmd = &cobra.Command{
       addressOrAlias := args[0]
       loadWallets()
       for _, wallet := range wallets {
-        if wallet.Alias == addressOrAlias || fmt.Sprintf("%x", wallet.Address) == addressOrAlias {
+        if wallet.Alias == addressOrAlias || isWalletAddress(wallet.Address, addressOrAlias) {
           defaultWalletID = addressOrAlias
           loadWallets()
           idx := slices.IndexFunc(wallets, func(c CliWallet) bool { return c.Alias == defaultWalletID })
@@ -68,20 +95,272 @@ var setDefaultWalletCmd = &cobra.Command{
     },
 }
 
+var balanceMinConf int
+
 var getBalanceCmd = &cobra.Command{
-    Use:   "getbalance <walletID>",
-    Short: "Get the balance of a wallet",
+    Use:   "getbalance [walletID]",
+    Short: "Get the balance of a wallet, or of all wallets",
+    Args:  cobra.MaximumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        loadWallets()
+        addresses := selectWallet(args)
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        tracker := syncCoins(chainDB, openMempool(chainDB))
+
+        balance := tracker.Balance(balanceMinConf, addresses)
+        fmt.Printf("Confirmed:   %.8f\n", balance.Confirmed)
+        fmt.Printf("Unconfirmed: %.8f\n", balance.Unconfirmed)
+        fmt.Printf("Immature:    %.8f\n", balance.Immature)
+        fmt.Printf("Total:       %.8f\n", balance.Total())
+    },
+}
+
+var unspentMinConf int
+
+var listUnspentCmd = &cobra.Command{
+    Use:   "listunspent [walletID]",
+    Short: "List the spendable outputs of a wallet, or of all wallets",
+    Args:  cobra.MaximumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        loadWallets()
+        addresses := selectWallet(args)
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        tracker := syncCoins(chainDB, openMempool(chainDB))
+
+        type unspentOutput struct {
+            TxID          string  `json:"txid"`
+            Index         uint64  `json:"index"`
+            Address       string  `json:"address"`
+            Amount        float64 `json:"amount"`
+            Confirmations int     `json:"confirmations"`
+            Coinbase      bool    `json:"coinbase,omitempty"`
+        }
+        unspent := []unspentOutput{}
+        for _, coin := range tracker.Unspent(unspentMinConf, addresses) {
+            unspent = append(unspent, unspentOutput{
+                hex.EncodeToString(coin.TxHash), coin.Index, encodeOutputAddress(&coin.Output),
+                coin.Output.Amount, coin.Confirmations, coin.Coinbase,
+            })
+        }
+        out, _ := json.MarshalIndent(unspent, "", " ")
+        fmt.Println(string(out))
+    },
+}
+
+var transactionsCount int
+
+var listTransactionsCmd = &cobra.Command{
+    Use:   "listtransactions [walletID]",
+    Short: "List the confirmed transactions of a wallet, or of all wallets, most recent first",
+    Args:  cobra.MaximumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        loadWallets()
+        addresses := selectWallet(args)
+        if addresses == nil {
+            addresses = walletAddresses()
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        if !chainDB.AddressIndexEnabled() {
+            fmt.Println("Address index is not enabled, run buildaddrindex first")
+            os.Exit(1)
+        }
+        best, err := chainDB.GetBestHeight()
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        type walletTransaction struct {
+            TxID          string  `json:"txid"`
+            Amount        float64 `json:"amount"`
+            BlockIndex    int     `json:"blockIndex"`
+            Confirmations int     `json:"confirmations"`
+        }
+        // Credits and debits of all addresses are merged, a payment to
+        // ourselves nets its change against the spent coins
+        byHash := make(map[string]*walletTransaction)
+        for _, address := range addresses {
+            entries, err := chainDB.GetAddressHistory(address, 0, math.MaxInt32)
+            if err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+            for _, entry := range entries {
+                txid := hex.EncodeToString(entry.TxHash)
+                tx, ok := byHash[txid]
+                if !ok {
+                    tx = &walletTransaction{TxID: txid, BlockIndex: entry.BlockIndex, Confirmations: best - entry.BlockIndex + 1}
+                    byHash[txid] = tx
+                }
+                if entry.IsDebit {
+                    tx.Amount -= entry.Amount
+                } else {
+                    tx.Amount += entry.Amount
+                }
+            }
+        }
+
+        transactions := []walletTransaction{}
+        for _, tx := range byHash {
+            tx.Amount = math.Round(tx.Amount*1e8) / 1e8
+            transactions = append(transactions, *tx)
+        }
+        slices.SortFunc(transactions, func(a, b walletTransaction) int {
+            if a.BlockIndex != b.BlockIndex {
+                return b.BlockIndex - a.BlockIndex
+            }
+            return strings.Compare(a.TxID, b.TxID)
+        })
+        if transactionsCount > 0 && len(transactions) > transactionsCount {
+            transactions = transactions[:transactionsCount]
+        }
+        out, _ := json.MarshalIndent(transactions, "", " ")
+        fmt.Println(string(out))
+    },
+}
+
+var bumpFeeRate float64
+
+var bumpFeeCmd = &cobra.Command{
+    Use:   "bumpfee <txid>",
+    Short: "Replace an unconfirmed wallet transaction with one paying a higher fee",
     Args:  cobra.ExactArgs(1),
     Run: func(cmd *cobra.Command, args []string) {
-        
+        txid, err := hex.DecodeString(args[0])
+        if err != nil {
+            fmt.Println("Invalid transaction ID")
+            os.Exit(1)
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+        pool := openMempool(chainDB)
+        estimator := openFeeEstimator(chainDB)
+        pool.SetFeeEstimator(estimator)
+        loadWallets()
+
+        entry, ok := pool.GetTransaction(txid)
+        if !ok {
+            fmt.Println("Transaction not found in the mempool")
+            os.Exit(1)
+        }
+
+        // The extra fee comes out of the change paid back to our wallets,
+        // preferably to a change address so that payments to our own
+        // wallets are left whole
+        changeIndex := -1
+        for i, output := range entry.Tx.Outputs {
+            if isChangeAddress(output.Address) {
+                changeIndex = i
+                break
+            }
+            if changeIndex < 0 && ownsAddress(output.Address) {
+                changeIndex = i
+            }
+        }
+        if changeIndex < 0 {
+            fmt.Println("Transaction has no change output to take the fee from")
+            os.Exit(1)
+        }
+
+        bumped, err := pool.BumpFee(txid, bumpFeeRate, changeIndex)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        for i, input := range bumped.Inputs {
+            prevOutput, err := pool.LookupOutput(input.PreviousTxHash, input.OutputIndex)
+            if err != nil {
+                fmt.Printf("Input %d: %v\n", i, err)
+                os.Exit(1)
+            }
+            key, ok := walletKey(prevOutput.Address)
+            if !ok {
+                fmt.Printf("Input %d is not spent by any of our wallets\n", i)
+                os.Exit(1)
+            }
+            if err := transaction.SignInput(bumped, i, prevOutput, key); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+
+        if _, err := submitTransaction(pool, *bumped); err != nil {
+            fmt.Println("Replacement rejected:", err)
+            os.Exit(1)
+        }
+        saveMempool(pool)
+        saveFeeEstimator(estimator)
+
+        replaced, _ := pool.GetTransaction(bumped.Hash())
+        fmt.Printf("Replaced %x with %x, fee %f -> %f\n", txid, bumped.Hash(), entry.Fee, replaced.Fee)
+    },
+}
+
+var migrateWalletsCmd = &cobra.Command{
+    Use:   "migratewallets",
+    Short: "Move wallets with legacy P-256 keys to secp256k1 keys",
+    Run: func(cmd *cobra.Command, args []string) {
+      loadWallets()
+      data, err := os.ReadFile(walletsPath)
+      if err != nil {
+        fmt.Println("No wallets to migrate")
+        return
+      }
+
+      migrated := 0
+      for i := range wallets {
+        w := wallets[i].Wallet
+        if !w.NeedsMigration() {
+          continue
+        }
+        if w.IsLocked() {
+          exitLocked()
+        }
+        if err := w.Migrate(wallet.DefaultConfig()); err != nil {
+          fmt.Printf("Failed to migrate %s: %v\n", w.Alias, err)
+          os.Exit(1)
+        }
+        fmt.Printf("Migrated %s: %s -> %s\n", w.Alias, encodeAddress(w.LegacyAddress), encodeAddress(w.Address))
+        migrated++
+      }
+      if migrated == 0 {
+        fmt.Println("All wallets already use secp256k1 keys")
+        return
+      }
+
+      // The original file is kept until the migrated one is known to work
+      backupPath := walletsPath + ".bak"
+      if err := wallet.WriteFileAtomic(backupPath, data, 0600); err != nil {
+        fmt.Printf("Failed to back up %s: %v\n", walletsPath, err)
+        os.Exit(1)
+      }
+      saveWallets()
+      fmt.Printf("Migrated %d wallets, the previous file is saved as %s\n", migrated, backupPath)
+      fmt.Println("Coins left at the legacy addresses can no longer be spent")
     },
 }
 
 func init() {
+    getBalanceCmd.Flags().IntVar(&balanceMinConf, "minconf", 1, "Confirmations needed for coins to count as confirmed")
+    listUnspentCmd.Flags().IntVar(&unspentMinConf, "minconf", 1, "Confirmations needed for coins to be listed")
+    listTransactionsCmd.Flags().IntVar(&transactionsCount, "count", 20, "Number of transactions to list, 0 for all")
+    bumpFeeCmd.Flags().Float64Var(&bumpFeeRate, "fee-rate", 0, "New fee per byte (default: the smallest increase accepted)")
+
     rootCmd.AddCommand(createWalletCmd)
     rootCmd.AddCommand(listWalletsCmd)
     rootCmd.AddCommand(setDefaultWalletCmd)
     rootCmd.AddCommand(getBalanceCmd)
+    rootCmd.AddCommand(listUnspentCmd)
+    rootCmd.AddCommand(listTransactionsCmd)
+    rootCmd.AddCommand(bumpFeeCmd)
+    rootCmd.AddCommand(migrateWalletsCmd)
 }
 
 func createWallet() *wallet.Wallet {
@@ -97,12 +376,232 @@ func createWallet() *wallet.Wallet {
     return wallet
 }
 
+// saveWallets writes the wallets to wallets.dat, encrypting their
+// mnemonics if the keystore is encrypted
 func saveWallets() {
-    file, _ := json.MarshalIndent(wallets, "", " ")
-    _ = os.WriteFile("wallets.dat", file, 0644)
+    saved := make([]CliWallet, len(wallets))
+    for i, w := range wallets {
+        copied := *w.Wallet
+        if keystore.Encrypted() && !copied.IsLocked() && copied.Mnemonic != "" {
+            if keystoreKey == nil {
+                exitLocked()
+            }
+            if err := copied.Encrypt(keystoreKey); err != nil {
+                fmt.Println("Failed to encrypt wallet:", err)
+                os.Exit(1)
+            }
+        }
+        saved[i] = CliWallet{w.DefaultWallet, &copied}
+    }
+
+    data, err := json.Marshal(saved)
+    if err != nil {
+        fmt.Println("Failed to encode wallets:", err)
+        os.Exit(1)
+    }
+    keystore.Wallets = data
+    if err := keystore.Write(walletsPath); err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
 }
 
+// loadWallets reads wallets.dat, decrypting the mnemonics if the keystore
+// is encrypted and unlocked
 func loadWallets() {
-    file, _ := os.ReadFile("wallets.dat")
-    _ = json.Unmarshal(file, &wallets)
+    ks, err := wallet.ReadKeystore(walletsPath)
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    keystore, keystoreKey, wallets = ks, nil, nil
+    if err := json.Unmarshal(ks.Wallets, &wallets); err != nil {
+        fmt.Println("Failed to read wallets:", err)
+        os.Exit(1)
+    }
+
+    if !ks.Encrypted() {
+        return
+    }
+    key, ok := unlockedKey(ks)
+    if !ok {
+        return
+    }
+    for _, w := range wallets {
+        if err := w.Decrypt(key); err != nil {
+            fmt.Printf("Failed to decrypt wallet %s: %v\n", w.Alias, err)
+            os.Exit(1)
+        }
+    }
+    keystoreKey = key
+}
+
+// ownsAddress reports whether address pays to one of the loaded wallets
+func ownsAddress(address []byte) bool {
+    if len(address) == 0 {
+        return false
+    }
+    for _, w := range wallets {
+        for _, owned := range w.Addresses() {
+            if bytes.Equal(owned, address) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// selectWallet returns the addresses of the wallet named by the optional
+// alias or address argument, or nil for all wallets
+func selectWallet(args []string) [][]byte {
+    if len(args) == 0 {
+        return nil
+    }
+    for _, w := range wallets {
+        if w.Alias == args[0] || isWalletAddress(w.Address, args[0]) {
+            return w.Addresses()
+        }
+    }
+    fmt.Println("Wallet not found")
+    os.Exit(1)
+    return nil
+}
+
+// isChangeAddress reports whether address is a change address of one of
+// the loaded wallets
+func isChangeAddress(address []byte) bool {
+    for _, w := range wallets {
+        if _, ok := w.ChangeIndex(address); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// findWallet returns the wallet named by alias or address, or the
+// default wallet if addressOrAlias is empty
+func findWallet(addressOrAlias string) *wallet.Wallet {
+    for _, w := range wallets {
+        if addressOrAlias == "" && w.DefaultWallet || addressOrAlias != "" && (w.Alias == addressOrAlias || isWalletAddress(w.Address, addressOrAlias)) {
+            return w.Wallet
+        }
+    }
+    if addressOrAlias == "" {
+        fmt.Println("No default wallet, name one or set one with setdefaultwallet")
+    } else {
+        fmt.Println("Wallet not found")
+    }
+    os.Exit(1)
+    return nil
+}
+
+// walletKey returns the private key of the loaded wallet paid to by
+// address. Keys are derived again from the mnemonic, which is what
+// wallets.dat reliably holds. Wallets that still need migration have no
+// key that can sign.
+func walletKey(address []byte) (*ecdsa.PrivateKey, bool) {
+    if len(address) == 0 {
+        return nil, false
+    }
+    for _, w := range wallets {
+        if w.WatchOnly || w.NeedsMigration() {
+            continue
+        }
+        var key *ecdsa.PrivateKey
+        var err error
+        switch {
+        case bytes.Equal(w.Address, address):
+            key, err = wallet.PrivateKeyFromMnemonic(w.Mnemonic, wallet.DefaultConfig())
+        default:
+            index, ok := w.ChangeIndex(address)
+            if !ok {
+                continue
+            }
+            key, err = wallet.DeriveKeyFromMnemonic(w.Mnemonic, wallet.DefaultConfig(), wallet.InternalChain, index)
+        }
+        if w.IsLocked() {
+            exitLocked()
+        }
+        if err != nil {
+            return nil, false
+        }
+        return key, true
+    }
+    return nil, false
+}
+
+// walletAddress resolves a wallet alias or address to the key hash it
+// pays to, using the default wallet when addressOrAlias is empty. Addresses
+// of wallets not in wallets.dat are accepted as given.
+func walletAddress(addressOrAlias string) ([]byte, error) {
+    loadWallets()
+    for _, w := range wallets {
+        if addressOrAlias == "" && w.DefaultWallet || addressOrAlias != "" && (w.Alias == addressOrAlias || isWalletAddress(w.Address, addressOrAlias)) {
+            if w.IsMultisig() {
+                return nil, fmt.Errorf("coinbases pay to key hashes, %s is a multisig wallet", w.Alias)
+            }
+            return w.Address, nil
+        }
+    }
+    if addressOrAlias == "" {
+        return nil, fmt.Errorf("no default wallet, create one with createwallet or pass an address")
+    }
+    address, err := coinbaseAddress(addressOrAlias)
+    if err != nil {
+        return nil, fmt.Errorf("unknown wallet %q: %v", addressOrAlias, err)
+    }
+    return address, nil
+}
+
+// coinbaseAddress returns the key hash of a P2PKH address of the selected
+// network, the only kind coinbases pay to
+func coinbaseAddress(s string) ([]byte, error) {
+    address, err := wallet.DecodeAddress(s, chainNetwork())
+    if err != nil {
+        return nil, err
+    }
+    if address.ScriptType() != wallet.ScriptTypeP2PKH {
+        return nil, fmt.Errorf("coinbases pay to key hashes, %s is a %s address", s, address.ScriptType())
+    }
+    return address.Payload(), nil
+}
+
+// encodeAddress returns the Base58Check P2PKH address of a key hash on the
+// selected network, or hex for hashes of another size
+func encodeAddress(hash []byte) string {
+    address, err := wallet.NewPubKeyHashAddress(hash, chainNetwork())
+    if err != nil {
+        return hex.EncodeToString(hash)
+    }
+    return address.String()
+}
+
+// decodeAddress returns the key or script hash an address of the selected
+// network pays to
+func decodeAddress(s string) ([]byte, error) {
+    address, err := wallet.DecodeAddress(s, chainNetwork())
+    if err != nil {
+        return nil, err
+    }
+    return address.Payload(), nil
+}
+
+// encodeOutputAddress returns the Base58Check address an output pays to,
+// P2SH or P2PKH as its script type says
+func encodeOutputAddress(output *types.Output) string {
+    if output.ScriptType != wallet.ScriptTypeP2SH {
+        return encodeAddress(output.Address)
+    }
+    address, err := wallet.NewScriptHashAddress(output.Address, chainNetwork())
+    if err != nil {
+        return hex.EncodeToString(output.Address)
+    }
+    return address.String()
+}
+
+// isWalletAddress reports whether s is an encoding of the wallet address
+// hash
+func isWalletAddress(hash []byte, s string) bool {
+    decoded, err := decodeAddress(s)
+    return err == nil && bytes.Equal(decoded, hash)
 }
@@ -0,0 +1,117 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+
+    "blockchain/wallet"
+    "github.com/spf13/cobra"
+)
+
+var watchAlias string
+
+var importWatchOnlyCmd = &cobra.Command{
+    Use:   "importwatchonly <xpub | address...>",
+    Short: "Watch the addresses of an account extended public key, or a list of addresses",
+    Args:  cobra.MinimumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        alias := watchAlias
+        if alias == "" {
+            var err error
+            if alias, err = wallet.GenerateAlias(); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+            }
+        }
+
+        var watch *wallet.Wallet
+        var err error
+        if _, keyErr := wallet.ParseExtendedKey(args[0]); keyErr == nil && len(args) == 1 {
+            watch, err = wallet.NewWatchOnlyWallet(args[0], alias, chainNetwork())
+        } else {
+            var addresses [][]byte
+            for _, arg := range args {
+                address, err := decodeAddress(arg)
+                if err != nil {
+                    fmt.Printf("Invalid address %s: %v\n", arg, err)
+                    os.Exit(1)
+                }
+                addresses = append(addresses, address)
+            }
+            watch, err = wallet.NewAddressWatchWallet(addresses, alias)
+        }
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+
+        loadWallets()
+        for _, w := range wallets {
+            if w.Alias == alias {
+                fmt.Printf("A wallet called %s already exists\n", alias)
+                os.Exit(1)
+            }
+        }
+
+        chainDB := openDatabase()
+        defer chainDB.Close()
+
+        // Addresses used before the import are found in the chain, later
+        // ones as coins arrive
+        if _, err := watch.ExtendAddresses(usedAddresses(chainDB)); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        wallets = append(wallets, CliWallet{len(wallets) == 0, watch})
+        saveWallets()
+
+        tracker := syncCoins(chainDB, openMempool(chainDB))
+        balance := tracker.Balance(1, watch.Addresses())
+        fmt.Printf("Watching %s: %d addresses, balance %.8f\n", alias, len(watch.Addresses()), balance.Total())
+    },
+}
+
+var getXpubCmd = &cobra.Command{
+    Use:   "getxpub [walletID]",
+    Short: "Show the account extended public key of a wallet, for watching it elsewhere",
+    Args:  cobra.MaximumNArgs(1),
+    Run: func(cmd *cobra.Command, args []string) {
+        id := ""
+        if len(args) == 1 {
+            id = args[0]
+        }
+        loadWallets()
+        w := findWallet(id)
+
+        switch {
+        case w.WatchOnly && w.AccountKey != "":
+            fmt.Println(w.AccountKey)
+            return
+        case w.IsMultisig():
+            fmt.Println("Multisig wallets have no extended key, each co-signer has their own")
+            os.Exit(1)
+        case w.WatchOnly:
+            fmt.Println("Wallet watches a list of addresses and has no extended key")
+            os.Exit(1)
+        case w.IsLocked():
+            exitLocked()
+        case w.NeedsMigration():
+            fmt.Printf("Wallet %s uses a legacy key, run migratewallets first\n", w.Alias)
+            os.Exit(1)
+        }
+
+        account, err := wallet.AccountKeyFromMnemonic(w.Mnemonic, wallet.DefaultConfig(), chainNetwork())
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println(account.String())
+    },
+}
+
+func init() {
+    importWatchOnlyCmd.Flags().StringVar(&watchAlias, "alias", "", "Alias of the watch-only wallet (default: a generated one)")
+
+    rootCmd.AddCommand(importWatchOnlyCmd)
+    rootCmd.AddCommand(getXpubCmd)
+}
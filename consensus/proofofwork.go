@@ -8,6 +8,7 @@ import (
 //	"fmt"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +17,7 @@ const (
 	MaxNonce           = ^uint64(0) // Maximum nonce value
 	DifficultyInterval = 2016  // Blocks between difficulty adjustments
 	TargetDuration     = 14 * time.Minute // Expected time per block
+	MaxBlockSize       = 1000000 // Maximum serialized size of a block's transactions, in bytes
 )
 
 type ProofOfWork struct {
@@ -40,7 +42,11 @@ func CalculateTarget(bits uint32) *big.Int {
 	mantissa := bits & 0x007fffff
 
 	target := big.NewInt(int64(mantissa))
-	target.Lsh(target, 8*(uint(exponent)-3))
+	if exponent <= 3 {
+		target.Rsh(target, 8*(3-uint(exponent)))
+	} else {
+		target.Lsh(target, 8*(uint(exponent)-3))
+	}
 	return target
 }
 
@@ -48,20 +54,37 @@ func CalculateTarget(bits uint32) *big.Int {
 func CalculateDifficultyBits(difficulty uint32) uint32 {
 	target := big.NewInt(1)
 	target.Lsh(target, 256-uint(difficulty))
-	
-	// Convert to Bitcoin-like compact format
-	bits := target.Bytes()
-	exponent := uint32(len(bits))
+	return TargetToCompact(target)
+}
+
+// TargetToCompact converts a target to the Bitcoin-like compact format: one
+// byte of exponent followed by a three byte mantissa
+func TargetToCompact(target *big.Int) uint32 {
+	exponent := uint32(len(target.Bytes()))
 	mantissa := uint32(0)
-	if exponent > 3 {
-		mantissa = uint32(binary.BigEndian.Uint32(bits[:4]))
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - exponent))
 	} else {
-		mantissa = uint32(binary.BigEndian.Uint32(append(make([]byte, 4-exponent), bits...)))
+		mantissa = uint32(new(big.Int).Rsh(target, 8*uint(exponent-3)).Uint64())
 	}
-	
+
+	// The mantissa is signed, so a set top bit moves into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
 	return (exponent << 24) | mantissa
 }
 
+// CalculateWork returns the expected number of hashes needed to find a
+// proof for the given difficulty bits, 2^256 / (target + 1)
+func CalculateWork(bits uint32) *big.Int {
+	denominator := new(big.Int).Add(CalculateTarget(bits), big.NewInt(1))
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, denominator)
+}
+
 // Validate validates the proof against current difficulty
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
@@ -72,16 +95,31 @@ func (pow *ProofOfWork) Validate() bool {
 	return hashInt.Cmp(target) < 0
 }
 
+// MeetsTarget reports whether the proof's hash is below the target of bits.
+// The hash commits to the proof's own difficulty, so this checks work
+// against an easier target, such as that of mining pool shares.
+func (pow *ProofOfWork) MeetsTarget(bits uint32) bool {
+	var hashInt big.Int
+	hashInt.SetBytes(pow.calculateHash())
+	return hashInt.Cmp(CalculateTarget(bits)) < 0
+}
+
 // calculateHash performs double SHA-256
 func (pow *ProofOfWork) calculateHash() []byte {
-	data := pow.prepareData()
+	return pow.calculateHashWithNonce(pow.Nonce)
+}
+
+// calculateHashWithNonce hashes the proof with nonce in place of its own.
+// The proof is left untouched, so mining workers can share it.
+func (pow *ProofOfWork) calculateHashWithNonce(nonce uint64) []byte {
+	data := pow.prepareData(nonce)
 	firstHash := sha256.Sum256(data)
 	secondHash := sha256.Sum256(firstHash[:])
 	return secondHash[:]
 }
 
-// prepareData serializes all fields for hashing
-func (pow *ProofOfWork) prepareData() []byte {
+// prepareData serializes all fields for hashing, with nonce as the nonce
+func (pow *ProofOfWork) prepareData(nonce uint64) []byte {
 	data := []byte{}
 	
 	// Convert timestamp to bytes
@@ -89,13 +127,13 @@ func (pow *ProofOfWork) prepareData() []byte {
 	binary.BigEndian.PutUint64(ts, uint64(pow.Timestamp))
 	
 	// Convert nonce to bytes
-	nonce := make([]byte, 8)
-	binary.BigEndian.PutUint64(nonce, pow.Nonce)
+	nonceBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(nonceBytes, nonce)
 	
 	// Combine all components
 	data = append(data, pow.Data...)
 	data = append(data, ts...)
-	data = append(data, nonce...)
+	data = append(data, nonceBytes...)
 	data = append(data, byte(pow.Difficulty>>24), byte(pow.Difficulty>>16), 
 		byte(pow.Difficulty>>8), byte(pow.Difficulty))
 	
@@ -105,8 +143,7 @@ func (pow *ProofOfWork) prepareData() []byte {
 // Mine performs the proof-of-work computation
 func (pow *ProofOfWork) Mine(timeout time.Duration) error {
 	var wg sync.WaitGroup
-	var found bool
-	var mutex sync.Mutex
+	var found atomic.Bool
 	
 	target := CalculateTarget(pow.Difficulty)
 	startTime := time.Now()
@@ -118,7 +155,7 @@ func (pow *ProofOfWork) Mine(timeout time.Duration) error {
 			defer wg.Done()
 			
 			localNonce := offset
-			for !found {
+			for !found.Load() {
 				// Check timeout
 				if time.Since(startTime) > timeout {
 					return
@@ -131,12 +168,10 @@ func (pow *ProofOfWork) Mine(timeout time.Duration) error {
 				var hashInt big.Int
 				hashInt.SetBytes(hash)
 				if hashInt.Cmp(target) < 0 {
-					mutex.Lock()
-					if !found {
-						found = true
+					// Only the first worker to succeed writes the nonce
+					if found.CompareAndSwap(false, true) {
 						pow.Nonce = localNonce
 					}
-					mutex.Unlock()
 					return
 				}
 				
@@ -146,19 +181,12 @@ func (pow *ProofOfWork) Mine(timeout time.Duration) error {
 	}
 	
 	wg.Wait()
-	if !found {
+	if !found.Load() {
 		return errors.New("proof-of-work not found within timeout")
 	}
 	return nil
 }
 
-func (pow *ProofOfWork) calculateHashWithNonce(nonce uint64) []byte {
-	// Save current nonce and restore after calculation
-	defer func(original uint64) { pow.Nonce = original }(pow.Nonce)
-	pow.Nonce = nonce
-	return pow.calculateHash()
-}
-
 // Serialize converts proof to byte format
 func (pow *ProofOfWork) Serialize() []byte {
 	data := []byte{}
@@ -0,0 +1,27 @@
+package consensus
+
+const (
+	InitialSubsidy         = 50     // Coins minted by the coinbase of the first blocks
+	SubsidyHalvingInterval = 210000 // Blocks between halvings of the subsidy
+	CoinbaseMaturity       = 100    // Confirmations a coinbase output needs before it is spent
+)
+
+// CoinbaseMature reports whether a coinbase output created at height may be
+// spent by a transaction in a block at spendHeight
+func CoinbaseMature(height, spendHeight int) bool {
+	return spendHeight-height >= CoinbaseMaturity
+}
+
+// BlockSubsidy returns the coins a block at height may mint, on top of the
+// fees of its transactions
+func BlockSubsidy(height int) float64 {
+	halvings := height / SubsidyHalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	subsidy := float64(InitialSubsidy)
+	for i := 0; i < halvings; i++ {
+		subsidy /= 2
+	}
+	return subsidy
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"blockchain/types"
+)
+
+// AddressEntry is a single credit or debit recorded for an address
+type AddressEntry struct {
+	TxHash     []byte  `json:"txHash"`
+	BlockHash  []byte  `json:"blockHash"`
+	BlockIndex int     `json:"blockIndex"`
+	// Output index for credits, input index for debits
+	Index      int     `json:"index"`
+	Amount     float64 `json:"amount"`
+	IsDebit    bool    `json:"isDebit"`
+	// Output spent by a debit
+	PrevTxHash []byte  `json:"prevTxHash,omitempty"`
+	PrevIndex  uint64  `json:"prevIndex,omitempty"`
+}
+
+// AddressTotals summarises the activity of an address
+type AddressTotals struct {
+	Received float64 `json:"received"`
+	Sent     float64 `json:"sent"`
+	Balance  float64 `json:"balance"`
+	TxCount  int     `json:"txCount"`
+}
+
+// AddressIndexEnabled reports whether the address index is maintained
+func (bdb *BlockchainDB) AddressIndexEnabled() bool {
+	return bdb.addrIndex
+}
+
+// EnableAddressIndex turns on the address index. The index is built over
+// the blocks already stored, then kept up to date by AddBlock.
+func (bdb *BlockchainDB) EnableAddressIndex() error {
+	if bdb.addrIndex {
+		return nil
+	}
+	if bdb.prune != nil {
+		return fmt.Errorf("the index cannot be built on a pruned chain")
+	}
+
+	if err := bdb.BuildAddressIndex(); err != nil {
+		return err
+	}
+	if err := bdb.setMeta(metaAddrIndex, "1"); err != nil {
+		return err
+	}
+
+	bdb.addrIndex = true
+	return nil
+}
+
+// BuildAddressIndex rebuilds the address index from scratch over every
+// stored block
+func (bdb *BlockchainDB) BuildAddressIndex() error {
+	blocks, err := bdb.loadBlocks()
+	if err != nil {
+		return err
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM address_index`); err != nil {
+		return fmt.Errorf("failed to clear address_index: %v", err)
+	}
+
+	for _, block := range blocks {
+		if err := indexAddresses(tx, block); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAddressHistory returns the credits and debits of address, most recent
+// first. offset and limit select a page of the history.
+func (bdb *BlockchainDB) GetAddressHistory(address []byte, offset, limit int) ([]AddressEntry, error) {
+	if !bdb.addrIndex {
+		return nil, fmt.Errorf("address index is not enabled")
+	}
+
+	rows, err := bdb.db.Query(`
+		SELECT tx_hash, block_hash, block_index, io_index, amount,
+		       is_debit, prev_tx_hash, prev_output_index
+		FROM address_index WHERE address = ?
+		ORDER BY block_index DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, address, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address history: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []AddressEntry
+	for rows.Next() {
+		var entry AddressEntry
+		var prevIndex sql.NullInt64
+		err := rows.Scan(
+			&entry.TxHash, &entry.BlockHash, &entry.BlockIndex, &entry.Index, &entry.Amount,
+			&entry.IsDebit, &entry.PrevTxHash, &prevIndex,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan address entry: %v", err)
+		}
+		entry.PrevIndex = uint64(prevIndex.Int64)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read address history: %v", err)
+	}
+	return entries, nil
+}
+
+// GetAddressTotals returns the amounts received and sent by address
+func (bdb *BlockchainDB) GetAddressTotals(address []byte) (*AddressTotals, error) {
+	if !bdb.addrIndex {
+		return nil, fmt.Errorf("address index is not enabled")
+	}
+
+	var totals AddressTotals
+	err := bdb.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN is_debit = 0 THEN amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN is_debit = 1 THEN amount ELSE 0 END), 0),
+			COUNT(DISTINCT tx_hash)
+		FROM address_index WHERE address = ?
+	`, address).Scan(&totals.Received, &totals.Sent, &totals.TxCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query address totals: %v", err)
+	}
+
+	totals.Balance = totals.Received - totals.Sent
+	return &totals, nil
+}
+
+// indexAddresses records the credits and debits made by every transaction
+// of block. Debits are found by looking up the credit of the spent output,
+// so blocks must be indexed in height order.
+func indexAddresses(tx *sql.Tx, block *types.Block) error {
+	for i := range block.Transactions {
+		txn := &block.Transactions[i]
+		txHash := txn.Hash()
+
+		for inIndex, input := range txn.Inputs {
+			var address []byte
+			var amount float64
+			err := tx.QueryRow(`
+				SELECT address, amount FROM address_index
+				WHERE tx_hash = ? AND io_index = ? AND is_debit = 0
+			`, input.PreviousTxHash, input.OutputIndex).Scan(&address, &amount)
+			if err == sql.ErrNoRows {
+				// The spent output did not pay a known address
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to look up spent output: %v", err)
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO address_index (
+					address, tx_hash, block_hash, block_index, io_index,
+					amount, is_debit, prev_tx_hash, prev_output_index
+				)
+				VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)
+			`, address, txHash, block.Hash, block.Index, inIndex,
+				amount, input.PreviousTxHash, input.OutputIndex)
+			if err != nil {
+				return fmt.Errorf("failed to index debit: %v", err)
+			}
+		}
+
+		for outIndex, output := range txn.Outputs {
+			if len(output.Address) == 0 {
+				continue
+			}
+
+			_, err := tx.Exec(`
+				INSERT INTO address_index (
+					address, tx_hash, block_hash, block_index, io_index,
+					amount, is_debit
+				)
+				VALUES (?, ?, ?, ?, ?, ?, 0)
+			`, output.Address, txHash, block.Hash, block.Index, outIndex, output.Amount)
+			if err != nil {
+				return fmt.Errorf("failed to index credit: %v", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"blockchain/types"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestAddressIndex tests credits, debits, totals and paging for an address
+func TestAddressIndex(t *testing.T) {
+	dbPath := "test_addrindex.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	alice := []byte("alice")
+	bob := []byte("bob")
+
+	// alice receives 50 in block 1
+	funding := types.Transaction{
+		Version: 1,
+		Outputs: []types.Output{
+			{Amount: 50.0, ScriptPubKey: alice, ScriptType: "P2PKH", Address: alice},
+		},
+	}
+	block1 := &types.Block{
+		Index:        1,
+		Timestamp:    time.Now().Unix(),
+		Transactions: []types.Transaction{funding},
+		PrevHash:     []byte("genesis"),
+		Hash:         []byte("block1"),
+	}
+	if err := db.AddBlock(block1); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+
+	// Enabling the index afterwards picks up block 1
+	if err := db.EnableAddressIndex(); err != nil {
+		t.Fatalf("EnableAddressIndex failed: %v", err)
+	}
+
+	// alice spends it, paying 30 to bob and 20 back to herself
+	spend := types.Transaction{
+		Version: 1,
+		Inputs: []types.Input{
+			{PreviousTxHash: funding.Hash(), OutputIndex: 0, ScriptSig: []byte("sig"), Sequence: 0xFFFFFFFF},
+		},
+		Outputs: []types.Output{
+			{Amount: 30.0, ScriptPubKey: bob, ScriptType: "P2PKH", Address: bob},
+			{Amount: 20.0, ScriptPubKey: alice, ScriptType: "P2PKH", Address: alice},
+		},
+	}
+	block2 := &types.Block{
+		Index:        2,
+		Timestamp:    time.Now().Unix(),
+		Transactions: []types.Transaction{spend},
+		PrevHash:     block1.Hash,
+		Hash:         []byte("block2"),
+	}
+	if err := db.AddBlock(block2); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+
+	totals, err := db.GetAddressTotals(alice)
+	if err != nil {
+		t.Fatalf("GetAddressTotals failed: %v", err)
+	}
+	if totals.Received != 70.0 || totals.Sent != 50.0 || totals.Balance != 20.0 || totals.TxCount != 2 {
+		t.Errorf("Unexpected totals for alice: %+v", totals)
+	}
+
+	history, err := db.GetAddressHistory(alice, 0, 10)
+	if err != nil {
+		t.Fatalf("GetAddressHistory failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 entries for alice, got %d", len(history))
+	}
+	if history[2].BlockIndex != 1 || history[2].IsDebit {
+		t.Errorf("Expected the oldest entry to be the block 1 credit, got %+v", history[2])
+	}
+
+	var debits int
+	for _, entry := range history {
+		if entry.IsDebit {
+			debits++
+			if entry.Amount != 50.0 || entry.PrevIndex != 0 {
+				t.Errorf("Unexpected debit: %+v", entry)
+			}
+		}
+	}
+	if debits != 1 {
+		t.Errorf("Expected 1 debit for alice, got %d", debits)
+	}
+
+	page, err := db.GetAddressHistory(alice, 2, 2)
+	if err != nil {
+		t.Fatalf("GetAddressHistory failed: %v", err)
+	}
+	if len(page) != 1 || page[0].BlockIndex != 1 {
+		t.Errorf("Expected the second page to hold the block 1 credit, got %+v", page)
+	}
+
+	totals, err = db.GetAddressTotals(bob)
+	if err != nil {
+		t.Fatalf("GetAddressTotals failed: %v", err)
+	}
+	if totals.Received != 30.0 || totals.Sent != 0 {
+		t.Errorf("Unexpected totals for bob: %+v", totals)
+	}
+}
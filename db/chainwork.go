@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"blockchain/consensus"
+	"blockchain/types"
+)
+
+// GetChainWork returns the total proof of work of the chain up to and
+// including the block at height
+func (bdb *BlockchainDB) GetChainWork(height int) (*big.Int, error) {
+	var work []byte
+	err := bdb.db.QueryRow(`SELECT chain_work FROM blocks WHERE id = ?`, height).Scan(&work)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chain work: %v", err)
+	}
+	return new(big.Int).SetBytes(work), nil
+}
+
+// BuildChainWork recomputes the cumulative work of every stored block from
+// the headers. Headers are kept when pruning, so this works on any chain.
+func (bdb *BlockchainDB) BuildChainWork() error {
+	rows, err := bdb.db.Query(`SELECT id, difficulty FROM blocks ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to query block headers: %v", err)
+	}
+	var heights []int
+	var bits []uint32
+	for rows.Next() {
+		var height int
+		var difficulty uint32
+		if err := rows.Scan(&height, &difficulty); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan block header: %v", err)
+		}
+		heights = append(heights, height)
+		bits = append(bits, difficulty)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read block headers: %v", err)
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	total := new(big.Int)
+	for i, height := range heights {
+		total.Add(total, consensus.CalculateWork(bits[i]))
+		if _, err := tx.Exec(`UPDATE blocks SET chain_work = ? WHERE id = ?`, total.Bytes(), height); err != nil {
+			return fmt.Errorf("failed to store chain work: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addChainWork records the cumulative work of block, building on the work
+// stored for its parent
+func addChainWork(tx *sql.Tx, block *types.Block) error {
+	var parent []byte
+	err := tx.QueryRow(`SELECT chain_work FROM blocks WHERE id = ?`, block.Index-1).Scan(&parent)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query parent chain work: %v", err)
+	}
+
+	work := new(big.Int).SetBytes(parent)
+	work.Add(work, consensus.CalculateWork(block.Difficulty))
+
+	if _, err := tx.Exec(`UPDATE blocks SET chain_work = ? WHERE id = ?`, work.Bytes(), block.Index); err != nil {
+		return fmt.Errorf("failed to store chain work: %v", err)
+	}
+	return nil
+}
@@ -11,7 +11,11 @@ import (
 
 // BlockchainDB manages the SQLite database for blockchain data
 type BlockchainDB struct {
-	db *sql.DB
+	db          *sql.DB
+	txIndex     bool
+	addrIndex   bool
+	prune       *PruneConfig
+	pruneHeight int
 }
 
 // InitDatabase creates a new database connection and sets up tables
@@ -36,13 +40,23 @@ func InitDatabase(dbPath string) (*BlockchainDB, error) {
 			nonce INTEGER NOT NULL,
 			miner TEXT NOT NULL,
 			blocksize INTEGER NOT NULL,
-			difficulty INTEGER NOT NULL
+			difficulty INTEGER NOT NULL,
+			merkle_root BLOB,
+			chain_work BLOB
 		)
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create blocks table: %v", err)
 	}
 
+	// Databases created by older versions lack the newer block columns
+	if err = addColumnIfMissing(db, "blocks", "merkle_root", "BLOB"); err != nil {
+		return nil, err
+	}
+	if err = addColumnIfMissing(db, "blocks", "chain_work", "BLOB"); err != nil {
+		return nil, err
+	}
+
 	// Create transactions table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS transactions (
@@ -91,5 +105,172 @@ func InitDatabase(dbPath string) (*BlockchainDB, error) {
 		return nil, fmt.Errorf("failed to create transaction_outputs table: %v", err)
 	}
 
-	return &BlockchainDB{db: db}, nil
+	// Create key/value table for chain-wide settings and state
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS chain_meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chain_meta table: %v", err)
+	}
+
+	// Create transaction index table, only populated when the index is enabled
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tx_index (
+			tx_hash BLOB PRIMARY KEY,       -- Transaction.Hash()
+			block_hash BLOB NOT NULL,
+			block_index INTEGER NOT NULL,
+			position INTEGER NOT NULL,      -- Position of the transaction in the block
+			FOREIGN KEY (block_hash) REFERENCES blocks(hash)
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tx_index table: %v", err)
+	}
+
+	// Create address index table, only populated when the index is enabled.
+	// Credits are outputs paying the address, debits are inputs spending them.
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS address_index (
+			id INTEGER PRIMARY KEY,
+			address BLOB NOT NULL,
+			tx_hash BLOB NOT NULL,
+			block_hash BLOB NOT NULL,
+			block_index INTEGER NOT NULL,
+			io_index INTEGER NOT NULL,      -- Output index for credits, input index for debits
+			amount REAL NOT NULL,
+			is_debit INTEGER NOT NULL,
+			prev_tx_hash BLOB,              -- Output spent by a debit
+			prev_output_index INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS address_index_address ON address_index (address, block_index);
+		CREATE INDEX IF NOT EXISTS address_index_output ON address_index (tx_hash, io_index, is_debit);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create address_index table: %v", err)
+	}
+
+	// Create UTXO set table, updated by every block added
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS utxos (
+			tx_hash BLOB NOT NULL,
+			output_index INTEGER NOT NULL,
+			amount REAL NOT NULL,
+			script_pubkey BLOB,
+			script_type TEXT,
+			address BLOB,
+			block_index INTEGER NOT NULL,   -- Height of the block creating the output
+			coinbase INTEGER NOT NULL,
+			PRIMARY KEY (tx_hash, output_index)
+		);
+		CREATE INDEX IF NOT EXISTS utxos_address ON utxos (address);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create utxos table: %v", err)
+	}
+
+	// Create undo table, holding the outputs each block spent so that it can
+	// be disconnected
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS utxo_undo (
+			spent_index INTEGER NOT NULL,   -- Height of the block spending the output
+			tx_hash BLOB NOT NULL,
+			output_index INTEGER NOT NULL,
+			amount REAL NOT NULL,
+			script_pubkey BLOB,
+			script_type TEXT,
+			address BLOB,
+			block_index INTEGER NOT NULL,   -- Height of the block creating the output
+			coinbase INTEGER NOT NULL,
+			PRIMARY KEY (tx_hash, output_index)
+		);
+		CREATE INDEX IF NOT EXISTS utxo_undo_spent ON utxo_undo (spent_index);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create utxo_undo table: %v", err)
+	}
+
+	bdb := &BlockchainDB{db: db}
+
+	txIndex, err := bdb.getMeta(metaTxIndex)
+	if err != nil {
+		return nil, err
+	}
+	bdb.txIndex = txIndex == "1"
+
+	addrIndex, err := bdb.getMeta(metaAddrIndex)
+	if err != nil {
+		return nil, err
+	}
+	bdb.addrIndex = addrIndex == "1"
+
+	if err := bdb.loadPruneState(); err != nil {
+		return nil, err
+	}
+
+	// Build the UTXO set for chains stored before it was persisted
+	utxoHeight, err := bdb.UTXOHeight()
+	if err != nil {
+		return nil, err
+	}
+	best, err := bdb.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if utxoHeight < 0 && best >= 0 {
+		if err := bdb.BuildUTXOSet(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Likewise for the cumulative work of each block
+	var missingWork int
+	err = db.QueryRow(`SELECT COUNT(*) FROM blocks WHERE chain_work IS NULL`).Scan(&missingWork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check chain work: %v", err)
+	}
+	if missingWork > 0 {
+		if err := bdb.BuildChainWork(); err != nil {
+			return nil, err
+		}
+	}
+
+	// And for the Merkle root kept with each header
+	var missingRoots int
+	err = db.QueryRow(`SELECT COUNT(*) FROM blocks WHERE merkle_root IS NULL AND length(transactions) > 0`).Scan(&missingRoots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check Merkle roots: %v", err)
+	}
+	if missingRoots > 0 {
+		if err := bdb.BuildMerkleRoots(); err != nil {
+			return nil, err
+		}
+	}
+
+	return bdb, nil
+}
+
+// addColumnIfMissing adds a column to an existing table created by an older
+// version of the schema
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// Close closes the underlying database connection
+func (bdb *BlockchainDB) Close() error {
+	return bdb.db.Close()
 }
@@ -1,6 +1,7 @@
 package db
 
 import (
+    "bytes"
     "blockchain/types"
 //    "database/sql"
     "os"
@@ -46,8 +47,8 @@ func TestAddBlock(t *testing.T) {
         Index:        1,
         Timestamp:    time.Now().Unix(),
         Transactions: []types.Transaction{},
-        PrevHash:     "prevhash",
-        Hash:         "blockhash",
+        PrevHash:     []byte("prevhash"),
+        Hash:         []byte("blockhash"),
         Nonce:        123,
         Miner:        "miner",
         BlockSize:    100,
@@ -109,8 +110,8 @@ func TestAddBlockWithTransactions(t *testing.T) {
         Index:        1,
         Timestamp:    time.Now().Unix(),
         Transactions: []types.Transaction{tx},
-        PrevHash:     "prevhash",
-        Hash:         "blockhash",
+        PrevHash:     []byte("prevhash"),
+        Hash:         []byte("blockhash"),
         Nonce:        123,
         Miner:        "miner",
         BlockSize:    100,
@@ -177,8 +178,8 @@ func TestGetTransaction(t *testing.T) {
         Index:        1,
         Timestamp:    time.Now().Unix(),
         Transactions: []types.Transaction{tx},
-        PrevHash:     "prevhash",
-        Hash:         "blockhash",
+        PrevHash:     []byte("prevhash"),
+        Hash:         []byte("blockhash"),
         Nonce:        123,
         Miner:        "miner",
         BlockSize:    100,
@@ -240,8 +241,8 @@ func TestGetBlock(t *testing.T) {
         Index:        1,
         Timestamp:    time.Now().Unix(),
         Transactions: []types.Transaction{tx},
-        PrevHash:     "prevhash",
-        Hash:         "blockhash",
+        PrevHash:     []byte("prevhash"),
+        Hash:         []byte("blockhash"),
         Nonce:        123,
         Miner:        "miner",
         BlockSize:    100,
@@ -255,13 +256,13 @@ func TestGetBlock(t *testing.T) {
     }
 
     // Retrieve the block
-    retrievedBlock, err := db.GetBlock(block.Hash)
+    retrievedBlock, err := db.GetBlock(string(block.Hash))
     if err != nil {
         t.Fatalf("GetBlock failed: %v", err)
     }
 
     // Verify that the retrieved block matches the original
-    if retrievedBlock.Index != block.Index || retrievedBlock.Hash != block.Hash {
+    if retrievedBlock.Index != block.Index || !bytes.Equal(retrievedBlock.Hash, block.Hash) {
         t.Errorf("Retrieved block does not match the original")
     }
 
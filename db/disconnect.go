@@ -0,0 +1,100 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"blockchain/types"
+)
+
+// ErrNoUndoData is returned by DisconnectBlock for a block stored without
+// the outputs it spent, as were blocks added before undo data was kept.
+// Reindexing the chain records it for every block.
+var ErrNoUndoData = errors.New("block has no undo data")
+
+// DisconnectBlock removes the tip block from the chain and returns it. The
+// outputs it created leave the UTXO set and those it spent are restored
+// from its undo data, and it is removed from the enabled indexes. The
+// genesis block and pruned blocks cannot be disconnected.
+func (bdb *BlockchainDB) DisconnectBlock() (*types.Block, error) {
+	best, err := bdb.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if best <= 0 {
+		return nil, fmt.Errorf("no block to disconnect")
+	}
+	utxoHeight, err := bdb.UTXOHeight()
+	if err != nil {
+		return nil, err
+	}
+	if utxoHeight != best {
+		return nil, fmt.Errorf("UTXO set is not at the chain tip (%d != %d)", utxoHeight, best)
+	}
+	block, err := bdb.GetBlockByHeight(best)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	spent := 0
+	for _, txn := range block.Transactions {
+		if !txn.IsCoinbase() {
+			spent += len(txn.Inputs)
+		}
+	}
+	var undone int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM utxo_undo WHERE spent_index = ?`, best).Scan(&undone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query undo data: %v", err)
+	}
+	if undone != spent {
+		return nil, fmt.Errorf("%w: block %d spent %d outputs, %d recorded", ErrNoUndoData, best, spent, undone)
+	}
+
+	// Outputs both created and spent by the block are not restored
+	_, err = tx.Exec(`
+		DELETE FROM utxos WHERE block_index = ?;
+		INSERT INTO utxos (
+			tx_hash, output_index, amount, script_pubkey,
+			script_type, address, block_index, coinbase
+		)
+		SELECT tx_hash, output_index, amount, script_pubkey,
+		       script_type, address, block_index, coinbase
+		FROM utxo_undo WHERE spent_index = ? AND block_index < ?;
+		DELETE FROM utxo_undo WHERE spent_index = ?;
+	`, best, best, best, best)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore spent outputs: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM transaction_inputs WHERE transaction_id IN (
+			SELECT id FROM transactions WHERE block_index = ?
+		);
+		DELETE FROM transaction_outputs WHERE transaction_id IN (
+			SELECT id FROM transactions WHERE block_index = ?
+		);
+		DELETE FROM transactions WHERE block_index = ?;
+		DELETE FROM tx_index WHERE block_index = ?;
+		DELETE FROM address_index WHERE block_index = ?;
+		DELETE FROM blocks WHERE id = ?;
+	`, best, best, best, best, best, best)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete block: %v", err)
+	}
+
+	if err := writeMeta(tx, metaUTXOHeight, strconv.Itoa(best-1)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit disconnection: %v", err)
+	}
+	return block, nil
+}
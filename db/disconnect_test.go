@@ -0,0 +1,122 @@
+package db
+
+import (
+	"blockchain/types"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestDisconnectBlock tests that disconnecting the tip restores the UTXO
+// set and the indexes as they were before it was added
+func TestDisconnectBlock(t *testing.T) {
+	dbPath := "test_disconnect.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+	if err := db.EnableTxIndex(); err != nil {
+		t.Fatalf("EnableTxIndex failed: %v", err)
+	}
+	if err := db.EnableAddressIndex(); err != nil {
+		t.Fatalf("EnableAddressIndex failed: %v", err)
+	}
+
+	output := func(amount float64, address string) types.Output {
+		return types.Output{Amount: amount, ScriptPubKey: []byte(address), ScriptType: "P2PKH", Address: []byte(address)}
+	}
+	spend := func(prev *types.Transaction, outputs ...types.Output) types.Transaction {
+		return types.Transaction{
+			Version: 1,
+			Inputs:  []types.Input{{PreviousTxHash: prev.Hash(), OutputIndex: 0, ScriptSig: []byte("sig"), Sequence: 0xFFFFFFFF}},
+			Outputs: outputs,
+		}
+	}
+
+	genesis := &types.Block{Index: 0, Timestamp: time.Now().Unix(), PrevHash: []byte{0}, Hash: []byte("genesis")}
+	coinbase := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput([]byte("height 1"))},
+		Outputs: []types.Output{output(50.0, "miner")},
+	}
+	block1 := &types.Block{Index: 1, Timestamp: time.Now().Unix(), Transactions: []types.Transaction{coinbase}, PrevHash: genesis.Hash, Hash: []byte("block1")}
+
+	// Block 2 spends the coinbase, and an output it creates itself
+	coinbase2 := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput([]byte("height 2"))},
+		Outputs: []types.Output{output(50.0, "miner")},
+	}
+	payment := spend(&coinbase, output(50.0, "bob"))
+	forward := spend(&payment, output(50.0, "carol"))
+	block2 := &types.Block{Index: 2, Timestamp: time.Now().Unix(), Transactions: []types.Transaction{coinbase2, payment, forward}, PrevHash: block1.Hash, Hash: []byte("block2")}
+
+	for _, block := range []*types.Block{genesis, block1, block2} {
+		if err := db.AddBlock(block); err != nil {
+			t.Fatalf("AddBlock failed: %v", err)
+		}
+	}
+
+	disconnected, err := db.DisconnectBlock()
+	if err != nil {
+		t.Fatalf("DisconnectBlock failed: %v", err)
+	}
+	if string(disconnected.Hash) != "block2" || len(disconnected.Transactions) != 3 {
+		t.Errorf("Expected block 2 with its 3 transactions, got %s with %d", disconnected.Hash, len(disconnected.Transactions))
+	}
+
+	if best, err := db.GetBestHeight(); err != nil || best != 1 {
+		t.Errorf("Expected best height 1, got %d (%v)", best, err)
+	}
+	if height, err := db.UTXOHeight(); err != nil || height != 1 {
+		t.Errorf("Expected UTXO height 1, got %d (%v)", height, err)
+	}
+	if height, isCoinbase, err := db.GetUTXOOrigin(coinbase.Hash(), 0); err != nil || height != 1 || !isCoinbase {
+		t.Errorf("Expected the coinbase of block 1 to be unspent again, got %d, %v (%v)", height, isCoinbase, err)
+	}
+	for _, txn := range []types.Transaction{coinbase2, payment, forward} {
+		if _, err := db.GetUTXO(txn.Hash(), 0); err != ErrUTXONotFound {
+			t.Errorf("Expected the outputs of block 2 to be gone, got %v", err)
+		}
+	}
+	if _, _, err := db.GetTransactionByHash(payment.Hash()); err == nil {
+		t.Errorf("Expected the transactions of block 2 to leave the index")
+	}
+	if history, err := db.GetAddressHistory([]byte("miner"), 0, 10); err != nil || len(history) != 1 {
+		t.Errorf("Expected only the credit of block 1 for the miner, got %d entries (%v)", len(history), err)
+	}
+
+	// The block can be connected again
+	if err := db.AddBlock(block2); err != nil {
+		t.Fatalf("AddBlock after disconnection failed: %v", err)
+	}
+	if _, err := db.GetUTXO(forward.Hash(), 0); err != nil {
+		t.Errorf("GetUTXO failed after reconnection: %v", err)
+	}
+
+	// Blocks stored without undo data are refused until a reindex
+	if _, err := db.db.Exec(`DELETE FROM utxo_undo`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DisconnectBlock(); !errors.Is(err, ErrNoUndoData) {
+		t.Errorf("Expected ErrNoUndoData, got %v", err)
+	}
+	if err := db.Reindex(); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	for height := 2; height > 0; height-- {
+		if _, err := db.DisconnectBlock(); err != nil {
+			t.Fatalf("DisconnectBlock after reindex failed: %v", err)
+		}
+	}
+	if _, err := db.DisconnectBlock(); err == nil {
+		t.Errorf("Expected the genesis block not to be disconnected")
+	}
+	if entries, err := db.GetUTXOsByAddress([]byte("miner")); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no outputs left above genesis, got %d (%v)", len(entries), err)
+	}
+}
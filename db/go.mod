@@ -2,11 +2,15 @@ module db
 
 go 1.23.2
 
+require (
+	blockchain/consensus v0.0.0-00010101000000-000000000000
+	blockchain/types v0.0.0-00010101000000-000000000000
+	github.com/mattn/go-sqlite3 v1.14.24
+)
+
 require (
 	blockchain/chain v0.0.0-00010101000000-000000000000 // indirect
 	blockchain/transaction v0.0.0-00010101000000-000000000000 // indirect
-	blockchain/types v0.0.0-00010101000000-000000000000 // indirect
-	github.com/mattn/go-sqlite3 v1.14.24 // indirect
 )
 
 replace blockchain/chain => ../blockchain
@@ -14,3 +18,5 @@ replace blockchain/chain => ../blockchain
 replace blockchain/transaction => ../blockchain/transaction
 
 replace blockchain/types => ../types
+
+replace blockchain/consensus => ../consensus
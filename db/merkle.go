@@ -0,0 +1,54 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"blockchain/types"
+)
+
+// BuildMerkleRoots stores the Merkle root of every block saved before the
+// root was kept with the header. Pruned blocks no longer have the
+// transactions to compute it from and are left without one.
+func (bdb *BlockchainDB) BuildMerkleRoots() error {
+	rows, err := bdb.db.Query(`
+		SELECT id, transactions FROM blocks
+		WHERE merkle_root IS NULL AND length(transactions) > 0
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query blocks: %v", err)
+	}
+	roots := make(map[int][]byte)
+	for rows.Next() {
+		var block types.Block
+		var txJSON []byte
+		if err := rows.Scan(&block.Index, &txJSON); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan block: %v", err)
+		}
+		if err := json.Unmarshal(txJSON, &block.Transactions); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to unmarshal transactions of block %d: %v", block.Index, err)
+		}
+		roots[block.Index] = block.ComputeMerkleRoot()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read blocks: %v", err)
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for height, root := range roots {
+		if _, err := tx.Exec(`UPDATE blocks SET merkle_root = ? WHERE id = ?`, root, height); err != nil {
+			return fmt.Errorf("failed to store Merkle root: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
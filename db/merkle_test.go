@@ -0,0 +1,50 @@
+package db
+
+import (
+	"blockchain/consensus"
+	"blockchain/types"
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMerkleRootBackfill tests that opening a database fills in the Merkle
+// roots missing from blocks stored by older versions
+func TestMerkleRootBackfill(t *testing.T) {
+	dbPath := "test_merkle.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+
+	coinbase := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput([]byte{0})},
+		Outputs: []types.Output{{Amount: 50.0, ScriptPubKey: []byte("miner"), ScriptType: "P2PKH", Address: []byte("miner")}},
+	}
+	block := &types.Block{Index: 0, Timestamp: time.Now().Unix(), Transactions: []types.Transaction{coinbase}, PrevHash: []byte("genesis"), Hash: []byte("a"), Difficulty: consensus.CalculateDifficultyBits(8)}
+	if err := db.AddBlock(block); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+	if _, err := db.db.Exec(`UPDATE blocks SET merkle_root = NULL`); err != nil {
+		t.Fatalf("Failed to clear Merkle root: %v", err)
+	}
+	db.Close()
+
+	db, err = InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	header, err := db.GetBlockHeader(0)
+	if err != nil {
+		t.Fatalf("GetBlockHeader failed: %v", err)
+	}
+	if !bytes.Equal(header.MerkleRoot, block.ComputeMerkleRoot()) {
+		t.Errorf("Expected Merkle root %x, got %x", block.ComputeMerkleRoot(), header.MerkleRoot)
+	}
+}
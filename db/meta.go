@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Keys used in the chain_meta table
+const (
+	metaTxIndex     = "txindex"
+	metaAddrIndex   = "addrindex"
+	metaUTXOHeight  = "utxo_height"
+	metaPruneHeight = "prune_height"
+	metaPruneBlocks = "prune_blocks"
+	metaPruneSize   = "prune_size"
+)
+
+// getMeta returns the value stored under key, or "" if it is not set
+func (bdb *BlockchainDB) getMeta(key string) (string, error) {
+	var value string
+	err := bdb.db.QueryRow(`SELECT value FROM chain_meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return value, nil
+}
+
+// setMeta stores value under key, replacing any previous value
+func (bdb *BlockchainDB) setMeta(key, value string) error {
+	return writeMeta(bdb.db, key, value)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// writeMeta stores value under key using e, so that it can take part in a
+// database transaction
+func writeMeta(e execer, key, value string) error {
+	_, err := e.Exec(`
+		INSERT INTO chain_meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	return nil
+}
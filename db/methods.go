@@ -8,7 +8,8 @@ import (
 	"strconv"
 )
 
-// AddBlock stores a new block in the database
+// AddBlock stores a new block in the database. On a pruned chain an error
+// wrapping ErrPruneFailed means the block was stored all the same.
 func (bdb *BlockchainDB) AddBlock(block *types.Block) error {
 	tx, err := bdb.db.Begin()
 	if err != nil {
@@ -24,11 +25,11 @@ func (bdb *BlockchainDB) AddBlock(block *types.Block) error {
 
 	// Insert block
 	_, err = tx.Exec(`
-		INSERT INTO blocks (id, timestamp, transactions, prev_hash, hash, nonce, miner, blocksize, difficulty)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO blocks (id, timestamp, transactions, prev_hash, hash, nonce, miner, blocksize, difficulty, merkle_root)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		block.Index, block.Timestamp, txJSON, block.PrevHash, block.Hash,
-		block.Nonce, block.Miner, block.BlockSize, block.Difficulty,
+		block.Nonce, block.Miner, block.BlockSize, block.Difficulty, block.MerkleRoot,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert block: %v", err)
@@ -81,7 +82,148 @@ func (bdb *BlockchainDB) AddBlock(block *types.Block) error {
 		}
 	}
 
-	return tx.Commit()
+	if err := addChainWork(tx, block); err != nil {
+		return err
+	}
+
+	if bdb.txIndex {
+		if err := indexTransactions(tx, block); err != nil {
+			return err
+		}
+	}
+
+	if bdb.addrIndex {
+		if err := indexAddresses(tx, block); err != nil {
+			return err
+		}
+	}
+
+	if err := applyUTXOs(tx, block); err != nil {
+		return err
+	}
+	if err := writeMeta(tx, metaUTXOHeight, strconv.Itoa(block.Index)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit block: %v", err)
+	}
+
+	// Bodies are only pruned once the UTXO set covering them is committed
+	if bdb.prune != nil {
+		if _, err := bdb.Prune(); err != nil {
+			return fmt.Errorf("%w: %v", ErrPruneFailed, err)
+		}
+	}
+	return nil
+}
+
+// GetBlockByHeight retrieves the block at the given height, with its
+// transactions exactly as they were added to the chain
+func (bdb *BlockchainDB) GetBlockByHeight(height int) (*types.Block, error) {
+	if height <= bdb.pruneHeight {
+		return nil, ErrBlockPruned
+	}
+
+	row := bdb.db.QueryRow(`
+		SELECT id, timestamp, transactions, prev_hash, hash,
+		       nonce, miner, blocksize, difficulty, merkle_root
+		FROM blocks WHERE id = ?
+	`, height)
+
+	block, err := scanBlock(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query block: %v", err)
+	}
+	return block, nil
+}
+
+// GetBlockHeader retrieves the header fields of the block at the given
+// height, without its transactions. Headers are kept when pruning.
+func (bdb *BlockchainDB) GetBlockHeader(height int) (*types.Block, error) {
+	var block types.Block
+	err := bdb.db.QueryRow(`
+		SELECT id, timestamp, prev_hash, hash, nonce, miner, blocksize, difficulty, merkle_root
+		FROM blocks WHERE id = ?
+	`, height).Scan(
+		&block.Index, &block.Timestamp, &block.PrevHash, &block.Hash,
+		&block.Nonce, &block.Miner, &block.BlockSize, &block.Difficulty, &block.MerkleRoot,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query block header: %v", err)
+	}
+	return &block, nil
+}
+
+// GetBestHeight returns the height of the highest stored block, or -1 if
+// the database holds no blocks
+func (bdb *BlockchainDB) GetBestHeight() (int, error) {
+	var height sql.NullInt64
+	err := bdb.db.QueryRow(`SELECT MAX(id) FROM blocks`).Scan(&height)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query best height: %v", err)
+	}
+	if !height.Valid {
+		return -1, nil
+	}
+	return int(height.Int64), nil
+}
+
+// loadBlocks returns every stored block in height order, with the header
+// fields needed for indexing and the transactions
+func (bdb *BlockchainDB) loadBlocks() ([]*types.Block, error) {
+	if bdb.pruneHeight >= 0 {
+		return nil, ErrBlockPruned
+	}
+
+	rows, err := bdb.db.Query(`SELECT id, hash, transactions FROM blocks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocks: %v", err)
+	}
+	defer rows.Close()
+
+	var blocks []*types.Block
+	for rows.Next() {
+		var block types.Block
+		var txJSON []byte
+		if err := rows.Scan(&block.Index, &block.Hash, &txJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan block: %v", err)
+		}
+		if err := json.Unmarshal(txJSON, &block.Transactions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transactions of block %d: %v", block.Index, err)
+		}
+		blocks = append(blocks, &block)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blocks: %v", err)
+	}
+	return blocks, nil
+}
+
+// scanBlock builds a block from a row of the blocks table, decoding the
+// transactions from the stored JSON
+func scanBlock(row *sql.Row) (*types.Block, error) {
+	var block types.Block
+	var txJSON []byte
+
+	err := row.Scan(
+		&block.Index, &block.Timestamp, &txJSON, &block.PrevHash, &block.Hash,
+		&block.Nonce, &block.Miner, &block.BlockSize, &block.Difficulty, &block.MerkleRoot,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(txJSON, &block.Transactions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transactions: %v", err)
+	}
+	return &block, nil
 }
 
 // GetTransaction retrieves a complete transaction by its ID
@@ -196,7 +338,7 @@ func (bdb *BlockchainDB) GetBlock(hash string) (*types.Block, error) {
     query := `
         SELECT
             b.id, b.timestamp, b.prev_hash, b.hash, b.nonce,
-            b.miner, b.blocksize, b.difficulty,
+            b.miner, b.blocksize, b.difficulty, b.merkle_root,
             t.id as tx_id, t.version, t.locktime,
             ti.id as input_id, ti.previous_tx_hash, ti.output_index,
             ti.script_sig, ti.sequence,
@@ -209,7 +351,8 @@ func (bdb *BlockchainDB) GetBlock(hash string) (*types.Block, error) {
         WHERE b.hash = ?
         ORDER BY t.id, ti.id, tx.id`
 
-    rows, err := bdb.db.Query(query, hash)
+    // Hashes are stored as blobs, a string argument would never match
+    rows, err := bdb.db.Query(query, []byte(hash))
     if err != nil {
         return nil, fmt.Errorf("failed to query block data: %v", err)
     }
@@ -234,7 +377,7 @@ func (bdb *BlockchainDB) GetBlock(hash string) (*types.Block, error) {
 
         err := rows.Scan(
             &block.Index, &block.Timestamp, &block.PrevHash, &block.Hash,
-            &block.Nonce, &block.Miner, &block.BlockSize, &block.Difficulty,
+            &block.Nonce, &block.Miner, &block.BlockSize, &block.Difficulty, &block.MerkleRoot,
             &txID, &version, &locktime,
             &inputID, &prevTxHash, &outputIndex, &scriptSig, &sequence,
             &outputID, &value, &scriptPubKey, &scriptType, &address,
@@ -301,6 +444,9 @@ func (bdb *BlockchainDB) GetBlock(hash string) (*types.Block, error) {
     if first {
         return nil, fmt.Errorf("block not found")
     }
+    if block.Index <= bdb.pruneHeight {
+        return nil, ErrBlockPruned
+    }
 
     return &block, nil
 }
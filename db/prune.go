@@ -0,0 +1,221 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MinBlocksToKeep is the smallest number of recent blocks a pruned node
+// keeps in full, so that it can still serve them and handle reorgs
+const MinBlocksToKeep = 288
+
+// Service flags a node advertises to its peers
+const (
+	// ServiceNodeNetwork means the node can serve the full chain
+	ServiceNodeNetwork uint64 = 1 << 0
+	// ServiceNodeNetworkLimited means the node only serves the most recent
+	// MinBlocksToKeep blocks because older ones have been pruned
+	ServiceNodeNetworkLimited uint64 = 1 << 10
+)
+
+// ErrBlockPruned is returned when the body of a requested block has been
+// deleted by pruning
+var ErrBlockPruned = errors.New("block body has been pruned")
+
+// ErrPruneFailed is returned by AddBlock when the block was stored but
+// pruning after it failed. Pruning is tried again after the next block.
+var ErrPruneFailed = errors.New("block added but pruning failed")
+
+// PruneConfig controls how much block data a pruned node keeps
+type PruneConfig struct {
+	// KeepBlocks is the number of most recent blocks always kept in full
+	KeepBlocks int
+	// TargetSize, when non-zero, keeps pruning older bodies until the
+	// remaining ones fit in this many bytes, never going below KeepBlocks
+	TargetSize uint64
+}
+
+// PruneConfig returns the pruning settings, or nil if pruning is disabled
+func (bdb *BlockchainDB) PruneConfig() *PruneConfig {
+	return bdb.prune
+}
+
+// PruneHeight returns the height of the highest block whose body has been
+// pruned, or -1 if no block has been pruned
+func (bdb *BlockchainDB) PruneHeight() int {
+	return bdb.pruneHeight
+}
+
+// Services returns the service flags a node on this database advertises:
+// the full chain until a block body has been pruned, only recent blocks
+// after
+func (bdb *BlockchainDB) Services() uint64 {
+	if bdb.pruneHeight >= 0 {
+		return ServiceNodeNetworkLimited
+	}
+	return ServiceNodeNetwork
+}
+
+// CanServeBlock reports whether the full block at height is still stored
+func (bdb *BlockchainDB) CanServeBlock(height int) bool {
+	return height > bdb.pruneHeight
+}
+
+// EnablePruning switches the database to pruned mode. Old block bodies
+// are deleted straight away and after every new block, keeping headers.
+func (bdb *BlockchainDB) EnablePruning(config PruneConfig) error {
+	if config.KeepBlocks < MinBlocksToKeep {
+		return fmt.Errorf("must keep at least %d blocks", MinBlocksToKeep)
+	}
+	if bdb.txIndex || bdb.addrIndex {
+		return fmt.Errorf("pruning is incompatible with the transaction and address indexes")
+	}
+
+	if err := bdb.setMeta(metaPruneBlocks, strconv.Itoa(config.KeepBlocks)); err != nil {
+		return err
+	}
+	if err := bdb.setMeta(metaPruneSize, strconv.FormatUint(config.TargetSize, 10)); err != nil {
+		return err
+	}
+	bdb.prune = &config
+
+	_, err := bdb.Prune()
+	return err
+}
+
+// Prune deletes the bodies of blocks that fall outside the prune settings
+// and returns the new prune height. Only blocks already applied to the
+// persisted UTXO set are pruned.
+func (bdb *BlockchainDB) Prune() (int, error) {
+	if bdb.prune == nil {
+		return bdb.pruneHeight, fmt.Errorf("pruning is not enabled")
+	}
+
+	best, err := bdb.GetBestHeight()
+	if err != nil {
+		return bdb.pruneHeight, err
+	}
+	utxoHeight, err := bdb.UTXOHeight()
+	if err != nil {
+		return bdb.pruneHeight, err
+	}
+	if utxoHeight < best {
+		return bdb.pruneHeight, fmt.Errorf("UTXO set is behind the chain (%d < %d)", utxoHeight, best)
+	}
+
+	target := best - bdb.prune.KeepBlocks
+	if bdb.prune.TargetSize > 0 {
+		target, err = bdb.sizePruneHeight(target)
+		if err != nil {
+			return bdb.pruneHeight, err
+		}
+	}
+	if target <= bdb.pruneHeight {
+		return bdb.pruneHeight, nil
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return bdb.pruneHeight, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM transaction_inputs WHERE transaction_id IN (
+			SELECT id FROM transactions WHERE block_index <= ?
+		);
+		DELETE FROM transaction_outputs WHERE transaction_id IN (
+			SELECT id FROM transactions WHERE block_index <= ?
+		);
+		DELETE FROM transactions WHERE block_index <= ?;
+		UPDATE blocks SET transactions = x'' WHERE id <= ?;
+		DELETE FROM utxo_undo WHERE spent_index <= ?;
+	`, target, target, target, target, target)
+	if err != nil {
+		return bdb.pruneHeight, fmt.Errorf("failed to prune blocks: %v", err)
+	}
+
+	if err := writeMeta(tx, metaPruneHeight, strconv.Itoa(target)); err != nil {
+		return bdb.pruneHeight, err
+	}
+	if err := tx.Commit(); err != nil {
+		return bdb.pruneHeight, fmt.Errorf("failed to commit prune: %v", err)
+	}
+
+	bdb.pruneHeight = target
+	return target, nil
+}
+
+// sizePruneHeight returns the height up to which bodies must be pruned so
+// that the rest fit in the size target, capped at maxHeight
+func (bdb *BlockchainDB) sizePruneHeight(maxHeight int) (int, error) {
+	rows, err := bdb.db.Query(`
+		SELECT id, LENGTH(transactions) FROM blocks WHERE id > ? ORDER BY id
+	`, bdb.pruneHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query block sizes: %v", err)
+	}
+	defer rows.Close()
+
+	var heights []int
+	var sizes []uint64
+	var total uint64
+	for rows.Next() {
+		var height int
+		var size uint64
+		if err := rows.Scan(&height, &size); err != nil {
+			return 0, fmt.Errorf("failed to scan block size: %v", err)
+		}
+		heights = append(heights, height)
+		sizes = append(sizes, size)
+		total += size
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read block sizes: %v", err)
+	}
+
+	target := bdb.pruneHeight
+	for i := 0; i < len(heights) && heights[i] <= maxHeight && total > bdb.prune.TargetSize; i++ {
+		total -= sizes[i]
+		target = heights[i]
+	}
+	return target, nil
+}
+
+// loadPruneState reads the prune settings and height from chain_meta
+func (bdb *BlockchainDB) loadPruneState() error {
+	bdb.pruneHeight = -1
+
+	value, err := bdb.getMeta(metaPruneHeight)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		if bdb.pruneHeight, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid prune height %q: %v", value, err)
+		}
+	}
+
+	value, err = bdb.getMeta(metaPruneBlocks)
+	if err != nil || value == "" {
+		return err
+	}
+	var config PruneConfig
+	if config.KeepBlocks, err = strconv.Atoi(value); err != nil {
+		return fmt.Errorf("invalid prune setting %q: %v", value, err)
+	}
+
+	value, err = bdb.getMeta(metaPruneSize)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		if config.TargetSize, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid prune setting %q: %v", value, err)
+		}
+	}
+
+	bdb.prune = &config
+	return nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"blockchain/types"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func addPruneTestBlocks(t *testing.T, db *BlockchainDB, from, to int) []*types.Block {
+	var blocks []*types.Block
+	for i := from; i <= to; i++ {
+		block := &types.Block{
+			Index:     i,
+			Timestamp: time.Now().Unix(),
+			Transactions: []types.Transaction{{
+				Version: 1,
+				Inputs:  []types.Input{*types.NewCoinbaseInput([]byte(fmt.Sprintf("height %04d", i)))},
+				Outputs: []types.Output{{Amount: 50.0, ScriptPubKey: []byte("miner"), ScriptType: "P2PKH", Address: []byte("miner")}},
+			}},
+			PrevHash: []byte(fmt.Sprintf("block%d", i-1)),
+			Hash:     []byte(fmt.Sprintf("block%d", i)),
+		}
+		if err := db.AddBlock(block); err != nil {
+			t.Fatalf("AddBlock failed: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// TestPruneByDepth tests pruning bodies older than a number of blocks
+func TestPruneByDepth(t *testing.T) {
+	dbPath := "test_prune.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+
+	best := MinBlocksToKeep + 6
+	blocks := addPruneTestBlocks(t, db, 0, best)
+
+	if db.Services() != ServiceNodeNetwork || !db.CanServeBlock(0) {
+		t.Errorf("Expected an unpruned node to serve the full chain")
+	}
+
+	if err := db.EnablePruning(PruneConfig{KeepBlocks: MinBlocksToKeep - 1}); err == nil {
+		t.Errorf("Expected fewer than %d blocks to be refused", MinBlocksToKeep)
+	}
+	if err := db.EnablePruning(PruneConfig{KeepBlocks: MinBlocksToKeep}); err != nil {
+		t.Fatalf("EnablePruning failed: %v", err)
+	}
+	if db.PruneHeight() != 6 {
+		t.Fatalf("Expected prune height 6, got %d", db.PruneHeight())
+	}
+
+	if db.Services() != ServiceNodeNetworkLimited {
+		t.Errorf("Expected a pruned node to advertise only recent blocks, got services %d", db.Services())
+	}
+	if db.CanServeBlock(6) || !db.CanServeBlock(7) {
+		t.Errorf("Expected to serve blocks above the prune height only")
+	}
+
+	if _, err := db.GetBlockByHeight(6); err != ErrBlockPruned {
+		t.Errorf("Expected pruned block, got %v", err)
+	}
+	if block, err := db.GetBlockByHeight(7); err != nil || len(block.Transactions) != 1 {
+		t.Errorf("Expected block 7 to be kept in full, got %v", err)
+	}
+	if header, err := db.GetBlockHeader(2); err != nil || string(header.Hash) != "block2" {
+		t.Errorf("Expected header of block 2 to be kept, got %v", err)
+	}
+
+	var txCount int
+	db.db.QueryRow("SELECT COUNT(*) FROM transactions WHERE block_index <= 6").Scan(&txCount)
+	if txCount != 0 {
+		t.Errorf("Expected pruned transactions to be deleted, found %d", txCount)
+	}
+
+	// Outputs of pruned blocks stay spendable
+	if _, err := db.GetUTXO(blocks[2].Transactions[0].Hash(), 0); err != nil {
+		t.Errorf("GetUTXO failed for output of a pruned block: %v", err)
+	}
+
+	// New blocks keep the window moving, also after reopening
+	db.Close()
+	db, err = InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if db.PruneConfig() == nil || db.PruneConfig().KeepBlocks != MinBlocksToKeep {
+		t.Fatalf("Expected prune settings to persist, got %+v", db.PruneConfig())
+	}
+
+	addPruneTestBlocks(t, db, best+1, best+2)
+	if db.PruneHeight() != 8 {
+		t.Errorf("Expected prune height 8, got %d", db.PruneHeight())
+	}
+
+	if err := db.EnableTxIndex(); err == nil {
+		t.Errorf("Expected the transaction index to be refused on a pruned chain")
+	}
+}
+
+// TestPruneBySize tests pruning bodies down to a size target
+func TestPruneBySize(t *testing.T) {
+	dbPath := "test_prune.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	addPruneTestBlocks(t, db, 0, MinBlocksToKeep+9)
+
+	block, err := db.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatalf("GetBlockByHeight failed: %v", err)
+	}
+	var bodySize uint64
+	db.db.QueryRow("SELECT LENGTH(transactions) FROM blocks WHERE id = ?", block.Index).Scan(&bodySize)
+
+	// Room for four bodies more than the blocks always kept
+	if err := db.EnablePruning(PruneConfig{KeepBlocks: MinBlocksToKeep, TargetSize: (MinBlocksToKeep + 4) * bodySize}); err != nil {
+		t.Fatalf("EnablePruning failed: %v", err)
+	}
+	if db.PruneHeight() != 5 {
+		t.Errorf("Expected prune height 5, got %d", db.PruneHeight())
+	}
+}
@@ -0,0 +1,30 @@
+package db
+
+import "fmt"
+
+// Reindex rebuilds all state derived from the stored blocks: the cumulative
+// chain work, the UTXO set and whichever indexes are enabled. It is the
+// recovery path when any of them has been corrupted.
+func (bdb *BlockchainDB) Reindex() error {
+	if bdb.pruneHeight >= 0 {
+		return fmt.Errorf("cannot reindex a pruned chain, import the blocks again instead")
+	}
+
+	if err := bdb.BuildChainWork(); err != nil {
+		return err
+	}
+	if err := bdb.BuildUTXOSet(); err != nil {
+		return err
+	}
+	if bdb.txIndex {
+		if err := bdb.BuildTxIndex(); err != nil {
+			return err
+		}
+	}
+	if bdb.addrIndex {
+		if err := bdb.BuildAddressIndex(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"blockchain/consensus"
+	"blockchain/types"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestReindex tests that Reindex restores corrupted derived state
+func TestReindex(t *testing.T) {
+	dbPath := "test_reindex.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.EnableTxIndex(); err != nil {
+		t.Fatalf("EnableTxIndex failed: %v", err)
+	}
+
+	bits := consensus.CalculateDifficultyBits(8)
+	var coinbase types.Transaction
+	prevHash := []byte("genesis")
+	for i := 0; i < 3; i++ {
+		coinbase = types.Transaction{
+			Version: 1,
+			Inputs:  []types.Input{*types.NewCoinbaseInput([]byte{byte(i)})},
+			Outputs: []types.Output{{Amount: 50.0, ScriptPubKey: []byte("miner"), ScriptType: "P2PKH", Address: []byte("miner")}},
+		}
+		block := &types.Block{Index: i, Timestamp: time.Now().Unix(), Transactions: []types.Transaction{coinbase}, PrevHash: prevHash, Hash: []byte{byte('a' + i)}, Difficulty: bits}
+		if err := db.AddBlock(block); err != nil {
+			t.Fatalf("AddBlock failed: %v", err)
+		}
+		prevHash = block.Hash
+	}
+
+	want := new(big.Int).Mul(consensus.CalculateWork(bits), big.NewInt(3))
+	work, err := db.GetChainWork(2)
+	if err != nil {
+		t.Fatalf("GetChainWork failed: %v", err)
+	}
+	if work.Cmp(want) != 0 {
+		t.Errorf("Expected chain work %s, got %s", want, work)
+	}
+
+	_, err = db.db.Exec(`
+		DELETE FROM utxos;
+		DELETE FROM tx_index;
+		UPDATE blocks SET chain_work = x'00';
+	`)
+	if err != nil {
+		t.Fatalf("Failed to corrupt database: %v", err)
+	}
+
+	if err := db.Reindex(); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	if _, err := db.GetUTXO(coinbase.Hash(), 0); err != nil {
+		t.Errorf("UTXO not restored: %v", err)
+	}
+	if _, _, err := db.GetTransactionByHash(coinbase.Hash()); err != nil {
+		t.Errorf("Transaction index not restored: %v", err)
+	}
+	if work, err := db.GetChainWork(2); err != nil || work.Cmp(want) != 0 {
+		t.Errorf("Chain work not restored: %v, %v", work, err)
+	}
+}
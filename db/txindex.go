@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"blockchain/types"
+)
+
+// TxLocation records where a transaction is stored in the chain
+type TxLocation struct {
+	BlockHash  []byte `json:"blockHash"`
+	BlockIndex int    `json:"blockIndex"`
+	Position   int    `json:"position"`
+}
+
+// TxIndexEnabled reports whether the transaction index is maintained
+func (bdb *BlockchainDB) TxIndexEnabled() bool {
+	return bdb.txIndex
+}
+
+// EnableTxIndex turns on the transaction index. The index is built over
+// the blocks already stored, then kept up to date by AddBlock.
+func (bdb *BlockchainDB) EnableTxIndex() error {
+	if bdb.txIndex {
+		return nil
+	}
+	if bdb.prune != nil {
+		return fmt.Errorf("the index cannot be built on a pruned chain")
+	}
+
+	if err := bdb.BuildTxIndex(); err != nil {
+		return err
+	}
+	if err := bdb.setMeta(metaTxIndex, "1"); err != nil {
+		return err
+	}
+
+	bdb.txIndex = true
+	return nil
+}
+
+// BuildTxIndex rebuilds the transaction index from scratch over every
+// stored block
+func (bdb *BlockchainDB) BuildTxIndex() error {
+	blocks, err := bdb.loadBlocks()
+	if err != nil {
+		return err
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM tx_index`); err != nil {
+		return fmt.Errorf("failed to clear tx_index: %v", err)
+	}
+
+	for _, block := range blocks {
+		if err := indexTransactions(tx, block); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetTransactionByHash looks up a confirmed transaction by its hash using
+// the transaction index
+func (bdb *BlockchainDB) GetTransactionByHash(hash []byte) (*types.Transaction, *TxLocation, error) {
+	if !bdb.txIndex {
+		return nil, nil, fmt.Errorf("transaction index is not enabled")
+	}
+
+	var loc TxLocation
+	err := bdb.db.QueryRow(`
+		SELECT block_hash, block_index, position FROM tx_index WHERE tx_hash = ?
+	`, hash).Scan(&loc.BlockHash, &loc.BlockIndex, &loc.Position)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("transaction %x not found", hash)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query tx_index: %v", err)
+	}
+
+	block, err := bdb.GetBlockByHeight(loc.BlockIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if loc.Position >= len(block.Transactions) {
+		return nil, nil, fmt.Errorf("transaction %x missing from block %d", hash, loc.BlockIndex)
+	}
+
+	txn := block.Transactions[loc.Position]
+	return &txn, &loc, nil
+}
+
+// indexTransactions adds every transaction of block to the index
+func indexTransactions(tx *sql.Tx, block *types.Block) error {
+	for i := range block.Transactions {
+		_, err := tx.Exec(`
+			INSERT OR REPLACE INTO tx_index (tx_hash, block_hash, block_index, position)
+			VALUES (?, ?, ?, ?)
+		`, block.Transactions[i].Hash(), block.Hash, block.Index, i)
+		if err != nil {
+			return fmt.Errorf("failed to index transaction: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"blockchain/types"
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func txIndexTestBlock(index int, prevHash, hash []byte, amounts ...float64) *types.Block {
+	var txs []types.Transaction
+	for _, amount := range amounts {
+		txs = append(txs, types.Transaction{
+			Version: 1,
+			Inputs: []types.Input{
+				{PreviousTxHash: []byte("prevhash"), OutputIndex: 0, ScriptSig: []byte("scriptsig"), Sequence: 0xFFFFFFFF},
+			},
+			Outputs: []types.Output{
+				{Amount: amount, ScriptPubKey: []byte("scriptpubkey"), ScriptType: "P2PKH", Address: []byte("address")},
+			},
+		})
+	}
+	return &types.Block{
+		Index:        index,
+		Timestamp:    time.Now().Unix(),
+		Transactions: txs,
+		PrevHash:     prevHash,
+		Hash:         hash,
+		Miner:        "miner",
+	}
+}
+
+// TestTxIndex tests lookups through an index enabled before blocks are added
+func TestTxIndex(t *testing.T) {
+	dbPath := "test_txindex.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if _, _, err := db.GetTransactionByHash([]byte("missing")); err == nil {
+		t.Errorf("Expected an error while the index is disabled")
+	}
+
+	if err := db.EnableTxIndex(); err != nil {
+		t.Fatalf("EnableTxIndex failed: %v", err)
+	}
+
+	block := txIndexTestBlock(1, []byte("prevhash"), []byte("blockhash"), 10.0, 20.0)
+	if err := db.AddBlock(block); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+
+	want := block.Transactions[1]
+	got, loc, err := db.GetTransactionByHash(want.Hash())
+	if err != nil {
+		t.Fatalf("GetTransactionByHash failed: %v", err)
+	}
+	if !bytes.Equal(got.Hash(), want.Hash()) || got.Outputs[0].Amount != 20.0 {
+		t.Errorf("Retrieved transaction does not match the original")
+	}
+	if !bytes.Equal(loc.BlockHash, block.Hash) || loc.BlockIndex != 1 || loc.Position != 1 {
+		t.Errorf("Unexpected location: %+v", loc)
+	}
+
+	if _, _, err := db.GetTransactionByHash([]byte("missing")); err == nil {
+		t.Errorf("Expected an error for an unknown transaction")
+	}
+}
+
+// TestBuildTxIndex tests building the index over blocks that already exist
+func TestBuildTxIndex(t *testing.T) {
+	dbPath := "test_txindex.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+
+	block1 := txIndexTestBlock(1, []byte("genesis"), []byte("block1"), 1.0)
+	block2 := txIndexTestBlock(2, block1.Hash, []byte("block2"), 2.0, 3.0)
+	for _, block := range []*types.Block{block1, block2} {
+		if err := db.AddBlock(block); err != nil {
+			t.Fatalf("AddBlock failed: %v", err)
+		}
+	}
+
+	if err := db.EnableTxIndex(); err != nil {
+		t.Fatalf("EnableTxIndex failed: %v", err)
+	}
+	db.Close()
+
+	// The setting survives reopening the database
+	db, err = InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if !db.TxIndexEnabled() {
+		t.Fatalf("Expected the transaction index to stay enabled")
+	}
+
+	_, loc, err := db.GetTransactionByHash(block2.Transactions[1].Hash())
+	if err != nil {
+		t.Fatalf("GetTransactionByHash failed: %v", err)
+	}
+	if loc.BlockIndex != 2 || loc.Position != 1 {
+		t.Errorf("Unexpected location: %+v", loc)
+	}
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"blockchain/types"
+)
+
+// ErrUTXONotFound is returned when an output is unknown or already spent
+var ErrUTXONotFound = errors.New("unspent output not found")
+
+// UTXOEntry is an unspent output in the persisted UTXO set
+type UTXOEntry struct {
+	TxHash      []byte
+	OutputIndex uint64
+	Output      types.Output
+	BlockIndex  int
+	IsCoinbase  bool
+}
+
+// GetUTXO returns the unspent output created by txHash at index
+func (bdb *BlockchainDB) GetUTXO(txHash []byte, index uint64) (*types.Output, error) {
+	var output types.Output
+	err := bdb.db.QueryRow(`
+		SELECT amount, script_pubkey, script_type, address
+		FROM utxos WHERE tx_hash = ? AND output_index = ?
+	`, txHash, index).Scan(&output.Amount, &output.ScriptPubKey, &output.ScriptType, &output.Address)
+	if err == sql.ErrNoRows {
+		return nil, ErrUTXONotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utxo: %v", err)
+	}
+	return &output, nil
+}
+
+// GetUTXOOrigin returns the height of the block that created the unspent
+// output of txHash at index, and whether it is a coinbase output
+func (bdb *BlockchainDB) GetUTXOOrigin(txHash []byte, index uint64) (int, bool, error) {
+	var height int
+	var coinbase bool
+	err := bdb.db.QueryRow(`
+		SELECT block_index, coinbase FROM utxos WHERE tx_hash = ? AND output_index = ?
+	`, txHash, index).Scan(&height, &coinbase)
+	if err == sql.ErrNoRows {
+		return 0, false, ErrUTXONotFound
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to query utxo: %v", err)
+	}
+	return height, coinbase, nil
+}
+
+// GetUTXOsByAddress returns every unspent output paying address
+func (bdb *BlockchainDB) GetUTXOsByAddress(address []byte) ([]UTXOEntry, error) {
+	rows, err := bdb.db.Query(`
+		SELECT tx_hash, output_index, amount, script_pubkey, script_type,
+		       address, block_index, coinbase
+		FROM utxos WHERE address = ?
+		ORDER BY block_index, tx_hash, output_index
+	`, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query utxos: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []UTXOEntry
+	for rows.Next() {
+		var entry UTXOEntry
+		err := rows.Scan(
+			&entry.TxHash, &entry.OutputIndex, &entry.Output.Amount, &entry.Output.ScriptPubKey,
+			&entry.Output.ScriptType, &entry.Output.Address, &entry.BlockIndex, &entry.IsCoinbase,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan utxo: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read utxos: %v", err)
+	}
+	return entries, nil
+}
+
+// UTXOHeight returns the height of the last block applied to the persisted
+// UTXO set, or -1 if the set has not been built
+func (bdb *BlockchainDB) UTXOHeight() (int, error) {
+	value, err := bdb.getMeta(metaUTXOHeight)
+	if err != nil || value == "" {
+		return -1, err
+	}
+	height, err := strconv.Atoi(value)
+	if err != nil {
+		return -1, fmt.Errorf("invalid utxo height %q: %v", value, err)
+	}
+	return height, nil
+}
+
+// BuildUTXOSet rebuilds the UTXO set from scratch by replaying every
+// stored block in height order
+func (bdb *BlockchainDB) BuildUTXOSet() error {
+	if bdb.pruneHeight >= 0 {
+		return fmt.Errorf("cannot rebuild the UTXO set of a pruned chain")
+	}
+
+	blocks, err := bdb.loadBlocks()
+	if err != nil {
+		return err
+	}
+
+	tx, err := bdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM utxos; DELETE FROM utxo_undo`); err != nil {
+		return fmt.Errorf("failed to clear utxos: %v", err)
+	}
+
+	height := -1
+	for _, block := range blocks {
+		if err := applyUTXOs(tx, block); err != nil {
+			return err
+		}
+		height = block.Index
+	}
+
+	if err := writeMeta(tx, metaUTXOHeight, strconv.Itoa(height)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyUTXOs spends the outputs consumed by block and adds the ones it
+// creates. Spent outputs are moved to the undo data of the block.
+func applyUTXOs(tx *sql.Tx, block *types.Block) error {
+	for i := range block.Transactions {
+		txn := &block.Transactions[i]
+		coinbase := txn.IsCoinbase()
+
+		if !coinbase {
+			for _, input := range txn.Inputs {
+				_, err := tx.Exec(`
+					INSERT OR REPLACE INTO utxo_undo (
+						spent_index, tx_hash, output_index, amount, script_pubkey,
+						script_type, address, block_index, coinbase
+					)
+					SELECT ?, tx_hash, output_index, amount, script_pubkey,
+					       script_type, address, block_index, coinbase
+					FROM utxos WHERE tx_hash = ? AND output_index = ?
+				`, block.Index, input.PreviousTxHash, input.OutputIndex)
+				if err != nil {
+					return fmt.Errorf("failed to record undo data: %v", err)
+				}
+				_, err = tx.Exec(`
+					DELETE FROM utxos WHERE tx_hash = ? AND output_index = ?
+				`, input.PreviousTxHash, input.OutputIndex)
+				if err != nil {
+					return fmt.Errorf("failed to spend utxo: %v", err)
+				}
+			}
+		}
+
+		txHash := txn.Hash()
+		for index, output := range txn.Outputs {
+			_, err := tx.Exec(`
+				INSERT OR REPLACE INTO utxos (
+					tx_hash, output_index, amount, script_pubkey,
+					script_type, address, block_index, coinbase
+				)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, txHash, index, output.Amount, output.ScriptPubKey,
+				output.ScriptType, output.Address, block.Index, coinbase)
+			if err != nil {
+				return fmt.Errorf("failed to insert utxo: %v", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"blockchain/types"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestUTXOSet tests that AddBlock keeps the UTXO set up to date
+func TestUTXOSet(t *testing.T) {
+	dbPath := "test_utxo.db"
+	defer os.Remove(dbPath)
+
+	db, err := InitDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("InitDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	coinbase := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{*types.NewCoinbaseInput([]byte("height 1"))},
+		Outputs: []types.Output{{Amount: 50.0, ScriptPubKey: []byte("miner"), ScriptType: "P2PKH", Address: []byte("miner")}},
+	}
+	block1 := &types.Block{Index: 1, Timestamp: time.Now().Unix(), Transactions: []types.Transaction{coinbase}, PrevHash: []byte("genesis"), Hash: []byte("block1")}
+	if err := db.AddBlock(block1); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+
+	output, err := db.GetUTXO(coinbase.Hash(), 0)
+	if err != nil {
+		t.Fatalf("GetUTXO failed: %v", err)
+	}
+	if output.Amount != 50.0 {
+		t.Errorf("Expected amount 50, got %f", output.Amount)
+	}
+
+	entries, err := db.GetUTXOsByAddress([]byte("miner"))
+	if err != nil {
+		t.Fatalf("GetUTXOsByAddress failed: %v", err)
+	}
+	if len(entries) != 1 || !entries[0].IsCoinbase || entries[0].BlockIndex != 1 {
+		t.Errorf("Unexpected UTXO entries: %+v", entries)
+	}
+	if height, coinbase, err := db.GetUTXOOrigin(coinbase.Hash(), 0); err != nil || height != 1 || !coinbase {
+		t.Errorf("Expected a coinbase output from block 1, got %d, %v (%v)", height, coinbase, err)
+	}
+
+	spend := types.Transaction{
+		Version: 1,
+		Inputs:  []types.Input{{PreviousTxHash: coinbase.Hash(), OutputIndex: 0, ScriptSig: []byte("sig"), Sequence: 0xFFFFFFFF}},
+		Outputs: []types.Output{{Amount: 50.0, ScriptPubKey: []byte("bob"), ScriptType: "P2PKH", Address: []byte("bob")}},
+	}
+	block2 := &types.Block{Index: 2, Timestamp: time.Now().Unix(), Transactions: []types.Transaction{spend}, PrevHash: block1.Hash, Hash: []byte("block2")}
+	if err := db.AddBlock(block2); err != nil {
+		t.Fatalf("AddBlock failed: %v", err)
+	}
+
+	if _, err := db.GetUTXO(coinbase.Hash(), 0); err != ErrUTXONotFound {
+		t.Errorf("Expected spent output to be removed, got %v", err)
+	}
+	if _, err := db.GetUTXO(spend.Hash(), 0); err != nil {
+		t.Errorf("GetUTXO failed for new output: %v", err)
+	}
+
+	height, err := db.UTXOHeight()
+	if err != nil || height != 2 {
+		t.Errorf("Expected UTXO height 2, got %d (%v)", height, err)
+	}
+}
@@ -15,16 +15,33 @@ replace go-blockchain/cli => ./cli
 require go-blockchain/cli v0.0.0-00010101000000-000000000000
 
 require (
+	blockchain/chain v0.0.0-00010101000000-000000000000 // indirect
+	blockchain/consensus v0.0.0-00010101000000-000000000000 // indirect
+	blockchain/transaction v0.0.0-00010101000000-000000000000 // indirect
+	blockchain/types v0.0.0-00010101000000-000000000000 // indirect
+	blockchain/wallet v0.0.0-00010101000000-000000000000 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 	github.com/ethereum/go-ethereum v1.14.12 // indirect
 	github.com/holiman/uint256 v1.3.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.24 // indirect
 	github.com/spf13/cobra v1.9.1 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
 	github.com/tyler-smith/go-bip39 v1.1.0 // indirect
-	go-blockchain/wallet v0.0.0-00010101000000-000000000000 // indirect
+	go-blockchain/db v0.0.0-00010101000000-000000000000 // indirect
 	golang.org/x/crypto v0.22.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/term v0.22.0 // indirect
 )
 
-replace go-blockchain/wallet => ./wallet
+replace go-blockchain/db => ./db
+
+replace blockchain/chain => ./blockchain
+
+replace blockchain/consensus => ./consensus
+
+replace blockchain/transaction => ./blockchain/transaction
+
+replace blockchain/types => ./types
+
+replace blockchain/wallet => ./wallet
@@ -1,13 +1,30 @@
 package node
 
+import "go-blockchain/db"
+
 // MessageType represents the type of a network message.
 type MessageType string
 
 const (
 	MessageTypeTransaction MessageType = "TRANSACTION"
 	MessageTypeBlock       MessageType = "BLOCK"
+	MessageTypeVersion     MessageType = "VERSION"
 )
 
+// Service flags a node advertises to its peers, shared with the database
+// that knows what it has pruned.
+const (
+	// ServiceNodeNetwork means the node can serve the full chain.
+	ServiceNodeNetwork = db.ServiceNodeNetwork
+	// ServiceNodeNetworkLimited means the node only serves the most recent
+	// NetworkLimitedBlocks blocks because older ones have been pruned.
+	ServiceNodeNetworkLimited = db.ServiceNodeNetworkLimited
+)
+
+// NetworkLimitedBlocks is the number of recent blocks a pruned node
+// promises to serve.
+const NetworkLimitedBlocks = db.MinBlocksToKeep
+
 // Message represents a network message.
 type Message struct {
 	Type    MessageType
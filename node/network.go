@@ -17,6 +17,13 @@ func (n *Node) ReceiveMessage(peer string, message string) {
 	fmt.Printf("Received message from peer %s: %s\n", peer, message)
 }
 
+// AnnounceVersion tells all peers which services the node offers, so that
+// peers do not request pruned blocks from it.
+func (n *Node) AnnounceVersion() {
+	message := fmt.Sprintf("Version: services=%d pruneHeight=%d", n.Services, n.PruneHeight)
+	n.BroadcastMessage(message)
+}
+
 // BroadcastTransaction broadcasts a transaction to all peers.
 func (n *Node) BroadcastTransaction(tx transaction.Transaction) {
 	message := fmt.Sprintf("Transaction: %s", tx.TransactionID())
@@ -12,6 +12,9 @@ type Node struct {
 	Blockchain  *blockchain.Blockchain
 	TransactionPool []transaction.Transaction
 	Peers       []string
+	Services    uint64
+	// PruneHeight is the highest block whose body was pruned, -1 if none
+	PruneHeight int
 }
 
 // NewNode initializes a new blockchain node.
@@ -21,9 +24,25 @@ func NewNode(id string) *Node {
 		Blockchain:  &blockchain.Blockchain{},
 		TransactionPool: make([]transaction.Transaction, 0),
 		Peers:       make([]string, 0),
+		Services:    ServiceNodeNetwork,
+		PruneHeight: -1,
 	}
 }
 
+// SetPruned records that block bodies up to pruneHeight were deleted, so
+// the node stops advertising that it serves the full chain.
+func (n *Node) SetPruned(pruneHeight int) {
+	n.PruneHeight = pruneHeight
+	if pruneHeight >= 0 {
+		n.Services = (n.Services &^ ServiceNodeNetwork) | ServiceNodeNetworkLimited
+	}
+}
+
+// CanServeBlock reports whether the node still has the full block at height.
+func (n *Node) CanServeBlock(height int) bool {
+	return height > n.PruneHeight
+}
+
 // AddTransaction adds a transaction to the node's transaction pool if valid.
 func (n *Node) AddTransaction(tx transaction.Transaction) error {
 	// Validate the transaction
@@ -0,0 +1,296 @@
+package types
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+)
+
+// The canonical binary encoding writes fixed size fields little endian.
+// Byte strings and lists are prefixed with a uvarint of their length plus
+// one, with zero meaning nil, so that decoding gives back exactly the same
+// values and therefore the same hashes.
+
+// maxEncodedLength bounds any length prefix read while decoding
+const maxEncodedLength = 32 << 20
+
+// Serialize encodes the transaction in the canonical binary format.
+func (tx *Transaction) Serialize() []byte {
+    var buf bytes.Buffer
+    tx.encode(&buf)
+    return buf.Bytes()
+}
+
+// DeserializeTransaction decodes a transaction in the canonical binary format.
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+    r := bytes.NewReader(data)
+    tx, err := decodeTransaction(r)
+    if err != nil {
+        return nil, err
+    }
+    if r.Len() != 0 {
+        return nil, errors.New("trailing data after transaction")
+    }
+    return tx, nil
+}
+
+// Serialize encodes the output in the canonical binary format, as it
+// appears within a transaction.
+func (output *Output) Serialize() []byte {
+    var buf bytes.Buffer
+    output.encode(&buf)
+    return buf.Bytes()
+}
+
+// DeserializeOutput decodes an output in the canonical binary format.
+func DeserializeOutput(data []byte) (*Output, error) {
+    r := bytes.NewReader(data)
+    output, err := decodeOutput(r)
+    if err != nil {
+        return nil, err
+    }
+    if r.Len() != 0 {
+        return nil, errors.New("trailing data after output")
+    }
+    return output, nil
+}
+
+// Serialize encodes the block, including its transactions, in the
+// canonical binary format.
+func (b *Block) Serialize() []byte {
+    var buf bytes.Buffer
+
+    binary.Write(&buf, binary.LittleEndian, int64(b.Index))
+    binary.Write(&buf, binary.LittleEndian, b.Timestamp)
+    writeBytes(&buf, b.PrevHash)
+    writeBytes(&buf, b.Hash)
+    binary.Write(&buf, binary.LittleEndian, int64(b.Nonce))
+    writeBytes(&buf, []byte(b.Miner))
+    binary.Write(&buf, binary.LittleEndian, b.BlockSize)
+    binary.Write(&buf, binary.LittleEndian, b.Difficulty)
+    writeBytes(&buf, b.MerkleRoot)
+
+    writeLength(&buf, len(b.Transactions), b.Transactions == nil)
+    for i := range b.Transactions {
+        b.Transactions[i].encode(&buf)
+    }
+
+    return buf.Bytes()
+}
+
+// DeserializeBlock decodes a block in the canonical binary format.
+func DeserializeBlock(data []byte) (*Block, error) {
+    r := bytes.NewReader(data)
+
+    var block Block
+    var index, nonce int64
+    var miner []byte
+    var err error
+
+    if err = binary.Read(r, binary.LittleEndian, &index); err != nil {
+        return nil, fmt.Errorf("failed to read index: %w", err)
+    }
+    if err = binary.Read(r, binary.LittleEndian, &block.Timestamp); err != nil {
+        return nil, fmt.Errorf("failed to read timestamp: %w", err)
+    }
+    if block.PrevHash, err = readBytes(r); err != nil {
+        return nil, fmt.Errorf("failed to read previous hash: %w", err)
+    }
+    if block.Hash, err = readBytes(r); err != nil {
+        return nil, fmt.Errorf("failed to read hash: %w", err)
+    }
+    if err = binary.Read(r, binary.LittleEndian, &nonce); err != nil {
+        return nil, fmt.Errorf("failed to read nonce: %w", err)
+    }
+    if miner, err = readBytes(r); err != nil {
+        return nil, fmt.Errorf("failed to read miner: %w", err)
+    }
+    if err = binary.Read(r, binary.LittleEndian, &block.BlockSize); err != nil {
+        return nil, fmt.Errorf("failed to read block size: %w", err)
+    }
+    if err = binary.Read(r, binary.LittleEndian, &block.Difficulty); err != nil {
+        return nil, fmt.Errorf("failed to read difficulty: %w", err)
+    }
+    if block.MerkleRoot, err = readBytes(r); err != nil {
+        return nil, fmt.Errorf("failed to read merkle root: %w", err)
+    }
+
+    block.Index = int(index)
+    block.Nonce = int(nonce)
+    block.Miner = string(miner)
+
+    count, isNil, err := readLength(r)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read transaction count: %w", err)
+    }
+    if !isNil {
+        block.Transactions = make([]Transaction, 0, min(count, 1024))
+    }
+    for i := 0; i < count; i++ {
+        tx, err := decodeTransaction(r)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read transaction %d: %w", i, err)
+        }
+        block.Transactions = append(block.Transactions, *tx)
+    }
+
+    if r.Len() != 0 {
+        return nil, errors.New("trailing data after block")
+    }
+    return &block, nil
+}
+
+func (tx *Transaction) encode(w *bytes.Buffer) {
+    binary.Write(w, binary.LittleEndian, tx.ID)
+    binary.Write(w, binary.LittleEndian, tx.Version)
+    binary.Write(w, binary.LittleEndian, tx.Locktime)
+
+    writeLength(w, len(tx.Inputs), tx.Inputs == nil)
+    for _, input := range tx.Inputs {
+        binary.Write(w, binary.LittleEndian, input.ID)
+        writeBytes(w, input.PreviousTxHash)
+        binary.Write(w, binary.LittleEndian, input.OutputIndex)
+        writeBytes(w, input.ScriptSig)
+        binary.Write(w, binary.LittleEndian, input.Sequence)
+    }
+
+    writeLength(w, len(tx.Outputs), tx.Outputs == nil)
+    for i := range tx.Outputs {
+        tx.Outputs[i].encode(w)
+    }
+}
+
+func (output *Output) encode(w *bytes.Buffer) {
+    binary.Write(w, binary.LittleEndian, output.ID)
+    binary.Write(w, binary.LittleEndian, math.Float64bits(output.Amount))
+    writeBytes(w, output.ScriptPubKey)
+    writeBytes(w, []byte(output.ScriptType))
+    writeBytes(w, output.Address)
+}
+
+func decodeTransaction(r *bytes.Reader) (*Transaction, error) {
+    var tx Transaction
+
+    if err := binary.Read(r, binary.LittleEndian, &tx.ID); err != nil {
+        return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, &tx.Version); err != nil {
+        return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, &tx.Locktime); err != nil {
+        return nil, err
+    }
+
+    count, isNil, err := readLength(r)
+    if err != nil {
+        return nil, err
+    }
+    if !isNil {
+        tx.Inputs = make([]Input, 0, min(count, 1024))
+    }
+    for i := 0; i < count; i++ {
+        var input Input
+        if err := binary.Read(r, binary.LittleEndian, &input.ID); err != nil {
+            return nil, err
+        }
+        if input.PreviousTxHash, err = readBytes(r); err != nil {
+            return nil, err
+        }
+        if err := binary.Read(r, binary.LittleEndian, &input.OutputIndex); err != nil {
+            return nil, err
+        }
+        if input.ScriptSig, err = readBytes(r); err != nil {
+            return nil, err
+        }
+        if err := binary.Read(r, binary.LittleEndian, &input.Sequence); err != nil {
+            return nil, err
+        }
+        tx.Inputs = append(tx.Inputs, input)
+    }
+
+    count, isNil, err = readLength(r)
+    if err != nil {
+        return nil, err
+    }
+    if !isNil {
+        tx.Outputs = make([]Output, 0, min(count, 1024))
+    }
+    for i := 0; i < count; i++ {
+        output, err := decodeOutput(r)
+        if err != nil {
+            return nil, err
+        }
+        tx.Outputs = append(tx.Outputs, *output)
+    }
+
+    return &tx, nil
+}
+
+func decodeOutput(r *bytes.Reader) (*Output, error) {
+    var output Output
+    var amount uint64
+    var scriptType []byte
+    var err error
+    if err = binary.Read(r, binary.LittleEndian, &output.ID); err != nil {
+        return nil, err
+    }
+    if err = binary.Read(r, binary.LittleEndian, &amount); err != nil {
+        return nil, err
+    }
+    if output.ScriptPubKey, err = readBytes(r); err != nil {
+        return nil, err
+    }
+    if scriptType, err = readBytes(r); err != nil {
+        return nil, err
+    }
+    if output.Address, err = readBytes(r); err != nil {
+        return nil, err
+    }
+    output.Amount = math.Float64frombits(amount)
+    output.ScriptType = string(scriptType)
+    return &output, nil
+}
+
+func writeLength(w *bytes.Buffer, n int, isNil bool) {
+    var buf [binary.MaxVarintLen64]byte
+    if isNil {
+        w.WriteByte(0)
+        return
+    }
+    w.Write(buf[:binary.PutUvarint(buf[:], uint64(n)+1)])
+}
+
+func writeBytes(w *bytes.Buffer, data []byte) {
+    writeLength(w, len(data), data == nil)
+    w.Write(data)
+}
+
+func readLength(r io.ByteReader) (int, bool, error) {
+    n, err := binary.ReadUvarint(r)
+    if err != nil {
+        return 0, false, err
+    }
+    if n == 0 {
+        return 0, true, nil
+    }
+    if n-1 > maxEncodedLength {
+        return 0, false, fmt.Errorf("length %d exceeds limit", n-1)
+    }
+    return int(n - 1), false, nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+    n, isNil, err := readLength(r)
+    if err != nil || isNil {
+        return nil, err
+    }
+    if n > r.Len() {
+        return nil, io.ErrUnexpectedEOF
+    }
+    data := make([]byte, n)
+    _, err = io.ReadFull(r, data)
+    return data, err
+}
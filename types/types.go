@@ -11,6 +11,18 @@ import (
 //  "encoding/hex"
 )
 
+// CoinbaseOutputIndex is the output index referenced by the input of a
+// coinbase transaction, which spends no previous output.
+const CoinbaseOutputIndex = 0xFFFFFFFF
+
+// SequenceFinal is the sequence of an input that opts out of replacement.
+// Any input with a sequence of at most MaxRBFSequence signals that the
+// transaction may be replaced by one paying a higher fee.
+const (
+    SequenceFinal  = 0xFFFFFFFF
+    MaxRBFSequence = 0xFFFFFFFD
+)
+
 // Input references an output from a previous transaction.
 type Input struct {
     ID             int64   `json:"id"`
@@ -55,6 +67,7 @@ type Block struct {
     Miner        string              `json:"miner"`
     BlockSize    uint64              `json:"blocksize"`
     Difficulty   uint32              `json:"difficulty"`
+    MerkleRoot   []byte                  `json:"merkle_root"`
 }
 
 // Transaction represents a blockchain transaction.
@@ -90,6 +103,12 @@ func NewInput(previousTxHash []byte, outputIndex uint64, scriptSig []byte) *Inpu
     }
 }
 
+// NewCoinbaseInput creates the input of a coinbase transaction. scriptSig
+// carries arbitrary data such as the block height or an extra nonce.
+func NewCoinbaseInput(scriptSig []byte) *Input {
+    return NewInput(make([]byte, sha256.Size), CoinbaseOutputIndex, scriptSig)
+}
+
 func NewUTXO(block Block, transaction Transaction, outputIndex uint64, amount float64) *UTXO {
     return &UTXO{
         Block:        block,
@@ -135,6 +154,25 @@ func (tx *Transaction) Hash() []byte {
     return tx.hash
 }
 
+// IsCoinbase reports whether the transaction mints new coins, i.e. it has a
+// single input referencing the all-zero hash at CoinbaseOutputIndex
+func (tx *Transaction) IsCoinbase() bool {
+    if len(tx.Inputs) != 1 || tx.Inputs[0].OutputIndex != CoinbaseOutputIndex {
+        return false
+    }
+    return bytes.Equal(tx.Inputs[0].PreviousTxHash, make([]byte, sha256.Size))
+}
+
+// SignalsReplacement reports whether any input opts in to replace-by-fee
+func (tx *Transaction) SignalsReplacement() bool {
+    for _, input := range tx.Inputs {
+        if input.Sequence <= MaxRBFSequence {
+            return true
+        }
+    }
+    return false
+}
+
 // InvalidateHash clears the cached hash
 // Call this when modifying the transaction
 func (tx *Transaction) InvalidateHash() {
@@ -239,25 +277,30 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
     return &node
 }
 
-// NewMerkleTree creates a new Merkle tree from a list of transactions
+// NewMerkleTree creates a new Merkle tree from a list of transactions.
+// An empty list gives a root of all zeros.
 func NewMerkleTree(txHashes [][]byte) *MerkleNode {
     var nodes []MerkleNode
 
+    if len(txHashes) == 0 {
+        return &MerkleNode{Data: make([]byte, sha256.Size)}
+    }
+
     // Create leaf nodes
     for _, hash := range txHashes {
         node := NewMerkleNode(nil, nil, hash)
         nodes = append(nodes, *node)
     }
 
-    // If we have an odd number of transactions, duplicate the last one
-    if len(nodes) % 2 != 0 {
-        nodes = append(nodes, nodes[len(nodes)-1])
-    }
-
     // Build tree by pairing nodes
     for len(nodes) > 1 {
         var level []MerkleNode
 
+        // If a level has an odd number of nodes, duplicate the last one
+        if len(nodes) % 2 != 0 {
+            nodes = append(nodes, nodes[len(nodes)-1])
+        }
+
         // Process nodes two at a time to create parent nodes
         for i := 0; i < len(nodes); i += 2 {
             node := NewMerkleNode(&nodes[i], &nodes[i+1], nil)
@@ -270,6 +313,55 @@ func NewMerkleTree(txHashes [][]byte) *MerkleNode {
     return &nodes[0]
 }
 
+// MerkleBranch returns the hashes combined, level by level, with the first
+// leaf to reach the root of the tree of txHashes. The first hash itself is
+// not used, so the branch stays valid when the coinbase changes.
+func MerkleBranch(txHashes [][]byte) [][]byte {
+    var nodes [][]byte
+    for _, hash := range txHashes {
+        leaf := sha256.Sum256(hash)
+        nodes = append(nodes, leaf[:])
+    }
+
+    var branch [][]byte
+    for len(nodes) > 1 {
+        if len(nodes) % 2 != 0 {
+            nodes = append(nodes, nodes[len(nodes)-1])
+        }
+        branch = append(branch, nodes[1])
+
+        var level [][]byte
+        for i := 0; i < len(nodes); i += 2 {
+            hash := sha256.Sum256(append(append([]byte{}, nodes[i]...), nodes[i+1]...))
+            level = append(level, hash[:])
+        }
+        nodes = level
+    }
+    return branch
+}
+
+// MerkleRootFromBranch computes the Merkle root of a block whose first
+// transaction hashes to txHash, given the branch returned by MerkleBranch
+func MerkleRootFromBranch(txHash []byte, branch [][]byte) []byte {
+    hash := sha256.Sum256(txHash)
+    for _, sibling := range branch {
+        hash = sha256.Sum256(append(hash[:], sibling...))
+    }
+    return hash[:]
+}
+
+// ComputeMerkleRoot calculates the Merkle root of the block's transactions
+func (b *Block) ComputeMerkleRoot() []byte {
+    var txHashes [][]byte
+    for i := range b.Transactions {
+        txHashes = append(txHashes, b.Transactions[i].Hash())
+    }
+    return NewMerkleTree(txHashes).Data
+}
+
+// SerializeHeader encodes the header fields committed to by the proof of
+// work. The stored Merkle root is used when set, so that headers can be
+// checked without the transactions.
 func (b *Block) SerializeHeader() []byte {
     var buf bytes.Buffer
     encoder := gob.NewEncoder(&buf)
@@ -278,13 +370,10 @@ func (b *Block) SerializeHeader() []byte {
     encoder.Encode(b.Timestamp)
     encoder.Encode(b.Difficulty)
 
-    // Calculate Merkle root from transactions
-    var txHashes [][]byte
-    for _, tx := range b.Transactions {
-        txHashes = append(txHashes, tx.Hash())
+    merkleRoot := b.MerkleRoot
+    if merkleRoot == nil {
+        merkleRoot = b.ComputeMerkleRoot()
     }
-    
-    merkleRoot := NewMerkleTree(txHashes).Data
     encoder.Encode(merkleRoot)
 
     return buf.Bytes()
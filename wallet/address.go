@@ -2,49 +2,276 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-	"golang.org/x/crypto/ripemd160"
 	"crypto/sha256"
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"strings"
-	"github.com/ethereum/go-ethereum/crypto"
+
+	"golang.org/x/crypto/ripemd160"
 )
 
-// AddressFromPublicKey generates a Bitcoin-like wallet address from a public key.
-// Uses SHA256 followed by RIPEMD-160 hashing (Bitcoin style).
-func AddressFromPublicKey(publicKey *ecdsa.PublicKey, useChecksum bool) []byte {
-    publicKeyBytes := crypto.FromECDSAPub(publicKey)[1:] // Remove 0x04 prefix for uncompressed keys
-
-    sha256Hash := sha256.Sum256(publicKeyBytes)
-
-    secondHash := ripemd160.New()
-    secondHash.Write(sha256Hash[:])
-
-    ripemd160Hash := secondHash.Sum(nil)
-
-    address := ripemd160Hash
-    /*  if useChecksum {
-        return calculateChecksumAddress(address)
-    }*/
-    //return base58.Encode(address)
-    return address
-}
-
-func calculateChecksumAddress(address []byte) string {
-	hexAddress := hex.EncodeToString(address)
-	checksummed := ""
-	
-	for i, char := range hexAddress {
-		if char >= '0' && char <= '9' {
-			checksummed += string(char)
-		} else {
-			// Capitalize if corresponding bit in hash is 1
-			if hashBit := (address[i/2] >> (4 * (1 - uint(i)%2))) & 1; hashBit == 1 {
-				checksummed += strings.ToUpper(string(char))
-			} else {
-				checksummed += string(char)
-			}
+// Script opcodes used by standard output scripts
+const (
+	opZero        = 0x00
+	opOne         = 0x51
+	opDup         = 0x76
+	opEqual       = 0x87
+	opEqualVerify = 0x88
+	opHash160     = 0xa9
+	opCheckSig    = 0xac
+	opCheckMulti  = 0xae
+)
+
+// Script types recorded in types.Output.ScriptType
+const (
+	ScriptTypeP2PKH   = "P2PKH"
+	ScriptTypeP2SH    = "P2SH"
+	ScriptTypeP2WPKH  = "P2WPKH"
+	ScriptTypeP2WSH   = "P2WSH"
+	ScriptTypeP2TR    = "P2TR"
+	ScriptTypeWitness = "WITNESS"
+)
+
+// Hash160Size is the size of the key and script hashes P2PKH and P2SH
+// outputs pay to
+const Hash160Size = ripemd160.Size
+
+var (
+	// ErrWrongNetwork is returned for addresses of another network
+	ErrWrongNetwork = errors.New("address is for another network")
+	// ErrUnknownAddressType is returned for addresses and scripts of no
+	// known type
+	ErrUnknownAddressType = errors.New("unknown address type")
+)
+
+// Network holds the address and extended key prefixes of a chain.
+type Network struct {
+	Name             string
+	PubKeyHashAddrID byte
+	ScriptHashAddrID byte
+	Bech32HRP        string
+	HDPrivateKeyID   [4]byte
+	HDPublicKeyID    [4]byte
+}
+
+var (
+	MainNet = &Network{Name: "mainnet", PubKeyHashAddrID: 0x00, ScriptHashAddrID: 0x05, Bech32HRP: "bc", HDPrivateKeyID: XprvVersion, HDPublicKeyID: XpubVersion}
+	TestNet = &Network{Name: "testnet", PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0xc4, Bech32HRP: "tb", HDPrivateKeyID: TprvVersion, HDPublicKeyID: TpubVersion}
+	RegTest = &Network{Name: "regtest", PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0xc4, Bech32HRP: "bcrt", HDPrivateKeyID: TprvVersion, HDPublicKeyID: TpubVersion}
+
+	networks = []*Network{MainNet, TestNet, RegTest}
+)
+
+// NetworkByName returns the network called name.
+func NetworkByName(name string) (*Network, error) {
+	for _, net := range networks {
+		if net.Name == name {
+			return net, nil
 		}
 	}
-	
-	return checksummed
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+// Address is an encoded destination of coins.
+type Address interface {
+	// String returns the encoded address
+	String() string
+	// Payload returns the key or script hash the address pays to, as
+	// recorded in types.Output.Address
+	Payload() []byte
+	// ScriptPubKey returns the output script paying to the address
+	ScriptPubKey() []byte
+	// ScriptType returns the script type recorded in types.Output.ScriptType
+	ScriptType() string
+	// Network returns the network the address belongs to
+	Network() *Network
+}
+
+// PubKeyHashAddress is a Base58Check pay to public key hash address.
+type PubKeyHashAddress struct {
+	hash []byte
+	net  *Network
+}
+
+// NewPubKeyHashAddress returns the P2PKH address of a 20 byte key hash.
+func NewPubKeyHashAddress(hash []byte, net *Network) (*PubKeyHashAddress, error) {
+	if len(hash) != ripemd160.Size {
+		return nil, fmt.Errorf("key hash must be %d bytes, got %d", ripemd160.Size, len(hash))
+	}
+	return &PubKeyHashAddress{hash: append([]byte{}, hash...), net: net}, nil
+}
+
+func (a *PubKeyHashAddress) String() string {
+	return Base58CheckEncode(append([]byte{a.net.PubKeyHashAddrID}, a.hash...))
+}
+
+func (a *PubKeyHashAddress) Payload() []byte    { return append([]byte{}, a.hash...) }
+func (a *PubKeyHashAddress) ScriptType() string { return ScriptTypeP2PKH }
+func (a *PubKeyHashAddress) Network() *Network  { return a.net }
+
+// ScriptPubKey returns OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG.
+func (a *PubKeyHashAddress) ScriptPubKey() []byte {
+	script := []byte{opDup, opHash160, byte(len(a.hash))}
+	return append(append(script, a.hash...), opEqualVerify, opCheckSig)
+}
+
+// ScriptHashAddress is a Base58Check pay to script hash address.
+type ScriptHashAddress struct {
+	hash []byte
+	net  *Network
+}
+
+// NewScriptHashAddress returns the P2SH address of a 20 byte script hash.
+func NewScriptHashAddress(hash []byte, net *Network) (*ScriptHashAddress, error) {
+	if len(hash) != ripemd160.Size {
+		return nil, fmt.Errorf("script hash must be %d bytes, got %d", ripemd160.Size, len(hash))
+	}
+	return &ScriptHashAddress{hash: append([]byte{}, hash...), net: net}, nil
+}
+
+func (a *ScriptHashAddress) String() string {
+	return Base58CheckEncode(append([]byte{a.net.ScriptHashAddrID}, a.hash...))
+}
+
+func (a *ScriptHashAddress) Payload() []byte    { return append([]byte{}, a.hash...) }
+func (a *ScriptHashAddress) ScriptType() string { return ScriptTypeP2SH }
+func (a *ScriptHashAddress) Network() *Network  { return a.net }
+
+// ScriptPubKey returns OP_HASH160 <hash> OP_EQUAL.
+func (a *ScriptHashAddress) ScriptPubKey() []byte {
+	script := []byte{opHash160, byte(len(a.hash))}
+	return append(append(script, a.hash...), opEqual)
+}
+
+// WitnessAddress is a Bech32 or Bech32m witness program address.
+type WitnessAddress struct {
+	version byte
+	program []byte
+	net     *Network
+}
+
+// NewWitnessAddress returns the address of a witness program.
+func NewWitnessAddress(version byte, program []byte, net *Network) (*WitnessAddress, error) {
+	if err := checkWitnessProgram(version, program); err != nil {
+		return nil, err
+	}
+	return &WitnessAddress{version: version, program: append([]byte{}, program...), net: net}, nil
+}
+
+func (a *WitnessAddress) String() string {
+	// The program was checked on construction
+	s, _ := EncodeSegWitAddress(a.net.Bech32HRP, a.version, a.program)
+	return s
+}
+
+func (a *WitnessAddress) Payload() []byte   { return append([]byte{}, a.program...) }
+func (a *WitnessAddress) Network() *Network { return a.net }
+
+// Version returns the witness version.
+func (a *WitnessAddress) Version() byte { return a.version }
+
+func (a *WitnessAddress) ScriptType() string {
+	switch {
+	case a.version == 0 && len(a.program) == 20:
+		return ScriptTypeP2WPKH
+	case a.version == 0:
+		return ScriptTypeP2WSH
+	case a.version == 1 && len(a.program) == 32:
+		return ScriptTypeP2TR
+	}
+	return ScriptTypeWitness
+}
+
+// ScriptPubKey returns the witness version opcode followed by the program.
+func (a *WitnessAddress) ScriptPubKey() []byte {
+	versionOp := byte(opZero)
+	if a.version > 0 {
+		versionOp = opOne + a.version - 1
+	}
+	return append([]byte{versionOp, byte(len(a.program))}, a.program...)
+}
+
+// DecodeAddress decodes a Base58Check or Bech32 address of net, validating
+// its checksum and network.
+func DecodeAddress(s string, net *Network) (Address, error) {
+	if hrp, _, _, err := Bech32Decode(s); err == nil {
+		if hrp != net.Bech32HRP {
+			return nil, fmt.Errorf("%w: %s", ErrWrongNetwork, s)
+		}
+		version, program, err := DecodeSegWitAddress(net.Bech32HRP, s)
+		if err != nil {
+			return nil, err
+		}
+		return NewWitnessAddress(version, program, net)
+	} else if hasBech32Prefix(s) {
+		return nil, err
+	}
+
+	data, err := Base58CheckDecode(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	if len(data) != 1+ripemd160.Size {
+		return nil, fmt.Errorf("%w: %d byte payload", ErrUnknownAddressType, len(data)-1)
+	}
+	switch data[0] {
+	case net.PubKeyHashAddrID:
+		return NewPubKeyHashAddress(data[1:], net)
+	case net.ScriptHashAddrID:
+		return NewScriptHashAddress(data[1:], net)
+	}
+	for _, other := range networks {
+		if data[0] == other.PubKeyHashAddrID || data[0] == other.ScriptHashAddrID {
+			return nil, fmt.Errorf("%w: %s", ErrWrongNetwork, s)
+		}
+	}
+	return nil, fmt.Errorf("%w: version %#x", ErrUnknownAddressType, data[0])
+}
+
+// hasBech32Prefix reports whether s starts like a Bech32 address of a known
+// network, so that its decoding error is worth reporting as is.
+func hasBech32Prefix(s string) bool {
+	s = strings.ToLower(s)
+	for _, net := range networks {
+		if strings.HasPrefix(s, net.Bech32HRP+"1") {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractAddress returns the address a standard output script pays to.
+func ExtractAddress(script []byte, net *Network) (Address, error) {
+	switch {
+	case len(script) == 25 && script[0] == opDup && script[1] == opHash160 && script[2] == 20 &&
+		script[23] == opEqualVerify && script[24] == opCheckSig:
+		return NewPubKeyHashAddress(script[3:23], net)
+	case len(script) == 23 && script[0] == opHash160 && script[1] == 20 && script[22] == opEqual:
+		return NewScriptHashAddress(script[2:22], net)
+	case len(script) >= 4 && len(script) <= 42 && int(script[1]) == len(script)-2 &&
+		(script[0] == opZero || script[0] >= opOne && script[0] <= opOne+15):
+		version := byte(0)
+		if script[0] != opZero {
+			version = script[0] - opOne + 1
+		}
+		return NewWitnessAddress(version, script[2:], net)
+	}
+	return nil, ErrUnknownAddressType
+}
+
+// AddressFromPublicKey generates a Bitcoin-like wallet address from a public key.
+// Uses SHA256 followed by RIPEMD-160 hashing (Bitcoin style) of the compressed key.
+// The result is the raw key hash recorded in outputs; useChecksum is ignored,
+// the checksummed string forms come from NewPubKeyHashAddress and
+// NewWitnessAddress.
+func AddressFromPublicKey(publicKey *ecdsa.PublicKey, useChecksum bool) []byte {
+	return Hash160(SerializePublicKey(publicKey))
+}
+
+// Hash160 returns the RIPEMD-160 hash of the SHA256 hash of data.
+func Hash160(data []byte) []byte {
+	sha256Hash := sha256.Sum256(data)
+	hasher := ripemd160.New()
+	hasher.Write(sha256Hash[:])
+	return hasher.Sum(nil)
 }
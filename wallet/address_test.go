@@ -0,0 +1,159 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBech32Strings(t *testing.T) {
+	valid := []struct {
+		s        string
+		encoding Bech32Encoding
+	}{
+		{"A12UEL5L", Bech32},
+		{"a12uel5l", Bech32},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", Bech32},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", Bech32},
+		{"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", Bech32},
+		{"?1ezyfcl", Bech32},
+		{"A1LQFN3A", Bech32m},
+		{"a1lqfn3a", Bech32m},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", Bech32m},
+		{"?1v759aa", Bech32m},
+	}
+	for _, test := range valid {
+		hrp, data, encoding, err := Bech32Decode(test.s)
+		if err != nil || encoding != test.encoding {
+			t.Errorf("Bech32Decode(%s): expected encoding %d, got %d (%v)", test.s, test.encoding, encoding, err)
+			continue
+		}
+		encoded, err := Bech32Encode(hrp, data, encoding)
+		if err != nil || encoded != strings.ToLower(test.s) {
+			t.Errorf("Expected %s to round trip, got %s (%v)", test.s, encoded, err)
+		}
+	}
+
+	invalid := []string{
+		"pzry9x0s0muk",  // no separator
+		"1pzry9x0s0muk", // empty human readable part
+		"x1b4n0q5v",     // invalid data character
+		"li1dgmt3",      // checksum too short
+		"A1G7SGD8",      // checksum computed with an uppercase human readable part
+		"a12UEL5L",      // mixed case
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx", // bad checksum
+	}
+	for _, s := range invalid {
+		if _, _, _, err := Bech32Decode(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestSegWitAddresses(t *testing.T) {
+	tests := []struct {
+		address string
+		script  string
+		net     *Network
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "0014751e76e8199196d454941c45d1b3a323f1433bd6", MainNet},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", TestNet},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6", MainNet},
+		{"BC1SW50QGDZ25J", "6002751e", MainNet},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "5210751e76e8199196d454941c45d1b3a323", MainNet},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433", TestNet},
+	}
+	for _, test := range tests {
+		address, err := DecodeAddress(test.address, test.net)
+		if err != nil {
+			t.Errorf("DecodeAddress(%s) failed: %v", test.address, err)
+			continue
+		}
+		if got := hex.EncodeToString(address.ScriptPubKey()); got != test.script {
+			t.Errorf("%s: expected script %s, got %s", test.address, test.script, got)
+		}
+		if address.String() != strings.ToLower(test.address) {
+			t.Errorf("Expected %s to round trip, got %s", test.address, address.String())
+		}
+		script, _ := hex.DecodeString(test.script)
+		extracted, err := ExtractAddress(script, test.net)
+		if err != nil || extracted.String() != address.String() {
+			t.Errorf("ExtractAddress(%s): expected %s, got %v (%v)", test.script, address, extracted, err)
+		}
+	}
+
+	invalid := []string{
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", // version 1 with a Bech32 checksum
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",                     // version 0 with a Bech32m checksum
+		"bc1rw5uspcuh", // program too short
+		"bc1qr508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", // bad checksum
+	}
+	for _, s := range invalid {
+		if _, err := DecodeAddress(s, MainNet); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+	if _, err := DecodeAddress(tests[1].address, MainNet); !errors.Is(err, ErrWrongNetwork) {
+		t.Errorf("Expected a testnet address to be rejected on mainnet, got %v", err)
+	}
+}
+
+func TestBase58Addresses(t *testing.T) {
+	hash, _ := hex.DecodeString("010966776006953d5567439e5e39f86a0d273bee")
+	address, err := NewPubKeyHashAddress(hash, MainNet)
+	if err != nil {
+		t.Fatalf("NewPubKeyHashAddress failed: %v", err)
+	}
+	if address.String() != "16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM" {
+		t.Errorf("Unexpected address %s", address)
+	}
+	if hex.EncodeToString(address.ScriptPubKey()) != "76a914010966776006953d5567439e5e39f86a0d273bee88ac" {
+		t.Errorf("Unexpected script %x", address.ScriptPubKey())
+	}
+
+	decoded, err := DecodeAddress("16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM", MainNet)
+	if err != nil || hex.EncodeToString(decoded.Payload()) != hex.EncodeToString(hash) || decoded.ScriptType() != ScriptTypeP2PKH {
+		t.Errorf("Expected the address to decode to its key hash, got %v", err)
+	}
+	if _, err := DecodeAddress("16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvN", MainNet); err == nil {
+		t.Errorf("Expected a bad checksum to be rejected")
+	}
+	if _, err := DecodeAddress("16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM", TestNet); !errors.Is(err, ErrWrongNetwork) {
+		t.Errorf("Expected a mainnet address to be rejected on testnet, got %v", err)
+	}
+
+	scriptHash, _ := NewScriptHashAddress(hash, TestNet)
+	if !strings.HasPrefix(scriptHash.String(), "2") {
+		t.Errorf("Expected a testnet P2SH address to start with 2, got %s", scriptHash)
+	}
+	decoded, err = DecodeAddress(scriptHash.String(), TestNet)
+	if err != nil || decoded.ScriptType() != ScriptTypeP2SH {
+		t.Errorf("Expected the P2SH address to round trip, got %v", err)
+	}
+	extracted, err := ExtractAddress(scriptHash.ScriptPubKey(), TestNet)
+	if err != nil || extracted.String() != scriptHash.String() {
+		t.Errorf("Expected the P2SH script to give its address, got %v", err)
+	}
+
+	if _, err := NewPubKeyHashAddress(hash[:10], MainNet); err == nil {
+		t.Errorf("Expected a short key hash to be rejected")
+	}
+}
+
+func TestWalletAddressEncodings(t *testing.T) {
+	key, _ := GenerateKey()
+	hash := AddressFromPublicKey(&key.PublicKey, true)
+
+	p2pkh, _ := NewPubKeyHashAddress(hash, RegTest)
+	p2wpkh, _ := NewWitnessAddress(0, hash, RegTest)
+	if !strings.HasPrefix(p2wpkh.String(), "bcrt1q") || p2wpkh.ScriptType() != ScriptTypeP2WPKH {
+		t.Errorf("Unexpected witness address %s", p2wpkh)
+	}
+	for _, address := range []Address{p2pkh, p2wpkh} {
+		decoded, err := DecodeAddress(address.String(), RegTest)
+		if err != nil || hex.EncodeToString(decoded.Payload()) != hex.EncodeToString(hash) {
+			t.Errorf("Expected %s to decode to the key hash, got %v", address, err)
+		}
+	}
+}
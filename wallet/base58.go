@@ -0,0 +1,91 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	// ErrInvalidBase58 is returned for strings with characters outside the
+	// Base58 alphabet
+	ErrInvalidBase58 = errors.New("invalid base58 string")
+	// ErrChecksum is returned when the checksum of encoded data does not match
+	ErrChecksum = errors.New("checksum mismatch")
+)
+
+// Base58Encode encodes data with the Bitcoin Base58 alphabet, keeping
+// leading zero bytes as leading '1's.
+func Base58Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Base58Decode decodes a Base58 string.
+func Base58Decode(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		digit := bytes.IndexByte([]byte(base58Alphabet), s[i])
+		if digit < 0 {
+			return nil, ErrInvalidBase58
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// checksum returns the first four bytes of the double SHA256 of data.
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// Base58CheckEncode encodes data followed by its four byte checksum.
+func Base58CheckEncode(data []byte) string {
+	return Base58Encode(append(append([]byte{}, data...), checksum(data)...))
+}
+
+// Base58CheckDecode decodes a Base58Check string and verifies its checksum.
+func Base58CheckDecode(s string) ([]byte, error) {
+	decoded, err := Base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) < 4 {
+		return nil, ErrChecksum
+	}
+	data, sum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	if !bytes.Equal(checksum(data), sum) {
+		return nil, ErrChecksum
+	}
+	return data, nil
+}
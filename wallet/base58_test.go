@@ -0,0 +1,44 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		hex     string
+		encoded string
+	}{
+		{"", ""},
+		{"61", "2g"},
+		{"626262", "a3gV"},
+		{"636363", "aPEr"},
+		{"00000000000000000000", "1111111111"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+		{"516b6fcd0f", "ABnLTmg"},
+	}
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.hex)
+		if got := Base58Encode(data); got != test.encoded {
+			t.Errorf("Base58Encode(%s): expected %s, got %s", test.hex, test.encoded, got)
+		}
+		decoded, err := Base58Decode(test.encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("Base58Decode(%s): expected %s, got %x (%v)", test.encoded, test.hex, decoded, err)
+		}
+	}
+
+	if _, err := Base58Decode("0OIl"); err != ErrInvalidBase58 {
+		t.Errorf("Expected invalid characters to be rejected, got %v", err)
+	}
+
+	encoded := Base58CheckEncode([]byte("payload"))
+	if data, err := Base58CheckDecode(encoded); err != nil || string(data) != "payload" {
+		t.Errorf("Expected Base58Check to round trip, got %q (%v)", data, err)
+	}
+	if _, err := Base58CheckDecode(encoded[:len(encoded)-1] + "z"); err != ErrChecksum {
+		t.Errorf("Expected a bad checksum to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32mConst is the checksum constant of Bech32m, BIP350
+const bech32mConst = 0x2bc830a3
+
+// Bech32Encoding selects the checksum of a Bech32 string
+type Bech32Encoding int
+
+const (
+	// Bech32 is the BIP173 encoding, used for version 0 witness programs
+	Bech32 Bech32Encoding = iota + 1
+	// Bech32m is the BIP350 encoding, used for version 1 and later
+	Bech32m
+)
+
+// ErrInvalidBech32 is returned for malformed Bech32 strings
+var ErrInvalidBech32 = errors.New("invalid bech32 string")
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Const(encoding Bech32Encoding) uint32 {
+	if encoding == Bech32m {
+		return bech32mConst
+	}
+	return 1
+}
+
+// Bech32Encode encodes 5 bit values under a human readable part.
+func Bech32Encode(hrp string, data []byte, encoding Bech32Encoding) (string, error) {
+	if len(hrp) < 1 || len(hrp)+len(data)+7 > 90 {
+		return "", fmt.Errorf("%w: bad length", ErrInvalidBech32)
+	}
+	hrp = strings.ToLower(hrp)
+
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(values) ^ bech32Const(encoding)
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range data {
+		if v > 31 {
+			return "", fmt.Errorf("%w: value %d out of range", ErrInvalidBech32, v)
+		}
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return b.String(), nil
+}
+
+// Bech32Decode decodes a Bech32 or Bech32m string into its human readable
+// part and 5 bit values, reporting which checksum it carries.
+func Bech32Decode(s string) (string, []byte, Bech32Encoding, error) {
+	if len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("%w: too long", ErrInvalidBech32)
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, fmt.Errorf("%w: mixed case", ErrInvalidBech32)
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, 0, fmt.Errorf("%w: bad separator position", ErrInvalidBech32)
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, fmt.Errorf("%w: bad character in human readable part", ErrInvalidBech32)
+		}
+	}
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, 0, fmt.Errorf("%w: bad character %q", ErrInvalidBech32, s[i])
+		}
+		data = append(data, byte(v))
+	}
+
+	var encoding Bech32Encoding
+	switch bech32Polymod(append(bech32HRPExpand(hrp), data...)) {
+	case 1:
+		encoding = Bech32
+	case bech32mConst:
+		encoding = Bech32m
+	default:
+		return "", nil, 0, ErrChecksum
+	}
+	return hrp, data[:len(data)-6], encoding, nil
+}
+
+// convertBits regroups data of fromBits wide values into toBits wide
+// values, padding the last one when pad is set.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxValue := uint(1)<<toBits - 1
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("%w: value out of range", ErrInvalidBech32)
+		}
+		acc = acc<<fromBits | uint(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("%w: bad padding", ErrInvalidBech32)
+	}
+	return out, nil
+}
+
+// EncodeSegWitAddress encodes a witness program, with Bech32 for version 0
+// and Bech32m for later versions.
+func EncodeSegWitAddress(hrp string, version byte, program []byte) (string, error) {
+	if err := checkWitnessProgram(version, program); err != nil {
+		return "", err
+	}
+	encoding := Bech32
+	if version > 0 {
+		encoding = Bech32m
+	}
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return Bech32Encode(hrp, append([]byte{version}, data...), encoding)
+}
+
+// DecodeSegWitAddress decodes the witness program of an address with the
+// human readable part hrp.
+func DecodeSegWitAddress(hrp, address string) (byte, []byte, error) {
+	gotHRP, data, encoding, err := Bech32Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if gotHRP != hrp {
+		return 0, nil, fmt.Errorf("%w: human readable part %q, expected %q", ErrWrongNetwork, gotHRP, hrp)
+	}
+	if len(data) < 1 {
+		return 0, nil, fmt.Errorf("%w: no witness version", ErrInvalidBech32)
+	}
+
+	version := data[0]
+	if version == 0 && encoding != Bech32 || version > 0 && encoding != Bech32m {
+		return 0, nil, fmt.Errorf("%w: wrong checksum for witness version %d", ErrInvalidBech32, version)
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := checkWitnessProgram(version, program); err != nil {
+		return 0, nil, err
+	}
+	return version, program, nil
+}
+
+func checkWitnessProgram(version byte, program []byte) error {
+	if version > 16 {
+		return fmt.Errorf("%w: witness version %d", ErrInvalidBech32, version)
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return fmt.Errorf("%w: witness program of %d bytes", ErrInvalidBech32, len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return fmt.Errorf("%w: version 0 witness program of %d bytes", ErrInvalidBech32, len(program))
+	}
+	return nil
+}
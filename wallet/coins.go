@@ -0,0 +1,417 @@
+package wallet
+
+import (
+	"blockchain/consensus"
+	"blockchain/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// CoinbaseMaturity is the number of confirmations a coinbase output needs
+// before it is counted as spendable, as the consensus rules require.
+const CoinbaseMaturity = consensus.CoinbaseMaturity
+
+// MaxReorgDepth is the number of blocks a CoinTracker can disconnect. Deeper
+// reorgs need a rescan.
+const MaxReorgDepth = 100
+
+const coinTrackerVersion = 1
+
+var (
+	// ErrBlockNotConnecting is returned for blocks that do not extend the
+	// tracked tip
+	ErrBlockNotConnecting = errors.New("block does not extend the tracked chain")
+	// ErrReorgTooDeep is returned when the tracker cannot disconnect its tip
+	// because it no longer knows the block below
+	ErrReorgTooDeep = errors.New("reorg is deeper than the tracked blocks")
+)
+
+// Coin is an output paying one of the tracked addresses.
+type Coin struct {
+	TxHash []byte       `json:"txHash"`
+	Index  uint64       `json:"index"`
+	Output types.Output `json:"output"`
+	// Height is the height of the block confirming the coin, -1 while it is
+	// in the mempool
+	Height   int  `json:"height"`
+	Coinbase bool `json:"coinbase,omitempty"`
+	// Confirmations is filled in when the coin is returned by the tracker
+	Confirmations int `json:"-"`
+}
+
+// Balance is the value of the unspent coins of a set of addresses.
+type Balance struct {
+	// Confirmed holds the mature coins with at least the requested number
+	// of confirmations, Unconfirmed those with fewer
+	Confirmed   float64
+	Unconfirmed float64
+	// Immature holds the coinbase outputs not yet CoinbaseMaturity deep
+	Immature float64
+}
+
+// Total returns the value of all the coins of the balance.
+func (b Balance) Total() float64 {
+	return b.Confirmed + b.Unconfirmed + b.Immature
+}
+
+type coinKey struct {
+	hash  string
+	index uint64
+}
+
+// trackedCoin is a confirmed coin together with the height of the block
+// spending it, -1 while unspent. Spent coins are kept until the spend is
+// too deep to be disconnected.
+type trackedCoin struct {
+	Coin
+	SpentHeight int `json:"spentHeight"`
+}
+
+// blockRef is a block connected to the tracker
+type blockRef struct {
+	Height int    `json:"height"`
+	Hash   []byte `json:"hash"`
+}
+
+// CoinTracker follows the chain and the mempool for outputs paying a set of
+// addresses. Blocks are connected in order with ConnectBlock and removed
+// from the tip with DisconnectTip, while the mempool is replaced as a whole
+// with SetMempool.
+type CoinTracker struct {
+	mu        sync.Mutex
+	addresses map[string]bool
+
+	coins  map[coinKey]*trackedCoin
+	height int
+	// used holds the addresses any connected coin paid, which stay used
+	// once their spent coins are forgotten
+	used map[string]bool
+	// blocks holds the last MaxReorgDepth+1 connected blocks, the tip last
+	blocks []blockRef
+
+	// pending holds the coins created by mempool transactions, and
+	// pendingSpends the outputs mempool transactions spend
+	pending       map[coinKey]*Coin
+	pendingSpends map[coinKey]bool
+}
+
+// NewCoinTracker returns a tracker of addresses that has seen no block.
+func NewCoinTracker(addresses [][]byte) *CoinTracker {
+	ct := &CoinTracker{
+		addresses:     make(map[string]bool, len(addresses)),
+		coins:         make(map[coinKey]*trackedCoin),
+		height:        -1,
+		used:          make(map[string]bool),
+		pending:       make(map[coinKey]*Coin),
+		pendingSpends: make(map[coinKey]bool),
+	}
+	for _, address := range addresses {
+		ct.addresses[string(address)] = true
+	}
+	return ct
+}
+
+// Height returns the height of the last connected block, -1 if none.
+func (ct *CoinTracker) Height() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.height
+}
+
+// BlockHash returns the hash of the connected block at height, if it is
+// still known.
+func (ct *CoinTracker) BlockHash(height int) ([]byte, bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	for _, block := range ct.blocks {
+		if block.Height == height {
+			return block.Hash, true
+		}
+	}
+	return nil, false
+}
+
+// Seed replaces the tracked state with the unspent coins as of the block at
+// height, such as those read from a UTXO set, so that the tracker does not
+// need every block since genesis.
+func (ct *CoinTracker) Seed(height int, hash []byte, coins []Coin) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.coins = make(map[coinKey]*trackedCoin, len(coins))
+	for _, coin := range coins {
+		ct.coins[coinKey{string(coin.TxHash), coin.Index}] = &trackedCoin{Coin: coin, SpentHeight: -1}
+		ct.used[string(coin.Output.Address)] = true
+	}
+	ct.height = height
+	ct.blocks = []blockRef{{Height: height, Hash: hash}}
+}
+
+// ConnectBlock records the coins a block creates for the tracked addresses
+// and those it spends. The block must be the one following the tip.
+func (ct *CoinTracker) ConnectBlock(block *types.Block) error {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if block.Index != ct.height+1 {
+		return fmt.Errorf("%w: block %d on tip %d", ErrBlockNotConnecting, block.Index, ct.height)
+	}
+	if len(ct.blocks) > 0 && !bytes.Equal(block.PrevHash, ct.blocks[len(ct.blocks)-1].Hash) {
+		return fmt.Errorf("%w: block %d has another parent", ErrBlockNotConnecting, block.Index)
+	}
+
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		coinbase := tx.IsCoinbase()
+		if !coinbase {
+			for _, input := range tx.Inputs {
+				coin, ok := ct.coins[coinKey{string(input.PreviousTxHash), input.OutputIndex}]
+				if ok && coin.SpentHeight < 0 {
+					coin.SpentHeight = block.Index
+				}
+			}
+		}
+
+		hash := tx.Hash()
+		for j, output := range tx.Outputs {
+			if !ct.addresses[string(output.Address)] {
+				continue
+			}
+			ct.coins[coinKey{string(hash), uint64(j)}] = &trackedCoin{
+				Coin:        Coin{TxHash: hash, Index: uint64(j), Output: output, Height: block.Index, Coinbase: coinbase},
+				SpentHeight: -1,
+			}
+			ct.used[string(output.Address)] = true
+		}
+	}
+
+	ct.height = block.Index
+	ct.blocks = append(ct.blocks, blockRef{Height: block.Index, Hash: block.Hash})
+	ct.forget()
+	return nil
+}
+
+// forget drops the blocks and spent coins too deep to be disconnected
+func (ct *CoinTracker) forget() {
+	if len(ct.blocks) > MaxReorgDepth+1 {
+		ct.blocks = append([]blockRef(nil), ct.blocks[len(ct.blocks)-MaxReorgDepth-1:]...)
+	}
+	for key, coin := range ct.coins {
+		if coin.SpentHeight >= 0 && coin.SpentHeight <= ct.height-MaxReorgDepth {
+			delete(ct.coins, key)
+		}
+	}
+}
+
+// DisconnectTip undoes the last connected block: its coins are removed and
+// the coins it spent are unspent again.
+func (ct *CoinTracker) DisconnectTip() error {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if len(ct.blocks) < 2 {
+		return ErrReorgTooDeep
+	}
+
+	for key, coin := range ct.coins {
+		if coin.Height == ct.height {
+			delete(ct.coins, key)
+		} else if coin.SpentHeight == ct.height {
+			coin.SpentHeight = -1
+		}
+	}
+	ct.blocks = ct.blocks[:len(ct.blocks)-1]
+	ct.height = ct.blocks[len(ct.blocks)-1].Height
+	return nil
+}
+
+// SetMempool replaces the unconfirmed state with the given mempool
+// transactions: their outputs paying the tracked addresses become pending
+// coins, and the coins they spend are no longer counted.
+func (ct *CoinTracker) SetMempool(txs []types.Transaction) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.pending = make(map[coinKey]*Coin)
+	ct.pendingSpends = make(map[coinKey]bool)
+	for i := range txs {
+		tx := &txs[i]
+		for _, input := range tx.Inputs {
+			ct.pendingSpends[coinKey{string(input.PreviousTxHash), input.OutputIndex}] = true
+		}
+		hash := tx.Hash()
+		for j, output := range tx.Outputs {
+			if ct.addresses[string(output.Address)] {
+				ct.pending[coinKey{string(hash), uint64(j)}] = &Coin{TxHash: hash, Index: uint64(j), Output: output, Height: -1}
+			}
+		}
+	}
+}
+
+// Used reports whether a coin seen by the tracker, spent or not, pays
+// address. Coins spent before the tracker was seeded are not known.
+func (ct *CoinTracker) Used(address []byte) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.used[string(address)] {
+		return true
+	}
+	for _, coin := range ct.pending {
+		if bytes.Equal(coin.Output.Address, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// unspent returns the coins of addresses that neither a block nor the
+// mempool spends, with their confirmations filled in. A nil addresses
+// selects every tracked address.
+func (ct *CoinTracker) unspent(addresses [][]byte) []Coin {
+	var filter map[string]bool
+	if addresses != nil {
+		filter = make(map[string]bool, len(addresses))
+		for _, address := range addresses {
+			filter[string(address)] = true
+		}
+	}
+
+	var coins []Coin
+	add := func(key coinKey, coin Coin) {
+		if ct.pendingSpends[key] || filter != nil && !filter[string(coin.Output.Address)] {
+			return
+		}
+		if coin.Height >= 0 {
+			coin.Confirmations = ct.height - coin.Height + 1
+		}
+		coins = append(coins, coin)
+	}
+	for key, coin := range ct.coins {
+		if coin.SpentHeight < 0 {
+			add(key, coin.Coin)
+		}
+	}
+	for key, coin := range ct.pending {
+		add(key, *coin)
+	}
+	return coins
+}
+
+// Balance returns the balance of addresses, or of every tracked address if
+// addresses is nil. Mature coins with at least minconf confirmations are
+// confirmed.
+func (ct *CoinTracker) Balance(minconf int, addresses [][]byte) Balance {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	var balance Balance
+	for _, coin := range ct.unspent(addresses) {
+		switch {
+		case coin.Coinbase && coin.Confirmations < CoinbaseMaturity:
+			balance.Immature += coin.Output.Amount
+		case coin.Confirmations >= minconf:
+			balance.Confirmed += coin.Output.Amount
+		default:
+			balance.Unconfirmed += coin.Output.Amount
+		}
+	}
+	return balance
+}
+
+// Unspent returns the spendable coins of addresses, or of every tracked
+// address if addresses is nil, with at least minconf confirmations. Coins
+// are ordered by height, unconfirmed ones last.
+func (ct *CoinTracker) Unspent(minconf int, addresses [][]byte) []Coin {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	var coins []Coin
+	for _, coin := range ct.unspent(addresses) {
+		if coin.Confirmations < minconf || coin.Coinbase && coin.Confirmations < CoinbaseMaturity {
+			continue
+		}
+		coins = append(coins, coin)
+	}
+	sort.Slice(coins, func(i, j int) bool {
+		a, b := coins[i], coins[j]
+		if a.Confirmations != b.Confirmations {
+			return a.Confirmations > b.Confirmations
+		}
+		if c := bytes.Compare(a.TxHash, b.TxHash); c != 0 {
+			return c < 0
+		}
+		return a.Index < b.Index
+	})
+	return coins
+}
+
+// coinTrackerFile is the saved state of a CoinTracker. The mempool state is
+// not saved, it is set again from the mempool.
+type coinTrackerFile struct {
+	Version   int            `json:"version"`
+	Addresses [][]byte       `json:"addresses"`
+	Height    int            `json:"height"`
+	Blocks    []blockRef     `json:"blocks"`
+	Coins     []*trackedCoin `json:"coins"`
+	Used      [][]byte       `json:"used,omitempty"`
+}
+
+// Save writes the tracker state to path, readable only by its owner.
+func (ct *CoinTracker) Save(path string) error {
+	ct.mu.Lock()
+	state := coinTrackerFile{Version: coinTrackerVersion, Height: ct.height, Blocks: ct.blocks}
+	for address := range ct.addresses {
+		state.Addresses = append(state.Addresses, []byte(address))
+	}
+	for _, coin := range ct.coins {
+		state.Coins = append(state.Coins, coin)
+	}
+	for address := range ct.used {
+		state.Used = append(state.Used, []byte(address))
+	}
+	data, err := json.Marshal(state)
+	ct.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode coins: %w", err)
+	}
+	return WriteFileAtomic(path, data, 0600)
+}
+
+// LoadCoinTracker reads a tracker saved at path. Without a usable saved
+// state for exactly addresses, such as a missing file or one of another
+// set of wallets, a new tracker is returned that has to be synced from
+// scratch.
+func LoadCoinTracker(path string, addresses [][]byte) (*CoinTracker, error) {
+	ct := NewCoinTracker(addresses)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ct, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coins: %w", err)
+	}
+
+	var state coinTrackerFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode coins: %w", err)
+	}
+	if state.Version != coinTrackerVersion || len(state.Addresses) != len(ct.addresses) {
+		return ct, nil
+	}
+	for _, address := range state.Addresses {
+		if !ct.addresses[string(address)] {
+			return ct, nil
+		}
+	}
+
+	ct.height = state.Height
+	ct.blocks = state.Blocks
+	for _, coin := range state.Coins {
+		ct.coins[coinKey{string(coin.TxHash), coin.Index}] = coin
+		ct.used[string(coin.Output.Address)] = true
+	}
+	for _, address := range state.Used {
+		ct.used[string(address)] = true
+	}
+	return ct, nil
+}
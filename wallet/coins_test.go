@@ -0,0 +1,222 @@
+package wallet
+
+import (
+	"blockchain/types"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	trackedAddress = []byte("tracked-address-0001")
+	otherAddress   = []byte("other-address-000002")
+)
+
+// coinTestChain builds blocks for the coin tracker, each with a coinbase
+// paying to its own address
+type coinTestChain struct {
+	blocks []*types.Block
+}
+
+func (c *coinTestChain) block(payTo []byte, txs ...types.Transaction) *types.Block {
+	height := len(c.blocks)
+	coinbase := types.NewTransaction(
+		[]types.Input{*types.NewCoinbaseInput([]byte(fmt.Sprintf("height %d", height)))},
+		[]types.Output{{Amount: 50, Address: payTo}},
+	)
+	block := &types.Block{
+		Index:        height,
+		Transactions: append([]types.Transaction{*coinbase}, txs...),
+		Hash:         []byte(fmt.Sprintf("block %d %p", height, coinbase)),
+	}
+	if height > 0 {
+		block.PrevHash = c.blocks[height-1].Hash
+	}
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+func spend(hash []byte, index uint64, outputs ...types.Output) types.Transaction {
+	return *types.NewTransaction([]types.Input{*types.NewInput(hash, index, nil)}, outputs)
+}
+
+func connect(t *testing.T, ct *CoinTracker, block *types.Block) {
+	t.Helper()
+	if err := ct.ConnectBlock(block); err != nil {
+		t.Fatalf("ConnectBlock %d failed: %v", block.Index, err)
+	}
+}
+
+func TestCoinTrackerBalance(t *testing.T) {
+	ct := NewCoinTracker([][]byte{trackedAddress})
+	chain := &coinTestChain{}
+
+	payment := spend([]byte("funding"), 0, types.Output{Amount: 3, Address: trackedAddress}, types.Output{Amount: 7, Address: otherAddress})
+	connect(t, ct, chain.block(trackedAddress, payment))
+	for i := 0; i < CoinbaseMaturity-2; i++ {
+		connect(t, ct, chain.block(otherAddress))
+	}
+
+	balance := ct.Balance(1, nil)
+	if balance.Confirmed != 3 || balance.Immature != 50 || balance.Unconfirmed != 0 {
+		t.Fatalf("Unexpected balance %+v", balance)
+	}
+	if coins := ct.Unspent(1, nil); len(coins) != 1 || coins[0].Output.Amount != 3 || coins[0].Confirmations != CoinbaseMaturity-1 {
+		t.Fatalf("Expected only the payment to be spendable, got %+v", coins)
+	}
+
+	// One more block matures the coinbase
+	connect(t, ct, chain.block(otherAddress))
+	if balance := ct.Balance(1, nil); balance.Confirmed != 53 || balance.Immature != 0 {
+		t.Fatalf("Expected the coinbase to mature, got %+v", balance)
+	}
+	if balance := ct.Balance(1, [][]byte{otherAddress}); balance.Total() != 0 {
+		t.Errorf("Expected untracked addresses to have no balance, got %+v", balance)
+	}
+}
+
+func TestCoinTrackerMempool(t *testing.T) {
+	ct := NewCoinTracker([][]byte{trackedAddress})
+	chain := &coinTestChain{}
+
+	payment := spend([]byte("funding"), 0, types.Output{Amount: 10, Address: trackedAddress})
+	connect(t, ct, chain.block(otherAddress, payment))
+
+	// Spend the payment, with change back to the tracked address
+	pending := spend(payment.Hash(), 0, types.Output{Amount: 4, Address: otherAddress}, types.Output{Amount: 5.5, Address: trackedAddress})
+	ct.SetMempool([]types.Transaction{pending})
+
+	balance := ct.Balance(1, nil)
+	if balance.Confirmed != 0 || balance.Unconfirmed != 5.5 {
+		t.Fatalf("Expected the change to be unconfirmed, got %+v", balance)
+	}
+	if !ct.Used(trackedAddress) || ct.Used(otherAddress) {
+		t.Errorf("Expected only the tracked address to be used")
+	}
+	if coins := ct.Unspent(0, nil); len(coins) != 1 || coins[0].Height != -1 || coins[0].Confirmations != 0 {
+		t.Fatalf("Expected the unconfirmed change with minconf 0, got %+v", coins)
+	}
+	if coins := ct.Unspent(1, nil); len(coins) != 0 {
+		t.Errorf("Expected no coin with one confirmation, got %+v", coins)
+	}
+
+	// The block confirming it empties the mempool
+	connect(t, ct, chain.block(otherAddress, pending))
+	ct.SetMempool(nil)
+	if balance := ct.Balance(1, nil); balance.Confirmed != 5.5 || balance.Unconfirmed != 0 {
+		t.Fatalf("Expected the change to confirm, got %+v", balance)
+	}
+}
+
+func TestCoinTrackerReorg(t *testing.T) {
+	ct := NewCoinTracker([][]byte{trackedAddress})
+	chain := &coinTestChain{}
+
+	payment := spend([]byte("funding"), 0, types.Output{Amount: 10, Address: trackedAddress})
+	connect(t, ct, chain.block(otherAddress, payment))
+	spending := spend(payment.Hash(), 0, types.Output{Amount: 10, Address: otherAddress})
+	connect(t, ct, chain.block(otherAddress, spending))
+	received := spend([]byte("funding"), 1, types.Output{Amount: 2, Address: trackedAddress})
+	connect(t, ct, chain.block(otherAddress, received))
+
+	if balance := ct.Balance(1, nil); balance.Confirmed != 2 {
+		t.Fatalf("Unexpected balance %+v", balance)
+	}
+
+	// Disconnecting the last two blocks drops the coin received and unspends
+	// the payment
+	for i := 0; i < 2; i++ {
+		if err := ct.DisconnectTip(); err != nil {
+			t.Fatalf("DisconnectTip failed: %v", err)
+		}
+	}
+	if ct.Height() != 0 {
+		t.Fatalf("Expected height 0, got %d", ct.Height())
+	}
+	if balance := ct.Balance(1, nil); balance.Confirmed != 10 {
+		t.Fatalf("Expected the payment to be unspent again, got %+v", balance)
+	}
+	if err := ct.DisconnectTip(); !errors.Is(err, ErrReorgTooDeep) {
+		t.Errorf("Expected the first block not to be disconnected, got %v", err)
+	}
+
+	// A block of the old branch no longer connects
+	if err := ct.ConnectBlock(chain.blocks[2]); !errors.Is(err, ErrBlockNotConnecting) {
+		t.Errorf("Expected a block at the wrong height to be refused, got %v", err)
+	}
+	fork := &types.Block{Index: 1, PrevHash: []byte("elsewhere"), Hash: []byte("fork")}
+	if err := ct.ConnectBlock(fork); !errors.Is(err, ErrBlockNotConnecting) {
+		t.Errorf("Expected a block with another parent to be refused, got %v", err)
+	}
+	connect(t, ct, chain.blocks[1])
+}
+
+func TestCoinTrackerForgetsDeepSpends(t *testing.T) {
+	ct := NewCoinTracker([][]byte{trackedAddress})
+	chain := &coinTestChain{}
+
+	payment := spend([]byte("funding"), 0, types.Output{Amount: 10, Address: trackedAddress})
+	connect(t, ct, chain.block(otherAddress, payment))
+	connect(t, ct, chain.block(otherAddress, spend(payment.Hash(), 0, types.Output{Amount: 10, Address: otherAddress})))
+	for i := 0; i < MaxReorgDepth; i++ {
+		connect(t, ct, chain.block(otherAddress))
+	}
+
+	if len(ct.coins) != 0 {
+		t.Errorf("Expected the deeply spent coin to be forgotten, got %d coins", len(ct.coins))
+	}
+	if !ct.Used(trackedAddress) {
+		t.Errorf("Expected the address of a forgotten coin to stay used")
+	}
+	path := filepath.Join(t.TempDir(), "wallet.coins")
+	if err := ct.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if loaded, err := LoadCoinTracker(path, [][]byte{trackedAddress}); err != nil || !loaded.Used(trackedAddress) {
+		t.Errorf("Expected used addresses to be saved, got %v", err)
+	}
+	for i := 0; i < MaxReorgDepth; i++ {
+		if err := ct.DisconnectTip(); err != nil {
+			t.Fatalf("DisconnectTip %d failed: %v", i, err)
+		}
+	}
+	if err := ct.DisconnectTip(); !errors.Is(err, ErrReorgTooDeep) {
+		t.Errorf("Expected a reorg deeper than MaxReorgDepth to fail, got %v", err)
+	}
+}
+
+func TestCoinTrackerSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.coins")
+	addresses := [][]byte{trackedAddress}
+	chain := &coinTestChain{}
+
+	ct := NewCoinTracker(addresses)
+	ct.Seed(4, []byte("seed block"), []Coin{{TxHash: []byte("old"), Index: 1, Output: types.Output{Amount: 1, Address: trackedAddress}, Height: 2}})
+	chain.blocks = make([]*types.Block, 5)
+	chain.blocks[4] = &types.Block{Index: 4, Hash: []byte("seed block")}
+	connect(t, ct, chain.block(trackedAddress))
+	if err := ct.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadCoinTracker(path, addresses)
+	if err != nil {
+		t.Fatalf("LoadCoinTracker failed: %v", err)
+	}
+	if loaded.Height() != 5 || loaded.Balance(1, nil) != ct.Balance(1, nil) {
+		t.Fatalf("Loaded tracker differs: height %d, balance %+v", loaded.Height(), loaded.Balance(1, nil))
+	}
+	if hash, ok := loaded.BlockHash(4); !ok || string(hash) != "seed block" {
+		t.Errorf("Expected the seed block hash to be kept, got %q", hash)
+	}
+
+	// Another set of addresses needs a rescan
+	fresh, err := LoadCoinTracker(path, [][]byte{trackedAddress, otherAddress})
+	if err != nil {
+		t.Fatalf("LoadCoinTracker failed: %v", err)
+	}
+	if fresh.Height() != -1 {
+		t.Errorf("Expected a new tracker for other addresses, got height %d", fresh.Height())
+	}
+}
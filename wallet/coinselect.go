@@ -0,0 +1,267 @@
+package wallet
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// ErrInsufficientFunds is returned when the coins cannot pay the target
+// and its fee
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+const (
+	// coinUnit is the number of indivisible units in a coin. Selection
+	// works in units so that sums of amounts compare exactly.
+	coinUnit = 1e8
+	// bnbMaxTries bounds the branch and bound search
+	bnbMaxTries = 100000
+	// knapsackIterations is the number of random subsets tried
+	knapsackIterations = 1000
+)
+
+// CoinSelectionParams describe the transaction coins are selected for.
+// Sizes are in bytes and FeeRate is a fee per byte.
+type CoinSelectionParams struct {
+	// Target is the amount paid to the recipients
+	Target  float64
+	FeeRate float64
+	// BaseSize is the size of the transaction without inputs or change
+	BaseSize int
+	// InputSize is the size added by each signed input, and ChangeSize the
+	// size added by a change output
+	InputSize  int
+	ChangeSize int
+	// MinChange is the smallest change output created, less is left to the
+	// fee
+	MinChange float64
+}
+
+// CoinSelection is the result of SelectCoins.
+type CoinSelection struct {
+	Coins []Coin
+	Fee   float64
+	// Change is the amount of the change output, zero if none is needed
+	Change float64
+}
+
+func toUnits(amount float64) int64 {
+	return int64(math.Round(amount * coinUnit))
+}
+
+func fromUnits(units int64) float64 {
+	return float64(units) / coinUnit
+}
+
+// SelectCoins chooses the coins paying params.Target and the fee of the
+// transaction spending them. A branch and bound search first looks for a
+// set of coins matching the target closely enough that no change output is
+// worth creating. Failing that, a knapsack search picks the smallest set it
+// finds covering the target, the fee and a change output of at least
+// MinChange, or else the target and the fee alone, without change.
+func SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	feeOf := func(size int) int64 {
+		return int64(math.Ceil(params.FeeRate * float64(size) * coinUnit))
+	}
+	inputFee := feeOf(params.InputSize)
+	target := toUnits(params.Target)
+	if target <= 0 {
+		return nil, errors.New("target must be positive")
+	}
+
+	// Coins are compared by their effective value, what they add once the
+	// fee of spending them is paid. Coins worth less are left out.
+	var candidates []Coin
+	var values []int64
+	for _, coin := range coins {
+		if value := toUnits(coin.Output.Amount) - inputFee; value > 0 {
+			candidates = append(candidates, coin)
+			values = append(values, value)
+		}
+	}
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return values[order[i]] > values[order[j]] })
+	sorted := make([]int64, len(order))
+	for i, idx := range order {
+		sorted[i] = values[idx]
+	}
+
+	pick := func(selected []int) []Coin {
+		picked := make([]Coin, len(selected))
+		for i, s := range selected {
+			picked[i] = candidates[order[s]]
+		}
+		return picked
+	}
+	total := func(picked []Coin) int64 {
+		var sum int64
+		for _, coin := range picked {
+			sum += toUnits(coin.Output.Amount)
+		}
+		return sum
+	}
+
+	// Without change, anything above the target goes to the fee. A match is
+	// good enough when the excess costs less than creating and later
+	// spending a change output.
+	baseFee := feeOf(params.BaseSize)
+	costOfChange := feeOf(params.ChangeSize) + inputFee
+	if selected := branchAndBound(sorted, target+baseFee, costOfChange); selected != nil {
+		picked := pick(selected)
+		return &CoinSelection{Coins: picked, Fee: fromUnits(total(picked) - target)}, nil
+	}
+
+	changeFee := feeOf(params.ChangeSize)
+	minChange := toUnits(params.MinChange)
+	selected := knapsack(sorted, target+baseFee+changeFee+minChange)
+	if selected == nil {
+		// The coins may still pay the target without change, leaving more
+		// than the cost of change to the fee
+		if selected = knapsack(sorted, target+baseFee); selected == nil {
+			return nil, ErrInsufficientFunds
+		}
+		picked := pick(selected)
+		return &CoinSelection{Coins: picked, Fee: fromUnits(total(picked) - target)}, nil
+	}
+	picked := pick(selected)
+	fee := baseFee + changeFee + int64(len(picked))*inputFee
+	change := total(picked) - target - fee
+	if change < minChange {
+		return &CoinSelection{Coins: picked, Fee: fromUnits(total(picked) - target)}, nil
+	}
+	return &CoinSelection{Coins: picked, Fee: fromUnits(fee), Change: fromUnits(change)}, nil
+}
+
+// branchAndBound searches the values, sorted in decreasing order, for the
+// subset whose sum exceeds target by the least, at most by tolerance. It
+// returns the indexes of the subset, or nil if none was found within
+// bnbMaxTries steps.
+func branchAndBound(values []int64, target, tolerance int64) []int {
+	var remaining int64
+	for _, value := range values {
+		remaining += value
+	}
+
+	var best, selected []int
+	bestExcess := int64(-1)
+	tries := 0
+	// excluded is the value of the previous coin if it was left out.
+	// Including a coin of the same value instead would only explore the
+	// same sums again.
+	var search func(i int, sum, remaining, excluded int64)
+	search = func(i int, sum, remaining, excluded int64) {
+		tries++
+		if tries > bnbMaxTries || bestExcess == 0 {
+			return
+		}
+		if sum > target+tolerance || sum+remaining < target {
+			return
+		}
+		if sum >= target {
+			if excess := sum - target; bestExcess < 0 || excess < bestExcess {
+				best, bestExcess = append([]int(nil), selected...), excess
+			}
+			return
+		}
+		if i == len(values) {
+			return
+		}
+
+		value := values[i]
+		if value != excluded {
+			selected = append(selected, i)
+			search(i+1, sum+value, remaining-value, -1)
+			selected = selected[:len(selected)-1]
+		}
+		search(i+1, sum, remaining-value, value)
+	}
+	search(0, 0, remaining, -1)
+	return best
+}
+
+// knapsack picks a subset of the values, sorted in decreasing order, whose
+// sum is at least target: a single value equal to it, all the smaller
+// values if they sum to it, or else the smaller of the lowest larger value
+// and the best subset of smaller values found at random. It returns nil if
+// all values together fall short.
+func knapsack(values []int64, target int64) []int {
+	lowestLarger := -1
+	var smaller []int
+	var smallerSum int64
+	for i, value := range values {
+		switch {
+		case value == target:
+			return []int{i}
+		case value > target:
+			lowestLarger = i
+		default:
+			smaller = append(smaller, i)
+			smallerSum += value
+		}
+	}
+
+	if smallerSum == target {
+		return smaller
+	}
+	if smallerSum < target {
+		if lowestLarger < 0 {
+			return nil
+		}
+		return []int{lowestLarger}
+	}
+
+	best, bestSum := approximateBestSubset(values, smaller, target)
+	if lowestLarger >= 0 && bestSum != target && values[lowestLarger] <= bestSum {
+		return []int{lowestLarger}
+	}
+	return best
+}
+
+// approximateBestSubset tries random subsets of candidates, completing each
+// in order until it reaches target, and returns the one with the smallest
+// sum along with that sum
+func approximateBestSubset(values []int64, candidates []int, target int64) ([]int, int64) {
+	best := candidates
+	var bestSum int64
+	for _, c := range candidates {
+		bestSum += values[c]
+	}
+
+	included := make([]bool, len(candidates))
+	for rep := 0; rep < knapsackIterations && bestSum != target; rep++ {
+		clear(included)
+		var sum int64
+		reached := false
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for i, c := range candidates {
+				// The first pass includes each value at random, the second
+				// adds the values left out
+				if pass == 0 && rand.IntN(2) == 0 || pass == 1 && included[i] {
+					continue
+				}
+				sum += values[c]
+				included[i] = true
+				if sum < target {
+					continue
+				}
+				reached = true
+				if sum < bestSum {
+					bestSum = sum
+					best = best[:0:0]
+					for j, in := range included {
+						if in {
+							best = append(best, candidates[j])
+						}
+					}
+				}
+				sum -= values[c]
+				included[i] = false
+			}
+		}
+	}
+	return best, bestSum
+}
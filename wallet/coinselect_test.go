@@ -0,0 +1,151 @@
+package wallet
+
+import (
+	"blockchain/types"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func testCoins(amounts ...float64) []Coin {
+	coins := make([]Coin, len(amounts))
+	for i, amount := range amounts {
+		coins[i] = Coin{TxHash: []byte(fmt.Sprintf("tx %d", i)), Output: types.Output{Amount: amount}, Height: 1}
+	}
+	return coins
+}
+
+func selectionTotal(selection *CoinSelection) float64 {
+	var total float64
+	for _, coin := range selection.Coins {
+		total += coin.Output.Amount
+	}
+	return total
+}
+
+// checkSelection checks that the selection pays target, its fee and its
+// change exactly, with at least the fee rate asked for
+func checkSelection(t *testing.T, selection *CoinSelection, params CoinSelectionParams) {
+	t.Helper()
+	total := selectionTotal(selection)
+	if math.Abs(total-params.Target-selection.Fee-selection.Change) > 1e-9 {
+		t.Fatalf("Inputs %f do not add up to target %f, fee %f and change %f", total, params.Target, selection.Fee, selection.Change)
+	}
+	size := params.BaseSize + len(selection.Coins)*params.InputSize
+	if selection.Change > 0 {
+		size += params.ChangeSize
+	}
+	if selection.Fee < params.FeeRate*float64(size)-1e-9 {
+		t.Errorf("Fee %f is below the rate for %d bytes", selection.Fee, size)
+	}
+}
+
+var testSelectionParams = CoinSelectionParams{
+	FeeRate:    0.0001,
+	BaseSize:   50,
+	InputSize:  150,
+	ChangeSize: 40,
+	MinChange:  0.01,
+}
+
+func TestSelectCoinsExactMatch(t *testing.T) {
+	params := testSelectionParams
+	// 2 and 3 pay 5 plus the fee of two inputs, 0.005 + 2*0.015, within
+	// the cost of a change output
+	params.Target = 4.963
+	coins := testCoins(10, 3, 7, 2, 1)
+
+	selection, err := SelectCoins(coins, params)
+	if err != nil {
+		t.Fatalf("SelectCoins failed: %v", err)
+	}
+	if selection.Change != 0 || len(selection.Coins) != 2 || selectionTotal(selection) != 5 {
+		t.Fatalf("Expected 2 and 3 without change, got %+v", selection)
+	}
+	checkSelection(t, selection, params)
+}
+
+func TestSelectCoinsWithChange(t *testing.T) {
+	params := testSelectionParams
+	params.Target = 4.1
+	coins := testCoins(10, 3, 7, 2.5, 1.25)
+
+	for i := 0; i < 20; i++ {
+		selection, err := SelectCoins(coins, params)
+		if err != nil {
+			t.Fatalf("SelectCoins failed: %v", err)
+		}
+		if selection.Change < params.MinChange {
+			t.Fatalf("Expected a change output, got %+v", selection)
+		}
+		checkSelection(t, selection, params)
+	}
+}
+
+func TestSelectCoinsLargeWallet(t *testing.T) {
+	params := testSelectionParams
+	params.Target = 1234.5
+	amounts := make([]float64, 2000)
+	for i := range amounts {
+		amounts[i] = 50
+	}
+	amounts[7] = 39.99
+
+	selection, err := SelectCoins(testCoins(amounts...), params)
+	if err != nil {
+		t.Fatalf("SelectCoins failed: %v", err)
+	}
+	checkSelection(t, selection, params)
+	if len(selection.Coins) > 26 {
+		t.Errorf("Expected few coins to be selected, got %d", len(selection.Coins))
+	}
+}
+
+func TestSelectCoinsDustChange(t *testing.T) {
+	params := testSelectionParams
+	// A single coin covering the target with less than MinChange to spare
+	params.Target = 0.975
+	selection, err := SelectCoins(testCoins(1), params)
+	if err != nil {
+		t.Fatalf("SelectCoins failed: %v", err)
+	}
+	if selection.Change != 0 || math.Abs(selection.Fee-0.025) > 1e-9 {
+		t.Fatalf("Expected the excess to go to the fee, got %+v", selection)
+	}
+	checkSelection(t, selection, params)
+}
+
+func TestSelectCoinsNoRoomForChange(t *testing.T) {
+	params := CoinSelectionParams{
+		Target:     1.0,
+		FeeRate:    0.00000001,
+		BaseSize:   100,
+		InputSize:  150,
+		ChangeSize: 40,
+		MinChange:  0.01,
+	}
+	// The coin pays the target and its 250 byte fee, but leaves more than
+	// the cost of change over and too little for a change output
+	selection, err := SelectCoins(testCoins(1.000005), params)
+	if err != nil {
+		t.Fatalf("SelectCoins failed: %v", err)
+	}
+	if selection.Change != 0 || math.Abs(selection.Fee-0.000005) > 1e-12 {
+		t.Fatalf("Expected the excess to go to the fee, got %+v", selection)
+	}
+	checkSelection(t, selection, params)
+}
+
+func TestSelectCoinsInsufficientFunds(t *testing.T) {
+	params := testSelectionParams
+	params.Target = 6
+	// The last coin is worth less than the fee of spending it
+	if _, err := SelectCoins(testCoins(3, 3, 0.01), params); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+	}
+	params.Target = 0
+	if _, err := SelectCoins(testCoins(3), params); err == nil {
+		t.Errorf("Expected a zero target to be refused")
+	}
+}
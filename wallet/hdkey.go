@@ -0,0 +1,391 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	// HardenedKeyStart is the first hardened child index
+	HardenedKeyStart uint32 = 0x80000000
+
+	// BIP44Purpose is the purpose field of BIP44 paths
+	BIP44Purpose uint32 = 44
+	// CoinType is the BIP44 coin type of the chain, the one registered for
+	// all testnets
+	CoinType uint32 = 1
+
+	// ExternalChain is the BIP44 change value of receive addresses
+	ExternalChain uint32 = 0
+	// InternalChain is the BIP44 change value of change addresses
+	InternalChain uint32 = 1
+
+	minSeedLen        = 16
+	maxSeedLen        = 64
+	serializedKeyLen  = 78
+	compressedKeySize = 33
+)
+
+var (
+	// XprvVersion and XpubVersion are the serialization versions of
+	// mainnet extended keys
+	XprvVersion = [4]byte{0x04, 0x88, 0xad, 0xe4}
+	XpubVersion = [4]byte{0x04, 0x88, 0xb2, 0x1e}
+	// TprvVersion and TpubVersion are the serialization versions of
+	// testnet extended keys
+	TprvVersion = [4]byte{0x04, 0x35, 0x83, 0x94}
+	TpubVersion = [4]byte{0x04, 0x35, 0x87, 0xcf}
+
+	// publicVersions maps private key versions to their public version
+	publicVersions = map[[4]byte][4]byte{
+		XprvVersion: XpubVersion,
+		TprvVersion: TpubVersion,
+	}
+
+	masterKeySalt = []byte("Bitcoin seed")
+)
+
+var (
+	// ErrInvalidSeedLen is returned for seeds outside 16 to 64 bytes
+	ErrInvalidSeedLen = errors.New("seed must be 16 to 64 bytes")
+	// ErrUnusableSeed is returned for the astronomically rare seeds that do
+	// not give a valid master key
+	ErrUnusableSeed = errors.New("seed does not give a valid master key")
+	// ErrInvalidChild is returned for the astronomically rare child indexes
+	// that do not give a valid key; the next index should be used instead
+	ErrInvalidChild = errors.New("child index gives an invalid key")
+	// ErrDeriveHardenedFromPublic is returned when deriving a hardened child
+	// from a public extended key
+	ErrDeriveHardenedFromPublic = errors.New("cannot derive a hardened child from a public key")
+	// ErrNotPrivate is returned when a private key is asked of a public
+	// extended key
+	ErrNotPrivate = errors.New("extended key is not private")
+	// ErrInvalidExtendedKey is returned for malformed serialized keys
+	ErrInvalidExtendedKey = errors.New("invalid extended key")
+	// ErrInvalidPath is returned for malformed derivation paths
+	ErrInvalidPath = errors.New("invalid derivation path")
+)
+
+// ExtendedKey is a BIP32 extended private or public key.
+type ExtendedKey struct {
+	version           [4]byte
+	depth             uint8
+	parentFingerprint [4]byte
+	childNumber       uint32
+	chainCode         []byte
+	// key is a 32 byte private key or a 33 byte compressed public key
+	key       []byte
+	isPrivate bool
+}
+
+// NewMasterKey derives the master extended private key of a seed.
+func NewMasterKey(seed []byte, version [4]byte) (*ExtendedKey, error) {
+	if len(seed) < minSeedLen || len(seed) > maxSeedLen {
+		return nil, ErrInvalidSeedLen
+	}
+
+	mac := hmac.New(sha512.New, masterKeySalt)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	var k secp256k1.ModNScalar
+	if k.SetByteSlice(sum[:32]) || k.IsZero() {
+		return nil, ErrUnusableSeed
+	}
+
+	return &ExtendedKey{
+		version:   version,
+		chainCode: sum[32:],
+		key:       sum[:32],
+		isPrivate: true,
+	}, nil
+}
+
+// MasterKeyFromMnemonic derives the master extended private key of a BIP39
+// mnemonic, serialized with the extended key version of net. The version
+// does not change the keys derived from it or their fingerprints.
+func MasterKeyFromMnemonic(mnemonic, passphrase string, net *Network) (*ExtendedKey, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, fmt.Errorf("invalid mnemonic")
+	}
+	return NewMasterKey(bip39.NewSeed(mnemonic, passphrase), net.HDPrivateKeyID)
+}
+
+// IsPrivate reports whether the extended key holds a private key.
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.isPrivate
+}
+
+// Depth returns the number of derivations from the master key.
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// ChildNumber returns the index the key was derived with.
+func (k *ExtendedKey) ChildNumber() uint32 {
+	return k.childNumber
+}
+
+// ParentFingerprint returns the fingerprint of the parent key, zero for
+// master keys.
+func (k *ExtendedKey) ParentFingerprint() [4]byte {
+	return k.parentFingerprint
+}
+
+// ChainCode returns the chain code of the key.
+func (k *ExtendedKey) ChainCode() []byte {
+	return append([]byte{}, k.chainCode...)
+}
+
+// PublicKeyBytes returns the compressed public key.
+func (k *ExtendedKey) PublicKeyBytes() []byte {
+	if !k.isPrivate {
+		return append([]byte{}, k.key...)
+	}
+	return secp256k1.PrivKeyFromBytes(k.key).PubKey().SerializeCompressed()
+}
+
+// Fingerprint returns the first four bytes of the HASH160 of the public key.
+func (k *ExtendedKey) Fingerprint() [4]byte {
+	var fingerprint [4]byte
+	copy(fingerprint[:], Hash160(k.PublicKeyBytes()))
+	return fingerprint
+}
+
+// PrivateKey returns the secp256k1 private key of a private extended key.
+func (k *ExtendedKey) PrivateKey() (*ecdsa.PrivateKey, error) {
+	if !k.isPrivate {
+		return nil, ErrNotPrivate
+	}
+	return secp256k1.PrivKeyFromBytes(k.key).ToECDSA(), nil
+}
+
+// PublicKey returns the secp256k1 public key.
+func (k *ExtendedKey) PublicKey() (*ecdsa.PublicKey, error) {
+	pub, err := secp256k1.ParsePubKey(k.PublicKeyBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return pub.ToECDSA(), nil
+}
+
+// Neuter returns the public extended key of k.
+func (k *ExtendedKey) Neuter() (*ExtendedKey, error) {
+	if !k.isPrivate {
+		return k, nil
+	}
+	version, ok := publicVersions[k.version]
+	if !ok {
+		return nil, fmt.Errorf("no public version for %x", k.version)
+	}
+	return &ExtendedKey{
+		version:           version,
+		depth:             k.depth,
+		parentFingerprint: k.parentFingerprint,
+		childNumber:       k.childNumber,
+		chainCode:         k.chainCode,
+		key:               k.PublicKeyBytes(),
+	}, nil
+}
+
+// Child derives the child key at index, hardened for indexes from
+// HardenedKeyStart on. Public keys only derive normal children.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	hardened := index >= HardenedKeyStart
+	if hardened && !k.isPrivate {
+		return nil, ErrDeriveHardenedFromPublic
+	}
+
+	data := make([]byte, 0, compressedKeySize+4)
+	if hardened {
+		data = append(append(data, 0x00), k.key...)
+	} else {
+		data = append(data, k.PublicKeyBytes()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	var tweak secp256k1.ModNScalar
+	if tweak.SetByteSlice(sum[:32]) {
+		return nil, ErrInvalidChild
+	}
+
+	var childKey []byte
+	if k.isPrivate {
+		var parent secp256k1.ModNScalar
+		parent.SetByteSlice(k.key)
+		tweak.Add(&parent)
+		if tweak.IsZero() {
+			return nil, ErrInvalidChild
+		}
+		key := tweak.Bytes()
+		childKey = key[:]
+	} else {
+		parent, err := secp256k1.ParsePubKey(k.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		var parentPoint, tweakPoint, result secp256k1.JacobianPoint
+		parent.AsJacobian(&parentPoint)
+		secp256k1.ScalarBaseMultNonConst(&tweak, &tweakPoint)
+		secp256k1.AddNonConst(&tweakPoint, &parentPoint, &result)
+		if (result.X.IsZero() && result.Y.IsZero()) || result.Z.IsZero() {
+			return nil, ErrInvalidChild
+		}
+		result.ToAffine()
+		childKey = secp256k1.NewPublicKey(&result.X, &result.Y).SerializeCompressed()
+	}
+
+	return &ExtendedKey{
+		version:           k.version,
+		depth:             k.depth + 1,
+		parentFingerprint: k.Fingerprint(),
+		childNumber:       index,
+		chainCode:         sum[32:],
+		key:               childKey,
+		isPrivate:         k.isPrivate,
+	}, nil
+}
+
+// Derive derives the key at the given path of child indexes.
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// String returns the Base58Check serialization of the key, such as an
+// xprv or xpub string.
+func (k *ExtendedKey) String() string {
+	data := make([]byte, 0, serializedKeyLen)
+	data = append(data, k.version[:]...)
+	data = append(data, k.depth)
+	data = append(data, k.parentFingerprint[:]...)
+	data = binary.BigEndian.AppendUint32(data, k.childNumber)
+	data = append(data, k.chainCode...)
+	if k.isPrivate {
+		data = append(data, 0x00)
+	}
+	data = append(data, k.key...)
+	return Base58CheckEncode(data)
+}
+
+// ParseExtendedKey parses a Base58Check serialized extended key.
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	data, err := Base58CheckDecode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+	if len(data) != serializedKeyLen {
+		return nil, ErrInvalidExtendedKey
+	}
+
+	k := &ExtendedKey{
+		depth:       data[4],
+		childNumber: binary.BigEndian.Uint32(data[9:13]),
+		chainCode:   append([]byte{}, data[13:45]...),
+	}
+	copy(k.version[:], data[:4])
+	copy(k.parentFingerprint[:], data[5:9])
+	if k.depth == 0 && (k.parentFingerprint != [4]byte{} || k.childNumber != 0) {
+		return nil, ErrInvalidExtendedKey
+	}
+
+	keyData := data[45:]
+	_, private := publicVersions[k.version]
+	switch {
+	case private:
+		var scalar secp256k1.ModNScalar
+		if keyData[0] != 0x00 || scalar.SetByteSlice(keyData[1:]) || scalar.IsZero() {
+			return nil, ErrInvalidExtendedKey
+		}
+		k.key = append([]byte{}, keyData[1:]...)
+		k.isPrivate = true
+	case isPublicVersion(k.version):
+		if keyData[0] != 0x02 && keyData[0] != 0x03 {
+			return nil, ErrInvalidExtendedKey
+		}
+		if _, err := secp256k1.ParsePubKey(keyData); err != nil {
+			return nil, ErrInvalidExtendedKey
+		}
+		k.key = append([]byte{}, keyData...)
+	default:
+		return nil, fmt.Errorf("%w: unknown version %x", ErrInvalidExtendedKey, k.version)
+	}
+	return k, nil
+}
+
+// ParseDerivationPath parses a path such as "m/44'/1'/0'/0/5". Hardened
+// indexes are marked with ' or h.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q must start with m", ErrInvalidPath, path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyStart {
+			return nil, fmt.Errorf("%w: bad index %q in %q", ErrInvalidPath, part, path)
+		}
+		if hardened {
+			index += uint64(HardenedKeyStart)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// FormatDerivationPath formats child indexes as a path such as
+// "m/44'/1'/0'/0/5".
+func FormatDerivationPath(path []uint32) string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, index := range path {
+		if index >= HardenedKeyStart {
+			fmt.Fprintf(&b, "/%d'", index-HardenedKeyStart)
+		} else {
+			fmt.Fprintf(&b, "/%d", index)
+		}
+	}
+	return b.String()
+}
+
+// BIP44Path returns the path m/44'/coin'/account'/change/index of the chain
+// coin type.
+func BIP44Path(account, change, index uint32) []uint32 {
+	return []uint32{
+		HardenedKeyStart + BIP44Purpose,
+		HardenedKeyStart + CoinType,
+		HardenedKeyStart + account,
+		change,
+		index,
+	}
+}
+
+// isPublicVersion reports whether version is that of a public extended key.
+func isPublicVersion(version [4]byte) bool {
+	return version == XpubVersion || version == TpubVersion
+}
@@ -0,0 +1,214 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// BIP32 test vectors 1 to 3
+var bip32Vectors = []struct {
+	seed string
+	keys []struct{ path, xpub, xprv string }
+}{
+	{
+		seed: "000102030405060708090a0b0c0d0e0f",
+		keys: []struct{ path, xpub, xprv string }{
+			{"m", "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8", "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"},
+			{"m/0H", "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw", "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7"},
+			{"m/0H/1", "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ", "xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs"},
+			{"m/0H/1/2H", "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5", "xprv9z4pot5VBttmtdRTWfWQmoH1taj2axGVzFqSb8C9xaxKymcFzXBDptWmT7FwuEzG3ryjH4ktypQSAewRiNMjANTtpgP4mLTj34bhnZX7UiM"},
+			{"m/0H/1/2H/2", "xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV", "xprvA2JDeKCSNNZky6uBCviVfJSKyQ1mDYahRjijr5idH2WwLsEd4Hsb2Tyh8RfQMuPh7f7RtyzTtdrbdqqsunu5Mm3wDvUAKRHSC34sJ7in334"},
+			{"m/0H/1/2H/2/1000000000", "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy", "xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76"},
+		},
+	},
+	{
+		seed: "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		keys: []struct{ path, xpub, xprv string }{
+			{"m", "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB", "xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U"},
+			{"m/0", "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH", "xprv9vHkqa6EV4sPZHYqZznhT2NPtPCjKuDKGY38FBWLvgaDx45zo9WQRUT3dKYnjwih2yJD9mkrocEZXo1ex8G81dwSM1fwqWpWkeS3v86pgKt"},
+			{"m/0/2147483647H", "xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a", "xprv9wSp6B7kry3Vj9m1zSnLvN3xH8RdsPP1Mh7fAaR7aRLcQMKTR2vidYEeEg2mUCTAwCd6vnxVrcjfy2kRgVsFawNzmjuHc2YmYRmagcEPdU9"},
+			{"m/0/2147483647H/1", "xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon", "xprv9zFnWC6h2cLgpmSA46vutJzBcfJ8yaJGg8cX1e5StJh45BBciYTRXSd25UEPVuesF9yog62tGAQtHjXajPPdbRCHuWS6T8XA2ECKADdw4Ef"},
+			{"m/0/2147483647H/1/2147483646H", "xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL", "xprvA1RpRA33e1JQ7ifknakTFpgNXPmW2YvmhqLQYMmrj4xJXXWYpDPS3xz7iAxn8L39njGVyuoseXzU6rcxFLJ8HFsTjSyQbLYnMpCqE2VbFWc"},
+			{"m/0/2147483647H/1/2147483646H/2", "xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt", "xprvA2nrNbFZABcdryreWet9Ea4LvTJcGsqrMzxHx98MMrotbir7yrKCEXw7nadnHM8Dq38EGfSh6dqA9QWTyefMLEcBYJUuekgW4BYPJcr9E7j"},
+		},
+	},
+	{
+		// Retention of leading zeros
+		seed: "4b381541583be4423346c643850da4b320e46a87ae3d2a4e6da11eba819cd4acba45d239319ac14f863b8d5ab5a0d0c64d2e8a1e7d1457df2e5a3c51c73235be",
+		keys: []struct{ path, xpub, xprv string }{
+			{"m", "xpub661MyMwAqRbcEZVB4dScxMAdx6d4nFc9nvyvH3v4gJL378CSRZiYmhRoP7mBy6gSPSCYk6SzXPTf3ND1cZAceL7SfJ1Z3GC8vBgp2epUt13", "xprv9s21ZrQH143K25QhxbucbDDuQ4naNntJRi4KUfWT7xo4EKsHt2QJDu7KXp1A3u7Bi1j8ph3EGsZ9Xvz9dGuVrtHHs7pXeTzjuxBrCmmhgC6"},
+			{"m/0H", "xpub68NZiKmJWnxxS6aaHmn81bvJeTESw724CRDs6HbuccFQN9Ku14VQrADWgqbhhTHBaohPX4CjNLf9fq9MYo6oDaPPLPxSb7gwQN3ih19Zm4Y", "xprv9uPDJpEQgRQfDcW7BkF7eTya6RPxXeJCqCJGHuCJ4GiRVLzkTXBAJMu2qaMWPrS7AANYqdq6vcBcBUdJCVVFceUvJFjaPdGZ2y9WACViL4L"},
+		},
+	},
+}
+
+func TestBIP32Vectors(t *testing.T) {
+	for _, vector := range bip32Vectors {
+		seed, _ := hex.DecodeString(vector.seed)
+		master, err := NewMasterKey(seed, XprvVersion)
+		if err != nil {
+			t.Fatalf("NewMasterKey failed: %v", err)
+		}
+
+		for _, want := range vector.keys {
+			path, err := ParseDerivationPath(want.path)
+			if err != nil {
+				t.Fatalf("ParseDerivationPath(%q) failed: %v", want.path, err)
+			}
+			key, err := master.Derive(path)
+			if err != nil {
+				t.Fatalf("Derive(%s) failed: %v", want.path, err)
+			}
+			if got := key.String(); got != want.xprv {
+				t.Errorf("%s: expected xprv %s, got %s", want.path, want.xprv, got)
+			}
+			pub, err := key.Neuter()
+			if err != nil {
+				t.Fatalf("Neuter failed: %v", err)
+			}
+			if got := pub.String(); got != want.xpub {
+				t.Errorf("%s: expected xpub %s, got %s", want.path, want.xpub, got)
+			}
+
+			for _, s := range []string{want.xprv, want.xpub} {
+				parsed, err := ParseExtendedKey(s)
+				if err != nil {
+					t.Fatalf("ParseExtendedKey(%s) failed: %v", s, err)
+				}
+				if parsed.String() != s {
+					t.Errorf("Expected %s to round trip, got %s", s, parsed.String())
+				}
+			}
+		}
+	}
+}
+
+func TestPublicDerivation(t *testing.T) {
+	seed, _ := hex.DecodeString(bip32Vectors[0].seed)
+	master, _ := NewMasterKey(seed, XprvVersion)
+	account, err := master.Derive(BIP44Path(0, ExternalChain, 0)[:3])
+	if err != nil {
+		t.Fatalf("Derive failed: %v", err)
+	}
+	accountPub, _ := account.Neuter()
+
+	// Normal children of the public key match the public keys of the
+	// private children
+	for index := uint32(0); index < 5; index++ {
+		private, err := account.Derive([]uint32{ExternalChain, index})
+		if err != nil {
+			t.Fatalf("Derive failed: %v", err)
+		}
+		public, err := accountPub.Derive([]uint32{ExternalChain, index})
+		if err != nil {
+			t.Fatalf("Derive failed: %v", err)
+		}
+		neutered, _ := private.Neuter()
+		if neutered.String() != public.String() {
+			t.Errorf("Index %d: public derivation %s differs from %s", index, public, neutered)
+		}
+		if private.ParentFingerprint() != public.ParentFingerprint() || private.Depth() != 5 {
+			t.Errorf("Index %d: unexpected parent fingerprint or depth", index)
+		}
+	}
+
+	if _, err := accountPub.Child(HardenedKeyStart); !errors.Is(err, ErrDeriveHardenedFromPublic) {
+		t.Errorf("Expected hardened public derivation to fail, got %v", err)
+	}
+	if _, err := accountPub.PrivateKey(); !errors.Is(err, ErrNotPrivate) {
+		t.Errorf("Expected a public key to have no private key, got %v", err)
+	}
+}
+
+func TestMasterKeyFromMnemonic(t *testing.T) {
+	mnemonic, err := GenerateMnemonic(12)
+	if err != nil {
+		t.Fatalf("GenerateMnemonic failed: %v", err)
+	}
+	first, err := MasterKeyFromMnemonic(mnemonic, "", MainNet)
+	if err != nil {
+		t.Fatalf("MasterKeyFromMnemonic failed: %v", err)
+	}
+	second, _ := MasterKeyFromMnemonic(mnemonic, "", MainNet)
+	other, _ := MasterKeyFromMnemonic(mnemonic, "passphrase", MainNet)
+	if first.String() != second.String() || first.String() == other.String() {
+		t.Errorf("Expected the master key to depend only on the mnemonic and passphrase")
+	}
+
+	// Fresh addresses come from successive indexes
+	a, _ := first.Derive(BIP44Path(0, ExternalChain, 0))
+	b, _ := first.Derive(BIP44Path(0, ExternalChain, 1))
+	if a.String() == b.String() {
+		t.Errorf("Expected distinct keys for distinct indexes")
+	}
+
+	// Testnet and regtest keys serialize as tprv, their accounts as tpub
+	for _, net := range []*Network{TestNet, RegTest} {
+		master, _ := MasterKeyFromMnemonic(mnemonic, "", net)
+		account, err := AccountKeyFromMnemonic(mnemonic, &WalletConfig{}, net)
+		if err != nil {
+			t.Fatalf("AccountKeyFromMnemonic failed: %v", err)
+		}
+		if !strings.HasPrefix(master.String(), "tprv") || !strings.HasPrefix(account.String(), "tpub") {
+			t.Errorf("Expected %s keys to serialize as tprv and tpub, got %s and %s", net.Name, master.String()[:4], account.String()[:4])
+		}
+		if master.Fingerprint() != first.Fingerprint() {
+			t.Errorf("Expected the %s master key to have the mainnet fingerprint", net.Name)
+		}
+	}
+
+	if _, err := MasterKeyFromMnemonic("not a mnemonic", "", MainNet); err == nil {
+		t.Errorf("Expected an invalid mnemonic to fail")
+	}
+	if _, err := NewMasterKey(make([]byte, 8), XprvVersion); !errors.Is(err, ErrInvalidSeedLen) {
+		t.Errorf("Expected a short seed to fail, got %v", err)
+	}
+}
+
+func TestParseExtendedKeyInvalid(t *testing.T) {
+	valid := bip32Vectors[0].keys[1].xpub
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"bad checksum", valid[:len(valid)-1] + "9"},
+		{"not base58", "xpub0OIl"},
+		{"truncated", Base58CheckEncode([]byte{0x04, 0x88, 0xb2, 0x1e, 0x00})},
+	}
+
+	// A master key with a parent fingerprint
+	data, _ := Base58CheckDecode(bip32Vectors[0].keys[0].xpub)
+	data[5] = 1
+	tests = append(tests, struct{ name, key string }{"master with parent", Base58CheckEncode(data)})
+
+	// A public key that is not on the curve
+	data, _ = Base58CheckDecode(valid)
+	data[45] = 0x04
+	tests = append(tests, struct{ name, key string }{"bad public key prefix", Base58CheckEncode(data)})
+
+	for _, test := range tests {
+		if _, err := ParseExtendedKey(test.key); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestDerivationPath(t *testing.T) {
+	path, err := ParseDerivationPath("m/44'/1h/0H/0/5")
+	if err != nil {
+		t.Fatalf("ParseDerivationPath failed: %v", err)
+	}
+	if FormatDerivationPath(path) != "m/44'/1'/0'/0/5" {
+		t.Errorf("Unexpected path %s", FormatDerivationPath(path))
+	}
+	if FormatDerivationPath(BIP44Path(0, InternalChain, 3)) != "m/44'/1'/0'/1/3" {
+		t.Errorf("Unexpected BIP44 path %s", FormatDerivationPath(BIP44Path(0, InternalChain, 3)))
+	}
+	for _, bad := range []string{"", "44'/0'", "m/x", "m/2147483648", "m//1"} {
+		if _, err := ParseDerivationPath(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
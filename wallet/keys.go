@@ -2,14 +2,48 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-//	"crypto/elliptic"
-//	"crypto/rand"
+	"crypto/elliptic"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/big"
 
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 )
 
+var (
+	// ErrInvalidPrivateKey is returned for private keys outside 1 to n-1 of
+	// the secp256k1 group order n
+	ErrInvalidPrivateKey = errors.New("private key out of range")
+	// ErrInvalidPublicKey is returned for malformed public keys or points off
+	// the curve
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// S256 returns the secp256k1 curve all wallet keys are on.
+func S256() elliptic.Curve {
+	return secp256k1.S256()
+}
+
+// GenerateKey returns a new random secp256k1 private key.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key.ToECDSA(), nil
+}
+
+// NewPrivateKey returns the secp256k1 private key with the 32 byte big
+// endian scalar d, rejecting zero and values not below the group order.
+func NewPrivateKey(d []byte) (*ecdsa.PrivateKey, error) {
+	var scalar secp256k1.ModNScalar
+	if len(d) != 32 || scalar.SetByteSlice(d) || scalar.IsZero() {
+		return nil, ErrInvalidPrivateKey
+	}
+	return secp256k1.NewPrivateKey(&scalar).ToECDSA(), nil
+}
+
 func GenerateKeyPair(mnemonic string, config *WalletConfig) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
 	privateKey, err := PrivateKeyFromMnemonic(mnemonic, config)
 	if err != nil {
@@ -19,10 +53,57 @@ func GenerateKeyPair(mnemonic string, config *WalletConfig) (*ecdsa.PrivateKey,
 	return privateKey, &privateKey.PublicKey, nil
 }
 
+// SerializePublicKey returns the 33 byte compressed form of a secp256k1
+// public key.
+func SerializePublicKey(publicKey *ecdsa.PublicKey) []byte {
+	format := byte(0x02) | byte(publicKey.Y.Bit(0))
+	return append([]byte{format}, publicKey.X.FillBytes(make([]byte, 32))...)
+}
+
+// ParsePublicKey parses a compressed or uncompressed secp256k1 public key.
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	key, err := secp256k1.ParsePubKey(data)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return key.ToECDSA(), nil
+}
+
 func PrivateKeyToHex(privateKey *ecdsa.PrivateKey) string {
-	return hex.EncodeToString(crypto.FromECDSA(privateKey))
+	return hex.EncodeToString(privateKey.D.FillBytes(make([]byte, 32)))
+}
+
+// PrivateKeyFromHex parses a hex encoded secp256k1 private key.
+func PrivateKeyFromHex(s string) (*ecdsa.PrivateKey, error) {
+	d, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	return NewPrivateKey(d)
 }
 
 func PublicKeyToHex(publicKey *ecdsa.PublicKey) string {
-	return hex.EncodeToString(crypto.FromECDSAPub(publicKey))
+	return hex.EncodeToString(SerializePublicKey(publicKey))
+}
+
+// legacyPrivateKey returns the P-256 key wallets derived before the switch
+// to secp256k1: the first 32 bytes of the seed, reduced to the group order
+// so that it can sign.
+func legacyPrivateKey(seed []byte) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(seed[:32])
+	d.Mod(d, curve.Params().N)
+	if d.Sign() == 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	privateKey := &ecdsa.PrivateKey{D: d, PublicKey: ecdsa.PublicKey{Curve: curve}}
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return privateKey, nil
+}
+
+// legacyKeyAddress returns the address of a legacy P-256 public key, the hash
+// of its X and Y coordinates
+func legacyKeyAddress(publicKey *ecdsa.PublicKey) []byte {
+	return Hash160(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y)[1:])
 }
@@ -0,0 +1,132 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestNewPrivateKeyRange(t *testing.T) {
+	order := secp256k1.S256().Params().N
+	orderMinusOne := order.Bytes()
+	orderMinusOne[31]--
+
+	tests := []struct {
+		name  string
+		d     []byte
+		valid bool
+	}{
+		{"one", append(make([]byte, 31), 1), true},
+		{"order minus one", orderMinusOne, true},
+		{"zero", make([]byte, 32), false},
+		{"order", order.Bytes(), false},
+		{"above order", bytes.Repeat([]byte{0xff}, 32), false},
+		{"short", []byte{1}, false},
+	}
+	for _, test := range tests {
+		key, err := NewPrivateKey(test.d)
+		if test.valid && (err != nil || key.Curve != S256()) {
+			t.Errorf("%s: expected a secp256k1 key, got %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidPrivateKey) {
+			t.Errorf("%s: expected ErrInvalidPrivateKey, got %v", test.name, err)
+		}
+	}
+}
+
+func TestPublicKeyEncoding(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	compressed := SerializePublicKey(&key.PublicKey)
+	if len(compressed) != 33 || (compressed[0] != 0x02 && compressed[0] != 0x03) {
+		t.Fatalf("Expected a compressed key, got %x", compressed)
+	}
+	parsed, err := ParsePublicKey(compressed)
+	if err != nil || !publicKeysEqual(parsed, &key.PublicKey) {
+		t.Errorf("Expected the compressed key to round trip, got %v", err)
+	}
+
+	uncompressed := elliptic.Marshal(S256(), key.X, key.Y)
+	if parsed, err := ParsePublicKey(uncompressed); err != nil || !publicKeysEqual(parsed, &key.PublicKey) {
+		t.Errorf("Expected the uncompressed key to parse, got %v", err)
+	}
+
+	if _, err := ParsePublicKey(compressed[:20]); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("Expected a truncated key to be rejected, got %v", err)
+	}
+
+	hexKey := PrivateKeyToHex(key)
+	restored, err := PrivateKeyFromHex(hexKey)
+	if err != nil || restored.D.Cmp(key.D) != 0 {
+		t.Errorf("Expected the private key to round trip through hex, got %v", err)
+	}
+}
+
+func TestWalletKeysAreSecp256k1(t *testing.T) {
+	config := DefaultConfig()
+	w, err := NewWalletWithMnemonic(config)
+	if err != nil {
+		t.Fatalf("NewWalletWithMnemonic failed: %v", err)
+	}
+	if w.PrivateKey.Curve != S256() || w.KeyVersion != CurrentKeyVersion {
+		t.Errorf("Expected a current secp256k1 wallet")
+	}
+
+	master, _ := MasterKeyFromMnemonic(w.Mnemonic, config.Passphrase, MainNet)
+	first, _ := master.Derive(BIP44Path(0, ExternalChain, 0))
+	if !bytes.Equal(first.PublicKeyBytes(), SerializePublicKey(w.PublicKey)) {
+		t.Errorf("Expected the wallet key at m/44'/1'/0'/0/0")
+	}
+	if !bytes.Equal(w.Address, Hash160(first.PublicKeyBytes())) {
+		t.Errorf("Expected the address to hash the compressed public key")
+	}
+}
+
+func TestMigrateLegacyWallet(t *testing.T) {
+	config := DefaultConfig()
+	mnemonic, _ := GenerateMnemonic(12)
+	legacyKey, err := legacyPrivateKeyFromMnemonic(mnemonic, config)
+	if err != nil {
+		t.Fatalf("legacyPrivateKeyFromMnemonic failed: %v", err)
+	}
+	legacyAddress := legacyKeyAddress(&legacyKey.PublicKey)
+
+	// A wallet as saved before the switch to secp256k1
+	w := &Wallet{Mnemonic: mnemonic, Address: legacyAddress, Alias: "old"}
+	if !w.NeedsMigration() {
+		t.Fatalf("Expected a version 0 wallet to need migration")
+	}
+	if err := w.Migrate(config); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	recovered, _ := RecoverWalletFromMnemonic(mnemonic, config)
+	if !bytes.Equal(w.Address, recovered.Address) || !bytes.Equal(w.LegacyAddress, legacyAddress) {
+		t.Errorf("Expected the secp256k1 address with the legacy address kept")
+	}
+	if w.NeedsMigration() || w.Migrate(config) != nil || !bytes.Equal(w.LegacyAddress, legacyAddress) {
+		t.Errorf("Expected migration to be done once")
+	}
+
+	// Only the migration knows about P-256 keys
+	uncompressed := elliptic.Marshal(elliptic.P256(), legacyKey.X, legacyKey.Y)
+	if _, err := ParsePublicKey(uncompressed); err == nil {
+		t.Errorf("Expected a P-256 public key to be refused")
+	}
+	for _, address := range w.Addresses() {
+		if bytes.Equal(address, legacyAddress) {
+			t.Errorf("Expected the unspendable legacy address not to be watched")
+		}
+	}
+
+	mismatched := &Wallet{Mnemonic: mnemonic, Address: []byte("other")}
+	if err := mismatched.Migrate(config); err == nil {
+		t.Errorf("Expected an address not derived from the mnemonic to fail")
+	}
+}
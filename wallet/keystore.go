@@ -0,0 +1,261 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeystoreVersion is the version of the keystore file format
+const KeystoreVersion = 1
+
+// Default scrypt parameters, about 100ms of work
+const (
+	DefaultScryptN = 1 << 15
+	DefaultScryptR = 8
+	DefaultScryptP = 1
+
+	keyLen  = 32
+	saltLen = 16
+)
+
+// verifierPlaintext is encrypted under the keystore key so that a wrong
+// passphrase is caught before any secret is touched
+var verifierPlaintext = []byte("gochain keystore")
+
+var (
+	// ErrWrongPassphrase is returned when a passphrase does not decrypt the
+	// keystore
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrNotEncrypted is returned for passphrase operations on a plain
+	// keystore
+	ErrNotEncrypted = errors.New("keystore is not encrypted")
+	// ErrLocked is returned when a secret is needed from a locked wallet
+	ErrLocked = errors.New("wallet is locked")
+)
+
+// KDFParams are the scrypt parameters and salt deriving the keystore key
+// from a passphrase.
+type KDFParams struct {
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// NewKDFParams returns the default scrypt parameters with a fresh salt.
+func NewKDFParams() (*KDFParams, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return &KDFParams{Salt: salt, N: DefaultScryptN, R: DefaultScryptR, P: DefaultScryptP}, nil
+}
+
+// DeriveKey derives the 32 byte encryption key of a passphrase.
+func (p *KDFParams) DeriveKey(passphrase string) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), p.Salt, p.N, p.R, p.P, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
+
+// seal encrypts plaintext with AES-256-GCM, prefixing the random nonce.
+// additionalData is authenticated but not encrypted.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts data sealed by seal.
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsLocked reports whether the mnemonic of the wallet is only held
+// encrypted.
+func (w *Wallet) IsLocked() bool {
+	return w.Mnemonic == "" && len(w.EncryptedMnemonic) > 0
+}
+
+// Encrypt encrypts the mnemonic under key and clears it. The address is
+// authenticated with it so that mnemonics cannot be swapped between
+// wallets. Watch-only wallets have nothing to encrypt.
+func (w *Wallet) Encrypt(key []byte) error {
+	if w.IsLocked() || w.Mnemonic == "" {
+		return nil
+	}
+	sealed, err := seal(key, []byte(w.Mnemonic), w.Address)
+	if err != nil {
+		return err
+	}
+	w.EncryptedMnemonic = sealed
+	w.Mnemonic = ""
+	return nil
+}
+
+// Decrypt restores the mnemonic encrypted under key.
+func (w *Wallet) Decrypt(key []byte) error {
+	if !w.IsLocked() {
+		return nil
+	}
+	mnemonic, err := open(key, w.EncryptedMnemonic, w.Address)
+	if err != nil {
+		return err
+	}
+	w.Mnemonic = string(mnemonic)
+	return nil
+}
+
+// Keystore is the wallet file. Wallets are stored as given by the caller,
+// with their mnemonics encrypted once a KDF is set.
+type Keystore struct {
+	Version  int             `json:"version"`
+	KDF      *KDFParams      `json:"kdf,omitempty"`
+	Verifier []byte          `json:"verifier,omitempty"`
+	Wallets  json.RawMessage `json:"wallets"`
+}
+
+// Encrypted reports whether the keystore secrets are encrypted.
+func (ks *Keystore) Encrypted() bool {
+	return ks.KDF != nil
+}
+
+// SetKey makes key the keystore key, replacing the KDF parameters.
+func (ks *Keystore) SetKey(params *KDFParams, key []byte) error {
+	verifier, err := seal(key, verifierPlaintext, nil)
+	if err != nil {
+		return err
+	}
+	ks.KDF = params
+	ks.Verifier = verifier
+	return nil
+}
+
+// CheckKey returns ErrWrongPassphrase unless key is the keystore key.
+func (ks *Keystore) CheckKey(key []byte) error {
+	if !ks.Encrypted() {
+		return ErrNotEncrypted
+	}
+	plaintext, err := open(key, ks.Verifier, nil)
+	if err != nil || !bytes.Equal(plaintext, verifierPlaintext) {
+		return ErrWrongPassphrase
+	}
+	return nil
+}
+
+// Unlock derives the keystore key of passphrase and checks it.
+func (ks *Keystore) Unlock(passphrase string) ([]byte, error) {
+	if !ks.Encrypted() {
+		return nil, ErrNotEncrypted
+	}
+	key, err := ks.KDF.DeriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.CheckKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ReadKeystore reads a keystore file. A missing file gives an empty
+// keystore, and the plain JSON wallet list of earlier versions is read as
+// an unencrypted keystore.
+func ReadKeystore(path string) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Keystore{Version: KeystoreVersion, Wallets: json.RawMessage("[]")}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return &Keystore{Version: KeystoreVersion, Wallets: json.RawMessage(trimmed)}, nil
+	}
+	var ks Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore: %w", err)
+	}
+	if ks.Version > KeystoreVersion {
+		return nil, fmt.Errorf("keystore version %d is newer than supported version %d", ks.Version, KeystoreVersion)
+	}
+	return &ks, nil
+}
+
+// Write saves the keystore readable only by its owner, replacing the file
+// atomically.
+func (ks *Keystore) Write(path string) error {
+	ks.Version = KeystoreVersion
+	data, err := json.MarshalIndent(ks, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keystore: %w", err)
+	}
+	return WriteFileAtomic(path, data, 0600)
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames
+// it over path, so that readers see the old or the new file and never a
+// partial one.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
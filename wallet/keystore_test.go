@@ -0,0 +1,104 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKDFParams are cheap scrypt parameters for tests
+func testKDFParams(t *testing.T) *KDFParams {
+	params, err := NewKDFParams()
+	if err != nil {
+		t.Fatalf("NewKDFParams failed: %v", err)
+	}
+	params.N = 1 << 10
+	return params
+}
+
+func TestWalletEncryption(t *testing.T) {
+	w, err := NewWalletWithMnemonic(DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewWalletWithMnemonic failed: %v", err)
+	}
+	mnemonic := w.Mnemonic
+
+	params := testKDFParams(t)
+	key, _ := params.DeriveKey("correct horse")
+	if err := w.Encrypt(key); err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if !w.IsLocked() || w.Mnemonic != "" || strings.Contains(string(w.EncryptedMnemonic), mnemonic) {
+		t.Fatalf("Expected the mnemonic to be held encrypted only")
+	}
+
+	wrongKey, _ := params.DeriveKey("wrong")
+	if err := w.Decrypt(wrongKey); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a wrong key to fail, got %v", err)
+	}
+
+	// The mnemonic is bound to the address it was encrypted with
+	swapped := *w
+	swapped.Address = []byte("other")
+	if err := swapped.Decrypt(key); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a mnemonic moved to another wallet to fail, got %v", err)
+	}
+
+	if err := w.Decrypt(key); err != nil || w.Mnemonic != mnemonic {
+		t.Errorf("Expected the mnemonic back, got %v", err)
+	}
+}
+
+func TestKeystoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallets.dat")
+
+	ks, err := ReadKeystore(path)
+	if err != nil || ks.Encrypted() || string(ks.Wallets) != "[]" {
+		t.Fatalf("Expected a missing file to give an empty keystore, got %v", err)
+	}
+
+	params := testKDFParams(t)
+	key, _ := params.DeriveKey("passphrase")
+	if err := ks.SetKey(params, key); err != nil {
+		t.Fatalf("SetKey failed: %v", err)
+	}
+	ks.Wallets = json.RawMessage(`[{"Alias":"a"}]`)
+	if err := ks.Write(path); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the keystore to be written with mode 0600, got %v", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+
+	read, err := ReadKeystore(path)
+	if err != nil || !read.Encrypted() {
+		t.Fatalf("Expected an encrypted keystore, got %v", err)
+	}
+	if _, err := read.Unlock("passphrase"); err != nil {
+		t.Errorf("Unlock failed: %v", err)
+	}
+	if _, err := read.Unlock("wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a wrong passphrase to fail, got %v", err)
+	}
+
+	// Wallet lists written before keystores are read as plain keystores
+	if err := os.WriteFile(path, []byte(`[{"Alias":"old"}]`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	read, err = ReadKeystore(path)
+	if err != nil || read.Encrypted() || string(read.Wallets) != `[{"Alias":"old"}]` {
+		t.Errorf("Expected the plain wallet list to be read, got %v", err)
+	}
+	if _, err := read.Unlock("passphrase"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected unlocking a plain keystore to fail, got %v", err)
+	}
+}
@@ -2,16 +2,13 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
 //"	"crypto/rand"
-	"math/big"
 	"fmt"
 	"time"
 	"github.com/tyler-smith/go-bip39"
 )
 
 type WalletConfig struct {
-	Curve       elliptic.Curve
 	WordCount   int  // 12 or 24 words
 	UseChecksum bool // Add optional address checksum
 	Passphrase  string
@@ -24,7 +21,6 @@ func DefaultConfig() *WalletConfig {
 		alias += time.Now().Format("20060102150405")
 	}
 	return &WalletConfig{
-		Curve:       elliptic.P256(),
 		WordCount:   12,
 		UseChecksum: true,
 		Passphrase:  "",
@@ -56,25 +52,33 @@ func GenerateMnemonic(wordCount int) (string, error) {
 	return mnemonic, nil
 }
 
+// PrivateKeyFromMnemonic derives the secp256k1 key of the first receive
+// address of the wallet, at BIP44 path m/44'/1'/0'/0/0.
 func PrivateKeyFromMnemonic(mnemonic string, config *WalletConfig) (*ecdsa.PrivateKey, error) {
-	if !bip39.IsMnemonicValid(mnemonic) {
-		return nil, fmt.Errorf("invalid mnemonic")
-	}
-
-	seed := bip39.NewSeed(mnemonic, config.Passphrase)
+	return DeriveKeyFromMnemonic(mnemonic, config, ExternalChain, 0)
+}
 
-	// Derive private key using curve from config
-	d := new(big.Int).SetBytes(seed[:32])
-	privateKey := &ecdsa.PrivateKey{
-		D: d,
-		PublicKey: ecdsa.PublicKey{
-			Curve: config.Curve,
-			X:     nil,
-			Y:     nil,
-		},
+// DeriveKeyFromMnemonic derives the secp256k1 key at BIP44 path
+// m/44'/1'/0'/change/index of the first account.
+func DeriveKeyFromMnemonic(mnemonic string, config *WalletConfig, change, index uint32) (*ecdsa.PrivateKey, error) {
+	master, err := MasterKeyFromMnemonic(mnemonic, config.Passphrase, MainNet)
+	if err != nil {
+		return nil, err
 	}
 
-	privateKey.PublicKey.X, privateKey.PublicKey.Y = privateKey.PublicKey.Curve.ScalarBaseMult(privateKey.D.Bytes())
+	key, err := master.Derive(BIP44Path(0, change, index))
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key.PrivateKey()
+}
 
-	return privateKey, nil
+// legacyPrivateKeyFromMnemonic derives the P-256 key of wallets created
+// before keys moved to secp256k1. Migrate uses it to check that a wallet's
+// address comes from its mnemonic.
+func legacyPrivateKeyFromMnemonic(mnemonic string, config *WalletConfig) (*ecdsa.PrivateKey, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, fmt.Errorf("invalid mnemonic")
+	}
+	return legacyPrivateKey(bip39.NewSeed(mnemonic, config.Passphrase))
 }
@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MaxMultisigKeys is the largest number of keys of a multisig script, which
+// keeps the script of compressed keys within a single 520 byte push.
+const MaxMultisigKeys = 15
+
+// MultisigScript returns the redeem script OP_m <key>... OP_n
+// OP_CHECKMULTISIG spendable by any m of the n compressed public keys, in
+// the order given.
+func MultisigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	n := len(pubKeys)
+	if n < 1 || n > MaxMultisigKeys {
+		return nil, fmt.Errorf("multisig needs 1 to %d keys, got %d", MaxMultisigKeys, n)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("cannot require %d of %d signatures", m, n)
+	}
+
+	var script bytes.Buffer
+	script.WriteByte(opOne + byte(m) - 1)
+	for i, pubKey := range pubKeys {
+		if len(pubKey) != compressedKeySize {
+			return nil, fmt.Errorf("key %d is not a compressed public key", i)
+		}
+		if _, err := ParsePublicKey(pubKey); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		for _, other := range pubKeys[:i] {
+			if bytes.Equal(other, pubKey) {
+				return nil, fmt.Errorf("key %d is repeated", i)
+			}
+		}
+		script.WriteByte(compressedKeySize)
+		script.Write(pubKey)
+	}
+	script.WriteByte(opOne + byte(n) - 1)
+	script.WriteByte(opCheckMulti)
+	return script.Bytes(), nil
+}
+
+// ParseMultisigScript returns the number of signatures required by a
+// script made by MultisigScript and its public keys.
+func ParseMultisigScript(script []byte) (int, [][]byte, error) {
+	malformed := errors.New("not a multisig script")
+	if len(script) < 3 || script[len(script)-1] != opCheckMulti {
+		return 0, nil, malformed
+	}
+	m := int(script[0]) - opOne + 1
+	n := int(script[len(script)-2]) - opOne + 1
+	if n < 1 || n > MaxMultisigKeys || m < 1 || m > n || len(script) != 3+n*(1+compressedKeySize) {
+		return 0, nil, malformed
+	}
+
+	pubKeys := make([][]byte, n)
+	for i := range pubKeys {
+		offset := 1 + i*(1+compressedKeySize)
+		if script[offset] != compressedKeySize {
+			return 0, nil, malformed
+		}
+		pubKeys[i] = script[offset+1 : offset+1+compressedKeySize]
+	}
+	return m, pubKeys, nil
+}
+
+// NewMultisigWallet returns a wallet watching the P2SH address spendable by
+// m of the n public keys. The keys are sorted first, as in BIP 67, so that
+// every key holder creates the same address whatever order they list the
+// keys in.
+func NewMultisigWallet(m int, pubKeys [][]byte, alias string) (*Wallet, error) {
+	sorted := slices.Clone(pubKeys)
+	slices.SortFunc(sorted, bytes.Compare)
+	script, err := MultisigScript(m, sorted)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		WatchOnly:    true,
+		RedeemScript: script,
+		Address:      Hash160(script),
+		Alias:        alias,
+		KeyVersion:   CurrentKeyVersion,
+	}, nil
+}
+
+// IsMultisig reports whether the wallet watches a multisig address.
+func (w *Wallet) IsMultisig() bool {
+	return w.RedeemScript != nil
+}
@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testPublicKeys(t *testing.T, n int) [][]byte {
+	t.Helper()
+	var pubKeys [][]byte
+	for i := 0; i < n; i++ {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		pubKeys = append(pubKeys, SerializePublicKey(&key.PublicKey))
+	}
+	return pubKeys
+}
+
+func TestMultisigScript(t *testing.T) {
+	pubKeys := testPublicKeys(t, 3)
+	script, err := MultisigScript(2, pubKeys)
+	if err != nil {
+		t.Fatalf("MultisigScript failed: %v", err)
+	}
+	if script[0] != 0x52 || script[len(script)-2] != 0x53 || script[len(script)-1] != 0xae {
+		t.Errorf("Expected OP_2 ... OP_3 OP_CHECKMULTISIG, got %x", script)
+	}
+
+	m, parsed, err := ParseMultisigScript(script)
+	if err != nil {
+		t.Fatalf("ParseMultisigScript failed: %v", err)
+	}
+	if m != 2 || len(parsed) != 3 {
+		t.Fatalf("Expected 2 of 3 keys, got %d of %d", m, len(parsed))
+	}
+	for i := range pubKeys {
+		if !bytes.Equal(parsed[i], pubKeys[i]) {
+			t.Errorf("Key %d differs", i)
+		}
+	}
+
+	for _, bad := range []struct {
+		name    string
+		m       int
+		pubKeys [][]byte
+	}{
+		{"more signatures than keys", 4, pubKeys},
+		{"no signatures", 0, pubKeys},
+		{"repeated key", 1, [][]byte{pubKeys[0], pubKeys[0]}},
+		{"uncompressed key", 1, [][]byte{append([]byte{0x04}, make([]byte, 64)...)}},
+		{"too many keys", 1, testPublicKeys(t, MaxMultisigKeys+1)},
+	} {
+		if _, err := MultisigScript(bad.m, bad.pubKeys); err == nil {
+			t.Errorf("Expected %s to be refused", bad.name)
+		}
+	}
+	if _, _, err := ParseMultisigScript(script[:len(script)-1]); err == nil {
+		t.Errorf("Expected a truncated script to be refused")
+	}
+}
+
+func TestMultisigWalletIgnoresKeyOrder(t *testing.T) {
+	pubKeys := testPublicKeys(t, 3)
+	w, err := NewMultisigWallet(2, pubKeys, "vault")
+	if err != nil {
+		t.Fatalf("NewMultisigWallet failed: %v", err)
+	}
+	reversed, _ := NewMultisigWallet(2, [][]byte{pubKeys[2], pubKeys[1], pubKeys[0]}, "vault")
+	if !bytes.Equal(w.Address, reversed.Address) {
+		t.Errorf("Expected the same address whatever the key order")
+	}
+	if !w.IsMultisig() || !w.WatchOnly || !bytes.Equal(w.Address, Hash160(w.RedeemScript)) {
+		t.Errorf("Expected a watch-only wallet of the script hash")
+	}
+
+	address, err := NewScriptHashAddress(w.Address, RegTest)
+	if err != nil {
+		t.Fatalf("NewScriptHashAddress failed: %v", err)
+	}
+	if decoded, err := DecodeAddress(address.String(), RegTest); err != nil || decoded.ScriptType() != ScriptTypeP2SH {
+		t.Errorf("Expected a P2SH address, got %v (%v)", decoded, err)
+	}
+}
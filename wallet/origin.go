@@ -0,0 +1,119 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownOrigin is returned when a key origin does not lead to a key of
+// the wallet
+var ErrUnknownOrigin = errors.New("key origin does not belong to the wallet")
+
+// KeyOrigin records where the key behind an address comes from, so that an
+// offline signer holding the mnemonic can derive it: the fingerprint of the
+// extended key Path starts from and the path itself. Full wallets record the
+// master key and the whole BIP44 path, watch-only wallets their account key
+// and the change/index path below it.
+type KeyOrigin struct {
+	PubKey      []byte
+	Fingerprint [4]byte
+	Path        []uint32
+}
+
+// KeyOrigin returns the origin of the key behind address, which must be a
+// derived receive or change address of the wallet. Full wallets need their
+// mnemonic.
+func (w *Wallet) KeyOrigin(address []byte) (*KeyOrigin, error) {
+	change, index, ok := w.addressIndex(address)
+	if !ok {
+		return nil, fmt.Errorf("address %x has no derivation path in wallet %s", address, w.Alias)
+	}
+
+	if w.WatchOnly {
+		account, err := ParseExtendedKey(w.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := account.Derive([]uint32{change, index})
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return &KeyOrigin{key.PublicKeyBytes(), account.Fingerprint(), []uint32{change, index}}, nil
+	}
+
+	if w.IsLocked() {
+		return nil, ErrLocked
+	}
+	master, err := MasterKeyFromMnemonic(w.Mnemonic, DefaultConfig().Passphrase, MainNet)
+	if err != nil {
+		return nil, err
+	}
+	path := BIP44Path(0, change, index)
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return &KeyOrigin{key.PublicKeyBytes(), master.Fingerprint(), path}, nil
+}
+
+// KeyForOrigin derives the private key recorded by origin, starting from
+// the master or the account key of the wallet, whichever matches its
+// fingerprint.
+func (w *Wallet) KeyForOrigin(origin *KeyOrigin) (*ecdsa.PrivateKey, error) {
+	if w.WatchOnly {
+		return nil, ErrWatchOnly
+	}
+	if w.IsLocked() {
+		return nil, ErrLocked
+	}
+	master, err := MasterKeyFromMnemonic(w.Mnemonic, DefaultConfig().Passphrase, MainNet)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(BIP44Path(0, 0, 0)[:3])
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive account key: %w", err)
+	}
+
+	var parent *ExtendedKey
+	switch origin.Fingerprint {
+	case master.Fingerprint():
+		parent = master
+	case account.Fingerprint():
+		parent = account
+	default:
+		return nil, ErrUnknownOrigin
+	}
+	key, err := parent.Derive(origin.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	if !bytes.Equal(key.PublicKeyBytes(), origin.PubKey) {
+		return nil, ErrUnknownOrigin
+	}
+	return key.PrivateKey()
+}
+
+// addressIndex returns the chain and index address is derived at.
+func (w *Wallet) addressIndex(address []byte) (uint32, uint32, bool) {
+	if index, ok := w.ChangeIndex(address); ok {
+		return InternalChain, index, true
+	}
+	if w.WatchOnly {
+		if w.AccountKey == "" {
+			return 0, 0, false
+		}
+		for i, receive := range w.ReceiveAddresses {
+			if bytes.Equal(receive, address) {
+				return ExternalChain, uint32(i), true
+			}
+		}
+		return 0, 0, false
+	}
+	if bytes.Equal(w.Address, address) && !w.NeedsMigration() {
+		return ExternalChain, 0, true
+	}
+	return 0, 0, false
+}
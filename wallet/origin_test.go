@@ -0,0 +1,57 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestKeyOriginRoundTrip(t *testing.T) {
+	config := DefaultConfig()
+	w, err := NewWalletWithMnemonic(config)
+	if err != nil {
+		t.Fatalf("NewWalletWithMnemonic failed: %v", err)
+	}
+	change, err := w.NewChangeAddress(config)
+	if err != nil {
+		t.Fatalf("NewChangeAddress failed: %v", err)
+	}
+	account, _ := AccountKeyFromMnemonic(w.Mnemonic, config, MainNet)
+	watch, err := NewWatchOnlyWallet(account.String(), "watch", MainNet)
+	if err != nil {
+		t.Fatalf("NewWatchOnlyWallet failed: %v", err)
+	}
+
+	// Origins from the full wallet start at the master key, those from the
+	// watch-only wallet at the account key, and both lead to the same key
+	for _, owner := range []*Wallet{w, watch} {
+		for _, address := range [][]byte{w.Address, change} {
+			origin, err := owner.KeyOrigin(address)
+			if err != nil {
+				t.Fatalf("KeyOrigin failed: %v", err)
+			}
+			if !bytes.Equal(Hash160(origin.PubKey), address) {
+				t.Errorf("Origin public key does not hash to %x", address)
+			}
+			key, err := w.KeyForOrigin(origin)
+			if err != nil {
+				t.Fatalf("KeyForOrigin(%s) failed: %v", FormatDerivationPath(origin.Path), err)
+			}
+			if !bytes.Equal(AddressFromPublicKey(&key.PublicKey, true), address) {
+				t.Errorf("Derived key does not match %x", address)
+			}
+		}
+	}
+
+	other, _ := NewWalletWithMnemonic(config)
+	origin, _ := w.KeyOrigin(w.Address)
+	if _, err := other.KeyForOrigin(origin); !errors.Is(err, ErrUnknownOrigin) {
+		t.Errorf("Expected ErrUnknownOrigin from another wallet, got %v", err)
+	}
+	if _, err := watch.KeyForOrigin(origin); !errors.Is(err, ErrWatchOnly) {
+		t.Errorf("Expected ErrWatchOnly, got %v", err)
+	}
+	if _, err := w.KeyOrigin(otherAddress); err == nil {
+		t.Errorf("Expected an unknown address to have no origin")
+	}
+}
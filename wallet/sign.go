@@ -2,33 +2,194 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto/elliptic"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"math/big"
 
-//"	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 )
 
-// SignMessage signs a given message with the private key.
-func SignMessage(privateKey *ecdsa.PrivateKey, message string) ([]byte, []byte, error) {
-	hash := sha256.Sum256([]byte(message))
+var (
+	// ErrNonCanonicalSignature is returned for signatures that are not
+	// strict DER or whose S is above half the group order. Either would let
+	// anyone change a signature, and so a transaction ID, without the key.
+	ErrNonCanonicalSignature = errors.New("signature is not canonical")
+	// ErrInvalidSignature is returned for canonical signatures that do not
+	// verify.
+	ErrInvalidSignature = errors.New("signature does not verify")
+)
+
+// MaxSignatureSize is the largest canonical DER signature: a 33 byte R, a
+// low S of at most 32 bytes and six bytes of framing.
+const MaxSignatureSize = 71
+
+// CompactSignatureSize is the size of a recoverable compact signature: a
+// recovery byte, then R and S as 32 bytes each.
+const CompactSignatureSize = 65
+
+// Sign returns the strict DER signature of hash by the secp256k1 key. The
+// nonce is derived from the key and hash as in RFC 6979 and S is the lower
+// of its two values, so signing the same hash always gives the same
+// signature.
+func Sign(key *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	privKey, err := secp256k1Key(key)
+	if err != nil {
+		return nil, err
+	}
+	return secpecdsa.Sign(privKey, hash).Serialize(), nil
+}
+
+// SignCompact returns the 65 byte compact signature of hash by key, from
+// which RecoverCompact finds the public key. Only secp256k1 keys, which are
+// always serialized compressed, have a compact form.
+func SignCompact(key *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	privKey, err := secp256k1Key(key)
+	if err != nil {
+		return nil, err
+	}
+	return secpecdsa.SignCompact(privKey, hash, true), nil
+}
+
+// RecoverCompact returns the public key whose compact signature of hash is
+// sig.
+func RecoverCompact(sig, hash []byte) (*ecdsa.PublicKey, error) {
+	if len(sig) != CompactSignatureSize {
+		return nil, fmt.Errorf("%w: compact signatures are %d bytes", ErrNonCanonicalSignature, CompactSignatureSize)
+	}
+	if !isLowS(S256(), new(big.Int).SetBytes(sig[33:])) {
+		return nil, fmt.Errorf("%w: high S", ErrNonCanonicalSignature)
+	}
+	pubKey, compressed, err := secpecdsa.RecoverCompact(sig, hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !compressed {
+		return nil, fmt.Errorf("%w: uncompressed key flag", ErrNonCanonicalSignature)
+	}
+	return pubKey.ToECDSA(), nil
+}
+
+// CheckSignature checks that sig is a canonical DER signature of hash by
+// the secp256k1 publicKey, returning ErrNonCanonicalSignature or
+// ErrInvalidSignature if it is not.
+func CheckSignature(publicKey *ecdsa.PublicKey, hash, sig []byte) error {
+	if publicKey.Curve != S256() {
+		return ErrInvalidPublicKey
+	}
+	r, s, err := ParseSignature(publicKey.Curve, sig)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.Verify(publicKey, hash, r, s) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
 
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash[:])
+// ParseSignature returns R and S of a DER signature on curve, enforcing the
+// strict encoding of BIP 66 and a low S.
+func ParseSignature(curve elliptic.Curve, sig []byte) (*big.Int, *big.Int, error) {
+	// 0x30 <length> 0x02 <length of R> <R> 0x02 <length of S> <S>
+	if len(sig) < 8 || len(sig) > 72 || sig[0] != 0x30 || int(sig[1]) != len(sig)-2 {
+		return nil, nil, fmt.Errorf("%w: malformed DER sequence", ErrNonCanonicalSignature)
+	}
+	r, rest, err := parseDERInteger(sig[2:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: R %v", ErrNonCanonicalSignature, err)
+	}
+	s, rest, err := parseDERInteger(rest)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to sign message: %w", err)
+		return nil, nil, fmt.Errorf("%w: S %v", ErrNonCanonicalSignature, err)
 	}
+	if len(rest) != 0 {
+		return nil, nil, fmt.Errorf("%w: trailing bytes", ErrNonCanonicalSignature)
+	}
+
+	n := curve.Params().N
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 {
+		return nil, nil, fmt.Errorf("%w: R or S out of range", ErrNonCanonicalSignature)
+	}
+	if !isLowS(curve, s) {
+		return nil, nil, fmt.Errorf("%w: high S", ErrNonCanonicalSignature)
+	}
+	return r, s, nil
+}
+
+// parseDERInteger reads a positive minimally encoded DER integer from the
+// start of data, returning it and the bytes after it
+func parseDERInteger(data []byte) (*big.Int, []byte, error) {
+	if len(data) < 2 || data[0] != 0x02 {
+		return nil, nil, errors.New("is not an integer")
+	}
+	length := int(data[1])
+	if length == 0 || length > len(data)-2 {
+		return nil, nil, errors.New("has a bad length")
+	}
+	value := data[2 : 2+length]
+	if value[0]&0x80 != 0 {
+		return nil, nil, errors.New("is negative")
+	}
+	if length > 1 && value[0] == 0 && value[1]&0x80 == 0 {
+		return nil, nil, errors.New("has excess padding")
+	}
+	return new(big.Int).SetBytes(value), data[2+length:], nil
+}
+
+// isLowS reports whether s is at most half the group order of curve
+func isLowS(curve elliptic.Curve, s *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(halfOrder) <= 0
+}
+
+// secp256k1Key converts key for signing with the secp256k1 package
+func secp256k1Key(key *ecdsa.PrivateKey) (*secp256k1.PrivateKey, error) {
+	if key.Curve != S256() {
+		return nil, errors.New("key is not a secp256k1 key")
+	}
+	var scalar secp256k1.ModNScalar
+	if key.D.BitLen() > 256 || scalar.SetByteSlice(key.D.FillBytes(make([]byte, 32))) || scalar.IsZero() {
+		return nil, ErrInvalidPrivateKey
+	}
+	return secp256k1.NewPrivateKey(&scalar), nil
+}
 
-	return r.Bytes(), s.Bytes(), nil
+// SignMessage returns the canonical DER signature of the SHA-256 hash of
+// message by the private key.
+func SignMessage(privateKey *ecdsa.PrivateKey, message string) ([]byte, error) {
+	hash := sha256.Sum256([]byte(message))
+
+	sig, err := Sign(privateKey, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return sig, nil
 }
 
-// VerifySignature verifies a message signature using the public key.
-func VerifySignature(publicKey *ecdsa.PublicKey, message string, rBytes, sBytes []byte) bool {
+// SignMessageCompact returns the compact recoverable signature of the
+// SHA-256 hash of message by the private key.
+func SignMessageCompact(privateKey *ecdsa.PrivateKey, message string) ([]byte, error) {
 	hash := sha256.Sum256([]byte(message))
 
-	var r, s big.Int
-	r.SetBytes(rBytes)
-	s.SetBytes(sBytes)
+	sig, err := SignCompact(privateKey, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return sig, nil
+}
 
-	return ecdsa.Verify(publicKey, hash[:], &r, &s)
+// VerifySignature verifies a canonical DER message signature using the
+// public key.
+func VerifySignature(publicKey *ecdsa.PublicKey, message string, sig []byte) bool {
+	hash := sha256.Sum256([]byte(message))
+	return CheckSignature(publicKey, hash[:], sig) == nil
+}
+
+// RecoverMessageKey returns the public key that made a compact signature of
+// message.
+func RecoverMessageKey(message string, sig []byte) (*ecdsa.PublicKey, error) {
+	hash := sha256.Sum256([]byte(message))
+	return RecoverCompact(sig, hash[:])
 }
@@ -1,35 +1,43 @@
 package wallet
 
 import (
+    "bytes"
     "crypto/ecdsa"
     "crypto/elliptic"
     "crypto/rand"
+    "crypto/sha256"
     "encoding/hex"
+    "errors"
+    "math/big"
     "testing"
 )
 
 func TestSignMessage(t *testing.T) {
-    privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    privateKey, err := GenerateKey()
     if err != nil {
         t.Fatalf("Failed to generate private key: %v", err)
     }
 
     message := "Test message"
-    rBytes, sBytes, err := SignMessage(privateKey, message)
+    sig, err := SignMessage(privateKey, message)
     if err != nil {
         t.Fatalf("SignMessage returned an error: %v", err)
     }
 
-    if len(rBytes) == 0 || len(sBytes) == 0 {
-        t.Fatal("SignMessage returned empty signature components")
+    if len(sig) == 0 || len(sig) > MaxSignatureSize {
+        t.Fatalf("SignMessage returned a signature of %d bytes", len(sig))
     }
 
-    t.Logf("Signature generated successfully: r=%s, s=%s",
-        hex.EncodeToString(rBytes), hex.EncodeToString(sBytes))
+    again, err := SignMessage(privateKey, message)
+    if err != nil || !bytes.Equal(again, sig) {
+        t.Fatal("Signing the same message twice gave different signatures")
+    }
+
+    t.Logf("Signature generated successfully: %s", hex.EncodeToString(sig))
 }
 
 func TestVerifySignature(t *testing.T) {
-    privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    privateKey, err := GenerateKey()
     if err != nil {
         t.Fatalf("Failed to generate private key: %v", err)
     }
@@ -37,12 +45,12 @@ func TestVerifySignature(t *testing.T) {
     publicKey := &privateKey.PublicKey
     message := "Test message"
 
-    rBytes, sBytes, err := SignMessage(privateKey, message)
+    sig, err := SignMessage(privateKey, message)
     if err != nil {
         t.Fatalf("SignMessage returned an error: %v", err)
     }
 
-    isValid := VerifySignature(publicKey, message, rBytes, sBytes)
+    isValid := VerifySignature(publicKey, message, sig)
     if !isValid {
         t.Fatal("VerifySignature failed for a valid signature")
     }
@@ -51,7 +59,7 @@ func TestVerifySignature(t *testing.T) {
 }
 
 func TestVerifySignatureWithInvalidSignature(t *testing.T) {
-    privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    privateKey, err := GenerateKey()
     if err != nil {
         t.Fatalf("Failed to generate private key: %v", err)
     }
@@ -60,16 +68,15 @@ func TestVerifySignatureWithInvalidSignature(t *testing.T) {
     message := "Test message"
 
     // Sign the message
-    _, _, err = SignMessage(privateKey, message)
+    _, err = SignMessage(privateKey, message)
     if err != nil {
         t.Fatalf("SignMessage returned an error: %v", err)
     }
 
     // Provide invalid signature values
-    rBytes := []byte{0}
-    sBytes := []byte{0}
+    sig := []byte{0x30, 0x06, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00}
 
-    isValid := VerifySignature(publicKey, message, rBytes, sBytes)
+    isValid := VerifySignature(publicKey, message, sig)
     if isValid {
         t.Fatal("VerifySignature validated an invalid signature")
     }
@@ -78,7 +85,7 @@ func TestVerifySignatureWithInvalidSignature(t *testing.T) {
 }
 
 func TestVerifySignatureWithTamperedMessage(t *testing.T) {
-    privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    privateKey, err := GenerateKey()
     if err != nil {
         t.Fatalf("Failed to generate private key: %v", err)
     }
@@ -87,12 +94,12 @@ func TestVerifySignatureWithTamperedMessage(t *testing.T) {
     message := "Test message"
     tamperedMessage := "Tampered message"
 
-    rBytes, sBytes, err := SignMessage(privateKey, message)
+    sig, err := SignMessage(privateKey, message)
     if err != nil {
         t.Fatalf("SignMessage returned an error: %v", err)
     }
 
-    isValid := VerifySignature(publicKey, tamperedMessage, rBytes, sBytes)
+    isValid := VerifySignature(publicKey, tamperedMessage, sig)
     if isValid {
         t.Fatal("VerifySignature validated a signature for a tampered message")
     }
@@ -102,7 +109,7 @@ func TestVerifySignatureWithTamperedMessage(t *testing.T) {
 
 func TestSignAndVerifyMessage(t *testing.T) {
 	// Generate a private key for all test cases
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateKey, err := GenerateKey()
 	if err != nil {
 		t.Fatalf("Failed to generate private key: %v", err)
 	}
@@ -144,7 +151,7 @@ func TestSignAndVerifyMessage(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			// Sign the message
-			rBytes, sBytes, err := SignMessage(privateKey, tc.message)
+			sig, err := SignMessage(privateKey, tc.message)
 			if err != nil {
 				t.Fatalf("SignMessage failed: %v", err)
 			}
@@ -156,7 +163,7 @@ func TestSignAndVerifyMessage(t *testing.T) {
 			}
 
 			// Verify the signature
-			isValid := VerifySignature(publicKey, messageToVerify, rBytes, sBytes)
+			isValid := VerifySignature(publicKey, messageToVerify, sig)
 			if isValid != tc.expectValid {
 				t.Errorf("Expected validity: %v, got: %v", tc.expectValid, isValid)
 			}
@@ -165,7 +172,7 @@ func TestSignAndVerifyMessage(t *testing.T) {
 }
 
 func TestInvalidSignatures(t *testing.T) {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateKey, err := GenerateKey()
 	if err != nil {
 		t.Fatalf("Failed to generate private key: %v", err)
 	}
@@ -174,33 +181,29 @@ func TestInvalidSignatures(t *testing.T) {
 	// Test cases with invalid signatures
 	tests := []struct {
 		name    string
-		rBytes  []byte
-		sBytes  []byte
+		sig     []byte
 		message string
 	}{
 		{
-			name:    "Empty signature components",
-			rBytes:  []byte{},
-			sBytes:  []byte{},
+			name:    "Empty signature",
+			sig:     []byte{},
 			message: "Test message",
 		},
 		{
 			name:    "Incorrect signature length",
-			rBytes:  []byte{0x01, 0x02},
-			sBytes:  []byte{0x03},
+			sig:     []byte{0x30, 0x07, 0x02, 0x02, 0x01, 0x02, 0x02, 0x01, 0x03},
 			message: "Test message",
 		},
 		{
 			name:    "Random invalid signature",
-			rBytes:  []byte{0x01, 0x02, 0x03, 0x04},
-			sBytes:  []byte{0x05, 0x06, 0x07, 0x08},
+			sig:     []byte{0x30, 0x0c, 0x02, 0x04, 0x01, 0x02, 0x03, 0x04, 0x02, 0x04, 0x05, 0x06, 0x07, 0x08},
 			message: "Test message",
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			isValid := VerifySignature(publicKey, tc.message, tc.rBytes, tc.sBytes)
+			isValid := VerifySignature(publicKey, tc.message, tc.sig)
 			if isValid {
 				t.Error("VerifySignature should have returned false for invalid signature")
 			}
@@ -210,14 +213,14 @@ func TestInvalidSignatures(t *testing.T) {
 
 // Benchmark for SignMessage
 func BenchmarkSignMessage(b *testing.B) {
-    privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    privateKey, err := GenerateKey()
     if err != nil {
         b.Fatalf("Failed to generate private key: %v", err)
     }
 
     message := "Benchmark message"
     for i := 0; i < b.N; i++ {
-        _, _, err := SignMessage(privateKey, message)
+        _, err := SignMessage(privateKey, message)
         if err != nil {
             b.Fatalf("SignMessage returned an error: %v", err)
         }
@@ -226,7 +229,7 @@ func BenchmarkSignMessage(b *testing.B) {
 
 // Benchmark for VerifySignature
 func BenchmarkVerifySignature(b *testing.B) {
-    privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    privateKey, err := GenerateKey()
     if err != nil {
         b.Fatalf("Failed to generate private key: %v", err)
     }
@@ -234,16 +237,141 @@ func BenchmarkVerifySignature(b *testing.B) {
     publicKey := &privateKey.PublicKey
     message := "Benchmark message"
 
-    rBytes, sBytes, err := SignMessage(privateKey, message)
+    sig, err := SignMessage(privateKey, message)
     if err != nil {
         b.Fatalf("SignMessage returned an error: %v", err)
     }
 
 	b.ResetTimer()
     for i := 0; i < b.N; i++ {
-        isValid := VerifySignature(publicKey, message, rBytes, sBytes)
+        isValid := VerifySignature(publicKey, message, sig)
         if !isValid {
             b.Fatal("VerifySignature failed during benchmark")
         }
     }
 }
+
+func TestSignRFC6979Vectors(t *testing.T) {
+	mustHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// secp256k1 with the private key 1, as widely published for Bitcoin
+	key, err := NewPrivateKey(append(make([]byte, 31), 1))
+	if err != nil {
+		t.Fatalf("NewPrivateKey failed: %v", err)
+	}
+	sig, err := SignMessage(key, "Satoshi Nakamoto")
+	if err != nil {
+		t.Fatalf("SignMessage failed: %v", err)
+	}
+	want := mustHex("3045022100934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d802202442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5")
+	if !bytes.Equal(sig, want) {
+		t.Errorf("secp256k1 signature\n got %x\nwant %x", sig, want)
+	}
+
+	// Legacy P-256 keys neither sign nor verify
+	legacy := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(mustHex("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721"))}
+	legacy.Curve = elliptic.P256()
+	legacy.X, legacy.Y = legacy.Curve.ScalarBaseMult(legacy.D.Bytes())
+	if _, err := SignMessage(legacy, "sample"); err == nil {
+		t.Errorf("Expected a P-256 key not to sign")
+	}
+	if VerifySignature(&legacy.PublicKey, "Satoshi Nakamoto", sig) {
+		t.Errorf("Expected a P-256 key not to verify")
+	}
+}
+
+func TestNonCanonicalSignaturesRejected(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	hash := sha256.Sum256([]byte("malleable"))
+	sig, err := Sign(key, hash[:])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	r, s, err := ParseSignature(S256(), sig)
+	if err != nil {
+		t.Fatalf("ParseSignature failed: %v", err)
+	}
+
+	highS := encodeDER(r, new(big.Int).Sub(S256().Params().N, s))
+	// An extra zero byte before R is valid BER but not DER
+	padded := append([]byte{0x30, sig[1] + 1, 0x02, sig[3] + 1, 0x00}, sig[4:]...)
+
+	if !ecdsa.Verify(&key.PublicKey, hash[:], r, new(big.Int).Sub(S256().Params().N, s)) {
+		t.Fatalf("Expected the negated S to be mathematically valid")
+	}
+	for name, bad := range map[string][]byte{
+		"high S":         highS,
+		"trailing bytes": append(append([]byte{}, sig...), 0x01),
+		"wrong length":   append([]byte{0x30, sig[1] + 1}, sig[2:]...),
+		"BER padding":    padded,
+	} {
+		if err := CheckSignature(&key.PublicKey, hash[:], bad); !errors.Is(err, ErrNonCanonicalSignature) {
+			t.Errorf("%s: expected ErrNonCanonicalSignature, got %v", name, err)
+		}
+	}
+	if err := CheckSignature(&key.PublicKey, hash[:], sig); err != nil {
+		t.Errorf("Canonical signature refused: %v", err)
+	}
+	other := sha256.Sum256([]byte("other"))
+	if err := CheckSignature(&key.PublicKey, other[:], sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another hash, got %v", err)
+	}
+}
+
+func TestCompactSignatureRecovery(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	sig, err := SignMessageCompact(key, "recover me")
+	if err != nil {
+		t.Fatalf("SignMessageCompact failed: %v", err)
+	}
+	if len(sig) != CompactSignatureSize {
+		t.Fatalf("Expected %d bytes, got %d", CompactSignatureSize, len(sig))
+	}
+
+	pubKey, err := RecoverMessageKey("recover me", sig)
+	if err != nil {
+		t.Fatalf("RecoverMessageKey failed: %v", err)
+	}
+	if !bytes.Equal(SerializePublicKey(pubKey), SerializePublicKey(&key.PublicKey)) {
+		t.Errorf("Recovered a different key")
+	}
+	if pubKey, err := RecoverMessageKey("recovered", sig); err == nil && bytes.Equal(SerializePublicKey(pubKey), SerializePublicKey(&key.PublicKey)) {
+		t.Errorf("Expected another message not to recover the key")
+	}
+
+	highS := append([]byte{}, sig...)
+	new(big.Int).Sub(S256().Params().N, new(big.Int).SetBytes(sig[33:])).FillBytes(highS[33:])
+	if _, err := RecoverMessageKey("recover me", highS); !errors.Is(err, ErrNonCanonicalSignature) {
+		t.Errorf("Expected a high S to be refused, got %v", err)
+	}
+
+	legacy, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := SignMessageCompact(legacy, "recover me"); err == nil {
+		t.Errorf("Expected legacy keys to have no compact signatures")
+	}
+}
+
+// encodeDER returns the strict DER encoding of a signature
+func encodeDER(r, s *big.Int) []byte {
+	integer := func(v *big.Int) []byte {
+		b := v.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+	body := append(integer(r), integer(s)...)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
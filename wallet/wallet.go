@@ -1,16 +1,40 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"fmt"
 )
 
+// CurrentKeyVersion is the key scheme of new wallets: secp256k1 keys derived
+// along BIP44 paths. Wallets of version 0 hold a P-256 key taken directly
+// from the seed.
+const CurrentKeyVersion = 1
+
 type Wallet struct {
-	Mnemonic   string
-	PrivateKey *ecdsa.PrivateKey
-	PublicKey  *ecdsa.PublicKey
+	Mnemonic   string `json:",omitempty"`
+	// EncryptedMnemonic holds the mnemonic once the keystore is encrypted
+	EncryptedMnemonic []byte `json:",omitempty"`
+	PrivateKey *ecdsa.PrivateKey `json:"-"`
+	PublicKey  *ecdsa.PublicKey  `json:"-"`
 	Address    []byte
 	Alias	   string
+	KeyVersion int
+	// LegacyAddress is the P-256 address of a migrated wallet
+	LegacyAddress []byte `json:",omitempty"`
+	// ChangeAddresses are the addresses handed out for change, the one at
+	// index i derived at m/44'/1'/0'/1/i
+	ChangeAddresses [][]byte `json:",omitempty"`
+	// WatchOnly wallets hold no mnemonic. They watch the addresses derived
+	// from the account extended public key AccountKey, or a fixed list of
+	// imported addresses, in ReceiveAddresses.
+	WatchOnly        bool     `json:",omitempty"`
+	AccountKey       string   `json:",omitempty"`
+	ReceiveAddresses [][]byte `json:",omitempty"`
+	// RedeemScript is the M-of-N script of a multisig wallet, whose Address
+	// is its hash. Multisig wallets are watch-only, their coins are spent
+	// with signatures gathered from the wallets of the key holders.
+	RedeemScript []byte `json:",omitempty"`
 }
 
 func NewWalletWithMnemonic(config *WalletConfig) (*Wallet, error) {
@@ -32,6 +56,7 @@ func NewWalletWithMnemonic(config *WalletConfig) (*Wallet, error) {
 		PublicKey:  publicKey,
 		Address:    address,
 		Alias:      config.Alias,
+		KeyVersion: CurrentKeyVersion,
 	}, nil
 }
 
@@ -50,5 +75,84 @@ func RecoverWalletFromMnemonic(mnemonic string, config *WalletConfig) (*Wallet,
 		PublicKey:  publicKey,
 		Address:    address,
 		Alias: 	    config.Alias,
+		KeyVersion: CurrentKeyVersion,
 	}, nil
 }
+
+// NeedsMigration reports whether the wallet still uses a legacy P-256 key.
+func (w *Wallet) NeedsMigration() bool {
+	return w.KeyVersion < CurrentKeyVersion
+}
+
+// Migrate moves a legacy wallet to the secp256k1 key derived from its
+// mnemonic. The old address is kept in LegacyAddress as a record only:
+// P-256 signatures no longer verify, so coins paid to it cannot be spent.
+func (w *Wallet) Migrate(config *WalletConfig) error {
+	if !w.NeedsMigration() {
+		return nil
+	}
+
+	legacyKey, err := legacyPrivateKeyFromMnemonic(w.Mnemonic, config)
+	if err != nil {
+		return fmt.Errorf("failed to derive legacy key: %w", err)
+	}
+	legacyAddress := legacyKeyAddress(&legacyKey.PublicKey)
+	if len(w.Address) > 0 && !bytes.Equal(w.Address, legacyAddress) {
+		return fmt.Errorf("address %x does not match the mnemonic", w.Address)
+	}
+
+	privateKey, err := PrivateKeyFromMnemonic(w.Mnemonic, config)
+	if err != nil {
+		return fmt.Errorf("failed to derive private key: %w", err)
+	}
+
+	w.PrivateKey = privateKey
+	w.PublicKey = &privateKey.PublicKey
+	w.Address = AddressFromPublicKey(w.PublicKey, config.UseChecksum)
+	w.LegacyAddress = legacyAddress
+	w.KeyVersion = CurrentKeyVersion
+	return nil
+}
+
+// Addresses returns every address the wallet receives coins on: its
+// address or the receive addresses of a watch-only wallet and its change
+// addresses.
+func (w *Wallet) Addresses() [][]byte {
+	addresses := [][]byte{w.Address}
+	if len(w.ReceiveAddresses) > 0 {
+		addresses = append([][]byte(nil), w.ReceiveAddresses...)
+	}
+	return append(addresses, w.ChangeAddresses...)
+}
+
+// NewChangeAddress derives the next unused change address and records it.
+// The mnemonic must be available.
+func (w *Wallet) NewChangeAddress(config *WalletConfig) ([]byte, error) {
+	if w.WatchOnly {
+		return nil, ErrWatchOnly
+	}
+	if w.IsLocked() {
+		return nil, ErrLocked
+	}
+	if w.NeedsMigration() {
+		return nil, fmt.Errorf("wallet %s must be migrated before deriving change addresses", w.Alias)
+	}
+	key, err := DeriveKeyFromMnemonic(w.Mnemonic, config, InternalChain, uint32(len(w.ChangeAddresses)))
+	if err != nil {
+		return nil, err
+	}
+	address := AddressFromPublicKey(&key.PublicKey, config.UseChecksum)
+	w.ChangeAddresses = append(w.ChangeAddresses, address)
+	return address, nil
+}
+
+// ChangeIndex returns the derivation index of a change address of the
+// wallet.
+func (w *Wallet) ChangeIndex(address []byte) (uint32, bool) {
+	for i, change := range w.ChangeAddresses {
+		if bytes.Equal(change, address) {
+			return uint32(i), true
+		}
+	}
+	return 0, false
+}
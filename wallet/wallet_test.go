@@ -2,7 +2,6 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"bytes"
 	"testing"
 	"strings"
@@ -40,19 +39,16 @@ func TestNewWalletWithMnemonic_CustomConfig(t *testing.T) {
 	testCases := []struct {
 		name       string
 		wordCount  int
-		curve      elliptic.Curve
 		passphrase string
 	}{
 		{
-			name:       "12-word mnemonic with P256",
+			name:       "12-word mnemonic",
 			wordCount:  12,
-			curve:      elliptic.P256(),
 			passphrase: "",
 		},
 		{
-			name:       "24-word mnemonic with P256",
+			name:       "24-word mnemonic",
 			wordCount:  24,
-			curve:      elliptic.P256(),
 			passphrase: "test passphrase",
 		},
 	}
@@ -61,7 +57,6 @@ func TestNewWalletWithMnemonic_CustomConfig(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			config := &WalletConfig{
 				WordCount:   tc.wordCount,
-				Curve:       tc.curve,
 				Passphrase:  tc.passphrase,
 				UseChecksum: true,
 			}
@@ -114,11 +109,9 @@ func TestRecoverWalletFromMnemonic_DifferentConfigs(t *testing.T) {
 			expectDifferent: true,
 		},
 		{
-			name: "Different Curve",
-			modifyConfig: func(cfg *WalletConfig) {
-				cfg.Curve = elliptic.P384()
-			},
-			expectDifferent: true,
+			name: "Same Config",
+			modifyConfig: func(cfg *WalletConfig) {},
+			expectDifferent: false,
 		},
 	}
 
@@ -126,7 +119,6 @@ func TestRecoverWalletFromMnemonic_DifferentConfigs(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			config := &WalletConfig{
 				WordCount:   originalConfig.WordCount,
-				Curve:       originalConfig.Curve,
 				Passphrase:  originalConfig.Passphrase,
 				UseChecksum: originalConfig.UseChecksum,
 			}
@@ -141,6 +133,8 @@ func TestRecoverWalletFromMnemonic_DifferentConfigs(t *testing.T) {
 				if bytes.Equal(originalWallet.Address, recoveredWallet.Address) {
 					t.Errorf("Expected different wallet addresses")
 				}
+			} else {
+				compareWallets(t, originalWallet, recoveredWallet)
 			}
 		})
 	}
@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GapLimit is the number of consecutive unused addresses a watch-only
+// wallet keeps derived past the last used one of each chain.
+const GapLimit = 20
+
+// ErrWatchOnly is returned when a secret is needed from a watch-only wallet
+var ErrWatchOnly = errors.New("wallet is watch-only")
+
+// AccountKeyFromMnemonic derives the extended public key of net for the
+// first account of a mnemonic, at m/44'/1'/0'. Its children 0/i and 1/i
+// are the receive and change addresses of the wallet.
+func AccountKeyFromMnemonic(mnemonic string, config *WalletConfig, net *Network) (*ExtendedKey, error) {
+	master, err := MasterKeyFromMnemonic(mnemonic, config.Passphrase, net)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(BIP44Path(0, 0, 0)[:3])
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive account key: %w", err)
+	}
+	return account.Neuter()
+}
+
+// NewWatchOnlyWallet returns a wallet watching the addresses derived from
+// an account extended public key of net, with GapLimit addresses on each of
+// the receive and change chains. Extended private keys are refused, they
+// have no place on a watching machine.
+func NewWatchOnlyWallet(accountKey, alias string, net *Network) (*Wallet, error) {
+	key, err := ParseExtendedKey(accountKey)
+	if err != nil {
+		return nil, err
+	}
+	if key.IsPrivate() {
+		return nil, errors.New("watch-only wallets take an extended public key, not a private one")
+	}
+	if key.version != net.HDPublicKeyID {
+		return nil, fmt.Errorf("extended key is not a %s key", net.Name)
+	}
+
+	w := &Wallet{
+		WatchOnly:  true,
+		AccountKey: key.String(),
+		Alias:      alias,
+		KeyVersion: CurrentKeyVersion,
+	}
+	if _, err := w.ExtendAddresses(func([]byte) bool { return false }); err != nil {
+		return nil, err
+	}
+	w.Address = w.ReceiveAddresses[0]
+	return w, nil
+}
+
+// NewAddressWatchWallet returns a wallet watching a fixed list of
+// addresses.
+func NewAddressWatchWallet(addresses [][]byte, alias string) (*Wallet, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no addresses to watch")
+	}
+	return &Wallet{
+		WatchOnly:        true,
+		Address:          addresses[0],
+		ReceiveAddresses: addresses,
+		Alias:            alias,
+		KeyVersion:       CurrentKeyVersion,
+	}, nil
+}
+
+// DeriveAddress returns the address at change/index below the account key
+// of a watch-only wallet.
+func (w *Wallet) DeriveAddress(change, index uint32) ([]byte, error) {
+	if w.AccountKey == "" {
+		return nil, errors.New("wallet has no account key")
+	}
+	account, err := ParseExtendedKey(w.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := account.Derive([]uint32{change, index})
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive address: %w", err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return AddressFromPublicKey(publicKey, true), nil
+}
+
+// ExtendAddresses derives receive and change addresses of a watch-only
+// wallet until each chain ends with GapLimit addresses for which used
+// reports false. It returns the number of addresses added. Wallets
+// watching a fixed list of addresses are left unchanged.
+func (w *Wallet) ExtendAddresses(used func(address []byte) bool) (int, error) {
+	if w.AccountKey == "" {
+		return 0, nil
+	}
+
+	added := 0
+	for _, change := range []uint32{ExternalChain, InternalChain} {
+		addresses := &w.ReceiveAddresses
+		if change == InternalChain {
+			addresses = &w.ChangeAddresses
+		}
+		for {
+			unused := 0
+			for i := len(*addresses) - 1; i >= 0 && !used((*addresses)[i]); i-- {
+				unused++
+			}
+			if unused >= GapLimit {
+				break
+			}
+			for ; unused < GapLimit; unused++ {
+				address, err := w.DeriveAddress(change, uint32(len(*addresses)))
+				if err != nil {
+					return added, err
+				}
+				*addresses = append(*addresses, address)
+				added++
+			}
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,122 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWatchOnlyWalletMatchesMnemonic(t *testing.T) {
+	config := DefaultConfig()
+	w, err := NewWalletWithMnemonic(config)
+	if err != nil {
+		t.Fatalf("NewWalletWithMnemonic failed: %v", err)
+	}
+	account, err := AccountKeyFromMnemonic(w.Mnemonic, config, MainNet)
+	if err != nil {
+		t.Fatalf("AccountKeyFromMnemonic failed: %v", err)
+	}
+	if account.IsPrivate() || account.Depth() != 3 {
+		t.Fatalf("Expected a public key at depth 3, got private %v depth %d", account.IsPrivate(), account.Depth())
+	}
+
+	watch, err := NewWatchOnlyWallet(account.String(), "watch", MainNet)
+	if err != nil {
+		t.Fatalf("NewWatchOnlyWallet failed: %v", err)
+	}
+	if !bytes.Equal(watch.Address, w.Address) {
+		t.Errorf("Expected the first receive address %x, got %x", w.Address, watch.Address)
+	}
+	if len(watch.ReceiveAddresses) != GapLimit || len(watch.ChangeAddresses) != GapLimit {
+		t.Fatalf("Expected %d addresses on each chain, got %d and %d", GapLimit, len(watch.ReceiveAddresses), len(watch.ChangeAddresses))
+	}
+	for i := 0; i < 3; i++ {
+		change, err := w.NewChangeAddress(config)
+		if err != nil {
+			t.Fatalf("NewChangeAddress failed: %v", err)
+		}
+		if !bytes.Equal(change, watch.ChangeAddresses[i]) {
+			t.Errorf("Change address %d differs: %x and %x", i, change, watch.ChangeAddresses[i])
+		}
+	}
+
+	if _, err := watch.NewChangeAddress(config); !errors.Is(err, ErrWatchOnly) {
+		t.Errorf("Expected ErrWatchOnly, got %v", err)
+	}
+	if err := watch.Encrypt(make([]byte, 32)); err != nil || watch.IsLocked() {
+		t.Errorf("Expected encrypting a watch-only wallet to do nothing, got %v", err)
+	}
+}
+
+func TestWatchOnlyWalletRefusesPrivateKey(t *testing.T) {
+	master, err := NewMasterKey(bytes.Repeat([]byte{1}, 32), XprvVersion)
+	if err != nil {
+		t.Fatalf("NewMasterKey failed: %v", err)
+	}
+	if _, err := NewWatchOnlyWallet(master.String(), "watch", MainNet); err == nil {
+		t.Errorf("Expected an extended private key to be refused")
+	}
+	if _, err := NewWatchOnlyWallet("xpub-not-a-key", "watch", MainNet); err == nil {
+		t.Errorf("Expected a malformed key to be refused")
+	}
+}
+
+func TestWatchOnlyWalletRefusesOtherNetworks(t *testing.T) {
+	mnemonic, _ := GenerateMnemonic(12)
+	xpub, _ := AccountKeyFromMnemonic(mnemonic, &WalletConfig{}, MainNet)
+	tpub, _ := AccountKeyFromMnemonic(mnemonic, &WalletConfig{}, TestNet)
+
+	if _, err := NewWatchOnlyWallet(tpub.String(), "watch", MainNet); err == nil {
+		t.Errorf("Expected a tpub to be refused on mainnet")
+	}
+	if _, err := NewWatchOnlyWallet(xpub.String(), "watch", RegTest); err == nil {
+		t.Errorf("Expected an xpub to be refused on regtest")
+	}
+	for _, net := range []*Network{TestNet, RegTest} {
+		if _, err := NewWatchOnlyWallet(tpub.String(), "watch", net); err != nil {
+			t.Errorf("Expected a tpub to be accepted on %s, got %v", net.Name, err)
+		}
+	}
+}
+
+func TestExtendAddressesGapLimit(t *testing.T) {
+	master, _ := NewMasterKey(bytes.Repeat([]byte{2}, 32), XprvVersion)
+	account, _ := master.Derive(BIP44Path(0, 0, 0)[:3])
+	public, _ := account.Neuter()
+	watch, err := NewWatchOnlyWallet(public.String(), "watch", MainNet)
+	if err != nil {
+		t.Fatalf("NewWatchOnlyWallet failed: %v", err)
+	}
+
+	// Using receive address 5 and then 24, which is only derived once 5 is
+	// seen, pushes the gap past both
+	used := map[string]bool{}
+	used[string(watch.ReceiveAddresses[5])] = true
+	added, err := watch.ExtendAddresses(func(address []byte) bool {
+		if used[string(address)] {
+			return true
+		}
+		if len(watch.ReceiveAddresses) > 24 && bytes.Equal(address, watch.ReceiveAddresses[24]) {
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		t.Fatalf("ExtendAddresses failed: %v", err)
+	}
+	if len(watch.ReceiveAddresses) != 25+GapLimit || len(watch.ChangeAddresses) != GapLimit || added != 25 {
+		t.Fatalf("Expected %d receive and %d change addresses, got %d and %d (%d added)",
+			25+GapLimit, GapLimit, len(watch.ReceiveAddresses), len(watch.ChangeAddresses), added)
+	}
+	if address, _ := watch.DeriveAddress(ExternalChain, 30); !bytes.Equal(address, watch.ReceiveAddresses[30]) {
+		t.Errorf("Expected receive addresses in derivation order")
+	}
+
+	fixed, err := NewAddressWatchWallet([][]byte{trackedAddress, otherAddress}, "list")
+	if err != nil {
+		t.Fatalf("NewAddressWatchWallet failed: %v", err)
+	}
+	if added, _ := fixed.ExtendAddresses(func([]byte) bool { return true }); added != 0 || len(fixed.Addresses()) != 2 {
+		t.Errorf("Expected a fixed address list to stay as imported, got %d addresses", len(fixed.Addresses()))
+	}
+}